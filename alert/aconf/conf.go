@@ -2,6 +2,8 @@ package aconf
 
 import (
 	"path"
+
+	"github.com/ccfos/nightingale/v6/pushgw/pconf"
 )
 
 type Alert struct {
@@ -9,6 +11,7 @@ type Alert struct {
 	EngineDelay int64
 	Heartbeat   HeartbeatConfig
 	Alerting    Alerting
+	KafkaSink   KafkaSink
 }
 
 type SMTPConfig struct {
@@ -35,6 +38,20 @@ type Alerting struct {
 	WebhookBatchSend  bool
 }
 
+// KafkaSink publishes every fired and recovered event to kafka
+type KafkaSink struct {
+	Enable    bool
+	Typ       string // async sync
+	Brokers   []string
+	Topic     string
+	Version   string
+	Timeout   int64 // unit: second
+	SASL      *pconf.SASLConfig
+	Key       string // message key: rule_id hash busi_group
+	Encoding  string // json avro
+	QueueSize int    // events are dropped when the queue is full
+}
+
 type CallPlugin struct {
 	Enable     bool
 	PluginPath string
@@ -60,6 +77,26 @@ func (a *Alert) PreCheck(configDir string) {
 		a.Heartbeat.Interval = 1000
 	}
 
+	if a.KafkaSink.Typ == "" {
+		a.KafkaSink.Typ = "async"
+	}
+
+	if a.KafkaSink.Topic == "" {
+		a.KafkaSink.Topic = "n9e-alert-events"
+	}
+
+	if a.KafkaSink.Key == "" {
+		a.KafkaSink.Key = "hash"
+	}
+
+	if a.KafkaSink.Encoding == "" {
+		a.KafkaSink.Encoding = "json"
+	}
+
+	if a.KafkaSink.QueueSize == 0 {
+		a.KafkaSink.QueueSize = 10000
+	}
+
 	if a.EngineDelay == 0 {
 		a.EngineDelay = 30
 	}
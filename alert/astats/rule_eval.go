@@ -0,0 +1,46 @@
+package astats
+
+import (
+	"sync"
+)
+
+// RuleEvalState is the last evaluation of a rule on a datasource
+type RuleEvalState struct {
+	RuleId       int64
+	DatasourceId int64
+	LastEval     int64 // unix timestamp, unit: ms
+	Duration     int64 // unit: ms
+	SeriesCount  int   // series returned by the queries
+	SkippedBy    int64 // the firing parent rule the evaluation is skipped because of
+	Error        string
+}
+
+type RuleEvalStates struct {
+	sync.RWMutex
+	states map[string]RuleEvalState // key: rule key of the worker
+}
+
+func NewRuleEvalStates() *RuleEvalStates {
+	return &RuleEvalStates{
+		states: make(map[string]RuleEvalState),
+	}
+}
+
+func (r *RuleEvalStates) Set(key string, state RuleEvalState) {
+	r.Lock()
+	defer r.Unlock()
+	r.states[key] = state
+}
+
+func (r *RuleEvalStates) Get(key string) (RuleEvalState, bool) {
+	r.RLock()
+	defer r.RUnlock()
+	state, has := r.states[key]
+	return state, has
+}
+
+func (r *RuleEvalStates) Del(key string) {
+	r.Lock()
+	defer r.Unlock()
+	delete(r.states, key)
+}
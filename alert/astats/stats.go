@@ -21,12 +21,19 @@ type Stats struct {
 	CounterRecordEval           *prometheus.CounterVec
 	CounterRecordEvalErrorTotal *prometheus.CounterVec
 	CounterMuteTotal            *prometheus.CounterVec
+	CounterSuppressedTotal      *prometheus.CounterVec
 	CounterRuleEvalErrorTotal   *prometheus.CounterVec
 	CounterHeartbeatErrorTotal  *prometheus.CounterVec
 	CounterSubEventTotal        *prometheus.CounterVec
 	GaugeQuerySeriesCount       *prometheus.GaugeVec
 	GaugeRuleEvalDuration       *prometheus.GaugeVec
 	GaugeNotifyRecordQueueSize  prometheus.Gauge
+	GaugeEventSinkQueueSize     prometheus.Gauge
+	CounterEventSinkTotal       *prometheus.CounterVec
+	GaugeEventSinkDisconnected  prometheus.Gauge
+	QueryDuration               *prometheus.HistogramVec
+	QueryQueueDuration          *prometheus.HistogramVec
+	RuleEvals                   *RuleEvalStates
 }
 
 func NewSyncStats() *Stats {
@@ -109,6 +116,13 @@ func NewSyncStats() *Stats {
 		Help:      "Number of mute.",
 	}, []string{"group", "rule_id", "mute_rule_id", "datasource_id"})
 
+	CounterSuppressedTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "suppressed_total",
+		Help:      "Number of events suppressed by the parent rules.",
+	}, []string{"group", "rule_id", "parent_rule_id", "datasource_id"})
+
 	CounterSubEventTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
 		Namespace: namespace,
 		Subsystem: subsystem,
@@ -137,6 +151,29 @@ func NewSyncStats() *Stats {
 		Help:      "The size of notify record queue.",
 	})
 
+	// 发往 kafka 的告警事件队列的长度
+	GaugeEventSinkQueueSize := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "event_sink_queue_size",
+		Help:      "The size of the queue of events to publish to kafka.",
+	})
+
+	CounterEventSinkTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "event_sink_total",
+		Help:      "Number of events published to kafka.",
+	}, []string{"status"})
+
+	// 告警事件 kafka sink 是否未连上 kafka
+	GaugeEventSinkDisconnected := prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "event_sink_disconnected",
+		Help:      "Whether the kafka sink of the events is not connected to kafka yet.",
+	})
+
 	GaugeRuleEvalDuration := prometheus.NewGaugeVec(prometheus.GaugeOpts{
 		Namespace: namespace,
 		Subsystem: subsystem,
@@ -151,6 +188,22 @@ func NewSyncStats() *Stats {
 		Help:      "Number of var filling query.",
 	}, []string{"rule_id", "datasource_id", "ref", "typ"})
 
+	QueryDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "query_duration_seconds",
+		Help:      "Duration of rule eval queries in seconds.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+	}, []string{"datasource", "cate", "status"})
+
+	QueryQueueDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "query_queue_duration_seconds",
+		Help:      "Time rule eval queries wait for the concurrency limit of the datasource in seconds.",
+		Buckets:   []float64{.001, .01, .05, .1, .5, 1, 5, 10, 30},
+	}, []string{"datasource"})
+
 	prometheus.MustRegister(
 		CounterAlertsTotal,
 		GaugeAlertQueueSize,
@@ -162,13 +215,19 @@ func NewSyncStats() *Stats {
 		CounterRecordEval,
 		CounterRecordEvalErrorTotal,
 		CounterMuteTotal,
+		CounterSuppressedTotal,
 		CounterRuleEvalErrorTotal,
 		CounterHeartbeatErrorTotal,
 		CounterSubEventTotal,
 		GaugeQuerySeriesCount,
 		GaugeRuleEvalDuration,
 		GaugeNotifyRecordQueueSize,
+		GaugeEventSinkQueueSize,
+		CounterEventSinkTotal,
+		GaugeEventSinkDisconnected,
 		CounterVarFillingQuery,
+		QueryDuration,
+		QueryQueueDuration,
 	)
 
 	return &Stats{
@@ -182,12 +241,19 @@ func NewSyncStats() *Stats {
 		CounterRecordEval:           CounterRecordEval,
 		CounterRecordEvalErrorTotal: CounterRecordEvalErrorTotal,
 		CounterMuteTotal:            CounterMuteTotal,
+		CounterSuppressedTotal:      CounterSuppressedTotal,
 		CounterRuleEvalErrorTotal:   CounterRuleEvalErrorTotal,
 		CounterHeartbeatErrorTotal:  CounterHeartbeatErrorTotal,
 		CounterSubEventTotal:        CounterSubEventTotal,
 		GaugeQuerySeriesCount:       GaugeQuerySeriesCount,
 		GaugeRuleEvalDuration:       GaugeRuleEvalDuration,
 		GaugeNotifyRecordQueueSize:  GaugeNotifyRecordQueueSize,
+		GaugeEventSinkQueueSize:     GaugeEventSinkQueueSize,
+		CounterEventSinkTotal:       CounterEventSinkTotal,
+		GaugeEventSinkDisconnected:  GaugeEventSinkDisconnected,
 		CounterVarFillingQuery:      CounterVarFillingQuery,
+		QueryDuration:               QueryDuration,
+		QueryQueueDuration:          QueryQueueDuration,
+		RuleEvals:                   NewRuleEvalStates(),
 	}
 }
@@ -111,6 +111,8 @@ func (e *Consumer) consumeOne(event *models.AlertCurEvent) {
 	e.persist(event)
 
 	if event.IsRecovered && event.NotifyRecovered == 0 {
+		// published even if the recovery is not notified, no pipeline runs for it
+		e.dispatch.sink.Publish(event)
 		return
 	}
 
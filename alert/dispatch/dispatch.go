@@ -17,6 +17,7 @@ import (
 	"github.com/ccfos/nightingale/v6/alert/common"
 	"github.com/ccfos/nightingale/v6/alert/pipeline"
 	"github.com/ccfos/nightingale/v6/alert/sender"
+	"github.com/ccfos/nightingale/v6/alert/sink"
 	"github.com/ccfos/nightingale/v6/memsto"
 	"github.com/ccfos/nightingale/v6/models"
 	"github.com/ccfos/nightingale/v6/pkg/ctx"
@@ -37,8 +38,10 @@ type Dispatch struct {
 	notifyChannelCache   *memsto.NotifyChannelCacheType
 	messageTemplateCache *memsto.MessageTemplateCacheType
 	eventProcessorCache  *memsto.EventProcessorCacheType
+	calendarCache        *memsto.CalendarCacheType
 
 	alerting aconf.Alerting
+	sink     *sink.KafkaSink
 
 	Senders          map[string]sender.Sender
 	CallBacks        map[string]sender.CallBacker
@@ -56,7 +59,7 @@ type Dispatch struct {
 func NewDispatch(alertRuleCache *memsto.AlertRuleCacheType, userCache *memsto.UserCacheType, userGroupCache *memsto.UserGroupCacheType,
 	alertSubscribeCache *memsto.AlertSubscribeCacheType, targetCache *memsto.TargetCacheType, notifyConfigCache *memsto.NotifyConfigCacheType,
 	taskTplsCache *memsto.TaskTplCache, notifyRuleCache *memsto.NotifyRuleCacheType, notifyChannelCache *memsto.NotifyChannelCacheType,
-	messageTemplateCache *memsto.MessageTemplateCacheType, eventProcessorCache *memsto.EventProcessorCacheType, alerting aconf.Alerting, ctx *ctx.Context, astats *astats.Stats) *Dispatch {
+	messageTemplateCache *memsto.MessageTemplateCacheType, eventProcessorCache *memsto.EventProcessorCacheType, calendarCache *memsto.CalendarCacheType, alerting aconf.Alerting, sink *sink.KafkaSink, ctx *ctx.Context, astats *astats.Stats) *Dispatch {
 	notify := &Dispatch{
 		alertRuleCache:       alertRuleCache,
 		userCache:            userCache,
@@ -69,8 +72,10 @@ func NewDispatch(alertRuleCache *memsto.AlertRuleCacheType, userCache *memsto.Us
 		notifyChannelCache:   notifyChannelCache,
 		messageTemplateCache: messageTemplateCache,
 		eventProcessorCache:  eventProcessorCache,
+		calendarCache:        calendarCache,
 
 		alerting: alerting,
+		sink:     sink,
 
 		Senders:          make(map[string]sender.Sender),
 		tpls:             make(map[string]*template.Template),
@@ -84,7 +89,7 @@ func NewDispatch(alertRuleCache *memsto.AlertRuleCacheType, userCache *memsto.Us
 	pipeline.Init()
 
 	// 设置通知记录回调函数
-	notifyChannelCache.SetNotifyRecordFunc(sender.NotifyRecord)
+	notifyChannelCache.SetNotifyRecordFunc(sender.NotifyRecordWithOutbox)
 
 	return notify
 }
@@ -150,7 +155,12 @@ func (e *Dispatch) reloadTpls() error {
 	return nil
 }
 
+// HandleEventWithNotifyRule runs the pipelines of the notify rules of the event and notifies the processed events.
+// The event is published to the sink once, as processed by the pipelines of its first notify rule keeping it, or
+// as it is if no notify rule processes it. The subscribed copies are not published.
 func (e *Dispatch) HandleEventWithNotifyRule(eventOrigin *models.AlertCurEvent) {
+	processed := false
+	published := eventOrigin.SubRuleId != 0
 
 	if len(eventOrigin.NotifyRuleIds) > 0 {
 		for _, notifyRuleId := range eventOrigin.NotifyRuleIds {
@@ -166,6 +176,7 @@ func (e *Dispatch) HandleEventWithNotifyRule(eventOrigin *models.AlertCurEvent)
 			if !notifyRule.Enable {
 				continue
 			}
+			processed = true
 
 			var processors []models.Processor
 			for _, pipelineConfig := range notifyRule.PipelineConfigs {
@@ -204,9 +215,14 @@ func (e *Dispatch) HandleEventWithNotifyRule(eventOrigin *models.AlertCurEvent)
 				continue
 			}
 
+			if !published {
+				e.sink.Publish(eventCopy)
+				published = true
+			}
+
 			// notify
 			for i := range notifyRule.NotifyConfigs {
-				err := NotifyRuleMatchCheck(&notifyRule.NotifyConfigs[i], eventCopy)
+				err := NotifyRuleMatchCheck(&notifyRule.NotifyConfigs[i], eventCopy, e.calendarCache.Get)
 				if err != nil {
 					logger.Errorf("notify_id: %d, event:%+v, channel_id:%d, template_id: %d, notify_config:%+v, err:%v", notifyRuleId, eventCopy, notifyRule.NotifyConfigs[i].ChannelID, notifyRule.NotifyConfigs[i].TemplateID, notifyRule.NotifyConfigs[i], err)
 					continue
@@ -233,6 +249,10 @@ func (e *Dispatch) HandleEventWithNotifyRule(eventOrigin *models.AlertCurEvent)
 			}
 		}
 	}
+
+	if !processed && !published {
+		e.sink.Publish(eventOrigin)
+	}
 }
 
 func pipelineApplicable(pipeline *models.EventPipeline, event *models.AlertCurEvent) bool {
@@ -274,8 +294,8 @@ func pipelineApplicable(pipeline *models.EventPipeline, event *models.AlertCurEv
 	return tagMatch && attributesMatch
 }
 
-func NotifyRuleMatchCheck(notifyConfig *models.NotifyConfig, event *models.AlertCurEvent) error {
-	tm := time.Unix(event.TriggerTime, 0)
+func NotifyRuleMatchCheck(notifyConfig *models.NotifyConfig, event *models.AlertCurEvent, calendars models.CalendarGetter) error {
+	tm := models.TimeIn(event.TriggerTime, notifyConfig.Timezone, event.Timezone)
 	triggerTime := tm.Format("15:04")
 	triggerWeek := int(tm.Weekday())
 
@@ -288,6 +308,10 @@ func NotifyRuleMatchCheck(notifyConfig *models.NotifyConfig, event *models.Alert
 		if timeMatch {
 			break
 		}
+		if !notifyConfig.TimeRanges[j].Calendar.Match(calendars, tm) {
+			continue
+		}
+
 		enableStime := notifyConfig.TimeRanges[j].Start
 		enableEtime := notifyConfig.TimeRanges[j].End
 		enableDaysOfWeek := notifyConfig.TimeRanges[j].Week
@@ -473,42 +497,56 @@ func (e *Dispatch) sendV2(events []*models.AlertCurEvent, notifyRuleId int64, no
 		}
 
 		for i := range flashDutyChannelIDs {
+			outboxId := e.addOutbox(channelOutbox(events, notifyRuleId, notifyChannel, nil, nil, nil, flashDutyChannelIDs[i]))
 			start := time.Now()
 			respBody, err := notifyChannel.SendFlashDuty(events, flashDutyChannelIDs[i], e.notifyChannelCache.GetHttpClient(notifyChannel.ID))
 			respBody = fmt.Sprintf("duration: %d ms %s", time.Since(start).Milliseconds(), respBody)
 			logger.Infof("notify_id: %d, channel_name: %v, event:%+v, IntegrationUrl: %v dutychannel_id: %v, respBody: %v, err: %v", notifyRuleId, notifyChannel.Name, events[0], notifyChannel.RequestConfig.FlashDutyRequestConfig.IntegrationUrl, flashDutyChannelIDs[i], respBody, err)
-			sender.NotifyRecord(e.ctx, events, notifyRuleId, notifyChannel.Name, strconv.FormatInt(flashDutyChannelIDs[i], 10), respBody, err)
+			sender.NotifyRecordWithOutbox(e.ctx, events, notifyRuleId, outboxId, notifyChannel.Name, strconv.FormatInt(flashDutyChannelIDs[i], 10), respBody, err)
 		}
 
 	case "http":
-		// 使用队列模式处理 http 通知
-		// 创建通知任务
-		task := &memsto.NotifyTask{
-			Events:        events,
-			NotifyRuleId:  notifyRuleId,
-			NotifyChannel: notifyChannel,
-			TplContent:    tplContent,
-			CustomParams:  customParams,
-			Sendtos:       sendtos,
+		// 使用队列模式处理 http 通知, 每个接收人单独持久化, 失败时只重试失败的接收人
+		batches := [][]string{sendtos}
+		if len(sendtos) > 0 && !NeedBatchContacts(notifyChannel.RequestConfig.HTTPRequestConfig) {
+			batches = make([][]string, 0, len(sendtos))
+			for i := range sendtos {
+				batches = append(batches, []string{sendtos[i]})
+			}
 		}
 
-		// 将任务加入队列
-		success := e.notifyChannelCache.EnqueueNotifyTask(task)
-		if !success {
-			logger.Errorf("failed to enqueue notify task for channel %d, notify_id: %d", notifyChannel.ID, notifyRuleId)
-			// 如果入队失败，记录错误通知
-			sender.NotifyRecord(e.ctx, events, notifyRuleId, notifyChannel.Name, getSendTarget(customParams, sendtos), "", errors.New("failed to enqueue notify task, queue is full"))
+		for _, batch := range batches {
+			// 创建通知任务
+			task := &memsto.NotifyTask{
+				Events:        events,
+				NotifyRuleId:  notifyRuleId,
+				OutboxId:      e.addOutbox(channelOutbox(events, notifyRuleId, notifyChannel, tplContent, customParams, batch, 0)),
+				NotifyChannel: notifyChannel,
+				TplContent:    tplContent,
+				CustomParams:  customParams,
+				Sendtos:       batch,
+			}
+
+			// 将任务加入队列
+			success := e.notifyChannelCache.EnqueueNotifyTask(task)
+			if !success {
+				logger.Errorf("failed to enqueue notify task for channel %d, notify_id: %d", notifyChannel.ID, notifyRuleId)
+				// 如果入队失败，记录错误通知
+				sender.NotifyRecordWithOutbox(e.ctx, events, notifyRuleId, task.OutboxId, notifyChannel.Name, getSendTarget(customParams, batch), "", errors.New("failed to enqueue notify task, queue is full"))
+			}
 		}
 
 	case "smtp":
-		notifyChannel.SendEmail(notifyRuleId, events, tplContent, sendtos, e.notifyChannelCache.GetSmtpClient(notifyChannel.ID))
+		outboxId := e.addOutbox(channelOutbox(events, notifyRuleId, notifyChannel, tplContent, nil, sendtos, 0))
+		notifyChannel.SendEmail(notifyRuleId, outboxId, events, tplContent, sendtos, e.notifyChannelCache.GetSmtpClient(notifyChannel.ID))
 
 	case "script":
+		outboxId := e.addOutbox(channelOutbox(events, notifyRuleId, notifyChannel, tplContent, customParams, sendtos, 0))
 		start := time.Now()
 		target, res, err := notifyChannel.SendScript(events, tplContent, customParams, sendtos)
 		res = fmt.Sprintf("duration: %d ms %s", time.Since(start).Milliseconds(), res)
 		logger.Infof("notify_id: %d, channel_name: %v, event:%+v, tplContent:%s, customParams:%v, target:%s, res:%s, err:%v", notifyRuleId, notifyChannel.Name, events[0], tplContent, customParams, target, res, err)
-		sender.NotifyRecord(e.ctx, events, notifyRuleId, notifyChannel.Name, target, res, err)
+		sender.NotifyRecordWithOutbox(e.ctx, events, notifyRuleId, outboxId, notifyChannel.Name, target, res, err)
 	default:
 		logger.Warningf("notify_id: %d, channel_name: %v, event:%+v send type not found", notifyRuleId, notifyChannel.Name, events[0])
 	}
@@ -528,6 +566,10 @@ func (e *Dispatch) HandleEventNotify(event *models.AlertCurEvent, isSubscribe bo
 		return
 	}
 
+	if event.Timezone == "" {
+		event.Timezone = rule.Timezone
+	}
+
 	fillUsers(event, e.userCache, e.userGroupCache)
 
 	var (
@@ -555,6 +597,11 @@ func (e *Dispatch) HandleEventNotify(event *models.AlertCurEvent, isSubscribe bo
 		notifyTarget.AndMerge(handler(rule, event, notifyTarget, e))
 	}
 
+	if !isSubscribe {
+		// handle ibex callbacks, before the notifications which carry the approval links of the tasks
+		e.HandleIbex(rule, event)
+	}
+
 	go e.HandleEventWithNotifyRule(event)
 	go e.Send(rule, event, notifyTarget, isSubscribe)
 
@@ -637,6 +684,7 @@ func (e *Dispatch) Send(rule *models.AlertRule, event *models.AlertCurEvent, not
 		for channel, uids := range notifyTarget.ToChannelUserMap() {
 			msgCtx := sender.BuildMessageContext(e.ctx, rule, []*models.AlertCurEvent{event},
 				uids, e.userCache, e.Astats)
+			msgCtx.Outbox = e.addOutbox
 			e.RwLock.RLock()
 			s := e.Senders[channel]
 			e.RwLock.RUnlock()
@@ -661,20 +709,15 @@ func (e *Dispatch) Send(rule *models.AlertRule, event *models.AlertCurEvent, not
 	// handle global webhooks
 	if !event.OverrideGlobalWebhook() {
 		if e.alerting.WebhookBatchSend {
-			sender.BatchSendWebhooks(e.ctx, notifyTarget.ToWebhookMap(), event, e.Astats)
+			sender.BatchSendWebhooks(e.ctx, notifyTarget.ToWebhookMap(), event, e.Astats, e.addOutbox)
 		} else {
-			sender.SingleSendWebhooks(e.ctx, notifyTarget.ToWebhookMap(), event, e.Astats)
+			sender.SingleSendWebhooks(e.ctx, notifyTarget.ToWebhookMap(), event, e.Astats, e.addOutbox)
 		}
 	}
 
 	// handle plugin call
 	go sender.MayPluginNotify(e.ctx, e.genNoticeBytes(event), e.notifyConfigCache.
 		GetNotifyScript(), e.Astats, event)
-
-	if !isSubscribe {
-		// handle ibex callbacks
-		e.HandleIbex(rule, event)
-	}
 }
 
 func (e *Dispatch) SendCallbacks(rule *models.AlertRule, notifyTarget *NotifyTarget, event *models.AlertCurEvent) {
@@ -738,25 +781,44 @@ func (e *Dispatch) HandleIbex(rule *models.AlertRule, event *models.AlertCurEven
 	json.Unmarshal([]byte(rule.RuleConfig), &ruleConfig)
 
 	if event.IsRecovered {
-		// 恢复事件不需要走故障自愈的逻辑
+		// 恢复事件不需要走故障自愈的逻辑，还在等待审批的任务也不再执行
+		sender.Healer.Cancel(event.Hash)
 		return
 	}
 
+	var links []string
 	for _, t := range ruleConfig.TaskTpls {
 		if t.TplId == 0 {
 			continue
 		}
 
-		if len(t.Host) == 0 {
-			sender.CallIbex(e.ctx, t.TplId, event.TargetIdent,
-				e.taskTplsCache, e.targetCache, e.userCache, event)
-			continue
+		hosts := t.Host
+		if len(hosts) == 0 {
+			hosts = []string{event.TargetIdent}
 		}
-		for _, host := range t.Host {
-			sender.CallIbex(e.ctx, t.TplId, host,
-				e.taskTplsCache, e.targetCache, e.userCache, event)
+
+		for _, host := range hosts {
+			link := sender.Healer.Heal(e.ctx, *t, host, event, e.taskTplsCache, e.targetCache, e.userCache)
+			if link != "" {
+				links = append(links, link)
+			}
 		}
 	}
+
+	if len(links) == 0 {
+		return
+	}
+
+	// the approval links go with the notifications of the event
+	if event.AnnotationsJSON == nil {
+		event.AnnotationsJSON = make(map[string]string)
+	}
+	event.AnnotationsJSON[sender.IbexApprovalAnnotation] = strings.Join(links, " ")
+
+	annotations := map[string]string{sender.IbexApprovalAnnotation: event.AnnotationsJSON[sender.IbexApprovalAnnotation]}
+	if err := models.EventAnnotationsMerge(e.ctx, event.Id, annotations); err != nil {
+		logger.Warningf("event_callback_ibex: failed to update annotations of event(%d): %v", event.Id, err)
+	}
 }
 
 type Notice struct {
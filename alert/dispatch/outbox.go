@@ -0,0 +1,158 @@
+package dispatch
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/alert/sender"
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// addOutbox persists a send before it is tried, the returned id is carried to the notify record. The sends of
+// the notify rules and of the legacy notify configs both go through it. Only the center owns the database, sends
+// of edge alert engines are not persisted.
+func (e *Dispatch) addOutbox(o *models.NotifyOutbox) int64 {
+	if !e.ctx.IsCenter {
+		return 0
+	}
+
+	if err := o.Add(e.ctx); err != nil {
+		logger.Errorf("notify_id: %d, channel_name: %v, failed to add notify outbox: %v", o.NotifyRuleId, o.ChannelName, err)
+		return 0
+	}
+	return o.Id
+}
+
+// channelOutbox is the send of a notify rule on the channel
+func channelOutbox(events []*models.AlertCurEvent, notifyRuleId int64, notifyChannel *models.NotifyChannelConfig,
+	tplContent map[string]interface{}, customParams map[string]string, sendtos []string, flashDutyChannelId int64) *models.NotifyOutbox {
+	o := models.NewNotifyOutbox(events, notifyRuleId, notifyChannel)
+	o.TplContent = tplContent
+	o.CustomParams = customParams
+	o.Sendtos = sendtos
+	o.FlashDutyChannelId = flashDutyChannelId
+	return o
+}
+
+// RetryOutbox sends again the outbox rows whose next attempt is due: failed sends waiting for their backoff,
+// sends lost on restart once their lease expired and rows requeued by manual resend
+func (e *Dispatch) RetryOutbox() {
+	if !e.ctx.IsCenter {
+		return
+	}
+
+	duration := time.Duration(5000) * time.Millisecond
+	for {
+		time.Sleep(duration)
+		e.retryOutbox()
+	}
+}
+
+func (e *Dispatch) retryOutbox() {
+	now := time.Now().Unix()
+	lst, err := models.NotifyOutboxDue(e.ctx, now, 100)
+	if err != nil {
+		logger.Warningf("failed to get due notify outbox: %v", err)
+		return
+	}
+
+	for _, o := range lst {
+		ok, err := models.NotifyOutboxClaim(e.ctx, o, now)
+		if err != nil {
+			logger.Warningf("failed to claim notify outbox:%d err:%v", o.Id, err)
+			continue
+		}
+
+		if !ok {
+			continue
+		}
+
+		e.deliverOutbox(o)
+	}
+}
+
+// deliverOutbox makes one attempt of the row with the current config of its channel
+func (e *Dispatch) deliverOutbox(o *models.NotifyOutbox) {
+	if len(o.Events) == 0 {
+		sender.NotifyRecordWithOutbox(e.ctx, o.Events, o.NotifyRuleId, o.Id, o.ChannelName, "", "", errors.New("events is empty"))
+		return
+	}
+
+	if o.Legacy() {
+		e.deliverLegacyOutbox(o)
+		return
+	}
+
+	notifyChannel := e.notifyChannelCache.Get(o.ChannelId)
+	if notifyChannel == nil {
+		sender.NotifyRecordWithOutbox(e.ctx, o.Events, o.NotifyRuleId, o.Id, o.ChannelName, "", "", errors.New("notify_channel not found"))
+		return
+	}
+
+	var (
+		channel = notifyChannel.Name
+		target  string
+		res     string
+		err     error
+	)
+
+	start := time.Now()
+	switch notifyChannel.RequestType {
+	case "flashduty":
+		target = strconv.FormatInt(o.FlashDutyChannelId, 10)
+		res, err = notifyChannel.SendFlashDuty(o.Events, o.FlashDutyChannelId, e.notifyChannelCache.GetHttpClient(notifyChannel.ID))
+	case "http":
+		target = getSendTarget(o.CustomParams, o.Sendtos)
+		res, err = notifyChannel.SendHTTP(o.Events, o.TplContent, o.CustomParams, o.Sendtos, e.notifyChannelCache.GetHttpClient(notifyChannel.ID))
+	case "smtp":
+		channel = "Email"
+		target = strings.Join(o.Sendtos, ",")
+		err = notifyChannel.SendEmailNow(o.Events, o.TplContent, o.Sendtos)
+		if err == nil {
+			res = "success"
+		}
+	case "script":
+		target, res, err = notifyChannel.SendScript(o.Events, o.TplContent, o.CustomParams, o.Sendtos)
+	default:
+		err = fmt.Errorf("send type %s not found", notifyChannel.RequestType)
+	}
+
+	res = fmt.Sprintf("duration: %d ms %s", time.Since(start).Milliseconds(), res)
+	logger.Infof("notify_id: %d, channel_name: %v, outbox_id: %d, attempts: %d, target: %s, res: %s, err: %v", o.NotifyRuleId, notifyChannel.Name, o.Id, o.Attempts, target, res, err)
+	sender.NotifyRecordWithOutbox(e.ctx, o.Events, o.NotifyRuleId, o.Id, channel, target, res, err)
+}
+
+// deliverLegacyOutbox makes one attempt of a send of the legacy notify configs, emails go with the current smtp config
+func (e *Dispatch) deliverLegacyOutbox(o *models.NotifyOutbox) {
+	var (
+		target string
+		res    string
+		err    error
+	)
+
+	start := time.Now()
+	switch {
+	case o.Webhook != nil:
+		target = o.Webhook.Url
+		res, err = sender.SendWebhookNow(o.Webhook, o.Events, o.WebhookBatch, e.Astats)
+	case o.ChannelName == models.Email:
+		target = strings.Join(o.Sendtos, ",")
+		subject, _ := o.TplContent["subject"].(string)
+		content, _ := o.TplContent["content"].(string)
+		err = sender.SendEmail(subject, content, o.Sendtos, e.notifyConfigCache.GetSMTP())
+		if err == nil {
+			res = "ok"
+		}
+	default:
+		err = fmt.Errorf("legacy send of channel %s not supported", o.ChannelName)
+	}
+
+	res = fmt.Sprintf("duration: %d ms %s", time.Since(start).Milliseconds(), res)
+	logger.Infof("channel_name: %v, outbox_id: %d, attempts: %d, target: %s, res: %s, err: %v", o.ChannelName, o.Id, o.Attempts, target, res, err)
+	sender.NotifyRecordWithOutbox(e.ctx, o.Events, 0, o.Id, o.ChannelName, target, res, err)
+}
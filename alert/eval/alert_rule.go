@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/ccfos/nightingale/v6/alert/aconf"
@@ -12,6 +13,7 @@ import (
 	"github.com/ccfos/nightingale/v6/alert/process"
 	"github.com/ccfos/nightingale/v6/datasource/commons/eslike"
 	"github.com/ccfos/nightingale/v6/memsto"
+	"github.com/ccfos/nightingale/v6/models"
 	"github.com/ccfos/nightingale/v6/pkg/ctx"
 	"github.com/ccfos/nightingale/v6/prom"
 	"github.com/toolkits/pkg/logger"
@@ -20,6 +22,7 @@ import (
 type Scheduler struct {
 	// key: hash
 	alertRules map[string]*AlertRuleWorker
+	lock       sync.RWMutex
 
 	ExternalProcessors *process.ExternalProcessorsType
 
@@ -30,6 +33,7 @@ type Scheduler struct {
 	targetsOfAlertRuleCache *memsto.TargetsOfAlertRuleCacheType
 	busiGroupCache          *memsto.BusiGroupCacheType
 	alertMuteCache          *memsto.AlertMuteCacheType
+	calendarCache           *memsto.CalendarCacheType
 	datasourceCache         *memsto.DatasourceCacheType
 
 	promClients *prom.PromClientMap
@@ -42,7 +46,7 @@ type Scheduler struct {
 
 func NewScheduler(aconf aconf.Alert, externalProcessors *process.ExternalProcessorsType, arc *memsto.AlertRuleCacheType,
 	targetCache *memsto.TargetCacheType, toarc *memsto.TargetsOfAlertRuleCacheType,
-	busiGroupCache *memsto.BusiGroupCacheType, alertMuteCache *memsto.AlertMuteCacheType, datasourceCache *memsto.DatasourceCacheType,
+	busiGroupCache *memsto.BusiGroupCacheType, alertMuteCache *memsto.AlertMuteCacheType, calendarCache *memsto.CalendarCacheType, datasourceCache *memsto.DatasourceCacheType,
 	promClients *prom.PromClientMap, naming *naming.Naming, ctx *ctx.Context, stats *astats.Stats) *Scheduler {
 	scheduler := &Scheduler{
 		aconf:      aconf,
@@ -55,6 +59,7 @@ func NewScheduler(aconf aconf.Alert, externalProcessors *process.ExternalProcess
 		targetsOfAlertRuleCache: toarc,
 		busiGroupCache:          busiGroupCache,
 		alertMuteCache:          alertMuteCache,
+		calendarCache:           calendarCache,
 		datasourceCache:         datasourceCache,
 
 		promClients: promClients,
@@ -114,7 +119,7 @@ func (s *Scheduler) syncAlertRules() {
 					logger.Debugf("datasource %d status is %s", dsId, ds.Status)
 					continue
 				}
-				processor := process.NewProcessor(s.aconf.Heartbeat.EngineName, rule, dsId, s.alertRuleCache, s.targetCache, s.targetsOfAlertRuleCache, s.busiGroupCache, s.alertMuteCache, s.datasourceCache, s.ctx, s.stats)
+				processor := process.NewProcessor(s.aconf.Heartbeat.EngineName, rule, dsId, s.alertRuleCache, s.targetCache, s.targetsOfAlertRuleCache, s.busiGroupCache, s.alertMuteCache, s.calendarCache, s.datasourceCache, s.ctx, s.stats)
 
 				alertRule := NewAlertRuleWorker(rule, dsId, processor, s.promClients, s.ctx)
 				alertRuleWorkers[alertRule.Hash()] = alertRule
@@ -124,7 +129,7 @@ func (s *Scheduler) syncAlertRules() {
 			if !naming.DatasourceHashRing.IsHit(s.aconf.Heartbeat.EngineName, strconv.FormatInt(rule.Id, 10), s.aconf.Heartbeat.Endpoint) {
 				continue
 			}
-			processor := process.NewProcessor(s.aconf.Heartbeat.EngineName, rule, 0, s.alertRuleCache, s.targetCache, s.targetsOfAlertRuleCache, s.busiGroupCache, s.alertMuteCache, s.datasourceCache, s.ctx, s.stats)
+			processor := process.NewProcessor(s.aconf.Heartbeat.EngineName, rule, 0, s.alertRuleCache, s.targetCache, s.targetsOfAlertRuleCache, s.busiGroupCache, s.alertMuteCache, s.calendarCache, s.datasourceCache, s.ctx, s.stats)
 			alertRule := NewAlertRuleWorker(rule, 0, processor, s.promClients, s.ctx)
 			alertRuleWorkers[alertRule.Hash()] = alertRule
 		} else {
@@ -142,7 +147,7 @@ func (s *Scheduler) syncAlertRules() {
 					logger.Debugf("datasource %d status is %s", dsId, ds.Status)
 					continue
 				}
-				processor := process.NewProcessor(s.aconf.Heartbeat.EngineName, rule, dsId, s.alertRuleCache, s.targetCache, s.targetsOfAlertRuleCache, s.busiGroupCache, s.alertMuteCache, s.datasourceCache, s.ctx, s.stats)
+				processor := process.NewProcessor(s.aconf.Heartbeat.EngineName, rule, dsId, s.alertRuleCache, s.targetCache, s.targetsOfAlertRuleCache, s.busiGroupCache, s.alertMuteCache, s.calendarCache, s.datasourceCache, s.ctx, s.stats)
 				externalRuleWorkers[processor.Key()] = processor
 			}
 		}
@@ -153,14 +158,18 @@ func (s *Scheduler) syncAlertRules() {
 			rule.Prepare()
 			time.Sleep(time.Duration(20) * time.Millisecond)
 			rule.Start()
+			s.lock.Lock()
 			s.alertRules[hash] = rule
+			s.lock.Unlock()
 		}
 	}
 
 	for hash, rule := range s.alertRules {
 		if _, has := alertRuleWorkers[hash]; !has {
 			rule.Stop()
+			s.lock.Lock()
 			delete(s.alertRules, hash)
+			s.lock.Unlock()
 		}
 	}
 
@@ -185,3 +194,53 @@ func (s *Scheduler) syncAlertRules() {
 	}
 	s.ExternalProcessors.ExternalLock.Unlock()
 }
+
+// Processors returns the processors of the rules evaluated by this engine, external rules included
+func (s *Scheduler) Processors() []*process.Processor {
+	s.lock.RLock()
+	processors := make([]*process.Processor, 0, len(s.alertRules))
+	for _, rule := range s.alertRules {
+		processors = append(processors, rule.Processor)
+	}
+	s.lock.RUnlock()
+
+	s.ExternalProcessors.ExternalLock.RLock()
+	for _, processor := range s.ExternalProcessors.Processors {
+		processors = append(processors, processor)
+	}
+	s.ExternalProcessors.ExternalLock.RUnlock()
+	return processors
+}
+
+// ResolveEvent recovers the event of a rule evaluated by this engine at once
+func (s *Scheduler) ResolveEvent(event *models.AlertCurEvent) {
+	now := time.Now().Unix()
+	for _, processor := range s.Processors() {
+		rule := processor.Rule()
+		if rule == nil || rule.Id != event.RuleId || processor.DatasourceId() != event.DatasourceId {
+			continue
+		}
+
+		processor.Resolve(event.Hash, now)
+	}
+}
+
+// FiringEvent returns the firing event of a rule evaluated by this engine, nil if there is none
+func (s *Scheduler) FiringEvent(ruleId int64, hash string) *models.AlertCurEvent {
+	for _, processor := range s.Processors() {
+		rule := processor.Rule()
+		if rule == nil || rule.Id != ruleId {
+			continue
+		}
+
+		if event, has := processor.Fire(hash); has {
+			return event
+		}
+	}
+	return nil
+}
+
+// RuleDatasourceIds returns the ids of the datasources the queries of the rule match
+func (s *Scheduler) RuleDatasourceIds(rule *models.AlertRule) []int64 {
+	return s.datasourceCache.GetIDsByDsCateAndQueries(rule.Cate, rule.DatasourceQueries)
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/ccfos/nightingale/v6/alert/astats"
 	"github.com/ccfos/nightingale/v6/alert/common"
 	"github.com/ccfos/nightingale/v6/alert/process"
+	"github.com/ccfos/nightingale/v6/datasource"
 	"github.com/ccfos/nightingale/v6/dscache"
 	"github.com/ccfos/nightingale/v6/models"
 	"github.com/ccfos/nightingale/v6/pkg/ctx"
@@ -24,6 +25,7 @@ import (
 	"github.com/ccfos/nightingale/v6/pkg/poster"
 	promsdk "github.com/ccfos/nightingale/v6/pkg/prom"
 	promql2 "github.com/ccfos/nightingale/v6/pkg/promql"
+	"github.com/ccfos/nightingale/v6/pkg/qlimit"
 	"github.com/ccfos/nightingale/v6/pkg/unit"
 	"github.com/ccfos/nightingale/v6/prom"
 	"github.com/prometheus/common/model"
@@ -51,6 +53,12 @@ type AlertRuleWorker struct {
 
 	LastSeriesStore map[uint64]models.DataResp
 
+	// series returned by the queries of the current evaluation
+	seriesCount int
+
+	// host meta of the previous evaluation by the index of the meta_change trigger of host rules and the ident
+	hostMetas map[int]map[string]*hostMetaState
+
 	DeviceIdentHook func(arw *AlertRuleWorker, paramQuery models.ParamQuery) ([]string, error)
 }
 
@@ -126,6 +134,44 @@ func (arw *AlertRuleWorker) Key() string {
 	return common.RuleKey(arw.DatasourceId, arw.Rule.Id)
 }
 
+// limitQuery runs a query of the rule within the limits of qlimit, the durations are recorded in astats
+func (arw *AlertRuleWorker) limitQuery(ctx context.Context, cate, query string, fn func(ctx context.Context) error) error {
+	return arw.limitQueryOn(ctx, arw.DatasourceId, cate, query, fn)
+}
+
+// limitQueryOn is limitQuery on another datasource than the one of the worker
+func (arw *AlertRuleWorker) limitQueryOn(ctx context.Context, dsId int64, cate, query string, fn func(ctx context.Context) error) error {
+	entry, err := qlimit.Default.Do(ctx, qlimit.Query{
+		Source:       qlimit.SourceAlert,
+		RuleId:       arw.Rule.Id,
+		DatasourceId: dsId,
+		Cate:         cate,
+		Text:         query,
+	}, fn)
+
+	ds := fmt.Sprintf("%d", dsId)
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+
+	arw.Processor.Stats.QueryQueueDuration.WithLabelValues(ds).Observe(float64(entry.Queued) / 1000)
+	arw.Processor.Stats.QueryDuration.WithLabelValues(ds, cate, status).Observe(float64(entry.Duration) / 1000)
+	return err
+}
+
+// promQuery is an instant query of prometheus within the limits
+func (arw *AlertRuleWorker) promQuery(client promsdk.API, promql string) (model.Value, promsdk.Warnings, error) {
+	var value model.Value
+	var warnings promsdk.Warnings
+	err := arw.limitQuery(context.Background(), models.PROMETHEUS, promql, func(ctx context.Context) error {
+		var err error
+		value, warnings, err = client.Query(ctx, promql, time.Now())
+		return err
+	})
+	return value, warnings, err
+}
+
 func (arw *AlertRuleWorker) Hash() string {
 	return str.MD5(fmt.Sprintf("%d_%s_%s_%d",
 		arw.Rule.Id,
@@ -145,9 +191,26 @@ func (arw *AlertRuleWorker) Start() {
 
 func (arw *AlertRuleWorker) Eval() {
 	begin := time.Now()
-	var message string
+	var (
+		message   string
+		evalErr   error
+		skippedBy int64
+	)
 
 	defer func() {
+		state := astats.RuleEvalState{
+			RuleId:       arw.Rule.Id,
+			DatasourceId: arw.DatasourceId,
+			LastEval:     begin.UnixMilli(),
+			Duration:     time.Since(begin).Milliseconds(),
+			SeriesCount:  arw.seriesCount,
+			SkippedBy:    skippedBy,
+		}
+		if evalErr != nil {
+			state.Error = evalErr.Error()
+		}
+		arw.Processor.Stats.RuleEvals.Set(arw.Key(), state)
+
 		if len(message) == 0 {
 			logger.Infof("rule_eval:%s finished, duration:%v", arw.Key(), time.Since(begin))
 		} else {
@@ -164,8 +227,16 @@ func (arw *AlertRuleWorker) Eval() {
 		message = "rule not found"
 		return
 	}
+	if parentId := arw.Processor.SkippedBy(); parentId > 0 {
+		message = fmt.Sprintf("skipped, parent rule %d is firing", parentId)
+		skippedBy = parentId
+		arw.Processor.SuppressAll(parentId)
+		return
+	}
+
 	arw.Processor.Stats.CounterRuleEval.WithLabelValues().Inc()
 	arw.HostAndDeviceIdentCache = sync.Map{}
+	arw.seriesCount = 0
 
 	typ := cachedRule.GetRuleType()
 	var (
@@ -188,6 +259,7 @@ func (arw *AlertRuleWorker) Eval() {
 	if err != nil {
 		logger.Errorf("rule_eval:%s get anomaly point err:%s", arw.Key(), err.Error())
 		message = "failed to get anomaly points"
+		evalErr = err
 		return
 	}
 
@@ -238,6 +310,7 @@ func (arw *AlertRuleWorker) Stop() {
 	close(arw.Quit)
 	c := arw.Scheduler.Stop()
 	<-c.Done()
+	arw.Processor.Stats.RuleEvals.Del(arw.Key())
 
 }
 
@@ -325,7 +398,7 @@ func (arw *AlertRuleWorker) GetPromAnomalyPoint(ruleConfig string) ([]models.Ano
 
 			var warnings promsdk.Warnings
 			arw.Processor.Stats.CounterQueryDataTotal.WithLabelValues(fmt.Sprintf("%d", arw.DatasourceId), fmt.Sprintf("%d", arw.Rule.Id)).Inc()
-			value, warnings, err := readerClient.Query(context.Background(), promql, time.Now())
+			value, warnings, err := arw.promQuery(readerClient, promql)
 			if err != nil {
 				logger.Errorf("rule_eval:%s promql:%s, error:%v", arw.Key(), promql, err)
 				arw.Processor.Stats.CounterQueryDataErrorTotal.WithLabelValues(fmt.Sprintf("%d", arw.DatasourceId)).Inc()
@@ -351,6 +424,7 @@ func (arw *AlertRuleWorker) GetPromAnomalyPoint(ruleConfig string) ([]models.Ano
 				fmt.Sprintf("%v", arw.Processor.DatasourceId()),
 				fmt.Sprintf("%v", i),
 			).Set(float64(len(points)))
+			arw.seriesCount += len(points)
 
 			for i := 0; i < len(points); i++ {
 				points[i].Severity = query.Severity
@@ -436,7 +510,7 @@ func (arw *AlertRuleWorker) VarFillingAfterQuery(query models.PromQuery, readerC
 			}
 			// 得到满足值变量的所有结果
 			arw.Processor.Stats.CounterQueryDataTotal.WithLabelValues(fmt.Sprintf("%d", arw.DatasourceId), fmt.Sprintf("%d", arw.Rule.Id)).Inc()
-			value, _, err := readerClient.Query(context.Background(), curQuery, time.Now())
+			value, _, err := arw.promQuery(readerClient, curQuery)
 			if err != nil {
 				logger.Errorf("rule_eval:%s, promql:%s, error:%v", arw.Key(), curQuery, err)
 				continue
@@ -787,7 +861,7 @@ func (arw *AlertRuleWorker) GetHostAnomalyPoint(ruleConfig string) ([]models.Ano
 
 	arw.Inhibit = rule.Inhibit
 	now := time.Now().Unix()
-	for _, trigger := range rule.Triggers {
+	for i, trigger := range rule.Triggers {
 		switch trigger.Type {
 		case "target_miss":
 			t := now - int64(trigger.Duration)
@@ -832,6 +906,7 @@ func (arw *AlertRuleWorker) GetHostAnomalyPoint(ruleConfig string) ([]models.Ano
 				fmt.Sprintf("%v", arw.Processor.DatasourceId()),
 				"",
 			).Set(float64(len(missTargets)))
+			arw.seriesCount += len(missTargets)
 
 			logger.Debugf("rule_eval:%s missTargets:%v", arw.Key(), missTargets)
 			targets := arw.Processor.TargetCache.Gets(missTargets)
@@ -889,6 +964,7 @@ func (arw *AlertRuleWorker) GetHostAnomalyPoint(ruleConfig string) ([]models.Ano
 				fmt.Sprintf("%v", arw.Processor.DatasourceId()),
 				"",
 			).Set(float64(len(offsetIdents)))
+			arw.seriesCount += len(offsetIdents)
 			for host, offset := range offsetIdents {
 				m := make(map[string]string)
 				target, exists := arw.Processor.TargetCache.Get(host)
@@ -928,10 +1004,13 @@ func (arw *AlertRuleWorker) GetHostAnomalyPoint(ruleConfig string) ([]models.Ano
 				fmt.Sprintf("%v", arw.Processor.DatasourceId()),
 				"",
 			).Set(float64(len(missTargets)))
+			arw.seriesCount += len(missTargets)
 			pct := float64(len(missTargets)) / float64(len(idents)) * 100
 			if pct >= float64(trigger.Percent) {
 				lst = append(lst, models.NewAnomalyPoint(trigger.Type, nil, now, pct, trigger.Severity))
 			}
+		case HostAgentVersion, HostMetaChange, HostReboot, HostGlobalLabelsMissing:
+			lst = append(lst, arw.getHostMetaAnomalyPoints(i, trigger, now)...)
 		}
 	}
 	return lst, nil
@@ -1206,6 +1285,58 @@ func getString(query interface{}) string {
 	}
 }
 
+// queryPrev runs the query shifted back by the offset in seconds, the last values of the series are returned
+// by the hashes of the series, which are the same as the ones of the series of the query now
+func (arw *AlertRuleWorker) queryPrev(plug datasource.Datasource, dsId int64, cate string, query interface{}, offset int64) map[uint64]float64 {
+	ctx := datasource.WithCompareOffset(context.WithValue(context.Background(), "delay", int64(arw.Rule.Delay)), offset)
+	var series []models.DataResp
+	bs, _ := json.Marshal(query)
+	err := arw.limitQueryOn(ctx, dsId, cate, string(bs), func(ctx context.Context) error {
+		var err error
+		series, err = plug.QueryData(ctx, query)
+		return err
+	})
+	arw.Processor.Stats.CounterQueryDataTotal.WithLabelValues(fmt.Sprintf("%d", dsId), fmt.Sprintf("%d", arw.Rule.Id)).Inc()
+
+	values := make(map[uint64]float64)
+	if err != nil {
+		logger.Warningf("rule_eval rid:%d query offset %ds error: %v", arw.Rule.Id, offset, err)
+		arw.Processor.Stats.CounterQueryDataErrorTotal.WithLabelValues(fmt.Sprintf("%d", dsId)).Inc()
+		return values
+	}
+
+	logger.Infof("rule_eval rid:%d offset:%ds req:%+v resp:%v", arw.Rule.Id, offset, query, series)
+	for i := range series {
+		if _, v, exists := series[i].Last(); exists {
+			values[hash.GetHash(series[i].Metric, series[i].Ref)] = v
+		}
+	}
+	return values
+}
+
+// GetQueryDatasource returns the category and the id of the datasource the query runs on, a query
+// without datasource_id runs on the datasource of the rule
+func GetQueryDatasource(query interface{}, cate string, dsId int64) (string, int64) {
+	var q struct {
+		DatasourceCate string `json:"datasource_cate"`
+		DatasourceId   int64  `json:"datasource_id"`
+	}
+
+	bs, err := json.Marshal(query)
+	if err != nil {
+		return cate, dsId
+	}
+
+	if err := json.Unmarshal(bs, &q); err != nil || q.DatasourceId <= 0 {
+		return cate, dsId
+	}
+
+	if q.DatasourceCate == "" {
+		q.DatasourceCate = cate
+	}
+	return q.DatasourceCate, q.DatasourceId
+}
+
 func GetQueryRefAndUnit(query interface{}) (string, string, error) {
 	type Query struct {
 		Ref  string `json:"ref"`
@@ -1300,7 +1431,7 @@ func (arw *AlertRuleWorker) VarFillingBeforeQuery(query models.PromQuery, reader
 						wg.Done()
 					}()
 					arw.Processor.Stats.CounterQueryDataTotal.WithLabelValues(fmt.Sprintf("%d", arw.DatasourceId), fmt.Sprintf("%d", arw.Rule.Id)).Inc()
-					value, _, err := readerClient.Query(context.Background(), promql, time.Now())
+					value, _, err := arw.promQuery(readerClient, promql)
 					if err != nil {
 						logger.Errorf("rule_eval:%s, promql:%s, error:%v", arw.Key(), promql, err)
 						return
@@ -1464,15 +1595,25 @@ func (arw *AlertRuleWorker) GetAnomalyPoint(rule *models.AlertRule, dsId int64)
 	}
 
 	arw.Inhibit = ruleQuery.Inhibit
+	offset, err := ruleQuery.CompareOffset()
+	if err != nil {
+		logger.Warningf("rule_eval rid:%d %v", rule.Id, err)
+	}
+
 	if len(ruleQuery.Queries) > 0 {
 		seriesStore := make(map[uint64]models.DataResp)
+		// the last values of the series offset ago, for $A.prev of the period over period comparisons
+		prevValues := make(map[uint64]float64)
 		seriesTagIndexes := make(map[string]map[uint64][]uint64, 0)
 		for i, query := range ruleQuery.Queries {
 			seriesTagIndex := make(map[uint64][]uint64)
 
-			plug, exists := dscache.DsCache.Get(rule.Cate, dsId)
+			// the queries of cross-datasource rules name their own datasources, the rule is assigned
+			// to the engines by the datasource of the rule as the primary one
+			cate, queryDsId := GetQueryDatasource(query, rule.Cate, dsId)
+			plug, exists := dscache.DsCache.Get(cate, queryDsId)
 			if !exists {
-				logger.Warningf("rule_eval rid:%d datasource:%d not exists", rule.Id, dsId)
+				logger.Warningf("rule_eval rid:%d datasource:%d not exists", rule.Id, queryDsId)
 				arw.Processor.Stats.CounterRuleEvalErrorTotal.WithLabelValues(fmt.Sprintf("%v", arw.Processor.DatasourceId()), GET_CLIENT, arw.Processor.BusiGroupCache.GetNameByBusiGroupId(arw.Rule.GroupId), fmt.Sprintf("%v", arw.Rule.Id)).Inc()
 
 				arw.Processor.Stats.GaugeQuerySeriesCount.WithLabelValues(
@@ -1481,12 +1622,18 @@ func (arw *AlertRuleWorker) GetAnomalyPoint(rule *models.AlertRule, dsId int64)
 					fmt.Sprintf("%v", i),
 				).Set(-2)
 
-				return points, recoverPoints, fmt.Errorf("rule_eval:%d datasource:%d not exists", rule.Id, dsId)
+				return points, recoverPoints, fmt.Errorf("rule_eval:%d datasource:%d not exists", rule.Id, queryDsId)
 			}
 
 			ctx := context.WithValue(context.Background(), "delay", int64(rule.Delay))
-			series, err := plug.QueryData(ctx, query)
-			arw.Processor.Stats.CounterQueryDataTotal.WithLabelValues(fmt.Sprintf("%d", arw.DatasourceId), fmt.Sprintf("%d", rule.Id)).Inc()
+			var series []models.DataResp
+			bs, _ := json.Marshal(query)
+			err := arw.limitQueryOn(ctx, queryDsId, cate, string(bs), func(ctx context.Context) error {
+				var err error
+				series, err = plug.QueryData(ctx, query)
+				return err
+			})
+			arw.Processor.Stats.CounterQueryDataTotal.WithLabelValues(fmt.Sprintf("%d", queryDsId), fmt.Sprintf("%d", rule.Id)).Inc()
 			if err != nil {
 				logger.Warningf("rule_eval rid:%d query data error: %v", rule.Id, err)
 				arw.Processor.Stats.CounterRuleEvalErrorTotal.WithLabelValues(fmt.Sprintf("%v", arw.Processor.DatasourceId()), GET_CLIENT, arw.Processor.BusiGroupCache.GetNameByBusiGroupId(arw.Rule.GroupId), fmt.Sprintf("%v", arw.Rule.Id)).Inc()
@@ -1504,6 +1651,7 @@ func (arw *AlertRuleWorker) GetAnomalyPoint(rule *models.AlertRule, dsId int64)
 				fmt.Sprintf("%v", arw.Processor.DatasourceId()),
 				fmt.Sprintf("%v", i),
 			).Set(float64(len(series)))
+			arw.seriesCount += len(series)
 
 			//  此条日志很重要，是告警判断的现场值
 			logger.Infof("rule_eval rid:%d req:%+v resp:%v", rule.Id, query, series)
@@ -1518,6 +1666,13 @@ func (arw *AlertRuleWorker) GetAnomalyPoint(rule *models.AlertRule, dsId int64)
 				}
 				seriesTagIndex[tagHash] = append(seriesTagIndex[tagHash], serieHash)
 			}
+
+			if offset > 0 {
+				for h, v := range arw.queryPrev(plug, queryDsId, cate, query, offset) {
+					prevValues[h] = v
+				}
+			}
+
 			ref, err := GetQueryRef(query)
 			if err != nil {
 				logger.Warningf("rule_eval rid:%d query:%+v get ref error:%s", rule.Id, query, err.Error())
@@ -1569,6 +1724,10 @@ func (arw *AlertRuleWorker) GetAnomalyPoint(rule *models.AlertRule, dsId int64)
 
 						m["$"+series.Ref] = v
 						m["$"+series.Ref+"."+series.MetricName()] = v
+						if prev, has := prevValues[serieHash]; has {
+							m["$"+series.Ref+".prev"] = prev
+						}
+						m[parser.WindowKey(series.Ref)] = parser.NewWindow(series.Values)
 						for k, v := range series.Metric {
 							if k == "__name__" {
 								continue
@@ -4,6 +4,8 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/ccfos/nightingale/v6/models"
+
 	"golang.org/x/exp/slices"
 )
 
@@ -456,3 +458,103 @@ func TestExtractVarMapping(t *testing.T) {
 		})
 	}
 }
+
+func TestGetQueryDatasource(t *testing.T) {
+	tests := []struct {
+		name  string
+		query interface{}
+		cate  string
+		dsId  int64
+	}{
+		{"rule datasource", map[string]interface{}{"ref": "A", "sql": "select 1"}, "ck", 1},
+		{"own datasource", map[string]interface{}{"ref": "B", "datasource_cate": "mysql", "datasource_id": float64(2)}, "mysql", 2},
+		{"own datasource of the rule cate", map[string]interface{}{"ref": "C", "datasource_id": float64(3)}, "ck", 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cate, dsId := GetQueryDatasource(tt.query, "ck", 1)
+			if cate != tt.cate || dsId != tt.dsId {
+				t.Errorf("GetQueryDatasource() = %s, %d, want %s, %d", cate, dsId, tt.cate, tt.dsId)
+			}
+		})
+	}
+}
+
+func TestHostMetaChanges(t *testing.T) {
+	arw := &AlertRuleWorker{}
+	trigger := models.HostTrigger{Type: HostMetaChange, Duration: 60, Fields: []string{"cpu_num", "os"}}
+	metas := map[string]*models.HostMeta{
+		"host1": {CpuNum: 4, OS: "linux", HostIp: "10.0.0.1"},
+	}
+
+	if changes := arw.hostMetaChanges(0, metas, trigger, 100); len(changes) != 0 {
+		t.Fatalf("hosts seen the first time should not alert: %v", changes)
+	}
+
+	// host_ip is not in the fields of the trigger
+	metas["host1"] = &models.HostMeta{CpuNum: 4, OS: "linux", HostIp: "10.0.0.2"}
+	if changes := arw.hostMetaChanges(0, metas, trigger, 110); len(changes) != 0 {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+
+	metas["host1"] = &models.HostMeta{CpuNum: 8, OS: "linux", HostIp: "10.0.0.2"}
+	changes := arw.hostMetaChanges(0, metas, trigger, 120)
+	if len(changes) != 1 || changes["host1"].change != "cpu_num: 4 -> 8" {
+		t.Fatalf("unexpected changes: %v", changes)
+	}
+
+	if changes := arw.hostMetaChanges(0, metas, trigger, 170); len(changes) != 1 {
+		t.Fatalf("change should keep alerting in the duration: %v", changes)
+	}
+
+	if changes := arw.hostMetaChanges(0, metas, trigger, 200); len(changes) != 0 {
+		t.Fatalf("change should recover after the duration: %v", changes)
+	}
+}
+
+func TestHostMetaChangesByTrigger(t *testing.T) {
+	arw := &AlertRuleWorker{}
+	cpu := models.HostTrigger{Type: HostMetaChange, Duration: 60, Fields: []string{"cpu_num"}}
+	ip := models.HostTrigger{Type: HostMetaChange, Duration: 60, Fields: []string{"host_ip"}}
+	metas := map[string]*models.HostMeta{
+		"host1": {CpuNum: 4, OS: "linux", HostIp: "10.0.0.1"},
+	}
+
+	arw.hostMetaChanges(0, metas, cpu, 100)
+	arw.hostMetaChanges(1, metas, ip, 100)
+
+	// the first trigger seeing the new meta should not hide the change from the second one
+	metas["host1"] = &models.HostMeta{CpuNum: 4, OS: "linux", HostIp: "10.0.0.2"}
+	if changes := arw.hostMetaChanges(0, metas, cpu, 110); len(changes) != 0 {
+		t.Fatalf("unexpected changes of cpu_num: %v", changes)
+	}
+
+	changes := arw.hostMetaChanges(1, metas, ip, 110)
+	if len(changes) != 1 || changes["host1"].change != "host_ip: 10.0.0.1 -> 10.0.0.2" {
+		t.Fatalf("unexpected changes of host_ip: %v", changes)
+	}
+}
+
+func TestAgentVersionAllowed(t *testing.T) {
+	allowed := []string{"v0.4.*", "v0.3.80"}
+	for version, want := range map[string]bool{"v0.4.1": true, "v0.3.80": true, "v0.3.79": false, "": false} {
+		if got := agentVersionAllowed(version, allowed); got != want {
+			t.Errorf("agentVersionAllowed(%q) = %v, want %v", version, got, want)
+		}
+	}
+}
+
+func TestHostUptime(t *testing.T) {
+	if uptime, ok := hostUptime(map[string]interface{}{"platform": map[string]interface{}{"uptime": "300"}}, 0); !ok || uptime != 300 {
+		t.Errorf("uptime = %v %v, want 300", uptime, ok)
+	}
+
+	if uptime, ok := hostUptime(map[string]interface{}{"boot_time": float64(1000)}, 1600); !ok || uptime != 600 {
+		t.Errorf("uptime = %v %v, want 600", uptime, ok)
+	}
+
+	if _, ok := hostUptime(map[string]interface{}{"cpu": map[string]interface{}{}}, 1600); ok {
+		t.Error("uptime should not be found")
+	}
+}
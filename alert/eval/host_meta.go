@@ -0,0 +1,254 @@
+package eval
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// the host triggers checking the meta reported by the agents in their heartbeats
+const (
+	HostAgentVersion        = "agent_version"
+	HostMetaChange          = "meta_change"
+	HostReboot              = "reboot"
+	HostGlobalLabelsMissing = "global_labels_missing"
+)
+
+var hostMetaFields = []string{"cpu_num", "os", "arch", "host_ip"}
+
+// hostMetaState is the meta of a host seen by the previous evaluation, and its last change
+type hostMetaState struct {
+	values    map[string]string
+	change    string
+	changedAt int64
+}
+
+// hostMetaTargets returns the active hosts of the rule reported by agents, with their meta
+func (arw *AlertRuleWorker) hostMetaTargets(now int64) (map[string]*models.Target, map[string]*models.HostMeta, bool) {
+	idents, exists := arw.Processor.TargetsOfAlertRuleCache.Get(arw.Processor.EngineName, arw.Rule.Id)
+	if !exists {
+		logger.Warningf("rule_eval:%s targets not found", arw.Key())
+		arw.Processor.Stats.CounterRuleEvalErrorTotal.WithLabelValues(fmt.Sprintf("%v", arw.Processor.DatasourceId()), QUERY_DATA, arw.Processor.BusiGroupCache.GetNameByBusiGroupId(arw.Rule.GroupId), fmt.Sprintf("%v", arw.Rule.Id)).Inc()
+		return nil, nil, false
+	}
+
+	targets := arw.Processor.TargetCache.Gets(idents)
+	targetMap := make(map[string]*models.Target, len(targets))
+	for _, target := range targets {
+		targetMap[target.Ident] = target
+	}
+
+	metas := arw.Processor.TargetCache.GetHostMetas(targets)
+	for ident, meta := range metas {
+		target, exists := targetMap[ident]
+		if !exists || meta.CpuNum <= 0 || now-target.UpdateAt > 120 {
+			// not collected by categraf, or not an active host
+			delete(metas, ident)
+		}
+	}
+
+	return targetMap, metas, true
+}
+
+func (arw *AlertRuleWorker) getHostMetaAnomalyPoints(idx int, trigger models.HostTrigger, now int64) []models.AnomalyPoint {
+	var lst []models.AnomalyPoint
+	targets, metas, ok := arw.hostMetaTargets(now)
+	if !ok {
+		arw.Processor.Stats.GaugeQuerySeriesCount.WithLabelValues(
+			fmt.Sprintf("%v", arw.Rule.Id),
+			fmt.Sprintf("%v", arw.Processor.DatasourceId()),
+			"",
+		).Set(0)
+		return lst
+	}
+
+	add := func(ident string, value float64, values string) {
+		m := make(map[string]string)
+		if target, exists := targets[ident]; exists {
+			for k, v := range target.TagsMap {
+				m[k] = v
+			}
+		}
+		m["ident"] = ident
+
+		point := models.NewAnomalyPoint(trigger.Type, m, now, value, trigger.Severity)
+		point.Values = values
+		lst = append(lst, point)
+	}
+
+	switch trigger.Type {
+	case HostAgentVersion:
+		if len(trigger.AgentVersions) == 0 {
+			break
+		}
+
+		for ident, meta := range metas {
+			if !agentVersionAllowed(meta.AgentVersion, trigger.AgentVersions) {
+				add(ident, 1, "agent_version="+meta.AgentVersion)
+			}
+		}
+	case HostMetaChange:
+		for ident, change := range arw.hostMetaChanges(idx, metas, trigger, now) {
+			add(ident, float64(now-change.changedAt), change.change)
+		}
+	case HostReboot:
+		idents := make([]string, 0, len(metas))
+		for ident := range metas {
+			idents = append(idents, ident)
+		}
+
+		for ident, info := range arw.Processor.TargetCache.GetHostExtendInfos(idents) {
+			uptime, ok := hostUptime(info, metas[ident].UnixTime/1000)
+			if ok && uptime >= 0 && uptime < float64(trigger.Duration) {
+				add(ident, uptime, fmt.Sprintf("uptime=%.0fs", uptime))
+			}
+		}
+	case HostGlobalLabelsMissing:
+		for ident, meta := range metas {
+			var missing []string
+			for _, key := range trigger.LabelKeys {
+				if meta.GlobalLabels[key] == "" {
+					missing = append(missing, key)
+				}
+			}
+
+			if len(missing) > 0 {
+				add(ident, float64(len(missing)), "missing="+strings.Join(missing, ","))
+			}
+		}
+	}
+
+	logger.Debugf("rule_eval:%s trigger:%s points:%d", arw.Key(), trigger.Type, len(lst))
+	arw.Processor.Stats.GaugeQuerySeriesCount.WithLabelValues(
+		fmt.Sprintf("%v", arw.Rule.Id),
+		fmt.Sprintf("%v", arw.Processor.DatasourceId()),
+		"",
+	).Set(float64(len(lst)))
+	arw.seriesCount += len(lst)
+
+	return lst
+}
+
+// hostMetaChanges compares the meta with the one of the previous evaluation, a host keeps alerting for
+// the duration of the trigger after the change. Hosts seen the first time are only recorded. The triggers
+// of a rule compare different fields, so each trigger at idx of the rule keeps its own state.
+func (arw *AlertRuleWorker) hostMetaChanges(idx int, metas map[string]*models.HostMeta, trigger models.HostTrigger, now int64) map[string]*hostMetaState {
+	if arw.hostMetas == nil {
+		arw.hostMetas = make(map[int]map[string]*hostMetaState)
+	}
+
+	states, exists := arw.hostMetas[idx]
+	if !exists {
+		states = make(map[string]*hostMetaState)
+		arw.hostMetas[idx] = states
+	}
+
+	fields := trigger.Fields
+	if len(fields) == 0 {
+		fields = hostMetaFields
+	}
+
+	changes := make(map[string]*hostMetaState)
+	for ident, meta := range metas {
+		values := hostMetaValues(meta)
+		state, exists := states[ident]
+		if !exists {
+			states[ident] = &hostMetaState{values: values}
+			continue
+		}
+
+		var diffs []string
+		for _, field := range fields {
+			if state.values[field] != values[field] {
+				diffs = append(diffs, fmt.Sprintf("%s: %s -> %s", field, state.values[field], values[field]))
+			}
+		}
+
+		state.values = values
+		if len(diffs) > 0 {
+			state.change = strings.Join(diffs, ", ")
+			state.changedAt = now
+		}
+
+		if state.changedAt > 0 && now-state.changedAt <= int64(trigger.Duration) {
+			changes[ident] = state
+		}
+	}
+
+	// forget the hosts which are gone
+	for ident := range states {
+		if _, exists := metas[ident]; !exists {
+			delete(states, ident)
+		}
+	}
+
+	return changes
+}
+
+func hostMetaValues(meta *models.HostMeta) map[string]string {
+	return map[string]string{
+		"cpu_num": strconv.Itoa(meta.CpuNum),
+		"os":      meta.OS,
+		"arch":    meta.Arch,
+		"host_ip": meta.HostIp,
+	}
+}
+
+// agentVersionAllowed matches the version with the allowed ones, which may be globs like v0.4.*
+func agentVersionAllowed(version string, allowed []string) bool {
+	for _, pattern := range allowed {
+		if pattern == version {
+			return true
+		}
+
+		if matched, err := path.Match(pattern, version); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+// hostUptime reads the uptime in seconds from the extend info, agents report it as uptime or as boot_time,
+// at the top level or in a section like host or platform
+func hostUptime(info map[string]interface{}, reportTime int64) (float64, bool) {
+	sections := []map[string]interface{}{info}
+	keys := make([]string, 0, len(info))
+	for k := range info {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		if section, ok := info[k].(map[string]interface{}); ok {
+			sections = append(sections, section)
+		}
+	}
+
+	for _, section := range sections {
+		if uptime, ok := toFloat(section["uptime"]); ok {
+			return uptime, true
+		}
+
+		if bootTime, ok := toFloat(section["boot_time"]); ok && bootTime > 0 && reportTime > 0 {
+			return float64(reportTime) - bootTime, true
+		}
+	}
+	return 0, false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch val := v.(type) {
+	case float64:
+		return val, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
@@ -3,7 +3,6 @@ package mute
 import (
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/ccfos/nightingale/v6/alert/common"
 	"github.com/ccfos/nightingale/v6/memsto"
@@ -13,12 +12,12 @@ import (
 	"github.com/toolkits/pkg/logger"
 )
 
-func IsMuted(rule *models.AlertRule, event *models.AlertCurEvent, targetCache *memsto.TargetCacheType, alertMuteCache *memsto.AlertMuteCacheType) (bool, string, int64) {
+func IsMuted(rule *models.AlertRule, event *models.AlertCurEvent, targetCache *memsto.TargetCacheType, alertMuteCache *memsto.AlertMuteCacheType, calendarCache *memsto.CalendarCacheType) (bool, string, int64) {
 	if rule.Disabled == 1 {
 		return true, "rule disabled", 0
 	}
 
-	if TimeSpanMuteStrategy(rule, event) {
+	if TimeSpanMuteStrategy(rule, event, calendarCache.Get) {
 		return true, "rule is not effective for period of time", 0
 	}
 
@@ -30,7 +29,7 @@ func IsMuted(rule *models.AlertRule, event *models.AlertCurEvent, targetCache *m
 		return true, "bg not match mute", 0
 	}
 
-	hit, muteId := EventMuteStrategy(event, alertMuteCache)
+	hit, muteId := EventMuteStrategy(event, alertMuteCache, calendarCache.Get)
 	if hit {
 		return true, "match mute rule", muteId
 	}
@@ -40,11 +39,16 @@ func IsMuted(rule *models.AlertRule, event *models.AlertCurEvent, targetCache *m
 
 // TimeSpanMuteStrategy 根据规则配置的告警生效时间段过滤,如果产生的告警不在规则配置的告警生效时间段内,则不告警,即被mute
 // 时间范围，左闭右开，默认范围：00:00-24:00
-func TimeSpanMuteStrategy(rule *models.AlertRule, event *models.AlertCurEvent) bool {
-	tm := time.Unix(event.TriggerTime, 0)
+func TimeSpanMuteStrategy(rule *models.AlertRule, event *models.AlertCurEvent, calendars models.CalendarGetter) bool {
+	tm := models.TimeIn(event.TriggerTime, rule.Timezone)
 	triggerTime := tm.Format("15:04")
 	triggerWeek := strconv.Itoa(int(tm.Weekday()))
 
+	if !rule.EnableCalendar.Match(calendars, tm) {
+		// 不在规则引用的日历的日子里，比如节假日
+		return true
+	}
+
 	if rule.EnableDaysOfWeek == "" {
 		// 如果规则没有配置生效时间，则默认全天生效
 
@@ -129,14 +133,14 @@ func BgNotMatchMuteStrategy(rule *models.AlertRule, event *models.AlertCurEvent,
 	return false
 }
 
-func EventMuteStrategy(event *models.AlertCurEvent, alertMuteCache *memsto.AlertMuteCacheType) (bool, int64) {
+func EventMuteStrategy(event *models.AlertCurEvent, alertMuteCache *memsto.AlertMuteCacheType, calendars models.CalendarGetter) (bool, int64) {
 	mutes, has := alertMuteCache.Gets(event.GroupId)
 	if !has || len(mutes) == 0 {
 		return false, 0
 	}
 
 	for i := 0; i < len(mutes); i++ {
-		matched, _ := MatchMute(event, mutes[i])
+		matched, _ := MatchMute(event, mutes[i], calendars)
 		if matched {
 			return true, mutes[i].Id
 		}
@@ -146,7 +150,7 @@ func EventMuteStrategy(event *models.AlertCurEvent, alertMuteCache *memsto.Alert
 }
 
 // MatchMute 如果传入了clock这个可选参数，就表示使用这个clock表示的时间，否则就从event的字段中取TriggerTime
-func MatchMute(event *models.AlertCurEvent, mute *models.AlertMute, clock ...int64) (bool, error) {
+func MatchMute(event *models.AlertCurEvent, mute *models.AlertMute, calendars models.CalendarGetter, clock ...int64) (bool, error) {
 	if mute.Disabled == 1 {
 		return false, errors.New("mute is disabled")
 	}
@@ -174,7 +178,7 @@ func MatchMute(event *models.AlertCurEvent, mute *models.AlertMute, clock ...int
 			ts = clock[0]
 		}
 
-		if !mute.IsWithinPeriodicMute(ts) {
+		if !mute.IsWithinPeriodicMute(ts, calendars) {
 			return false, errors.New("event trigger time not within periodic mute range")
 		}
 	} else {
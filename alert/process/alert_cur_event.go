@@ -72,3 +72,14 @@ func (a *AlertCurEventMap) GetAll() map[string]*models.AlertCurEvent {
 	defer a.RUnlock()
 	return a.Data
 }
+
+// Values returns copies of the events, the events in the map are changed by the processor
+func (a *AlertCurEventMap) Values() []models.AlertCurEvent {
+	a.RLock()
+	defer a.RUnlock()
+	values := make([]models.AlertCurEvent, 0, len(a.Data))
+	for _, event := range a.Data {
+		values = append(values, *event)
+	}
+	return values
+}
@@ -0,0 +1,155 @@
+package process
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// SuppressedByAnnotation is the annotation recording the parent rule on the firing events suppressed by it
+const SuppressedByAnnotation = "suppressed_by"
+
+// the firing events of a parent rule are read from the database and shared by its dependent rules for a while
+const parentEventsTTL = 10 * time.Second
+
+type parentEntry struct {
+	tags   []map[string]string
+	expire time.Time
+}
+
+type parentEventsCache struct {
+	sync.Mutex
+	entries map[int64]parentEntry
+}
+
+var parentEvents = &parentEventsCache{entries: make(map[int64]parentEntry)}
+
+// get returns the tags of the firing events of the rule
+func (c *parentEventsCache) get(ctx *ctx.Context, ruleId int64) ([]map[string]string, error) {
+	c.Lock()
+	entry, has := c.entries[ruleId]
+	c.Unlock()
+	if has && time.Now().Before(entry.expire) {
+		return entry.tags, nil
+	}
+
+	events, err := models.AlertCurEventGetsByRuleId(ctx, ruleId)
+	if err != nil {
+		return nil, err
+	}
+
+	entry = parentEntry{tags: make([]map[string]string, 0, len(events)), expire: time.Now().Add(parentEventsTTL)}
+	for _, event := range events {
+		entry.tags = append(entry.tags, event.TagsMap)
+	}
+
+	c.Lock()
+	c.entries[ruleId] = entry
+	c.Unlock()
+	return entry.tags, nil
+}
+
+// suppressedBy returns the id of the firing parent rule the event is suppressed by, 0 means not suppressed
+func (p *Processor) suppressedBy(rule *models.AlertRule, event *models.AlertCurEvent) int64 {
+	for _, d := range rule.Dependencies {
+		tags, err := parentEvents.get(p.ctx, d.RuleId)
+		if err != nil {
+			logger.Warningf("rule_eval:%s failed to get events of parent rule %d: %v", p.Key(), d.RuleId, err)
+			continue
+		}
+
+		for _, parent := range tags {
+			if d.Match(parent, event.TagsMap) {
+				return d.RuleId
+			}
+		}
+	}
+	return 0
+}
+
+// SkippedBy returns the id of the firing parent rule the rule is not evaluated because of, the labels
+// of the dependency are not used as the rule has no events before the evaluation. 0 means not skipped.
+func (p *Processor) SkippedBy() int64 {
+	rule := p.alertRuleCache.Get(p.rule.Id)
+	if rule == nil {
+		rule = p.rule
+	}
+
+	for _, d := range rule.Dependencies {
+		if !d.Skip {
+			continue
+		}
+
+		tags, err := parentEvents.get(p.ctx, d.RuleId)
+		if err != nil {
+			logger.Warningf("rule_eval:%s failed to get events of parent rule %d: %v", p.Key(), d.RuleId, err)
+			continue
+		}
+
+		if len(tags) > 0 {
+			return d.RuleId
+		}
+	}
+	return 0
+}
+
+// Suppress annotates the firing event with the parent rule. Like a muted event it keeps firing and is
+// not dispatched, the notifications go on after the parent recovers if the anomaly is still there.
+func (p *Processor) Suppress(hash string, parentId int64) {
+	event, has := p.fires.Get(hash)
+	if !has {
+		return
+	}
+
+	p.setSuppressedBy(event, fmt.Sprintf("suppressed by parent rule %d", parentId))
+}
+
+// SuppressAll suppresses all the firing events of the rule, used when the rule is skipped because of the
+// parent rule and nothing is evaluated
+func (p *Processor) SuppressAll(parentId int64) {
+	for _, hash := range p.fires.Keys() {
+		p.Suppress(hash, parentId)
+	}
+}
+
+// unsuppress removes the annotation of the firing event once it is not suppressed any more
+func (p *Processor) unsuppress(hash string) {
+	event, has := p.fires.Get(hash)
+	if !has || !strings.Contains(event.Annotations, SuppressedByAnnotation) {
+		return
+	}
+
+	p.setSuppressedBy(event, "")
+}
+
+// setSuppressedBy updates the annotation of the firing event, an empty value removes it. The annotation
+// of the current event in the database is updated too, so the suppressed events are told apart in the UI.
+func (p *Processor) setSuppressedBy(event *models.AlertCurEvent, value string) {
+	if event.AnnotationsJSON == nil {
+		event.AnnotationsJSON = make(map[string]string)
+		json.Unmarshal([]byte(event.Annotations), &event.AnnotationsJSON)
+	}
+
+	if event.AnnotationsJSON[SuppressedByAnnotation] == value {
+		return
+	}
+
+	if value == "" {
+		delete(event.AnnotationsJSON, SuppressedByAnnotation)
+	} else {
+		event.AnnotationsJSON[SuppressedByAnnotation] = value
+	}
+	b, _ := json.Marshal(event.AnnotationsJSON)
+	event.Annotations = string(b)
+
+	if err := models.AlertCurEventSetAnnotations(p.ctx, event.Hash, event.Annotations); err != nil {
+		logger.Warningf("rule_eval:%s failed to update annotations of event %s: %v", p.Key(), event.Hash, err)
+	}
+}
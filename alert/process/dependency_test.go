@@ -0,0 +1,31 @@
+package process
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+)
+
+func TestSuppressKeepsFiring(t *testing.T) {
+	event := &models.AlertCurEvent{Hash: "h1", Annotations: `{"summary":"disk full"}`}
+	p := &Processor{
+		ctx:   &ctx.Context{},
+		fires: NewAlertCurEventMap(map[string]*models.AlertCurEvent{"h1": event}),
+	}
+
+	p.SuppressAll(2)
+	fired, has := p.fires.Get("h1")
+	if !has || fired.IsRecovered {
+		t.Fatal("suppressed event does not keep firing")
+	}
+	if fired.AnnotationsJSON[SuppressedByAnnotation] != "suppressed by parent rule 2" || fired.AnnotationsJSON["summary"] != "disk full" {
+		t.Fatalf("unexpected annotations: %v", fired.AnnotationsJSON)
+	}
+
+	p.unsuppress("h1")
+	if _, has := fired.AnnotationsJSON[SuppressedByAnnotation]; has || strings.Contains(fired.Annotations, SuppressedByAnnotation) {
+		t.Fatalf("annotation not removed after the parent recovers: %s", fired.Annotations)
+	}
+}
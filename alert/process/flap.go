@@ -0,0 +1,93 @@
+package process
+
+import (
+	"sync"
+
+	"github.com/ccfos/nightingale/v6/models"
+)
+
+// flapState is the recent state changes of the series of an event
+type flapState struct {
+	changes    []int64 // time of the state changes in the window
+	firing     bool    // the last state of the series
+	flapping   bool
+	lastChange int64
+}
+
+type flapDetector struct {
+	sync.Mutex
+	states map[string]*flapState // key: event hash
+}
+
+func newFlapDetector() *flapDetector {
+	return &flapDetector{states: make(map[string]*flapState)}
+}
+
+// observe records the state of the series of the event. It returns whether the event is flapping, whether
+// it starts flapping with this state, and whether it stops flapping as it has been stable for long enough.
+func (d *flapDetector) observe(cfg *models.FlapDetection, hash string, firing bool, now int64) (flapping, started, stopped bool) {
+	d.Lock()
+	defer d.Unlock()
+
+	state, has := d.states[hash]
+	if !has {
+		if !firing {
+			return false, false, false
+		}
+		state = &flapState{}
+		d.states[hash] = state
+	}
+
+	if state.firing != firing {
+		state.firing = firing
+		state.lastChange = now
+		state.changes = append(state.changes, now)
+	}
+
+	changes := state.changes[:0]
+	for _, t := range state.changes {
+		if t > now-cfg.Window {
+			changes = append(changes, t)
+		}
+	}
+	state.changes = changes
+
+	if state.flapping {
+		if now-state.lastChange < cfg.StableTime {
+			return true, false, false
+		}
+
+		// stable again, the changes before do not count any more
+		state.flapping = false
+		state.changes = state.changes[:0]
+		return false, false, true
+	}
+
+	if len(state.changes) >= cfg.Threshold {
+		state.flapping = true
+		return true, true, false
+	}
+
+	return false, false, false
+}
+
+// clean forgets the events which are recovered and have no state changes in the window
+func (d *flapDetector) clean(cfg *models.FlapDetection, now int64) {
+	d.Lock()
+	defer d.Unlock()
+
+	for hash, state := range d.states {
+		if !cfg.Enabled() || (!state.firing && !state.flapping && state.lastChange <= now-cfg.Window) {
+			delete(d.states, hash)
+		}
+	}
+}
+
+// flap observes the state of the series of the event with the flap detection of the rule
+func (p *Processor) flap(hash string, firing bool, now int64) (flapping, started, stopped bool) {
+	cfg := p.rule.FlapDetection
+	if !cfg.Enabled() {
+		return false, false, false
+	}
+	return p.flaps.observe(cfg, hash, firing, now)
+}
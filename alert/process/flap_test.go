@@ -0,0 +1,66 @@
+package process
+
+import (
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/models"
+)
+
+func TestFlapDetector(t *testing.T) {
+	cfg := &models.FlapDetection{Window: 600, Threshold: 4, StableTime: 300}
+	d := newFlapDetector()
+
+	if flapping, _, _ := d.observe(cfg, "h", false, 0); flapping {
+		t.Fatal("a recovered series seen the first time should not flap")
+	}
+
+	// fire, recover, fire: 3 changes
+	for i, firing := range []bool{true, false, true} {
+		if flapping, _, _ := d.observe(cfg, "h", firing, int64(i*60)); flapping {
+			t.Fatalf("change %d should not flap yet", i)
+		}
+	}
+
+	flapping, started, _ := d.observe(cfg, "h", false, 180)
+	if !flapping || !started {
+		t.Fatal("expected the 4th change in the window to start flapping")
+	}
+
+	flapping, started, _ = d.observe(cfg, "h", true, 240)
+	if !flapping || started {
+		t.Fatal("expected the event to keep flapping without starting again")
+	}
+
+	if flapping, _, stopped := d.observe(cfg, "h", true, 400); !flapping || stopped {
+		t.Fatal("expected the event to flap until it is stable for stable_time")
+	}
+
+	flapping, _, stopped := d.observe(cfg, "h", true, 540)
+	if flapping || !stopped {
+		t.Fatal("expected the event to stop flapping after stable_time")
+	}
+
+	if flapping, _, _ := d.observe(cfg, "h", false, 600); flapping {
+		t.Fatal("the changes before the flapping should not count any more")
+	}
+
+	d.clean(cfg, 1300)
+	if len(d.states) != 0 {
+		t.Fatal("expected the recovered event to be forgotten out of the window")
+	}
+}
+
+func TestFlapDetectionVerify(t *testing.T) {
+	var cfg *models.FlapDetection
+	if cfg.Enabled() || cfg.Verify() != nil {
+		t.Fatal("nil flap detection should be disabled and valid")
+	}
+
+	if (&models.FlapDetection{Window: 600, Threshold: 1, StableTime: 60}).Verify() == nil {
+		t.Error("expected error for threshold less than 2")
+	}
+
+	if (&models.FlapDetection{Threshold: 4}).Verify() == nil {
+		t.Error("expected error for no window")
+	}
+}
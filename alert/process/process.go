@@ -8,6 +8,7 @@ import (
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ccfos/nightingale/v6/alert/astats"
@@ -69,6 +70,7 @@ type Processor struct {
 	TargetsOfAlertRuleCache *memsto.TargetsOfAlertRuleCacheType
 	BusiGroupCache          *memsto.BusiGroupCacheType
 	alertMuteCache          *memsto.AlertMuteCacheType
+	calendarCache           *memsto.CalendarCacheType
 	datasourceCache         *memsto.DatasourceCacheType
 
 	ctx   *ctx.Context
@@ -80,6 +82,11 @@ type Processor struct {
 
 	ScheduleEntry    cron.Entry
 	PromEvalInterval int
+
+	// events suppressed by the parent rules in the last handling
+	suppressed atomic.Int64
+
+	flaps *flapDetector
 }
 
 func (p *Processor) Key() string {
@@ -90,6 +97,51 @@ func (p *Processor) DatasourceId() int64 {
 	return p.datasourceId
 }
 
+func (p *Processor) Rule() *models.AlertRule {
+	return p.rule
+}
+
+// Fires returns copies of the firing events of the processor
+func (p *Processor) Fires() []models.AlertCurEvent {
+	return p.fires.Values()
+}
+
+// Fire returns a copy of the firing event of the hash
+func (p *Processor) Fire(hash string) (*models.AlertCurEvent, bool) {
+	event, has := p.fires.Get(hash)
+	if !has {
+		return nil, false
+	}
+	return event.DeepCopy(), true
+}
+
+// Pendings returns copies of the events waiting for the for duration of the rule, the pending
+// events are kept after firing until recovered, so the firing ones are left out
+func (p *Processor) Pendings() []models.AlertCurEvent {
+	values := p.pendings.Values()
+	pendings := make([]models.AlertCurEvent, 0, len(values))
+	for _, event := range values {
+		if _, has := p.fires.Get(event.Hash); !has {
+			pendings = append(pendings, event)
+		}
+	}
+	return pendings
+}
+
+// Suppressed returns the number of the events suppressed by the parent rules in the last handling
+func (p *Processor) Suppressed() int64 {
+	return p.suppressed.Load()
+}
+
+// ForRemaining returns the seconds the pending event still has to wait before firing
+func (p *Processor) ForRemaining(event *models.AlertCurEvent) int64 {
+	remaining := int64(p.rule.PromForDuration) - (event.LastEvalTime - event.FirstEvalTime + int64(p.PromEvalInterval))
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
 func (p *Processor) Hash() string {
 	return str.MD5(fmt.Sprintf("%d_%s_%s_%d",
 		p.rule.Id,
@@ -101,7 +153,7 @@ func (p *Processor) Hash() string {
 
 func NewProcessor(engineName string, rule *models.AlertRule, datasourceId int64, alertRuleCache *memsto.AlertRuleCacheType,
 	targetCache *memsto.TargetCacheType, targetsOfAlertRuleCache *memsto.TargetsOfAlertRuleCacheType,
-	busiGroupCache *memsto.BusiGroupCacheType, alertMuteCache *memsto.AlertMuteCacheType, datasourceCache *memsto.DatasourceCacheType, ctx *ctx.Context,
+	busiGroupCache *memsto.BusiGroupCacheType, alertMuteCache *memsto.AlertMuteCacheType, calendarCache *memsto.CalendarCacheType, datasourceCache *memsto.DatasourceCacheType, ctx *ctx.Context,
 	stats *astats.Stats) *Processor {
 
 	p := &Processor{
@@ -113,6 +165,7 @@ func NewProcessor(engineName string, rule *models.AlertRule, datasourceId int64,
 		TargetsOfAlertRuleCache: targetsOfAlertRuleCache,
 		BusiGroupCache:          busiGroupCache,
 		alertMuteCache:          alertMuteCache,
+		calendarCache:           calendarCache,
 		alertRuleCache:          alertRuleCache,
 		datasourceCache:         datasourceCache,
 
@@ -122,6 +175,8 @@ func NewProcessor(engineName string, rule *models.AlertRule, datasourceId int64,
 		HandleFireEventHook:    func(event *models.AlertCurEvent) {},
 		HandleRecoverEventHook: func(event *models.AlertCurEvent) {},
 		EventMuteHook:          func(event *models.AlertCurEvent) bool { return false },
+
+		flaps: newFlapDetector(),
 	}
 
 	p.mayHandleGroup()
@@ -146,6 +201,7 @@ func (p *Processor) Handle(anomalyPoints []models.AnomalyPoint, from string, inh
 	p.rule = cachedRule
 	now := time.Now().Unix()
 	alertingKeys := map[string]struct{}{}
+	var suppressed int64
 
 	// 根据 event 的 tag 将 events 分组，处理告警抑制的情况
 	eventsMap := make(map[string][]*models.AlertCurEvent)
@@ -155,7 +211,7 @@ func (p *Processor) Handle(anomalyPoints []models.AnomalyPoint, from string, inh
 		// 如果 event 被 mute 了,本质也是 fire 的状态,这里无论如何都添加到 alertingKeys 中,防止 fire 的事件自动恢复了
 		hash := event.Hash
 		alertingKeys[hash] = struct{}{}
-		isMuted, detail, muteId := mute.IsMuted(cachedRule, event, p.TargetCache, p.alertMuteCache)
+		isMuted, detail, muteId := mute.IsMuted(cachedRule, event, p.TargetCache, p.alertMuteCache, p.calendarCache)
 		if isMuted {
 			logger.Debugf("rule_eval:%s event:%v is muted, detail:%s", p.Key(), event, detail)
 			p.Stats.CounterMuteTotal.WithLabelValues(
@@ -167,6 +223,20 @@ func (p *Processor) Handle(anomalyPoints []models.AnomalyPoint, from string, inh
 			continue
 		}
 
+		if parentId := p.suppressedBy(cachedRule, event); parentId > 0 {
+			logger.Debugf("rule_eval:%s event:%v is suppressed by parent rule %d", p.Key(), event, parentId)
+			p.Stats.CounterSuppressedTotal.WithLabelValues(
+				fmt.Sprintf("%v", event.GroupName),
+				fmt.Sprintf("%v", p.rule.Id),
+				fmt.Sprintf("%v", parentId),
+				fmt.Sprintf("%v", p.datasourceId),
+			).Inc()
+			suppressed++
+			// like the muted events, the firing event keeps firing without notifications
+			p.Suppress(hash, parentId)
+			continue
+		}
+
 		if p.EventMuteHook(event) {
 			logger.Debugf("rule_eval:%s event:%v is muted by hook", p.Key(), event)
 			p.Stats.CounterMuteTotal.WithLabelValues(
@@ -178,9 +248,12 @@ func (p *Processor) Handle(anomalyPoints []models.AnomalyPoint, from string, inh
 			continue
 		}
 
+		p.unsuppress(hash)
+
 		tagHash := TagHash(anomalyPoint)
 		eventsMap[tagHash] = append(eventsMap[tagHash], event)
 	}
+	p.suppressed.Store(suppressed)
 
 	for _, events := range eventsMap {
 		p.handleEvent(events)
@@ -306,7 +379,7 @@ func (p *Processor) HandleRecover(alertingKeys map[string]struct{}, now int64, i
 		hashArr = append(hashArr, hash)
 	}
 	p.HandleRecoverEvent(hashArr, now, inhibit)
-
+	p.flaps.clean(p.rule.FlapDetection, now)
 }
 
 func (p *Processor) HandleRecoverEvent(hashArr []string, now int64, inhibit bool) {
@@ -381,6 +454,19 @@ func (p *Processor) RecoverSingle(byRecover bool, hash string, now int64, value
 		return
 	}
 
+	// a flapping event keeps firing until it is stable, it is only notified when it starts flapping
+	if flapping, started, _ := p.flap(hash, false, now); flapping {
+		if started {
+			event.Flapping = 1
+			event.LastEvalTime = now
+			event.NotifyCurNumber++
+			logger.Infof("rule_eval:%s event-hash-%s flapping, not recover", p.Key(), hash)
+			p.pushEventToQueue(event)
+		}
+		return
+	}
+	event.Flapping = 0
+
 	if value != nil {
 		event.TriggerValue = *value
 		if len(values) > 0 {
@@ -404,6 +490,31 @@ func (p *Processor) RecoverSingle(byRecover bool, hash string, now int64, value
 	p.pushEventToQueue(event)
 }
 
+// Resolve recovers the event at once, no matter the recover duration and the recover condition of the rule,
+// e.g. when the self-healing task of the event succeeds. It fires again if the anomaly is still there.
+func (p *Processor) Resolve(hash string, now int64) {
+	cachedRule := p.rule
+	if cachedRule == nil {
+		return
+	}
+
+	event, has := p.fires.Get(hash)
+	if !has {
+		return
+	}
+
+	p.fires.Delete(hash)
+	p.pendings.Delete(hash)
+	p.pendingsUseByRecover.Delete(hash)
+
+	cachedRule.UpdateEvent(event)
+	event.IsRecovered = true
+	event.LastEvalTime = now
+
+	p.HandleRecoverEventHook(event)
+	p.pushEventToQueue(event)
+}
+
 func (p *Processor) handleEvent(events []*models.AlertCurEvent) {
 	var fireEvents []*models.AlertCurEvent
 	// severity 初始为最低优先级, 一定为遇到比自己优先级高的事件
@@ -473,6 +584,18 @@ func (p *Processor) fireEvent(event *models.AlertCurEvent) {
 		logger.Infof("rule_eval:%s event-hash-%s %s", p.Key(), event.Hash, message)
 	}()
 
+	if flapping, started, stopped := p.flap(event.Hash, true, event.LastEvalTime); flapping || stopped {
+		p.fireFlappingEvent(event, started, stopped)
+		if started {
+			message = "fired, flapping"
+		} else if stopped {
+			message = "fired, stable again"
+		} else {
+			message = "stalled, flapping"
+		}
+		return
+	}
+
 	if fired, has := p.fires.Get(event.Hash); has {
 		p.fires.UpdateLastEvalTime(event.Hash, event.LastEvalTime)
 		event.FirstTriggerTime = fired.FirstTriggerTime
@@ -513,6 +636,36 @@ func (p *Processor) fireEvent(event *models.AlertCurEvent) {
 	}
 }
 
+// fireFlappingEvent notifies the event once when it starts flapping, and once again when it is stable,
+// it is kept firing without notifications in between
+func (p *Processor) fireFlappingEvent(event *models.AlertCurEvent, started, stopped bool) {
+	fired, has := p.fires.Get(event.Hash)
+	if has {
+		event.FirstTriggerTime = fired.FirstTriggerTime
+		event.NotifyCurNumber = fired.NotifyCurNumber
+	} else {
+		event.FirstTriggerTime = event.TriggerTime
+	}
+
+	if !started && !stopped {
+		if has {
+			p.fires.UpdateLastEvalTime(event.Hash, event.LastEvalTime)
+		} else {
+			event.Flapping = 1
+			p.fires.Set(event.Hash, event)
+		}
+		return
+	}
+
+	if started {
+		event.Flapping = 1
+	}
+
+	event.NotifyCurNumber++
+	p.HandleFireEventHook(event)
+	p.pushEventToQueue(event)
+}
+
 func (p *Processor) pushEventToQueue(e *models.AlertCurEvent) {
 	if !e.IsRecovered {
 		e.LastSentTime = e.LastEvalTime
@@ -5,6 +5,7 @@ import (
 
 	"github.com/ccfos/nightingale/v6/alert/aconf"
 	"github.com/ccfos/nightingale/v6/alert/astats"
+	"github.com/ccfos/nightingale/v6/alert/eval"
 	"github.com/ccfos/nightingale/v6/alert/process"
 	"github.com/ccfos/nightingale/v6/memsto"
 	"github.com/ccfos/nightingale/v6/pkg/ctx"
@@ -17,24 +18,31 @@ type Router struct {
 	HTTP               httpx.Config
 	Alert              aconf.Alert
 	AlertMuteCache     *memsto.AlertMuteCacheType
+	CalendarCache      *memsto.CalendarCacheType
 	TargetCache        *memsto.TargetCacheType
 	BusiGroupCache     *memsto.BusiGroupCacheType
 	AlertStats         *astats.Stats
 	Ctx                *ctx.Context
 	ExternalProcessors *process.ExternalProcessorsType
+	AlertRuleCache     *memsto.AlertRuleCacheType
+	Scheduler          *eval.Scheduler
 }
 
-func New(httpConfig httpx.Config, alert aconf.Alert, amc *memsto.AlertMuteCacheType, tc *memsto.TargetCacheType, bgc *memsto.BusiGroupCacheType,
-	astats *astats.Stats, ctx *ctx.Context, externalProcessors *process.ExternalProcessorsType) *Router {
+func New(httpConfig httpx.Config, alert aconf.Alert, amc *memsto.AlertMuteCacheType, cc *memsto.CalendarCacheType, tc *memsto.TargetCacheType, bgc *memsto.BusiGroupCacheType,
+	astats *astats.Stats, ctx *ctx.Context, externalProcessors *process.ExternalProcessorsType,
+	arc *memsto.AlertRuleCacheType, scheduler *eval.Scheduler) *Router {
 	return &Router{
 		HTTP:               httpConfig,
 		Alert:              alert,
 		AlertMuteCache:     amc,
+		CalendarCache:      cc,
 		TargetCache:        tc,
 		BusiGroupCache:     bgc,
 		AlertStats:         astats,
 		Ctx:                ctx,
 		ExternalProcessors: externalProcessors,
+		AlertRuleCache:     arc,
+		Scheduler:          scheduler,
 	}
 }
 
@@ -50,6 +58,12 @@ func (rt *Router) Config(r *gin.Engine) {
 	service.POST("/event", rt.pushEventToQueue)
 	service.POST("/event-persist", rt.eventPersist)
 	service.POST("/make-event", rt.makeEvent)
+	service.GET("/alert-rule/:arid/eval-status", rt.alertRuleEvalStatus)
+
+	// prometheus compatible, take /v1/n9e/alert-api of an engine as the url of a prometheus datasource,
+	// the pending alerts and the health of the rules are those of this engine only
+	service.GET("/alert-api/api/v1/rules", rt.promRules)
+	service.GET("/alert-api/api/v1/alerts", rt.promAlerts)
 }
 
 func Render(c *gin.Context, data, msg interface{}) {
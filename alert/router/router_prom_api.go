@@ -0,0 +1,401 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/alert/astats"
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/str"
+)
+
+// the read endpoints of the prometheus rules and alerts api, so that tools like the alert list panel
+// of grafana can show the rules of n9e. The endpoints are per engine: the pending alerts, the health and
+// the last evaluation of the rules are those of the datasources evaluated by the engine answering, they
+// are not aggregated across the engines like the eval status of center. With several engines a datasource
+// per engine is needed to see them all. The firing alerts are read from the database on center, so they
+// cover all the engines there, and from the memory of the engine on edge.
+
+type promAlert struct {
+	Labels      map[string]string `json:"labels"`
+	Annotations map[string]string `json:"annotations"`
+	State       string            `json:"state"`
+	ActiveAt    time.Time         `json:"activeAt"`
+	Value       string            `json:"value"`
+}
+
+type promRule struct {
+	State          string            `json:"state"`
+	Name           string            `json:"name"`
+	Query          string            `json:"query"`
+	Duration       float64           `json:"duration"`
+	Labels         map[string]string `json:"labels"`
+	Annotations    map[string]string `json:"annotations"`
+	Alerts         []promAlert       `json:"alerts"`
+	Health         string            `json:"health"`
+	LastError      string            `json:"lastError,omitempty"`
+	EvaluationTime float64           `json:"evaluationTime"`
+	LastEvaluation time.Time         `json:"lastEvaluation"`
+	Type           string            `json:"type"`
+}
+
+type promRuleGroup struct {
+	Name           string     `json:"name"`
+	File           string     `json:"file"`
+	Rules          []promRule `json:"rules"`
+	Interval       float64    `json:"interval"`
+	EvaluationTime float64    `json:"evaluationTime"`
+	LastEvaluation time.Time  `json:"lastEvaluation"`
+}
+
+type promAlertsFilter struct {
+	bgids     map[int64]struct{}
+	dsIds     map[int64]struct{}
+	ruleNames map[string]struct{}
+}
+
+func newPromAlertsFilter(c *gin.Context) promAlertsFilter {
+	f := promAlertsFilter{
+		bgids:     idSet(c.Query("busi_group_id")),
+		dsIds:     idSet(c.Query("datasource_id")),
+		ruleNames: make(map[string]struct{}),
+	}
+
+	for _, name := range c.QueryArray("rule_name[]") {
+		f.ruleNames[name] = struct{}{}
+	}
+	return f
+}
+
+func idSet(ids string) map[int64]struct{} {
+	set := make(map[int64]struct{})
+	for _, id := range str.IdsInt64(ids, ",") {
+		set[id] = struct{}{}
+	}
+	return set
+}
+
+func (f promAlertsFilter) matchRule(rule *models.AlertRule, dsIds []int64) bool {
+	if len(f.bgids) > 0 {
+		if _, has := f.bgids[rule.GroupId]; !has {
+			return false
+		}
+	}
+
+	if len(f.ruleNames) > 0 {
+		if _, has := f.ruleNames[rule.Name]; !has {
+			return false
+		}
+	}
+
+	if len(f.dsIds) == 0 {
+		return true
+	}
+
+	for _, id := range dsIds {
+		if _, has := f.dsIds[id]; has {
+			return true
+		}
+	}
+	return false
+}
+
+func (f promAlertsFilter) matchEvent(event *models.AlertCurEvent) bool {
+	if len(f.bgids) > 0 {
+		if _, has := f.bgids[event.GroupId]; !has {
+			return false
+		}
+	}
+
+	if len(f.ruleNames) > 0 {
+		if _, has := f.ruleNames[event.RuleName]; !has {
+			return false
+		}
+	}
+
+	if len(f.dsIds) > 0 {
+		if _, has := f.dsIds[event.DatasourceId]; !has {
+			return false
+		}
+	}
+	return true
+}
+
+// ruleAlerts returns the pending and firing alerts by rule id
+func (rt *Router) ruleAlerts(f promAlertsFilter) (map[int64][]promAlert, error) {
+	alerts := make(map[int64][]promAlert)
+	add := func(event *models.AlertCurEvent, state string) {
+		if f.matchEvent(event) {
+			alerts[event.RuleId] = append(alerts[event.RuleId], toPromAlert(event, state))
+		}
+	}
+
+	if rt.Scheduler != nil {
+		for _, processor := range rt.Scheduler.Processors() {
+			for _, event := range processor.Pendings() {
+				add(&event, "pending")
+			}
+
+			if !rt.Ctx.IsCenter {
+				for _, event := range processor.Fires() {
+					add(&event, "firing")
+				}
+			}
+		}
+	}
+
+	if rt.Ctx.IsCenter {
+		var bgids, dsIds []int64
+		for id := range f.bgids {
+			bgids = append(bgids, id)
+		}
+		for id := range f.dsIds {
+			dsIds = append(dsIds, id)
+		}
+
+		events, err := models.AlertCurEventsGet(rt.Ctx, nil, bgids, 0, 0, nil, dsIds, nil, 0, "", -1, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range events {
+			add(&events[i], "firing")
+		}
+	}
+
+	return alerts, nil
+}
+
+func toPromAlert(event *models.AlertCurEvent, state string) promAlert {
+	labels := make(map[string]string, len(event.TagsMap)+2)
+	for k, v := range event.TagsMap {
+		labels[k] = v
+	}
+
+	if _, has := labels["alertname"]; !has {
+		labels["alertname"] = event.RuleName
+	}
+	labels["severity"] = strconv.Itoa(event.Severity)
+
+	annotations := event.AnnotationsJSON
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	activeAt := event.FirstTriggerTime
+	if activeAt == 0 {
+		activeAt = event.TriggerTime
+	}
+
+	return promAlert{
+		Labels:      labels,
+		Annotations: annotations,
+		State:       state,
+		ActiveAt:    time.Unix(activeAt, 0).UTC(),
+		Value:       event.TriggerValue,
+	}
+}
+
+// ruleQuery returns the promql of the rule, or the queries in json for the other datasources
+func ruleQuery(rule *models.AlertRule) string {
+	var config struct {
+		Queries []json.RawMessage `json:"queries"`
+	}
+	if err := json.Unmarshal([]byte(rule.RuleConfig), &config); err != nil || len(config.Queries) == 0 {
+		return rule.PromQl
+	}
+
+	queries := make([]string, 0, len(config.Queries))
+	for _, raw := range config.Queries {
+		var q struct {
+			PromQl string `json:"prom_ql"`
+		}
+		if json.Unmarshal(raw, &q) == nil && q.PromQl != "" {
+			queries = append(queries, q.PromQl)
+		} else {
+			queries = append(queries, string(raw))
+		}
+	}
+	return strings.Join(queries, "\n")
+}
+
+func ruleLabels(rule *models.AlertRule) map[string]string {
+	labels := make(map[string]string, len(rule.AppendTagsJSON)+1)
+	for _, tag := range rule.AppendTagsJSON {
+		arr := strings.SplitN(tag, "=", 2)
+		if len(arr) == 2 {
+			labels[arr[0]] = arr[1]
+		}
+	}
+	labels["rule_id"] = strconv.FormatInt(rule.Id, 10)
+	return labels
+}
+
+func ruleAnnotations(rule *models.AlertRule) map[string]string {
+	annotations := make(map[string]string, len(rule.AnnotationsJSON)+2)
+	for k, v := range rule.AnnotationsJSON {
+		annotations[k] = v
+	}
+
+	if rule.Note != "" {
+		annotations["description"] = rule.Note
+	}
+
+	if rule.RunbookUrl != "" {
+		annotations["runbook_url"] = rule.RunbookUrl
+	}
+	return annotations
+}
+
+// ruleHealth merges the evaluations of the rule on its datasources, the rule is unhealthy when one of them failed
+func ruleHealth(r *promRule, states []astats.RuleEvalState) {
+	r.Health = "unknown"
+	var last int64
+	for _, state := range states {
+		if state.Error != "" {
+			r.Health = "err"
+			r.LastError = fmt.Sprintf("datasource %d: %s", state.DatasourceId, state.Error)
+		} else if r.Health == "unknown" {
+			r.Health = "ok"
+		}
+
+		if d := float64(state.Duration) / 1000; d > r.EvaluationTime {
+			r.EvaluationTime = d
+		}
+
+		if state.LastEval > last {
+			last = state.LastEval
+		}
+	}
+
+	if last > 0 {
+		r.LastEvaluation = time.UnixMilli(last).UTC()
+	}
+}
+
+func (rt *Router) promRules(c *gin.Context) {
+	f := newPromAlertsFilter(c)
+
+	// n9e has no recording rules in the rules api
+	if typ := c.Query("type"); typ != "" && typ != "alert" {
+		c.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"groups": []promRuleGroup{}}})
+		return
+	}
+
+	alerts, err := rt.ruleAlerts(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "errorType": "internal", "error": err.Error()})
+		return
+	}
+
+	states := make(map[int64][]astats.RuleEvalState)
+	if rt.Scheduler != nil {
+		for _, processor := range rt.Scheduler.Processors() {
+			if state, has := rt.AlertStats.RuleEvals.Get(processor.Key()); has {
+				states[state.RuleId] = append(states[state.RuleId], state)
+			}
+		}
+	}
+
+	groups := make(map[int64]*promRuleGroup)
+	for _, id := range rt.AlertRuleCache.GetRuleIds() {
+		rule := rt.AlertRuleCache.Get(id)
+		if rule == nil {
+			continue
+		}
+
+		var dsIds []int64
+		if rt.Scheduler != nil {
+			dsIds = rt.Scheduler.RuleDatasourceIds(rule)
+		}
+
+		if !f.matchRule(rule, dsIds) {
+			continue
+		}
+
+		r := promRule{
+			State:       "inactive",
+			Name:        rule.Name,
+			Query:       ruleQuery(rule),
+			Duration:    float64(rule.PromForDuration),
+			Labels:      ruleLabels(rule),
+			Annotations: ruleAnnotations(rule),
+			Alerts:      alerts[rule.Id],
+			Type:        "alerting",
+		}
+
+		if r.Alerts == nil {
+			r.Alerts = []promAlert{}
+		}
+
+		for _, alert := range r.Alerts {
+			if alert.State == "firing" {
+				r.State = "firing"
+				break
+			}
+			r.State = "pending"
+		}
+
+		ruleHealth(&r, states[rule.Id])
+
+		group, has := groups[rule.GroupId]
+		if !has {
+			name := rt.BusiGroupCache.GetNameByBusiGroupId(rule.GroupId)
+			if name == "" {
+				name = strconv.FormatInt(rule.GroupId, 10)
+			}
+			group = &promRuleGroup{Name: name, File: name, Rules: []promRule{}}
+			groups[rule.GroupId] = group
+		}
+
+		group.Rules = append(group.Rules, r)
+		if interval := float64(rule.PromEvalInterval); interval > 0 && (group.Interval == 0 || interval < group.Interval) {
+			group.Interval = interval
+		}
+
+		group.EvaluationTime += r.EvaluationTime
+		if r.LastEvaluation.After(group.LastEvaluation) {
+			group.LastEvaluation = r.LastEvaluation
+		}
+	}
+
+	lst := make([]promRuleGroup, 0, len(groups))
+	for _, group := range groups {
+		sort.Slice(group.Rules, func(i, j int) bool {
+			return group.Rules[i].Name < group.Rules[j].Name
+		})
+		lst = append(lst, *group)
+	}
+
+	sort.Slice(lst, func(i, j int) bool {
+		return lst[i].Name < lst[j].Name
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"groups": lst}})
+}
+
+func (rt *Router) promAlerts(c *gin.Context) {
+	alerts, err := rt.ruleAlerts(newPromAlertsFilter(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"status": "error", "errorType": "internal", "error": err.Error()})
+		return
+	}
+
+	lst := make([]promAlert, 0)
+	for _, ruleAlerts := range alerts {
+		lst = append(lst, ruleAlerts...)
+	}
+
+	sort.Slice(lst, func(i, j int) bool {
+		return lst[i].ActiveAt.After(lst[j].ActiveAt)
+	})
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "data": gin.H{"alerts": lst}})
+}
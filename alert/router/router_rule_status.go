@@ -0,0 +1,62 @@
+package router
+
+import (
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+)
+
+// alertRuleEvalStatus returns the evaluation status of the rule on the datasources this engine evaluates,
+// center aggregates the statuses of all the engines
+func (rt *Router) alertRuleEvalStatus(c *gin.Context) {
+	ginx.NewRender(c).Data(rt.EvalStatus(ginx.UrlParamInt64(c, "arid")), nil)
+}
+
+// EvalStatus returns the evaluation status of the rule on the datasources this engine evaluates, center
+// gets the status of the engine in its own process with it
+func (rt *Router) EvalStatus(arid int64) []models.AlertRuleEvalStatus {
+	lst := make([]models.AlertRuleEvalStatus, 0)
+	if rt.Scheduler == nil {
+		return lst
+	}
+
+	for _, processor := range rt.Scheduler.Processors() {
+		if processor.Rule().Id != arid {
+			continue
+		}
+
+		status := models.AlertRuleEvalStatus{
+			Instance:     rt.Alert.Heartbeat.Endpoint,
+			EngineName:   rt.Alert.Heartbeat.EngineName,
+			RuleId:       arid,
+			DatasourceId: processor.DatasourceId(),
+			FiringCount:  len(processor.Fires()),
+			Suppressed:   processor.Suppressed(),
+			Pendings:     make([]models.PendingSeries, 0),
+		}
+
+		if state, has := rt.AlertStats.RuleEvals.Get(processor.Key()); has {
+			status.LastEval = state.LastEval
+			status.Duration = state.Duration
+			status.LastError = state.Error
+			status.SeriesCount = state.SeriesCount
+			status.SkippedBy = state.SkippedBy
+		}
+
+		for _, event := range processor.Pendings() {
+			status.Pendings = append(status.Pendings, models.PendingSeries{
+				Hash:          event.Hash,
+				Tags:          event.TagsJSON,
+				TriggerValue:  event.TriggerValue,
+				FirstEvalTime: event.FirstEvalTime,
+				LastEvalTime:  event.LastEvalTime,
+				ForRemaining:  processor.ForRemaining(&event),
+			})
+		}
+
+		lst = append(lst, status)
+	}
+
+	return lst
+}
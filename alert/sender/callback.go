@@ -142,10 +142,32 @@ func doSendAndRecord(ctx *ctx.Context, url, token string, body interface{}, chan
 }
 
 func NotifyRecord(ctx *ctx.Context, evts []*models.AlertCurEvent, notifyRuleID int64, channel, target, res string, err error) {
+	NotifyRecordWithOutbox(ctx, evts, notifyRuleID, 0, channel, target, res, err)
+}
+
+// NotifyRecordWithOutbox records an attempt of a send kept in the notify outbox, the outbox row is
+// marked done or scheduled for the next retry according to the result
+func NotifyRecordWithOutbox(ctx *ctx.Context, evts []*models.AlertCurEvent, notifyRuleID, outboxId int64, channel, target, res string, err error) {
+	outboxDone(ctx, outboxId, err)
+	notifyRecord(ctx, evts, notifyRuleID, outboxId, channel, target, res, err)
+}
+
+// outboxDone marks the outbox row done or schedules its next retry, an attempt is applied once however many
+// targets it has
+func outboxDone(ctx *ctx.Context, outboxId int64, err error) {
+	if outboxId > 0 && ctx.IsCenter {
+		if e := models.NotifyOutboxDone(ctx, outboxId, err); e != nil {
+			logger.Errorf("failed to update notify outbox:%d err:%v", outboxId, e)
+		}
+	}
+}
+
+func notifyRecord(ctx *ctx.Context, evts []*models.AlertCurEvent, notifyRuleID, outboxId int64, channel, target, res string, err error) {
 	// 一个通知可能对应多个 event，都需要记录
 	notis := make([]*models.NotificaitonRecord, 0, len(evts))
 	for _, evt := range evts {
 		noti := models.NewNotificationRecord(evt, notifyRuleID, channel, target)
+		noti.OutboxId = outboxId
 		if err != nil {
 			noti.SetStatus(models.NotiStatusFailure)
 			noti.SetDetails(err.Error())
@@ -25,8 +25,9 @@ type EmailSender struct {
 }
 
 type EmailContext struct {
-	events []*models.AlertCurEvent
-	mail   *gomail.Message
+	events   []*models.AlertCurEvent
+	mail     *gomail.Message
+	outboxId int64
 }
 
 func (es *EmailSender) Send(ctx MessageContext) {
@@ -42,7 +43,15 @@ func (es *EmailSender) Send(ctx MessageContext) {
 		subject = ctx.Events[0].RuleName
 	}
 	content := BuildTplMessage(models.Email, es.contentTpl, ctx.Events)
-	es.WriteEmail(subject, content, tos, ctx.Events)
+
+	var outboxId int64
+	if ctx.Outbox != nil {
+		o := models.NewLegacyNotifyOutbox(ctx.Events, models.Email, models.NotifyRetryConfig{})
+		o.TplContent = map[string]interface{}{"subject": subject, "content": content}
+		o.Sendtos = tos
+		outboxId = ctx.Outbox(o)
+	}
+	es.WriteEmail(subject, content, tos, ctx.Events, outboxId)
 
 	ctx.Stats.AlertNotifyTotal.WithLabelValues(models.Email).Add(float64(len(tos)))
 }
@@ -79,7 +88,7 @@ func SendEmail(subject, content string, tos []string, stmp aconf.SMTPConfig) err
 	return nil
 }
 
-func (es *EmailSender) WriteEmail(subject, content string, tos []string, events []*models.AlertCurEvent) {
+func (es *EmailSender) WriteEmail(subject, content string, tos []string, events []*models.AlertCurEvent, outboxId int64) {
 	m := gomail.NewMessage()
 
 	m.SetHeader("From", es.smtp.From)
@@ -87,7 +96,7 @@ func (es *EmailSender) WriteEmail(subject, content string, tos []string, events
 	m.SetHeader("Subject", subject)
 	m.SetBody("text/html", content)
 
-	mailch <- &EmailContext{events, m}
+	mailch <- &EmailContext{events, m, outboxId}
 }
 
 func dialSmtp(d *gomail.Dialer) gomail.SendCloser {
@@ -200,12 +209,13 @@ func startEmailSender(ctx *ctx.Context, smtp aconf.SMTPConfig) {
 					m.mail.GetHeader("Subject"), m.mail.GetHeader("To"))
 			}
 
+			outboxDone(ctx, m.outboxId, err)
 			for _, to := range m.mail.GetHeader("To") {
 				msg := ""
 				if err == nil {
 					msg = "ok"
 				}
-				NotifyRecord(ctx, m.events, 0, models.Email, to, msg, err)
+				notifyRecord(ctx, m.events, 0, m.outboxId, models.Email, to, msg, err)
 			}
 
 			size++
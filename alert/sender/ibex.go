@@ -86,30 +86,31 @@ func (c *IbexCallBacker) handleIbex(ctx *ctx.Context, url string, event *models.
 		return
 	}
 
-	CallIbex(ctx, id, host, c.taskTplCache, c.targetCache, c.userCache, event)
+	Healer.Heal(ctx, models.Tpl{TplId: id}, host, event, c.taskTplCache, c.targetCache, c.userCache)
 }
 
+// CallIbex creates the task of the template on the host for the event, it returns the id of the task, 0 if failed
 func CallIbex(ctx *ctx.Context, id int64, host string,
 	taskTplCache *memsto.TaskTplCache, targetCache *memsto.TargetCacheType,
-	userCache *memsto.UserCacheType, event *models.AlertCurEvent) {
+	userCache *memsto.UserCacheType, event *models.AlertCurEvent) int64 {
 	logger.Infof("event_callback_ibex: id: %d, host: %s, event: %+v", id, host, event)
 
 	tpl := taskTplCache.Get(id)
 	if tpl == nil {
 		logger.Errorf("event_callback_ibex: no such tpl(%d), event: %+v", id, event)
-		return
+		return 0
 	}
 	// check perm
 	// tpl.GroupId - host - account 三元组校验权限
 	can, err := canDoIbex(tpl.UpdateBy, tpl, host, targetCache, userCache)
 	if err != nil {
 		logger.Errorf("event_callback_ibex: check perm fail: %v, event: %+v", err, event)
-		return
+		return 0
 	}
 
 	if !can {
 		logger.Errorf("event_callback_ibex: user(%s) no permission, event: %+v", tpl.UpdateBy, event)
-		return
+		return 0
 	}
 
 	tagsMap := make(map[string]string)
@@ -134,7 +135,7 @@ func CallIbex(ctx *ctx.Context, id int64, host string,
 	tags, err := json.Marshal(tagsMap)
 	if err != nil {
 		logger.Errorf("event_callback_ibex: failed to marshal tags to json: %v, event: %+v", tagsMap, event)
-		return
+		return 0
 	}
 
 	// call ibex
@@ -157,7 +158,7 @@ func CallIbex(ctx *ctx.Context, id int64, host string,
 	id, err = TaskAdd(in, tpl.UpdateBy, ctx.IsCenter)
 	if err != nil {
 		logger.Errorf("event_callback_ibex: call ibex fail: %v, event: %+v", err, event)
-		return
+		return 0
 	}
 
 	// write db
@@ -180,6 +181,8 @@ func CallIbex(ctx *ctx.Context, id int64, host string,
 	if err = record.Add(ctx); err != nil {
 		logger.Errorf("event_callback_ibex: persist task_record fail: %v, event: %+v", err, event)
 	}
+
+	return id
 }
 
 func canDoIbex(username string, tpl *models.TaskTpl, host string, targetCache *memsto.TargetCacheType, userCache *memsto.UserCacheType) (bool, error) {
@@ -0,0 +1,520 @@
+package sender
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/memsto"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+	"github.com/ccfos/nightingale/v6/pkg/poster"
+	imodels "github.com/flashcatcloud/ibex/src/models"
+	"github.com/flashcatcloud/ibex/src/storage"
+
+	"github.com/pkg/errors"
+	"github.com/toolkits/pkg/logger"
+)
+
+const (
+	ibexChannel = "ibex"
+
+	// the approval link of the tasks of an event, in the annotations of the event
+	IbexApprovalAnnotation = "ibex_approval"
+
+	// the page of the web site approving the task with the token
+	ibexApprovalRoute = "/job-task-approval/"
+
+	// the pending approvals are taken over again after a restart, until the rules of their events are
+	// evaluated by the engine, which takes a while after the start
+	ibexReloadPeriod = 600
+
+	// the results are given up after the timeout of the task plus the grace
+	ibexResultGrace = 600
+	ibexStdoutTail  = 1024
+)
+
+// the statuses of a task on a host which are not done yet
+var ibexDoingStatus = map[string]struct{}{
+	"waiting": {},
+	"running": {},
+	"killing": {},
+}
+
+// IbexHealer runs the self-healing tasks of the events with the policies of their templates, and feeds the
+// results of the tasks back to the events. Each event is handled by the engine evaluating its rule, and the
+// runs are counted from the database, so the limits hold across restarts, reshards and engines. The tasks are
+// skipped when the runs can not be counted, e.g. the edge engines cut off from the center.
+type IbexHealer struct {
+	// ResolveEvent recovers the event when its task succeeds, see Tpl.AutoResolve
+	ResolveEvent func(event *models.AlertCurEvent)
+
+	// FiringEvent returns the firing event of a rule evaluated by this engine, nil if there is none. The
+	// pending approvals of the events are taken over with it after a restart.
+	FiringEvent func(ruleId int64, hash string) *models.AlertCurEvent
+
+	// SiteUrl returns the url of the web site the approval links point to, see memsto.SiteInfo
+	SiteUrl func() string
+
+	// countRuns and addRun count and save the runs of the templates on the hosts, see models.TaskHealRun
+	countRuns func(ctx *ctx.Context, tplId int64, host string, since int64) (int64, error)
+	addRun    func(ctx *ctx.Context, run *models.TaskHealRun) error
+	runsLock  sync.Mutex // counts and saves a run at once on this engine
+
+	sync.Mutex
+	approvals map[int64]*ibexJob    // key: approval id
+	starting  map[*ibexJob]struct{} // the jobs asking for approvals or creating the tasks
+	doing     map[int64]*ibexJob    // key: task id
+}
+
+var Healer = NewIbexHealer()
+
+type ibexJob struct {
+	tpl      models.Tpl
+	host     string
+	event    *models.AlertCurEvent
+	expireAt int64 // of the approval
+	taskId   int64
+	startAt  int64
+	timeout  int64
+
+	taskTplCache *memsto.TaskTplCache
+	targetCache  *memsto.TargetCacheType
+	userCache    *memsto.UserCacheType
+}
+
+func (j *ibexJob) same(other *ibexJob) bool {
+	return j.tpl.TplId == other.tpl.TplId && j.host == other.host && j.event.Hash == other.event.Hash
+}
+
+func NewIbexHealer() *IbexHealer {
+	return &IbexHealer{
+		countRuns: models.TaskHealRunCount,
+		addRun:    func(ctx *ctx.Context, run *models.TaskHealRun) error { return run.Add(ctx) },
+		approvals: make(map[int64]*ibexJob),
+		starting:  make(map[*ibexJob]struct{}),
+		doing:     make(map[int64]*ibexJob),
+	}
+}
+
+// Heal runs the task of the template on the host for the event, or asks for an approval first. It returns
+// the approval link of the task if it is waiting for an approval.
+func (h *IbexHealer) Heal(ctx *ctx.Context, tpl models.Tpl, host string, event *models.AlertCurEvent,
+	taskTplCache *memsto.TaskTplCache, targetCache *memsto.TargetCacheType, userCache *memsto.UserCacheType) string {
+	job := &ibexJob{
+		tpl:          tpl,
+		host:         host,
+		event:        event.DeepCopy(),
+		taskTplCache: taskTplCache,
+		targetCache:  targetCache,
+		userCache:    userCache,
+	}
+
+	// the slot is taken before starting, or the event notified again in the meantime is not seen in progress
+	h.Lock()
+	if tpl.SkipInProgress && h.inProgress(job) {
+		h.Unlock()
+		logger.Infof("event_callback_ibex: tpl(%d) is in progress on host(%s), skip, event: %+v", tpl.TplId, host, event)
+		return ""
+	}
+	h.starting[job] = struct{}{}
+	h.Unlock()
+
+	if !tpl.Approval {
+		go h.start(ctx, job)
+		return ""
+	}
+
+	if err := h.checkRuns(ctx, job, false); err != nil {
+		h.release(job)
+		logger.Warningf("event_callback_ibex: %v, event: %+v", err, event)
+		NotifyRecord(ctx, []*models.AlertCurEvent{job.event}, 0, ibexChannel, host, "", err)
+		return ""
+	}
+
+	return h.askApproval(ctx, job)
+}
+
+// release frees the slot of the job which is neither waiting for an approval nor running
+func (h *IbexHealer) release(job *ibexJob) {
+	h.Lock()
+	delete(h.starting, job)
+	h.Unlock()
+}
+
+// Cancel forgets the tasks of the event waiting for approvals, e.g. the event is recovered
+func (h *IbexHealer) Cancel(hash string) {
+	h.Lock()
+	defer h.Unlock()
+
+	for id, job := range h.approvals {
+		if job.event.Hash == hash {
+			delete(h.approvals, id)
+		}
+	}
+}
+
+func (h *IbexHealer) inProgress(job *ibexJob) bool {
+	for _, j := range h.approvals {
+		if j.same(job) {
+			return true
+		}
+	}
+
+	for j := range h.starting {
+		if j.same(job) {
+			return true
+		}
+	}
+
+	for _, j := range h.doing {
+		if j.same(job) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkRuns checks the runs of the template on the host in the window, and takes one if record is true
+func (h *IbexHealer) checkRuns(ctx *ctx.Context, job *ibexJob, record bool) error {
+	h.runsLock.Lock()
+	defer h.runsLock.Unlock()
+
+	window := job.tpl.GetRunsWindow()
+	now := time.Now().Unix()
+
+	if job.tpl.MaxRuns > 0 {
+		count, err := h.countRuns(ctx, job.tpl.TplId, job.host, now-window)
+		if err != nil {
+			return fmt.Errorf("failed to count the runs of tpl(%d) on host(%s), skip: %v", job.tpl.TplId, job.host, err)
+		}
+
+		if count >= int64(job.tpl.MaxRuns) {
+			return fmt.Errorf("tpl(%d) has run %d times on host(%s) in %ds, skip", job.tpl.TplId, count, job.host, window)
+		}
+	}
+
+	if !record {
+		return nil
+	}
+
+	run := &models.TaskHealRun{
+		TplId:     job.tpl.TplId,
+		Host:      job.host,
+		RuleId:    job.event.RuleId,
+		EventHash: job.event.Hash,
+		Window:    window,
+		CreateAt:  now,
+	}
+	if err := h.addRun(ctx, run); err != nil {
+		return fmt.Errorf("failed to save the run of tpl(%d) on host(%s), skip: %v", job.tpl.TplId, job.host, err)
+	}
+	return nil
+}
+
+func (h *IbexHealer) askApproval(ctx *ctx.Context, job *ibexJob) string {
+	tt := job.taskTplCache.Get(job.tpl.TplId)
+	if tt == nil {
+		h.release(job)
+		logger.Errorf("event_callback_ibex: no such tpl(%d), event: %+v", job.tpl.TplId, job.event)
+		return ""
+	}
+
+	now := time.Now().Unix()
+	approval := &models.TaskApproval{
+		GroupId:   tt.GroupId,
+		RuleId:    job.event.RuleId,
+		RuleName:  job.event.RuleName,
+		EventId:   job.event.Id,
+		EventHash: job.event.Hash,
+		TplId:     tt.Id,
+		Title:     tt.Title + " FH: " + job.host,
+		Host:      job.host,
+		ExpireAt:  now + job.tpl.GetApprovalTimeout(),
+		CreateAt:  now,
+	}
+
+	if err := approval.Add(ctx); err != nil {
+		h.release(job)
+		logger.Errorf("event_callback_ibex: failed to add approval: %v, event: %+v", err, job.event)
+		NotifyRecord(ctx, []*models.AlertCurEvent{job.event}, 0, ibexChannel, job.host, "", errors.WithMessage(err, "failed to add approval"))
+		return ""
+	}
+
+	job.expireAt = approval.ExpireAt
+
+	h.Lock()
+	delete(h.starting, job)
+	h.approvals[approval.Id] = job
+	h.Unlock()
+
+	logger.Infof("event_callback_ibex: tpl(%d) on host(%s) is waiting for approval(%d), event: %+v", job.tpl.TplId, job.host, approval.Id, job.event)
+	return h.approvalLink(approval.Token)
+}
+
+// approvalLink is the link of the approval page on the web site, the notifications go out of the site
+// so the link is relative only if the url of the site is not configured
+func (h *IbexHealer) approvalLink(token string) string {
+	var site string
+	if h.SiteUrl != nil {
+		site = strings.TrimRight(h.SiteUrl(), "/")
+	}
+
+	if site == "" {
+		logger.Warning("event_callback_ibex: site_url of site_info is not configured, the approval link is relative")
+	}
+	return site + ibexApprovalRoute + token
+}
+
+func (h *IbexHealer) start(ctx *ctx.Context, job *ibexJob) {
+	if err := h.checkRuns(ctx, job, true); err != nil {
+		h.release(job)
+		logger.Warningf("event_callback_ibex: %v, event: %+v", err, job.event)
+		NotifyRecord(ctx, []*models.AlertCurEvent{job.event}, 0, ibexChannel, job.host, "", err)
+		return
+	}
+
+	taskId := CallIbex(ctx, job.tpl.TplId, job.host, job.taskTplCache, job.targetCache, job.userCache, job.event)
+	if taskId <= 0 {
+		h.release(job)
+		return
+	}
+
+	job.taskId = taskId
+	job.startAt = time.Now().Unix()
+	if tt := job.taskTplCache.Get(job.tpl.TplId); tt != nil {
+		job.timeout = int64(tt.Timeout)
+	}
+
+	h.Lock()
+	delete(h.starting, job)
+	h.doing[taskId] = job
+	h.Unlock()
+}
+
+func (h *IbexHealer) LoopCheck(ctx *ctx.Context, taskTplCache *memsto.TaskTplCache, targetCache *memsto.TargetCacheType, userCache *memsto.UserCacheType) {
+	duration := time.Duration(10) * time.Second
+	begin := time.Now().Unix()
+	for {
+		time.Sleep(duration)
+		if time.Now().Unix()-begin < ibexReloadPeriod {
+			h.reloadApprovals(ctx, taskTplCache, targetCache, userCache)
+		}
+		h.checkApprovals(ctx)
+		h.checkTasks(ctx)
+	}
+}
+
+// reloadApprovals takes over the pending approvals of the firing events of this engine, which are lost
+// from the memory with a restart
+func (h *IbexHealer) reloadApprovals(ctx *ctx.Context, taskTplCache *memsto.TaskTplCache, targetCache *memsto.TargetCacheType, userCache *memsto.UserCacheType) {
+	if h.FiringEvent == nil {
+		return
+	}
+
+	lst, err := models.TaskApprovalGetsPending(ctx)
+	if err != nil {
+		logger.Warningf("event_callback_ibex: failed to get pending approvals: %v", err)
+		return
+	}
+
+	for _, approval := range lst {
+		h.Lock()
+		_, has := h.approvals[approval.Id]
+		h.Unlock()
+		if has {
+			continue
+		}
+
+		event := h.FiringEvent(approval.RuleId, approval.EventHash)
+		if event == nil {
+			continue
+		}
+
+		if event.Id == 0 {
+			event.Id = approval.EventId
+		}
+
+		tpl, found := ibexEventTpl(event, approval.TplId)
+		if !found {
+			continue
+		}
+
+		h.Lock()
+		h.approvals[approval.Id] = &ibexJob{
+			tpl:          tpl,
+			host:         approval.Host,
+			event:        event,
+			expireAt:     approval.ExpireAt,
+			taskTplCache: taskTplCache,
+			targetCache:  targetCache,
+			userCache:    userCache,
+		}
+		h.Unlock()
+		logger.Infof("event_callback_ibex: approval(%d) of tpl(%d) on host(%s) is reloaded, event: %+v", approval.Id, tpl.TplId, approval.Host, event)
+	}
+}
+
+// ibexEventTpl finds the policies of the template in the rule config of the event
+func ibexEventTpl(event *models.AlertCurEvent, tplId int64) (models.Tpl, bool) {
+	var ruleConfig struct {
+		TaskTpls []*models.Tpl `json:"task_tpls"`
+	}
+	json.Unmarshal([]byte(event.RuleConfig), &ruleConfig)
+
+	for _, t := range ruleConfig.TaskTpls {
+		if t != nil && t.TplId == tplId {
+			return *t, true
+		}
+	}
+	return models.Tpl{}, false
+}
+
+func (h *IbexHealer) checkApprovals(ctx *ctx.Context) {
+	now := time.Now().Unix()
+
+	h.Lock()
+	ids := make([]int64, 0, len(h.approvals))
+	for id, job := range h.approvals {
+		if now > job.expireAt {
+			delete(h.approvals, id)
+			logger.Infof("event_callback_ibex: approval(%d) is expired, event: %+v", id, job.event)
+			continue
+		}
+		ids = append(ids, id)
+	}
+	h.Unlock()
+
+	if len(ids) == 0 {
+		return
+	}
+
+	lst, err := models.TaskApprovalGetsByIds(ctx, ids)
+	if err != nil {
+		logger.Warningf("event_callback_ibex: failed to get approvals: %v", err)
+		return
+	}
+
+	for _, approval := range lst {
+		if approval.Status == models.TaskApprovalPending {
+			continue
+		}
+
+		h.Lock()
+		job, has := h.approvals[approval.Id]
+		delete(h.approvals, approval.Id)
+		if has && approval.Status == models.TaskApprovalApproved {
+			h.starting[job] = struct{}{}
+		}
+		h.Unlock()
+
+		if !has {
+			continue
+		}
+
+		if approval.Status == models.TaskApprovalApproved {
+			logger.Infof("event_callback_ibex: approval(%d) is approved by %s, event: %+v", approval.Id, approval.HandleBy, job.event)
+			h.start(ctx, job)
+			continue
+		}
+
+		NotifyRecord(ctx, []*models.AlertCurEvent{job.event}, 0, ibexChannel, job.host, "",
+			fmt.Errorf("approval(%d) is %s by %s", approval.Id, approval.Status, approval.HandleBy))
+	}
+}
+
+func (h *IbexHealer) checkTasks(ctx *ctx.Context) {
+	h.Lock()
+	jobs := make([]*ibexJob, 0, len(h.doing))
+	for _, job := range h.doing {
+		jobs = append(jobs, job)
+	}
+	h.Unlock()
+
+	now := time.Now().Unix()
+	for _, job := range jobs {
+		expired := now-job.startAt > job.timeout+ibexResultGrace
+
+		// the tasks created while the edge is cut off from the center never report the results to the center
+		if job.taskId >= storage.IDINITIAL {
+			if expired {
+				h.finish(ctx, job, "unknown", "")
+			}
+			continue
+		}
+
+		th, err := TaskHostResult(ctx, job.taskId, job.host)
+		if err != nil {
+			logger.Warningf("event_callback_ibex: failed to get result of task(%d) host(%s): %v", job.taskId, job.host, err)
+		}
+
+		if th == nil {
+			if expired {
+				h.finish(ctx, job, "unknown", "")
+			}
+			continue
+		}
+
+		if _, doing := ibexDoingStatus[th.Status]; doing {
+			if expired {
+				h.finish(ctx, job, th.Status, th.Stdout)
+			}
+			continue
+		}
+
+		h.finish(ctx, job, th.Status, th.Stdout)
+	}
+}
+
+// finish attaches the result of the task to the annotations and the notification records of the event
+func (h *IbexHealer) finish(ctx *ctx.Context, job *ibexJob, status, stdout string) {
+	h.Lock()
+	delete(h.doing, job.taskId)
+	h.Unlock()
+
+	result := fmt.Sprintf("task:%d host:%s status:%s", job.taskId, job.host, status)
+	if tail := stdoutTail(stdout, ibexStdoutTail); tail != "" {
+		result += " stdout:" + tail
+	}
+
+	annotations := map[string]string{fmt.Sprintf("ibex_task_%d", job.taskId): result}
+	if err := models.EventAnnotationsMerge(ctx, job.event.Id, annotations); err != nil {
+		logger.Warningf("event_callback_ibex: failed to update annotations of event(%d): %v", job.event.Id, err)
+	}
+
+	if status != "success" {
+		NotifyRecord(ctx, []*models.AlertCurEvent{job.event}, 0, ibexChannel, job.host, "", errors.New(result))
+		return
+	}
+
+	NotifyRecord(ctx, []*models.AlertCurEvent{job.event}, 0, ibexChannel, job.host, result, nil)
+
+	if job.tpl.AutoResolve && h.ResolveEvent != nil {
+		logger.Infof("event_callback_ibex: task(%d) succeeded, resolve event: %+v", job.taskId, job.event)
+		h.ResolveEvent(job.event)
+	}
+}
+
+func stdoutTail(stdout string, size int) string {
+	stdout = strings.TrimSpace(stdout)
+	if len(stdout) > size {
+		stdout = strings.ToValidUTF8(stdout[len(stdout)-size:], "")
+	}
+	return stdout
+}
+
+// TaskHostResult gets the result of the task on the host, the edge engines get it through the center
+func TaskHostResult(ctx *ctx.Context, id int64, host string) (*imodels.TaskHost, error) {
+	if !ctx.IsCenter {
+		return poster.GetByUrls[*imodels.TaskHost](ctx, fmt.Sprintf("/v1/n9e/task-host-result?id=%d&host=%s", id, url.QueryEscape(host)))
+	}
+
+	if imodels.DB() == nil {
+		return nil, errors.New("ibex is not enabled")
+	}
+
+	return imodels.TaskHostGet(id, host)
+}
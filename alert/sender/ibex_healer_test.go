@@ -0,0 +1,139 @@
+package sender
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+)
+
+// fakeHealRuns keeps the runs in memory in place of the database
+type fakeHealRuns struct {
+	runs []*models.TaskHealRun
+	err  error
+}
+
+func (f *fakeHealRuns) count(_ *ctx.Context, tplId int64, host string, since int64) (int64, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+
+	var count int64
+	for _, r := range f.runs {
+		if r.TplId == tplId && r.Host == host && r.CreateAt > since {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (f *fakeHealRuns) add(_ *ctx.Context, run *models.TaskHealRun) error {
+	f.runs = append(f.runs, run)
+	return nil
+}
+
+func TestIbexHealerCheckRuns(t *testing.T) {
+	runs := &fakeHealRuns{}
+	h := NewIbexHealer()
+	h.countRuns, h.addRun = runs.count, runs.add
+
+	job := &ibexJob{
+		tpl:   models.Tpl{TplId: 1, MaxRuns: 2},
+		host:  "db01",
+		event: &models.AlertCurEvent{Hash: "h1"},
+	}
+
+	for i := 0; i < 2; i++ {
+		if err := h.checkRuns(nil, job, true); err != nil {
+			t.Fatalf("run %d: %v", i, err)
+		}
+	}
+
+	// a restarted engine, or another one, sees the same runs
+	other := NewIbexHealer()
+	other.countRuns, other.addRun = runs.count, runs.add
+	if err := other.checkRuns(nil, job, true); err == nil {
+		t.Fatal("expected the third run in the window to be skipped")
+	}
+
+	if err := h.checkRuns(nil, &ibexJob{tpl: job.tpl, host: "db02", event: job.event}, false); err != nil {
+		t.Fatalf("the limit is per host: %v", err)
+	}
+
+	for _, r := range runs.runs {
+		r.CreateAt = 1
+	}
+	if err := h.checkRuns(nil, job, false); err != nil {
+		t.Fatalf("runs out of the window should not count: %v", err)
+	}
+
+	runs.err = errors.New("center unreachable")
+	if err := h.checkRuns(nil, job, true); err == nil {
+		t.Fatal("expected the run to be skipped when the runs can not be counted")
+	}
+}
+
+func TestIbexHealerInProgress(t *testing.T) {
+	h := NewIbexHealer()
+	job := &ibexJob{tpl: models.Tpl{TplId: 1}, host: "db01", event: &models.AlertCurEvent{Hash: "h1"}}
+	h.doing[100] = job
+
+	if !h.inProgress(&ibexJob{tpl: models.Tpl{TplId: 1}, host: "db01", event: &models.AlertCurEvent{Hash: "h1"}}) {
+		t.Error("expected the task of the same event to be in progress")
+	}
+
+	if h.inProgress(&ibexJob{tpl: models.Tpl{TplId: 1}, host: "db01", event: &models.AlertCurEvent{Hash: "h2"}}) {
+		t.Error("the task of another event should not be in progress")
+	}
+
+	// the job is in progress from the moment it is taken, before it gets a task or an approval
+	starting := &ibexJob{tpl: models.Tpl{TplId: 3}, host: "db01", event: &models.AlertCurEvent{Hash: "h3"}}
+	h.starting[starting] = struct{}{}
+	if !h.inProgress(&ibexJob{tpl: models.Tpl{TplId: 3}, host: "db01", event: &models.AlertCurEvent{Hash: "h3"}}) {
+		t.Error("expected the starting task of the same event to be in progress")
+	}
+
+	h.release(starting)
+	if h.inProgress(starting) {
+		t.Error("the released task should not be in progress")
+	}
+
+	h.approvals[1] = &ibexJob{tpl: models.Tpl{TplId: 2}, host: "db01", event: &models.AlertCurEvent{Hash: "h2"}}
+	h.Cancel("h2")
+	if len(h.approvals) != 0 {
+		t.Error("expected the approvals of the event to be canceled")
+	}
+}
+
+func TestIbexApprovalLink(t *testing.T) {
+	h := NewIbexHealer()
+	h.SiteUrl = func() string { return "https://n9e.example.com/" }
+	if got := h.approvalLink("abc"); got != "https://n9e.example.com/job-task-approval/abc" {
+		t.Errorf("approvalLink() = %q", got)
+	}
+}
+
+func TestIbexEventTpl(t *testing.T) {
+	event := &models.AlertCurEvent{RuleConfig: `{"task_tpls":[{"tpl_id":1},{"tpl_id":2,"approval":true,"max_runs":3}]}`}
+	tpl, found := ibexEventTpl(event, 2)
+	if !found || !tpl.Approval || tpl.MaxRuns != 3 {
+		t.Errorf("ibexEventTpl() = %+v, %v", tpl, found)
+	}
+
+	if _, found := ibexEventTpl(event, 3); found {
+		t.Error("expected tpl 3 not to be found")
+	}
+}
+
+func TestStdoutTail(t *testing.T) {
+	if got := stdoutTail("  ok\n", 10); got != "ok" {
+		t.Errorf("stdoutTail() = %q", got)
+	}
+
+	long := strings.Repeat("a", 20) + "tail"
+	if got := stdoutTail(long, 4); got != "tail" {
+		t.Errorf("stdoutTail() = %q", got)
+	}
+}
@@ -24,7 +24,11 @@ type (
 		Events []*models.AlertCurEvent
 		Stats  *astats.Stats
 		Ctx    *ctx.Context
+		Outbox OutboxFunc // nil if the sends are not persisted
 	}
+
+	// OutboxFunc persists a send before it is tried and returns the id of the outbox row, 0 if it is not persisted
+	OutboxFunc func(o *models.NotifyOutbox) int64
 )
 
 func NewSender(key string, tpls map[string]*template.Template, smtp ...aconf.SMTPConfig) Sender {
@@ -95,15 +95,57 @@ func sendWebhook(webhook *models.Webhook, event interface{}, stats *astats.Stats
 	return false, string(body), nil
 }
 
-func SingleSendWebhooks(ctx *ctx.Context, webhooks map[string]*models.Webhook, event *models.AlertCurEvent, stats *astats.Stats) {
+// SendWebhookNow makes one attempt of the legacy webhook, the events are sent as a list if batch is set
+func SendWebhookNow(webhook *models.Webhook, events []*models.AlertCurEvent, batch bool, stats *astats.Stats) (string, error) {
+	if webhook.Client == nil {
+		webhook.Client = &http.Client{
+			Timeout: time.Duration(webhook.Timeout) * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: webhook.SkipVerify},
+			},
+		}
+	}
+
+	var body interface{} = events
+	if !batch && len(events) > 0 {
+		body = events[0]
+	}
+
+	_, res, err := sendWebhook(webhook, body, stats)
+	return res, err
+}
+
+// webhookOutbox persists the send of the events to the legacy webhook, the single sends are tried 3 times a
+// minute apart like before, the batch sends with the retry settings of the webhook
+func webhookOutbox(outbox OutboxFunc, events []*models.AlertCurEvent, webhook *models.Webhook, batch bool) int64 {
+	if outbox == nil {
+		return 0
+	}
+
+	retry := models.NotifyRetryConfig{MaxAttempts: 3, Interval: 60}
+	if batch {
+		retry = models.NotifyRetryConfig{MaxAttempts: webhook.RetryCount, Interval: int64(webhook.RetryInterval)}
+	}
+
+	o := models.NewLegacyNotifyOutbox(events, "webhook", retry)
+	o.Webhook = webhook
+	o.WebhookBatch = batch
+	return outbox(o)
+}
+
+func SingleSendWebhooks(ctx *ctx.Context, webhooks map[string]*models.Webhook, event *models.AlertCurEvent, stats *astats.Stats, outbox OutboxFunc) {
 	for _, conf := range webhooks {
+		events := []*models.AlertCurEvent{event}
+		outboxId := webhookOutbox(outbox, events, conf, false)
+
 		retryCount := 0
 		for retryCount < 3 {
 			start := time.Now()
 			needRetry, res, err := sendWebhook(conf, event, stats)
 			res = fmt.Sprintf("duration: %d ms %s", time.Since(start).Milliseconds(), res)
-			NotifyRecord(ctx, []*models.AlertCurEvent{event}, 0, "webhook", conf.Url, res, err)
-			if !needRetry {
+			NotifyRecordWithOutbox(ctx, events, 0, outboxId, "webhook", conf.Url, res, err)
+			// the persisted sends are retried by the outbox
+			if !needRetry || outboxId > 0 {
 				break
 			}
 			retryCount++
@@ -112,10 +154,14 @@ func SingleSendWebhooks(ctx *ctx.Context, webhooks map[string]*models.Webhook, e
 	}
 }
 
-func BatchSendWebhooks(ctx *ctx.Context, webhooks map[string]*models.Webhook, event *models.AlertCurEvent, stats *astats.Stats) {
+func BatchSendWebhooks(ctx *ctx.Context, webhooks map[string]*models.Webhook, event *models.AlertCurEvent, stats *astats.Stats, outbox OutboxFunc) {
 	for _, conf := range webhooks {
 		logger.Infof("push event:%+v to queue:%v", event, conf)
-		PushEvent(ctx, conf, event, stats)
+
+		// each queue holds a copy of the event carrying its own outbox row
+		queued := *event
+		queued.OutboxId = webhookOutbox(outbox, []*models.AlertCurEvent{event}, conf, true)
+		PushEvent(ctx, conf, &queued, stats)
 	}
 }
 
@@ -149,6 +195,7 @@ func PushEvent(ctx *ctx.Context, webhook *models.Webhook, event *models.AlertCur
 		StartConsumer(ctx, queue, webhook.Batch, webhook, stats)
 	}
 
+	// the persisted events dropped here are sent by the outbox once their lease expires
 	succ := queue.eventQueue.Push(event)
 	if !succ {
 		stats.AlertNotifyErrorTotal.WithLabelValues("push_event_queue").Inc()
@@ -169,13 +216,21 @@ func StartConsumer(ctx *ctx.Context, queue *WebhookQueue, popSize int, webhook *
 				continue
 			}
 
+			// the persisted events are retried by the outbox
+			persisted := true
+			for _, event := range events {
+				if event.OutboxId == 0 {
+					persisted = false
+				}
+			}
+
 			retryCount := 0
 			for retryCount < webhook.RetryCount {
 				start := time.Now()
 				needRetry, res, err := sendWebhook(webhook, events, stats)
 				res = fmt.Sprintf("duration: %d ms %s", time.Since(start).Milliseconds(), res)
-				go NotifyRecord(ctx, events, 0, "webhook", webhook.Url, res, err)
-				if !needRetry {
+				go recordWebhookBatch(ctx, events, webhook.Url, res, err)
+				if !needRetry || persisted {
 					break
 				}
 				retryCount++
@@ -184,3 +239,10 @@ func StartConsumer(ctx *ctx.Context, queue *WebhookQueue, popSize int, webhook *
 		}
 	}
 }
+
+// recordWebhookBatch records the attempt of the batch for each event with its outbox row
+func recordWebhookBatch(ctx *ctx.Context, events []*models.AlertCurEvent, url, res string, err error) {
+	for _, event := range events {
+		NotifyRecordWithOutbox(ctx, []*models.AlertCurEvent{event}, 0, event.OutboxId, "webhook", url, res, err)
+	}
+}
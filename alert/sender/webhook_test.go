@@ -0,0 +1,70 @@
+package sender
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/alert/astats"
+	"github.com/ccfos/nightingale/v6/models"
+)
+
+func TestWebhookOutbox(t *testing.T) {
+	webhook := &models.Webhook{Url: "http://127.0.0.1/hook", RetryCount: 4, RetryInterval: 5}
+	events := []*models.AlertCurEvent{{Id: 7, Hash: "h1"}}
+
+	if id := webhookOutbox(nil, events, webhook, false); id != 0 {
+		t.Fatalf("expected the send not to be persisted without outbox, got %d", id)
+	}
+
+	var saved *models.NotifyOutbox
+	outbox := func(o *models.NotifyOutbox) int64 {
+		saved = o
+		return 1
+	}
+
+	if id := webhookOutbox(outbox, events, webhook, true); id != 1 {
+		t.Fatalf("expected the outbox id, got %d", id)
+	}
+	if !saved.Legacy() || saved.Webhook != webhook || !saved.WebhookBatch || saved.EventId != 7 {
+		t.Fatalf("unexpected outbox: %+v", saved)
+	}
+	if saved.Retry.MaxAttempts != 4 || saved.Retry.Interval != 5 {
+		t.Errorf("expected the retry settings of the webhook, got %+v", saved.Retry)
+	}
+
+	webhookOutbox(outbox, events, webhook, false)
+	if saved.Retry.MaxAttempts != 3 || saved.Retry.Interval != 60 {
+		t.Errorf("expected the retry settings of the single sends, got %+v", saved.Retry)
+	}
+}
+
+func TestSendWebhookNow(t *testing.T) {
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	stats := astats.NewSyncStats()
+	webhook := &models.Webhook{Url: srv.URL, Enable: true, Timeout: 3}
+	events := []*models.AlertCurEvent{{Hash: "h1"}}
+
+	if _, err := SendWebhookNow(webhook, events, true, stats); err != nil {
+		t.Fatal(err)
+	}
+	var lst []models.AlertCurEvent
+	if err := json.Unmarshal(body, &lst); err != nil || len(lst) != 1 {
+		t.Errorf("expected a list of the events, got %s", body)
+	}
+
+	if _, err := SendWebhookNow(webhook, events, false, stats); err != nil {
+		t.Fatal(err)
+	}
+	var event models.AlertCurEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.Hash != "h1" {
+		t.Errorf("expected the event, got %s", body)
+	}
+}
@@ -0,0 +1,134 @@
+package sink
+
+import (
+	"encoding/binary"
+	"sort"
+
+	"github.com/ccfos/nightingale/v6/models"
+)
+
+// EventSchema is the avro schema of the events in parsing canonical form, keep the
+// order of the fields the same as appendEvent
+const EventSchema = `{"name":"n9e.AlertEvent","type":"record","fields":[` +
+	`{"name":"id","type":"long"},` +
+	`{"name":"cate","type":"string"},` +
+	`{"name":"cluster","type":"string"},` +
+	`{"name":"datasource_id","type":"long"},` +
+	`{"name":"group_id","type":"long"},` +
+	`{"name":"group_name","type":"string"},` +
+	`{"name":"hash","type":"string"},` +
+	`{"name":"rule_id","type":"long"},` +
+	`{"name":"rule_name","type":"string"},` +
+	`{"name":"rule_prod","type":"string"},` +
+	`{"name":"severity","type":"int"},` +
+	`{"name":"prom_ql","type":"string"},` +
+	`{"name":"target_ident","type":"string"},` +
+	`{"name":"trigger_time","type":"long"},` +
+	`{"name":"trigger_value","type":"string"},` +
+	`{"name":"first_trigger_time","type":"long"},` +
+	`{"name":"last_eval_time","type":"long"},` +
+	`{"name":"is_recovered","type":"boolean"},` +
+	`{"name":"flapping","type":"int"},` +
+	`{"name":"notify_cur_number","type":"int"},` +
+	`{"name":"tags","type":{"type":"map","values":"string"}},` +
+	`{"name":"annotations","type":{"type":"map","values":"string"}}]}`
+
+const avroFingerprintEmpty = 0xc15d213aa4d7a795
+
+var (
+	avroFingerprintTable [256]uint64
+	// EventSchemaFingerprint is the CRC-64-AVRO fingerprint of EventSchema
+	EventSchemaFingerprint uint64
+)
+
+func init() {
+	for i := range avroFingerprintTable {
+		fp := uint64(i)
+		for j := 0; j < 8; j++ {
+			fp = (fp >> 1) ^ (avroFingerprintEmpty & -(fp & 1))
+		}
+		avroFingerprintTable[i] = fp
+	}
+
+	EventSchemaFingerprint = avroFingerprint([]byte(EventSchema))
+}
+
+func avroFingerprint(buf []byte) uint64 {
+	fp := uint64(avroFingerprintEmpty)
+	for _, b := range buf {
+		fp = (fp >> 8) ^ avroFingerprintTable[byte(fp)^b]
+	}
+	return fp
+}
+
+// EncodeAvro encodes the event in the avro single object encoding, the consumers find
+// the schema with the fingerprint following the 2 bytes marker
+func EncodeAvro(event *models.AlertCurEvent) []byte {
+	buf := make([]byte, 0, 1024)
+	buf = append(buf, 0xc3, 0x01)
+	buf = binary.LittleEndian.AppendUint64(buf, EventSchemaFingerprint)
+	return appendEvent(buf, event)
+}
+
+func appendEvent(buf []byte, e *models.AlertCurEvent) []byte {
+	buf = appendLong(buf, e.Id)
+	buf = appendString(buf, e.Cate)
+	buf = appendString(buf, e.Cluster)
+	buf = appendLong(buf, e.DatasourceId)
+	buf = appendLong(buf, e.GroupId)
+	buf = appendString(buf, e.GroupName)
+	buf = appendString(buf, e.Hash)
+	buf = appendLong(buf, e.RuleId)
+	buf = appendString(buf, e.RuleName)
+	buf = appendString(buf, e.RuleProd)
+	buf = appendLong(buf, int64(e.Severity))
+	buf = appendString(buf, e.PromQl)
+	buf = appendString(buf, e.TargetIdent)
+	buf = appendLong(buf, e.TriggerTime)
+	buf = appendString(buf, e.TriggerValue)
+	buf = appendLong(buf, e.FirstTriggerTime)
+	buf = appendLong(buf, e.LastEvalTime)
+	buf = appendBool(buf, e.IsRecovered)
+	buf = appendLong(buf, int64(e.Flapping))
+	buf = appendLong(buf, int64(e.NotifyCurNumber))
+	buf = appendMap(buf, e.TagsMap)
+	buf = appendMap(buf, e.AnnotationsJSON)
+	return buf
+}
+
+// appendLong appends int and long in zigzag varint
+func appendLong(buf []byte, n int64) []byte {
+	return binary.AppendVarint(buf, n)
+}
+
+func appendBool(buf []byte, b bool) []byte {
+	if b {
+		return append(buf, 1)
+	}
+	return append(buf, 0)
+}
+
+func appendString(buf []byte, s string) []byte {
+	buf = appendLong(buf, int64(len(s)))
+	return append(buf, s...)
+}
+
+// appendMap appends the map in one block sorted by the keys
+func appendMap(buf []byte, m map[string]string) []byte {
+	if len(m) == 0 {
+		return appendLong(buf, 0)
+	}
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	buf = appendLong(buf, int64(len(keys)))
+	for _, k := range keys {
+		buf = appendString(buf, k)
+		buf = appendString(buf, m[k])
+	}
+	return appendLong(buf, 0)
+}
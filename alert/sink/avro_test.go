@@ -0,0 +1,76 @@
+package sink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/models"
+)
+
+func TestAvroFingerprint(t *testing.T) {
+	// test vectors of the avro specification
+	cases := map[string]uint64{
+		`"null"`: 7195948357588979594,
+		`"int"`:  8247732601305521295,
+	}
+
+	for schema, want := range cases {
+		if got := avroFingerprint([]byte(schema)); got != want {
+			t.Errorf("fingerprint of %s = %d, want %d", schema, got, want)
+		}
+	}
+}
+
+func TestEncodeAvro(t *testing.T) {
+	event := &models.AlertCurEvent{
+		Id:              1,
+		RuleId:          -1,
+		Hash:            "abc",
+		IsRecovered:     true,
+		TagsMap:         map[string]string{"b": "2", "a": "1"},
+		AnnotationsJSON: map[string]string{},
+	}
+
+	buf := EncodeAvro(event)
+	if !bytes.HasPrefix(buf, []byte{0xc3, 0x01}) {
+		t.Fatalf("marker not found: %x", buf[:2])
+	}
+
+	if fp := binary.LittleEndian.Uint64(buf[2:10]); fp != EventSchemaFingerprint {
+		t.Fatalf("fingerprint = %d, want %d", fp, EventSchemaFingerprint)
+	}
+
+	var want []byte
+	want = append(want, 0x02)                                                   // id
+	want = append(want, 0x00, 0x00)                                             // cate cluster
+	want = append(want, 0x00, 0x00)                                             // datasource_id group_id
+	want = append(want, 0x00)                                                   // group_name
+	want = append(want, 0x06, 'a', 'b', 'c')                                    // hash
+	want = append(want, 0x01)                                                   // rule_id
+	want = append(want, 0x00, 0x00, 0x00, 0x00, 0x00)                           // rule_name rule_prod severity prom_ql target_ident
+	want = append(want, 0x00, 0x00, 0x00, 0x00)                                 // trigger_time trigger_value first_trigger_time last_eval_time
+	want = append(want, 0x01)                                                   // is_recovered
+	want = append(want, 0x00, 0x00)                                             // flapping notify_cur_number
+	want = append(want, 0x04, 0x02, 'a', 0x02, '1', 0x02, 'b', 0x02, '2', 0x00) // tags
+	want = append(want, 0x00)                                                   // annotations
+
+	if got := buf[10:]; !bytes.Equal(got, want) {
+		t.Fatalf("body = %x, want %x", got, want)
+	}
+}
+
+func TestEventKey(t *testing.T) {
+	event := &models.AlertCurEvent{RuleId: 12, GroupId: 3, Hash: "abc"}
+	cases := map[string]string{
+		"rule_id":    "12",
+		"busi_group": "3",
+		"hash":       "abc",
+	}
+
+	for key, want := range cases {
+		if got := eventKey(key, event); got != want {
+			t.Errorf("key of %s = %s, want %s", key, got, want)
+		}
+	}
+}
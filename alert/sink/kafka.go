@@ -0,0 +1,189 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/alert/aconf"
+	"github.com/ccfos/nightingale/v6/alert/astats"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pushgw/kafka"
+
+	"github.com/IBM/sarama"
+	"github.com/toolkits/pkg/logger"
+)
+
+const (
+	connectRetryMin = time.Second
+	connectRetryMax = time.Minute
+)
+
+// KafkaSink publishes the fired and recovered events to kafka. Unlike the callbacks it
+// is not bound to the rules, every event of the engine is published once, after the
+// pipelines of its notify rules. The events are dropped when kafka can not keep up and
+// the queue is full, the alert engine is never blocked by kafka.
+type KafkaSink struct {
+	cfg      aconf.KafkaSink
+	stats    *astats.Stats
+	producer kafka.Producer
+	queue    chan *sarama.ProducerMessage
+}
+
+// NewKafkaSink returns nil when the sink is disabled or misconfigured, the producer is
+// connected in LoopSend, so kafka being unreachable at startup does not disable the sink
+func NewKafkaSink(cfg aconf.KafkaSink, stats *astats.Stats) *KafkaSink {
+	if !cfg.Enable {
+		return nil
+	}
+
+	if err := verify(cfg); err != nil {
+		logger.Errorf("kafka sink config invalid: %v", err)
+		return nil
+	}
+
+	stats.GaugeEventSinkDisconnected.Set(1)
+	return &KafkaSink{
+		cfg:   cfg,
+		stats: stats,
+		queue: make(chan *sarama.ProducerMessage, cfg.QueueSize),
+	}
+}
+
+// connect retries until the producer is connected to kafka, the events published in the
+// meantime wait in the queue
+func (s *KafkaSink) connect() {
+	retry := connectRetryMin
+	for {
+		// the deliveries are counted from the acks of kafka, not from the hand-offs to the producer
+		config := kafka.NewConfig(s.cfg.Version, s.cfg.Timeout, s.cfg.SASL)
+		producer, err := kafka.NewWithAck(s.cfg.Typ, s.cfg.Brokers, config, s.ack)
+		if err == nil {
+			s.producer = producer
+			s.stats.GaugeEventSinkDisconnected.Set(0)
+			return
+		}
+
+		logger.Errorf("kafka sink: failed to connect to kafka, retry in %s, brokers: %v, err: %v", retry, s.cfg.Brokers, err)
+		time.Sleep(retry)
+		if retry *= 2; retry > connectRetryMax {
+			retry = connectRetryMax
+		}
+	}
+}
+
+func verify(cfg aconf.KafkaSink) error {
+	if len(cfg.Brokers) == 0 {
+		return fmt.Errorf("brokers is blank")
+	}
+
+	switch cfg.Typ {
+	case kafka.AsyncProducer, kafka.SyncProducer:
+	default:
+		return fmt.Errorf("unknown producer type: %s", cfg.Typ)
+	}
+
+	switch cfg.Key {
+	case "rule_id", "hash", "busi_group":
+	default:
+		return fmt.Errorf("unknown key: %s", cfg.Key)
+	}
+
+	switch cfg.Encoding {
+	case "json", "avro":
+	default:
+		return fmt.Errorf("unknown encoding: %s", cfg.Encoding)
+	}
+
+	return nil
+}
+
+// Publish encodes the event and puts it into the queue, it is safe to call on a nil sink
+func (s *KafkaSink) Publish(event *models.AlertCurEvent) {
+	if s == nil {
+		return
+	}
+
+	msg, err := s.message(event)
+	if err != nil {
+		s.stats.CounterEventSinkTotal.WithLabelValues("encode_error").Inc()
+		logger.Errorf("kafka sink: failed to encode event:%+v err:%v", event, err)
+		return
+	}
+
+	select {
+	case s.queue <- msg:
+	default:
+		s.stats.CounterEventSinkTotal.WithLabelValues("dropped").Inc()
+		logger.Warningf("kafka sink: queue is full, event dropped, rule_id:%d hash:%s", event.RuleId, event.Hash)
+	}
+}
+
+func (s *KafkaSink) message(event *models.AlertCurEvent) (*sarama.ProducerMessage, error) {
+	var value []byte
+	if s.cfg.Encoding == "avro" {
+		value = EncodeAvro(event)
+	} else {
+		var err error
+		value, err = json.Marshal(event)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &sarama.ProducerMessage{
+		Topic: s.cfg.Topic,
+		Key:   sarama.StringEncoder(eventKey(s.cfg.Key, event)),
+		Value: sarama.ByteEncoder(value),
+		Headers: []sarama.RecordHeader{
+			{Key: []byte("encoding"), Value: []byte(s.cfg.Encoding)},
+		},
+	}, nil
+}
+
+// eventKey keeps the events of the same key in order in one partition
+func eventKey(key string, event *models.AlertCurEvent) string {
+	switch key {
+	case "rule_id":
+		return strconv.FormatInt(event.RuleId, 10)
+	case "busi_group":
+		return strconv.FormatInt(event.GroupId, 10)
+	default:
+		return event.Hash
+	}
+}
+
+func (s *KafkaSink) LoopSend() {
+	if s == nil {
+		return
+	}
+
+	s.connect()
+
+	for msg := range s.queue {
+		// the errors are reported by the acks
+		s.producer.Send(msg)
+	}
+}
+
+func (s *KafkaSink) ack(msg *sarama.ProducerMessage, err error) {
+	if err == nil {
+		s.stats.CounterEventSinkTotal.WithLabelValues("sent").Inc()
+		return
+	}
+
+	s.stats.CounterEventSinkTotal.WithLabelValues("error").Inc()
+	logger.Warningf("kafka sink: send to kafka got error: %v, brokers: %v, topic: %s", err, s.cfg.Brokers, s.cfg.Topic)
+}
+
+func (s *KafkaSink) ReportQueueSize() {
+	if s == nil {
+		return
+	}
+
+	for {
+		time.Sleep(time.Second)
+		s.stats.GaugeEventSinkQueueSize.Set(float64(len(s.queue)))
+	}
+}
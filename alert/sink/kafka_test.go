@@ -0,0 +1,68 @@
+package sink
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/alert/aconf"
+	"github.com/ccfos/nightingale/v6/alert/astats"
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sinkTotal gathers the number of the events of the status from the registry
+func sinkTotal(t *testing.T, reg *prometheus.Registry, status string) float64 {
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() == "status" && l.GetValue() == status {
+					return m.GetCounter().GetValue()
+				}
+			}
+		}
+	}
+	return 0
+}
+
+func TestPublishAck(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	stats := &astats.Stats{
+		CounterEventSinkTotal: prometheus.NewCounterVec(prometheus.CounterOpts{Name: "event_sink_total"}, []string{"status"}),
+	}
+	reg.MustRegister(stats.CounterEventSinkTotal)
+	s := &KafkaSink{
+		cfg:   aconf.KafkaSink{Key: "hash", Encoding: "json"},
+		stats: stats,
+		queue: make(chan *sarama.ProducerMessage, 1),
+	}
+	event := &models.AlertCurEvent{RuleId: 1, Hash: "abc"}
+
+	s.Publish(event)
+	s.Publish(event)
+	if len(s.queue) != 1 {
+		t.Fatalf("expected the event to be queued once the queue is full, got %d", len(s.queue))
+	}
+	if got := sinkTotal(t, reg, "dropped"); got != 1 {
+		t.Errorf("dropped = %v, want 1", got)
+	}
+
+	msg := <-s.queue
+	s.ack(msg, nil)
+	s.ack(msg, errors.New("not enough replicas"))
+	if got := sinkTotal(t, reg, "sent"); got != 1 {
+		t.Errorf("sent = %v, want 1", got)
+	}
+	if got := sinkTotal(t, reg, "error"); got != 1 {
+		t.Errorf("error = %v, want 1", got)
+	}
+
+	var nilSink *KafkaSink
+	nilSink.Publish(event)
+}
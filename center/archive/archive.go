@@ -0,0 +1,271 @@
+// Package archive expires the rows of alert_his_event by the retention policies, expired rows are
+// written to gzipped ndjson files partitioned by day before they are deleted, and can be restored later
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/center/cconf"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+type Archiver struct {
+	ctx   *ctx.Context
+	conf  cconf.EventRetention
+	store Store
+}
+
+// NewArchiver returns an archiver, events are deleted without archive if store is nil
+func NewArchiver(ctx *ctx.Context, conf cconf.EventRetention, store Store) *Archiver {
+	return &Archiver{ctx: ctx, conf: conf, store: store}
+}
+
+// condition selects the expired events of a policy
+type condition struct {
+	where string
+	args  []interface{}
+}
+
+func policyMatch(p cconf.RetentionPolicy) (string, []interface{}) {
+	var parts []string
+	var args []interface{}
+	if len(p.GroupIds) > 0 {
+		parts = append(parts, "group_id in ?")
+		args = append(args, p.GroupIds)
+	}
+
+	if len(p.Severities) > 0 {
+		parts = append(parts, "severity in ?")
+		args = append(args, p.Severities)
+	}
+
+	if len(parts) == 0 {
+		return "1 = 1", nil
+	}
+	return strings.Join(parts, " and "), args
+}
+
+// conditions turns the policies into the conditions of the expired events, an event is ruled by the first
+// matching policy so that every policy excludes the events of the policies before it.
+// Events matched by no policy expire after Days, policies without days keep their events.
+func conditions(conf cconf.EventRetention, now int64) []condition {
+	var ret []condition
+	var excludes []string
+	var excludeArgs []interface{}
+
+	add := func(days int, match string, matchArgs []interface{}) {
+		if days <= 0 {
+			return
+		}
+
+		parts := []string{"last_eval_time < ?"}
+		args := []interface{}{now - int64(days)*86400}
+		if match != "" {
+			parts = append(parts, "("+match+")")
+			args = append(args, matchArgs...)
+		}
+
+		parts = append(parts, excludes...)
+		args = append(args, excludeArgs...)
+		ret = append(ret, condition{where: strings.Join(parts, " and "), args: args})
+	}
+
+	for _, p := range conf.Policies {
+		match, matchArgs := policyMatch(p)
+		add(p.Days, match, matchArgs)
+
+		excludes = append(excludes, "not ("+match+")")
+		excludeArgs = append(excludeArgs, matchArgs...)
+	}
+
+	add(conf.Days, "", nil)
+	return ret
+}
+
+// Run archives and deletes all the expired events
+func (a *Archiver) Run() error {
+	start := time.Now()
+	var total int64
+	for _, c := range conditions(a.conf, start.Unix()) {
+		var afterId int64
+		for {
+			n, lastId, err := a.chunk(c, afterId)
+			if err != nil {
+				return err
+			}
+
+			if n == 0 {
+				break
+			}
+
+			total += int64(n)
+			afterId = lastId
+		}
+	}
+
+	logger.Infof("event retention: %d events expired, duration: %v", total, time.Since(start))
+	return nil
+}
+
+// chunk archives up to ChunkSize events after the id, then deletes them in batches
+func (a *Archiver) chunk(c condition, afterId int64) (int, int64, error) {
+	var ids []int64
+	files := make(map[string]*dayFile)
+
+	for len(ids) < a.conf.ChunkSize {
+		lst, err := models.AlertHisEventsAfter(a.ctx, c.where, c.args, afterId, a.conf.BatchSize)
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if len(lst) == 0 {
+			break
+		}
+
+		for _, e := range lst {
+			if a.store != nil {
+				day := time.Unix(e.TriggerTime, 0)
+				key := day.Format("2006-01-02")
+				f, has := files[key]
+				if !has {
+					f = newDayFile(day)
+					files[key] = f
+				}
+
+				if err := f.add(e); err != nil {
+					return 0, 0, err
+				}
+			}
+			ids = append(ids, e.Id)
+		}
+
+		afterId = lst[len(lst)-1].Id
+	}
+
+	if len(ids) == 0 {
+		return 0, 0, nil
+	}
+
+	// the events are deleted only when their archive is written
+	for _, f := range files {
+		name, data, err := f.close()
+		if err != nil {
+			return 0, 0, err
+		}
+
+		if err := a.store.Put(name, data); err != nil {
+			return 0, 0, fmt.Errorf("failed to archive %s: %v", name, err)
+		}
+	}
+
+	for i := 0; i < len(ids); i += a.conf.BatchSize {
+		end := i + a.conf.BatchSize
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		if err := models.AlertHisEventDelByIds(a.ctx, ids[i:end]); err != nil {
+			return 0, 0, err
+		}
+		time.Sleep(time.Duration(a.conf.BatchInterval) * time.Millisecond)
+	}
+
+	return len(ids), afterId, nil
+}
+
+type dayFile struct {
+	day     time.Time
+	firstId int64
+	lastId  int64
+	buf     bytes.Buffer
+	gz      *gzip.Writer
+}
+
+func newDayFile(day time.Time) *dayFile {
+	f := &dayFile{day: day}
+	f.gz = gzip.NewWriter(&f.buf)
+	return f
+}
+
+func (f *dayFile) add(e *models.AlertHisEvent) error {
+	if f.firstId == 0 {
+		f.firstId = e.Id
+	}
+	f.lastId = e.Id
+
+	b, err := json.Marshal(models.NewAlertHisEventArchive(e))
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.gz.Write(b); err != nil {
+		return err
+	}
+	_, err = f.gz.Write([]byte("\n"))
+	return err
+}
+
+func (f *dayFile) close() (string, []byte, error) {
+	if err := f.gz.Close(); err != nil {
+		return "", nil, err
+	}
+	return fileName(f.day, f.firstId, f.lastId), f.buf.Bytes(), nil
+}
+
+// Import restores the events of an archive file, events still in the table are skipped
+func Import(ctx *ctx.Context, r io.Reader, batchSize int) (int64, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return 0, err
+	}
+	defer gz.Close()
+
+	if batchSize <= 0 {
+		batchSize = 500
+	}
+
+	var total int64
+	batch := make([]*models.AlertHisEvent, 0, batchSize)
+	flush := func() error {
+		n, err := models.AlertHisEventsRestore(ctx, batch)
+		total += n
+		batch = batch[:0]
+		return err
+	}
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+
+		var a models.AlertHisEventArchive
+		if err := json.Unmarshal(scanner.Bytes(), &a); err != nil {
+			return total, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		batch = append(batch, a.Event())
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return total, err
+	}
+
+	return total, flush()
+}
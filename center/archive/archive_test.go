@@ -0,0 +1,109 @@
+package archive
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/center/cconf"
+	"github.com/ccfos/nightingale/v6/models"
+)
+
+func TestConditions(t *testing.T) {
+	conf := cconf.EventRetention{
+		Days: 90,
+		Policies: []cconf.RetentionPolicy{
+			{GroupIds: []int64{1}, Days: 7},
+			{Severities: []int{3}},
+		},
+	}
+
+	now := int64(100 * 86400)
+	cs := conditions(conf, now)
+	if len(cs) != 2 {
+		t.Fatalf("expected 2 conditions, got %d", len(cs))
+	}
+
+	if cs[0].where != "last_eval_time < ? and (group_id in ?)" || !reflect.DeepEqual(cs[0].args, []interface{}{now - 7*86400, []int64{1}}) {
+		t.Fatalf("unexpected condition of the first policy: %+v", cs[0])
+	}
+
+	// the policy without days keeps severity 3, the default excludes both policies
+	expected := "last_eval_time < ? and not (group_id in ?) and not (severity in ?)"
+	if cs[1].where != expected || !reflect.DeepEqual(cs[1].args, []interface{}{now - 90*86400, []int64{1}, []int{3}}) {
+		t.Fatalf("unexpected default condition: %+v", cs[1])
+	}
+}
+
+func TestCheckName(t *testing.T) {
+	for _, name := range []string{"2024-01-02/a.ndjson.gz", "a.ndjson.gz"} {
+		if err := checkName(name); err != nil {
+			t.Errorf("%s should be valid: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"", "../a.ndjson.gz", "/etc/a.ndjson.gz", "a/../../b.ndjson.gz", "a.txt", "a//b.ndjson.gz"} {
+		if err := checkName(name); err == nil {
+			t.Errorf("%s should be invalid", name)
+		}
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	store := &localStore{dir: t.TempDir()}
+
+	day := time.Date(2024, 1, 2, 10, 0, 0, 0, time.Local)
+	f := newDayFile(day)
+	event := &models.AlertHisEvent{Id: 3, RuleName: "cpu", Tags: "ident=a,,env=prod", Annotations: `{"summary":"x"}`, TriggerTime: day.Unix()}
+	if err := f.add(event); err != nil {
+		t.Fatal(err)
+	}
+
+	name, data, err := f.close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if name != "2024-01-02/alert_his_event-2024-01-02-3-3.ndjson.gz" {
+		t.Fatalf("unexpected file name %s", name)
+	}
+
+	if err := store.Put(name, data); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := store.List()
+	if err != nil || len(files) != 1 || files[0].Name != name {
+		t.Fatalf("unexpected files %+v, err: %v", files, err)
+	}
+
+	r, err := store.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(gz).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+
+	var a models.AlertHisEventArchive
+	if err := json.Unmarshal(line, &a); err != nil {
+		t.Fatal(err)
+	}
+
+	restored := a.Event()
+	if restored.Id != 3 || restored.RuleName != "cpu" || restored.Tags != event.Tags || restored.Annotations != event.Annotations {
+		t.Fatalf("unexpected restored event %+v", restored)
+	}
+}
@@ -0,0 +1,202 @@
+package archive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/center/cconf"
+	"github.com/ccfos/nightingale/v6/pkg/s3x"
+)
+
+const fileSuffix = ".ndjson.gz"
+
+// File is an archive file, Name is relative to the archive directory or the s3 prefix
+type File struct {
+	Name    string `json:"name"`
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+}
+
+// Store keeps the archive files
+type Store interface {
+	Put(name string, data []byte) error
+	Open(name string) (io.ReadCloser, error)
+	List() ([]File, error)
+}
+
+// NewStore returns the store of the config, nil when no archive is configured
+func NewStore(conf cconf.EventRetention) (Store, error) {
+	if conf.S3.Endpoint != "" {
+		client, err := s3x.New(s3x.Config{
+			Endpoint:  conf.S3.Endpoint,
+			Region:    conf.S3.Region,
+			Bucket:    conf.S3.Bucket,
+			AccessKey: conf.S3.AccessKey,
+			SecretKey: conf.S3.SecretKey,
+			PathStyle: conf.S3.PathStyle,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &s3Store{client: client, prefix: strings.Trim(conf.S3.Prefix, "/")}, nil
+	}
+
+	if conf.ArchiveDir != "" {
+		return &localStore{dir: conf.ArchiveDir}, nil
+	}
+
+	return nil, nil
+}
+
+// checkName rejects names escaping the archive, e.g. ../../etc/passwd
+func checkName(name string) error {
+	if name == "" || !strings.HasSuffix(name, fileSuffix) || path.IsAbs(name) || strings.Contains(name, "\\") {
+		return fmt.Errorf("invalid archive name %s", name)
+	}
+
+	for _, s := range strings.Split(name, "/") {
+		if s == ".." || s == "." || s == "" {
+			return fmt.Errorf("invalid archive name %s", name)
+		}
+	}
+	return nil
+}
+
+type localStore struct {
+	dir string
+}
+
+func (s *localStore) Put(name string, data []byte) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+
+	fp := filepath.Join(s.dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(fp), 0755); err != nil {
+		return err
+	}
+
+	// written to a temporary file and renamed, a crash never leaves a truncated archive
+	tmp := fp + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fp)
+}
+
+func (s *localStore) Open(name string) (io.ReadCloser, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(s.dir, filepath.FromSlash(name)))
+}
+
+func (s *localStore) List() ([]File, error) {
+	var files []File
+	err := filepath.Walk(s.dir, func(fp string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		if info.IsDir() || !strings.HasSuffix(fp, fileSuffix) {
+			return nil
+		}
+
+		rel, err := filepath.Rel(s.dir, fp)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, File{Name: filepath.ToSlash(rel), Size: info.Size(), ModTime: info.ModTime().Unix()})
+		return nil
+	})
+
+	sortFiles(files)
+	return files, err
+}
+
+type s3Store struct {
+	client *s3x.Client
+	prefix string
+}
+
+func (s *s3Store) key(name string) string {
+	if s.prefix == "" {
+		return name
+	}
+	return s.prefix + "/" + name
+}
+
+func (s *s3Store) Put(name string, data []byte) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	return s.client.Put(context.Background(), s.key(name), data, "application/gzip")
+}
+
+func (s *s3Store) Open(name string) (io.ReadCloser, error) {
+	if err := checkName(name); err != nil {
+		return nil, err
+	}
+	return s.client.Get(context.Background(), s.key(name))
+}
+
+func (s *s3Store) List() ([]File, error) {
+	prefix := ""
+	if s.prefix != "" {
+		prefix = s.prefix + "/"
+	}
+
+	objects, err := s.client.List(context.Background(), prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]File, 0, len(objects))
+	for _, o := range objects {
+		if !strings.HasSuffix(o.Key, fileSuffix) {
+			continue
+		}
+		files = append(files, File{Name: strings.TrimPrefix(o.Key, prefix), Size: o.Size, ModTime: o.LastModified.Unix()})
+	}
+
+	sortFiles(files)
+	return files, nil
+}
+
+func sortFiles(files []File) {
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+}
+
+// fileName is day/alert_his_event-day-firstId-lastId.ndjson.gz, ids keep the files of two runs apart
+func fileName(day time.Time, firstId, lastId int64) string {
+	d := day.Format("2006-01-02")
+	return fmt.Sprintf("%s/alert_his_event-%s-%d-%d%s", d, d, firstId, lastId, fileSuffix)
+}
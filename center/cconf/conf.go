@@ -15,6 +15,10 @@ type Center struct {
 	EventHistoryGroupView  bool
 	CleanNotifyRecordDay   int
 	MigrateBusiGroupLabel  bool
+	Scim                   Scim
+	MaxRevisions           int // max revisions kept for each board or alert rule
+	EventRetention         EventRetention
+	QueryCache             QueryCache
 }
 
 type Plugin struct {
@@ -30,6 +34,65 @@ type FlashDuty struct {
 	Timeout time.Duration
 }
 
+// Scim configures the SCIM 2.0 provisioning endpoints under /scim/v2
+type Scim struct {
+	Enable       bool
+	Token        string
+	DefaultRoles []string
+}
+
+// EventRetention expires the rows of alert_his_event, expired rows are archived in gzipped ndjson files
+// partitioned by day, to ArchiveDir or S3, before they are deleted in batches
+type EventRetention struct {
+	Enable        bool
+	CronPattern   string // default: 0 3 * * *
+	Days          int    // retention of the events matched by no policy, 0 keeps them forever
+	Policies      []RetentionPolicy
+	BatchSize     int // rows deleted by one statement, default: 500
+	BatchInterval int // pause between two deletes, unit: ms, default: 100
+	ChunkSize     int // rows archived into one set of files before they are deleted, default: 50000
+	ArchiveDir    string
+	S3            ArchiveS3
+}
+
+// RetentionPolicy applies to the events of the busi groups and severities, empty means any,
+// the first matching policy of an event decides its retention
+type RetentionPolicy struct {
+	GroupIds   []int64
+	Severities []int
+	Days       int
+}
+
+type ArchiveS3 struct {
+	Endpoint  string
+	Region    string
+	Bucket    string
+	Prefix    string
+	AccessKey string
+	SecretKey string
+	PathStyle bool
+}
+
+// QueryCache caches the results of range queries as step aligned extents split by SplitInterval,
+// only the missing tail of a range is sent to the datasource
+type QueryCache struct {
+	Enable        bool
+	Backend       string // redis or memory, default: redis
+	SplitInterval int64  // unit: s, default: 86400
+	MaxFreshness  int64  // points newer than it are not cached, unit: s, default: 600
+	TTL           int64  // unit: s, default: 86400
+	MaxItems      int    // entries kept by the memory backend, default: 10000
+	Datasources   []QueryCacheDatasource
+}
+
+// QueryCacheDatasource overrides the cache settings of a datasource
+type QueryCacheDatasource struct {
+	Id           int64
+	Disable      bool
+	MaxFreshness int64
+	TTL          int64
+}
+
 type AnonymousAccess struct {
 	PromQuerier bool
 	AlertDetail bool
@@ -39,4 +102,48 @@ func (c *Center) PreCheck() {
 	if len(c.Plugins) == 0 {
 		c.Plugins = Plugins
 	}
+
+	if c.MaxRevisions <= 0 {
+		c.MaxRevisions = 50
+	}
+
+	if c.EventRetention.CronPattern == "" {
+		c.EventRetention.CronPattern = "0 3 * * *"
+	}
+
+	if c.EventRetention.BatchSize <= 0 {
+		c.EventRetention.BatchSize = 500
+	}
+
+	if c.EventRetention.BatchInterval <= 0 {
+		c.EventRetention.BatchInterval = 100
+	}
+
+	if c.EventRetention.ChunkSize <= 0 {
+		c.EventRetention.ChunkSize = 50000
+	}
+
+	if c.QueryCache.Backend == "" {
+		c.QueryCache.Backend = "redis"
+	}
+
+	if c.QueryCache.SplitInterval <= 0 {
+		c.QueryCache.SplitInterval = 86400
+	}
+
+	if c.QueryCache.MaxFreshness <= 0 {
+		c.QueryCache.MaxFreshness = 600
+	}
+
+	if c.QueryCache.TTL <= 0 {
+		c.QueryCache.TTL = 86400
+	}
+
+	if c.QueryCache.MaxItems <= 0 {
+		c.QueryCache.MaxItems = 10000
+	}
+
+	if len(c.Scim.DefaultRoles) == 0 {
+		c.Scim.DefaultRoles = []string{"Standard"}
+	}
 }
@@ -160,6 +160,12 @@ ops:
       cname: Mutting Rule - Modify
     - name: /alert-mutes/del
       cname: Mutting Rule - Delete
+    - name: /calendars/add
+      cname: Calendar - Add
+    - name: /calendars/put
+      cname: Calendar - Modify
+    - name: /calendars/del
+      cname: Calendar - Delete
     - name: /alert-subscribes
       cname: Subscribing Rule - View
     - name: /alert-subscribes/add
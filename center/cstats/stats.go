@@ -41,6 +41,28 @@ var (
 		},
 		[]string{"operation", "status"},
 	)
+
+	QueryDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "query_duration_seconds",
+			Help:      "Duration of datasource queries of users in seconds.",
+			Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60},
+		},
+		[]string{"datasource", "cate", "status"},
+	)
+
+	QueryQueueDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: subsystem,
+			Name:      "query_queue_duration_seconds",
+			Help:      "Time datasource queries of users wait for the concurrency limit in seconds.",
+			Buckets:   []float64{.001, .01, .05, .1, .5, 1, 5, 10, 30},
+		},
+		[]string{"datasource"},
+	)
 )
 
 func init() {
@@ -49,6 +71,8 @@ func init() {
 		uptime,
 		RequestDuration,
 		RedisOperationLatency,
+		QueryDuration,
+		QueryQueueDuration,
 	)
 
 	go recordUptime()
@@ -0,0 +1,286 @@
+// Package qcache caches the results of range queries for dashboards. A range is aligned to the step and
+// split by SplitInterval, every split is cached as an extent and only the missing tail of it is queried,
+// points newer than MaxFreshness are never cached because they may still change.
+package qcache
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/center/cconf"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/storage"
+
+	"github.com/prometheus/common/model"
+	"github.com/toolkits/pkg/logger"
+)
+
+// Default is the cache of the center, nil when the cache is disabled
+var Default *Cache
+
+type Cache struct {
+	store Store
+	conf  cconf.QueryCache
+	ds    map[int64]cconf.QueryCacheDatasource
+}
+
+func Init(conf cconf.QueryCache, redis storage.Redis) {
+	if !conf.Enable {
+		return
+	}
+
+	var store Store
+	if conf.Backend == "memory" || redis == nil {
+		store = newMemStore(conf.MaxItems)
+	} else {
+		store = &redisStore{redis: redis}
+	}
+
+	Default = New(conf, store)
+}
+
+func New(conf cconf.QueryCache, store Store) *Cache {
+	c := &Cache{store: store, conf: conf, ds: make(map[int64]cconf.QueryCacheDatasource)}
+	for _, d := range conf.Datasources {
+		c.ds[d.Id] = d
+	}
+	return c
+}
+
+// Fetcher queries the datasource for the points in [start, end], unit: s, points out of the range are dropped
+type Fetcher func(ctx context.Context, start, end int64) ([]models.DataResp, error)
+
+// extent is the cached points of a split in [Start, End]
+type extent struct {
+	Start  int64             `json:"start"`
+	End    int64             `json:"end"`
+	Series []models.DataResp `json:"series"`
+}
+
+func (c *Cache) settings(dsId int64) (enable bool, maxFreshness, ttl int64) {
+	d, has := c.ds[dsId]
+	if has && d.Disable {
+		return false, 0, 0
+	}
+
+	maxFreshness, ttl = c.conf.MaxFreshness, c.conf.TTL
+	if has && d.MaxFreshness > 0 {
+		maxFreshness = d.MaxFreshness
+	}
+
+	if has && d.TTL > 0 {
+		ttl = d.TTL
+	}
+	return true, maxFreshness, ttl
+}
+
+func genKey(dsId int64) string {
+	return fmt.Sprintf("n9e_qcache_gen_%d", dsId)
+}
+
+// generation is part of the keys of a datasource, bumping it invalidates all the extents of the datasource
+func (c *Cache) generation(ctx context.Context, dsId int64) int64 {
+	val, has := c.store.Get(ctx, genKey(dsId))
+	if !has {
+		return 0
+	}
+
+	n, _ := strconv.ParseInt(string(val), 10, 64)
+	return n
+}
+
+// Purge invalidates the cached results of a datasource
+func (c *Cache) Purge(ctx context.Context, dsId int64) error {
+	_, err := c.store.Incr(ctx, genKey(dsId))
+	return err
+}
+
+// QueryRange returns the series of the query in [start, end] with the step, query identifies the request
+// except the range. The cache is skipped if c is nil or the datasource disables it.
+func (c *Cache) QueryRange(ctx context.Context, dsId int64, query string, start, end, step int64, fetch Fetcher) ([]models.DataResp, error) {
+	if c == nil || step <= 0 || end < start {
+		return fetch(ctx, start, end)
+	}
+
+	enable, maxFreshness, ttl := c.settings(dsId)
+	if !enable {
+		return fetch(ctx, start, end)
+	}
+
+	start -= start % step
+	end -= end % step
+
+	// splits start at multiples of the interval, which is a multiple of the step so that they are aligned too
+	interval := c.conf.SplitInterval
+	if interval%step != 0 {
+		interval = (interval/step + 1) * step
+	}
+
+	freshEnd := time.Now().Unix() - maxFreshness
+	freshEnd -= freshEnd % step
+
+	sum := sha1.Sum([]byte(query))
+	prefix := fmt.Sprintf("n9e_qcache_%d_%d_%s_%d", dsId, c.generation(ctx, dsId), hex.EncodeToString(sum[:]), step)
+
+	var parts [][]models.DataResp
+	for splitStart := start - start%interval; splitStart <= end; splitStart += interval {
+		s, e := max(start, splitStart), min(end, splitStart+interval-step)
+		key := fmt.Sprintf("%s_%d", prefix, splitStart)
+		part, err := c.split(ctx, key, s, e, step, freshEnd, time.Duration(ttl)*time.Second, fetch)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+
+	merged := mergeSeries(parts...)
+	ret := merged[:0]
+	for _, s := range merged {
+		if len(s.Values) > 0 {
+			ret = append(ret, s)
+		}
+	}
+	return ret, nil
+}
+
+func (c *Cache) split(ctx context.Context, key string, s, e, step, freshEnd int64, ttl time.Duration, fetch Fetcher) ([]models.DataResp, error) {
+	var cached *extent
+	if val, has := c.store.Get(ctx, key); has {
+		var ext extent
+		if err := json.Unmarshal(val, &ext); err != nil {
+			logger.Warningf("query cache: invalid extent %s: %v", key, err)
+		} else if ext.Start <= s && ext.End >= s {
+			cached = &ext
+		}
+	}
+
+	from := s
+	var data []models.DataResp
+	if cached != nil {
+		data = slice(cached.Series, s, min(e, cached.End))
+		from = cached.End + step
+	}
+
+	if from > e {
+		return data, nil
+	}
+
+	fresh, err := fetch(ctx, from, e)
+	if err != nil {
+		return nil, err
+	}
+	fresh = slice(fresh, from, e)
+
+	cacheEnd := min(e, freshEnd)
+	if cacheEnd >= from {
+		ext := extent{Start: s, End: cacheEnd}
+		if cached != nil {
+			ext.Start = cached.Start
+			ext.Series = mergeSeries(cached.Series, slice(fresh, from, cacheEnd))
+		} else {
+			ext.Series = slice(fresh, s, cacheEnd)
+		}
+
+		if val, err := json.Marshal(ext); err == nil {
+			c.store.Set(ctx, key, val, ttl)
+		}
+	}
+
+	return mergeSeries(data, fresh), nil
+}
+
+// slice returns the points of the series in [start, end], series without points are kept
+// so that an extent remembers the series it has seen
+func slice(series []models.DataResp, start, end int64) []models.DataResp {
+	ret := make([]models.DataResp, 0, len(series))
+	for _, s := range series {
+		item := s
+		item.Values = nil
+		for _, v := range s.Values {
+			if len(v) < 2 {
+				continue
+			}
+
+			if ts := int64(v[0]); ts >= start && ts <= end {
+				item.Values = append(item.Values, v)
+			}
+		}
+		ret = append(ret, item)
+	}
+	return ret
+}
+
+// mergeSeries joins the points of the same series, points at the same timestamp are deduplicated
+func mergeSeries(parts ...[]models.DataResp) []models.DataResp {
+	index := make(map[string]int)
+	var ret []models.DataResp
+	for _, part := range parts {
+		for _, s := range part {
+			key := s.Ref + s.Metric.String()
+			i, has := index[key]
+			if !has {
+				index[key] = len(ret)
+				item := s
+				item.Values = append([][]float64(nil), s.Values...)
+				ret = append(ret, item)
+				continue
+			}
+			ret[i].Values = append(ret[i].Values, s.Values...)
+		}
+	}
+
+	for i := range ret {
+		values := ret[i].Values
+		sort.SliceStable(values, func(a, b int) bool {
+			return values[a][0] < values[b][0]
+		})
+
+		dedup := values[:0]
+		for j, v := range values {
+			if j > 0 && v[0] == values[j-1][0] {
+				continue
+			}
+			dedup = append(dedup, v)
+		}
+		ret[i].Values = dedup
+	}
+	return ret
+}
+
+// MatrixToSeries and SeriesToMatrix convert the results of prometheus
+func MatrixToSeries(m model.Matrix) []models.DataResp {
+	ret := make([]models.DataResp, 0, len(m))
+	for _, s := range m {
+		item := models.DataResp{Metric: s.Metric, Values: make([][]float64, 0, len(s.Values))}
+		for _, p := range s.Values {
+			item.Values = append(item.Values, []float64{float64(p.Timestamp.Unix()), float64(p.Value)})
+		}
+		ret = append(ret, item)
+	}
+	return ret
+}
+
+func SeriesToMatrix(series []models.DataResp) model.Matrix {
+	ret := make(model.Matrix, 0, len(series))
+	for _, s := range series {
+		if len(s.Values) == 0 {
+			continue
+		}
+
+		item := &model.SampleStream{Metric: s.Metric, Values: make([]model.SamplePair, 0, len(s.Values))}
+		for _, v := range s.Values {
+			item.Values = append(item.Values, model.SamplePair{
+				Timestamp: model.TimeFromUnix(int64(v[0])),
+				Value:     model.SampleValue(v[1]),
+			})
+		}
+		ret = append(ret, item)
+	}
+	return ret
+}
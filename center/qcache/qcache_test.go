@@ -0,0 +1,137 @@
+package qcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/center/cconf"
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/prometheus/common/model"
+)
+
+type call struct {
+	start, end int64
+}
+
+// fakeFetcher returns a point per step in the range, plus one after it like elasticsearch does
+func fakeFetcher(step int64, calls *[]call) Fetcher {
+	return func(ctx context.Context, start, end int64) ([]models.DataResp, error) {
+		*calls = append(*calls, call{start, end})
+		s := models.DataResp{Metric: model.Metric{"__name__": "up"}}
+		for ts := start; ts <= end+step; ts += step {
+			s.Values = append(s.Values, []float64{float64(ts), float64(ts)})
+		}
+		return []models.DataResp{s}, nil
+	}
+}
+
+func newTestCache(ds ...cconf.QueryCacheDatasource) *Cache {
+	return New(cconf.QueryCache{SplitInterval: 3600, MaxFreshness: 600, TTL: 3600, Datasources: ds}, newMemStore(100))
+}
+
+func TestQueryRangeTail(t *testing.T) {
+	c := newTestCache()
+	ctx := context.Background()
+	var calls []call
+	fetch := fakeFetcher(60, &calls)
+
+	base := int64(1700000000) - int64(1700000000)%3600
+	ret, err := c.QueryRange(ctx, 1, "up", base, base+1800, 60, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ret) != 1 || len(ret[0].Values) != 31 {
+		t.Fatalf("unexpected result: %+v", ret)
+	}
+
+	// the second query only fetches the tail, and the next split
+	ret, err = c.QueryRange(ctx, 1, "up", base+600, base+3900, 60, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []call{{base, base + 1800}, {base + 1860, base + 3540}, {base + 3600, base + 3900}}
+	if len(calls) != len(expect) {
+		t.Fatalf("expect calls %v, got %v", expect, calls)
+	}
+
+	for i := range expect {
+		if calls[i] != expect[i] {
+			t.Fatalf("expect calls %v, got %v", expect, calls)
+		}
+	}
+
+	values := ret[0].Values
+	if len(values) != 56 || values[0][0] != float64(base+600) || values[len(values)-1][0] != float64(base+3900) {
+		t.Fatalf("unexpected values: %v", values)
+	}
+
+	for i := 1; i < len(values); i++ {
+		if values[i][0]-values[i-1][0] != 60 {
+			t.Fatalf("points are not contiguous: %v", values)
+		}
+	}
+}
+
+func TestQueryRangeFresh(t *testing.T) {
+	c := newTestCache()
+	ctx := context.Background()
+	var calls []call
+	fetch := fakeFetcher(60, &calls)
+
+	now := time.Now().Unix()
+	for i := 0; i < 2; i++ {
+		if _, err := c.QueryRange(ctx, 1, "up", now-300, now, 60, fetch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(calls) < 2 {
+		t.Fatalf("recent points should not be cached, calls: %v", calls)
+	}
+}
+
+func TestQueryRangeInvalidate(t *testing.T) {
+	c := newTestCache(cconf.QueryCacheDatasource{Id: 2, Disable: true})
+	ctx := context.Background()
+	var calls []call
+	fetch := fakeFetcher(60, &calls)
+
+	base := int64(1700000000) - int64(1700000000)%3600
+	for _, dsId := range []int64{1, 1, 2, 2} {
+		if _, err := c.QueryRange(ctx, dsId, "up", base, base+600, 60, fetch); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(calls) != 3 {
+		t.Fatalf("expect 3 calls, got %v", calls)
+	}
+
+	if err := c.Purge(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.QueryRange(ctx, 1, "up", base, base+600, 60, fetch); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 4 {
+		t.Fatalf("purge should invalidate the cache, calls: %v", calls)
+	}
+}
+
+func TestQueryRangeNil(t *testing.T) {
+	var c *Cache
+	var calls []call
+	if _, err := c.QueryRange(context.Background(), 1, "up", 0, 60, 60, fakeFetcher(60, &calls)); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(calls) != 1 {
+		t.Fatalf("nil cache should fetch directly, calls: %v", calls)
+	}
+}
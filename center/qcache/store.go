@@ -0,0 +1,131 @@
+package qcache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/storage"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/toolkits/pkg/logger"
+)
+
+// Store keeps the cached extents, ttl 0 means no expiration
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool)
+	Set(ctx context.Context, key string, val []byte, ttl time.Duration)
+	Incr(ctx context.Context, key string) (int64, error)
+}
+
+type redisStore struct {
+	redis storage.Redis
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, bool) {
+	val, err := s.redis.Get(ctx, key).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			logger.Warningf("query cache: failed to get %s: %v", key, err)
+		}
+		return nil, false
+	}
+	return val, true
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, val []byte, ttl time.Duration) {
+	if err := s.redis.Set(ctx, key, val, ttl).Err(); err != nil {
+		logger.Warningf("query cache: failed to set %s: %v", key, err)
+	}
+}
+
+func (s *redisStore) Incr(ctx context.Context, key string) (int64, error) {
+	return s.redis.Incr(ctx, key).Result()
+}
+
+type memItem struct {
+	val      []byte
+	expireAt time.Time
+}
+
+// memStore is for single node installs, the entries closest to expiration are evicted when it is full
+type memStore struct {
+	sync.Mutex
+	items    map[string]memItem
+	maxItems int
+}
+
+func newMemStore(maxItems int) *memStore {
+	return &memStore{items: make(map[string]memItem), maxItems: maxItems}
+}
+
+func (s *memStore) Get(ctx context.Context, key string) ([]byte, bool) {
+	s.Lock()
+	defer s.Unlock()
+
+	item, has := s.items[key]
+	if !has {
+		return nil, false
+	}
+
+	if !item.expireAt.IsZero() && time.Now().After(item.expireAt) {
+		delete(s.items, key)
+		return nil, false
+	}
+	return item.val, true
+}
+
+func (s *memStore) Set(ctx context.Context, key string, val []byte, ttl time.Duration) {
+	s.Lock()
+	defer s.Unlock()
+
+	if _, has := s.items[key]; !has && len(s.items) >= s.maxItems {
+		s.evict()
+	}
+
+	item := memItem{val: val}
+	if ttl > 0 {
+		item.expireAt = time.Now().Add(ttl)
+	}
+	s.items[key] = item
+}
+
+func (s *memStore) Incr(ctx context.Context, key string) (int64, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	var n int64
+	if item, has := s.items[key]; has {
+		n, _ = strconv.ParseInt(string(item.val), 10, 64)
+	}
+	n++
+	s.items[key] = memItem{val: []byte(strconv.FormatInt(n, 10))}
+	return n, nil
+}
+
+// evict drops the expired entries, or the one expiring first if none expired
+func (s *memStore) evict() {
+	now := time.Now()
+	var victim string
+	var earliest time.Time
+	for k, item := range s.items {
+		if item.expireAt.IsZero() {
+			continue
+		}
+
+		if now.After(item.expireAt) {
+			delete(s.items, k)
+			continue
+		}
+
+		if victim == "" || item.expireAt.Before(earliest) {
+			victim, earliest = k, item.expireAt
+		}
+	}
+
+	if len(s.items) >= s.maxItems && victim != "" {
+		delete(s.items, victim)
+	}
+}
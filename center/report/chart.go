@@ -0,0 +1,193 @@
+package report
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	chartWidth  = 800
+	chartHeight = 300
+
+	marginLeft   = 70
+	marginRight  = 20
+	marginTop    = 30
+	marginBottom = 30
+)
+
+// same colors are used in the html summary so that series can be told apart
+var palette = []string{
+	"#6C53B1", "#73BF69", "#F2495C", "#5794F2", "#FF9830",
+	"#B877D9", "#FADE2A", "#8AB8FF", "#FF7383", "#96D98D",
+}
+
+var (
+	colorText = color.RGBA{R: 0x33, G: 0x33, B: 0x33, A: 0xff}
+	colorGrid = color.RGBA{R: 0xe5, G: 0xe5, B: 0xe5, A: 0xff}
+	colorAxis = color.RGBA{R: 0x99, G: 0x99, B: 0x99, A: 0xff}
+)
+
+func parseHex(s string) color.RGBA {
+	v, _ := strconv.ParseUint(s[1:], 16, 32)
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}
+}
+
+// Chart draws the series of a panel as a line chart, the legend is in the html summary
+func Chart(p *Panel, start, end time.Time) ([]byte, error) {
+	img := image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, s := range p.Series {
+		for _, point := range s.Points {
+			v := float64(point.Value)
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			min = math.Min(min, v)
+			max = math.Max(max, v)
+		}
+	}
+
+	if math.IsInf(min, 1) {
+		min, max = 0, 1
+	}
+
+	if min == max {
+		min, max = min-1, max+1
+	}
+
+	x0, x1 := marginLeft, chartWidth-marginRight
+	y0, y1 := chartHeight-marginBottom, marginTop
+	t0, t1 := start.Unix(), end.Unix()
+	if t1 <= t0 {
+		t1 = t0 + 1
+	}
+
+	toX := func(ts int64) int {
+		return x0 + int(float64(ts-t0)/float64(t1-t0)*float64(x1-x0))
+	}
+	toY := func(v float64) int {
+		return y0 - int((v-min)/(max-min)*float64(y0-y1))
+	}
+
+	// grid and y labels
+	const lines = 4
+	for i := 0; i <= lines; i++ {
+		v := min + (max-min)*float64(i)/lines
+		y := toY(v)
+		hline(img, x0, x1, y, colorGrid)
+		text(img, 4, y+4, formatValue(v), colorText)
+	}
+
+	hline(img, x0, x1, y0, colorAxis)
+	vline(img, x0, y1, y0, colorAxis)
+
+	// x labels: start, middle, end
+	for i := 0; i <= 2; i++ {
+		ts := t0 + (t1-t0)*int64(i)/2
+		label := time.Unix(ts, 0).Format("01-02 15:04")
+		x := toX(ts) - len(label)*7/2
+		if x+len(label)*7 > chartWidth {
+			x = chartWidth - len(label)*7
+		}
+		text(img, x, chartHeight-10, label, colorText)
+	}
+
+	text(img, marginLeft, 18, p.Name, colorText)
+
+	for i, s := range p.Series {
+		c := parseHex(palette[i%len(palette)])
+		prevX, prevY, has := 0, 0, false
+		for _, point := range s.Points {
+			v := float64(point.Value)
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				has = false
+				continue
+			}
+
+			x, y := toX(point.Timestamp.Unix()), toY(v)
+			if has {
+				line(img, prevX, prevY, x, y, c)
+			}
+			prevX, prevY, has = x, y, true
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func hline(img *image.RGBA, x0, x1, y int, c color.Color) {
+	for x := x0; x <= x1; x++ {
+		img.Set(x, y, c)
+	}
+}
+
+func vline(img *image.RGBA, x, y0, y1 int, c color.Color) {
+	for y := y0; y <= y1; y++ {
+		img.Set(x, y, c)
+	}
+}
+
+// line uses bresenham and draws two pixels wide so that lines stay visible after scaling
+func line(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		img.Set(x0, y0+1, c)
+
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func text(img *image.RGBA, x, y int, s string, c color.Color) {
+	d := &font.Drawer{
+		Dst:  img,
+		Src:  image.NewUniform(c),
+		Face: basicfont.Face7x13,
+		Dot:  fixed.P(x, y),
+	}
+	d.DrawString(s)
+}
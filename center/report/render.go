@@ -0,0 +1,176 @@
+package report
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/models"
+)
+
+const timeLayout = "2006-01-02 15:04:05"
+
+type seriesSummary struct {
+	Name  string
+	Color string
+	Min   string
+	Avg   string
+	Max   string
+	Last  string
+}
+
+type panelSummary struct {
+	Name   string
+	Unit   string
+	Error  string
+	Chart  string // cid of the chart
+	Series []seriesSummary
+}
+
+var htmlTpl = template.Must(template.New("report").Parse(`<html><body style="font-family: sans-serif">
+<h2>{{.Name}}</h2>
+<p>Board: {{.Board}}<br/>Time range: {{.Start}} ~ {{.End}}</p>
+{{if .Note}}<p>{{.Note}}</p>{{end}}
+{{range .Panels}}
+<h3>{{.Name}}</h3>
+{{if .Error}}<p style="color: #F2495C">{{.Error}}</p>{{end}}
+{{if .Chart}}<img src="cid:{{.Chart}}"/>{{end}}
+{{if $.Summary}}{{if .Series}}<table border="1" cellspacing="0" cellpadding="4" style="border-collapse: collapse; font-size: 12px">
+<tr><th>Series</th><th>Min</th><th>Avg</th><th>Max</th><th>Last</th></tr>
+{{range .Series}}<tr><td><span style="color: {{.Color}}">&#9632;</span> {{.Name}}</td><td>{{.Min}}</td><td>{{.Avg}}</td><td>{{.Max}}</td><td>{{.Last}}</td></tr>
+{{end}}</table>{{if .Unit}}<p style="font-size: 12px">unit: {{.Unit}}</p>{{end}}{{end}}{{end}}
+{{end}}
+</body></html>`))
+
+func hasFormat(r *models.BoardReport, format string) bool {
+	for _, f := range r.Formats {
+		if f == format {
+			return true
+		}
+	}
+	return false
+}
+
+// Render builds the mail body and attachments: charts are inline images, the csv is a regular attachment
+func Render(ret *Result) (string, string, []*models.ReportAttachment, error) {
+	r := ret.Report
+	withChart := hasFormat(r, models.BoardReportFormatPNG)
+
+	var attachments []*models.ReportAttachment
+	panels := make([]panelSummary, 0, len(ret.Panels))
+	for i, p := range ret.Panels {
+		ps := panelSummary{Name: p.Name, Unit: p.Unit, Error: p.Error}
+
+		for j, s := range p.Series {
+			ps.Series = append(ps.Series, summarize(s, palette[j%len(palette)]))
+		}
+
+		if withChart && len(p.Series) > 0 {
+			b, err := Chart(p, ret.Start, ret.End)
+			if err != nil {
+				return "", "", nil, err
+			}
+
+			name := fmt.Sprintf("panel-%d.png", i+1)
+			ps.Chart = name
+			attachments = append(attachments, &models.ReportAttachment{
+				Name:        name,
+				ContentType: "image/png",
+				Content:     b,
+				Inline:      true,
+			})
+		}
+
+		panels = append(panels, ps)
+	}
+
+	var buf bytes.Buffer
+	err := htmlTpl.Execute(&buf, map[string]interface{}{
+		"Name":    r.Name,
+		"Note":    r.Note,
+		"Board":   ret.Board.Name,
+		"Start":   ret.Start.Format(timeLayout),
+		"End":     ret.End.Format(timeLayout),
+		"Summary": hasFormat(r, models.BoardReportFormatHTML),
+		"Panels":  panels,
+	})
+	if err != nil {
+		return "", "", nil, err
+	}
+
+	if hasFormat(r, models.BoardReportFormatCSV) {
+		b, err := CSV(ret)
+		if err != nil {
+			return "", "", nil, err
+		}
+
+		attachments = append(attachments, &models.ReportAttachment{
+			Name:        fmt.Sprintf("%s-%s.csv", r.Name, ret.End.Format("20060102150405")),
+			ContentType: "text/csv",
+			Content:     b,
+		})
+	}
+
+	subject := fmt.Sprintf("[Report] %s %s", r.Name, ret.End.Format("2006-01-02"))
+	return subject, buf.String(), attachments, nil
+}
+
+func summarize(s *Series, color string) seriesSummary {
+	ss := seriesSummary{Name: s.Name, Color: color, Min: "-", Avg: "-", Max: "-", Last: "-"}
+
+	min, max, sum, cnt := math.Inf(1), math.Inf(-1), 0.0, 0
+	last := math.NaN()
+	for _, p := range s.Points {
+		v := float64(p.Value)
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+
+		min = math.Min(min, v)
+		max = math.Max(max, v)
+		sum += v
+		cnt++
+		last = v
+	}
+
+	if cnt > 0 {
+		ss.Min = formatValue(min)
+		ss.Avg = formatValue(sum / float64(cnt))
+		ss.Max = formatValue(max)
+		ss.Last = formatValue(last)
+	}
+
+	return ss
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+// CSV has one line per point: panel, series, time, value
+func CSV(ret *Result) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+
+	if err := w.Write([]string{"panel", "series", "time", "value"}); err != nil {
+		return nil, err
+	}
+
+	for _, p := range ret.Panels {
+		for _, s := range p.Series {
+			for _, point := range s.Points {
+				t := time.Unix(point.Timestamp.Unix(), 0).Format(timeLayout)
+				if err := w.Write([]string{p.Name, s.Name, t, formatValue(float64(point.Value))}); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
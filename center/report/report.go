@@ -0,0 +1,366 @@
+// Package report renders board snapshots for scheduled reports and delivers them through notify channels.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"github.com/prometheus/common/model"
+)
+
+const defaultPoints = 240
+
+// Querier runs range queries against a prometheus datasource under the datasource grants of the user,
+// it is backed by the logic of /query-range-batch
+type Querier func(username string, datasourceId, start, end, step int64, queries []string) ([]model.Value, error)
+
+type Series struct {
+	Name   string
+	Points []model.SamplePair
+}
+
+type Panel struct {
+	Name   string
+	Type   string
+	Unit   string
+	Series []*Series
+	Error  string
+}
+
+type Result struct {
+	Report *models.BoardReport
+	Board  *models.Board
+	Start  time.Time
+	End    time.Time
+	Step   int64
+	Panels []*Panel
+}
+
+// panelDef is a panel of the board configs with the fields needed to query it
+type panelDef struct {
+	Name            string
+	Type            string
+	DatasourceCate  string
+	DatasourceValue interface{}
+	Unit            string
+	Targets         []struct {
+		Expr   string `json:"expr"`
+		Legend string `json:"legend"`
+		Hide   bool   `json:"hide"`
+	}
+	Panels []*panelDef
+}
+
+func (p *panelDef) UnmarshalJSON(b []byte) error {
+	var raw struct {
+		Name            string      `json:"name"`
+		Type            string      `json:"type"`
+		DatasourceCate  string      `json:"datasourceCate"`
+		DatasourceValue interface{} `json:"datasourceValue"`
+		Options         struct {
+			StandardOptions struct {
+				Util string `json:"util"`
+			} `json:"standardOptions"`
+		} `json:"options"`
+		Targets json.RawMessage `json:"targets"`
+		Panels  []*panelDef     `json:"panels"`
+	}
+
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return err
+	}
+
+	p.Name, p.Type = raw.Name, raw.Type
+	p.DatasourceCate, p.DatasourceValue = raw.DatasourceCate, raw.DatasourceValue
+	p.Unit = raw.Options.StandardOptions.Util
+	p.Panels = raw.Panels
+
+	if len(raw.Targets) > 0 {
+		// targets of non prometheus panels have other shapes, they are skipped anyway
+		_ = json.Unmarshal(raw.Targets, &p.Targets)
+	}
+
+	return nil
+}
+
+type varDef struct {
+	Name         string `json:"name"`
+	Type         string `json:"type"`
+	Definition   string `json:"definition"`
+	DefaultValue string `json:"defaultValue"`
+	AllValue     string `json:"allValue"`
+}
+
+type boardConfigs struct {
+	Var    []*varDef   `json:"var"`
+	Panels []*panelDef `json:"panels"`
+}
+
+// Build queries every prometheus panel of the board, failed panels keep their error and do not stop the report
+func Build(ctx *ctx.Context, r *models.BoardReport, query Querier, now time.Time) (*Result, error) {
+	board, err := models.BoardGetByID(ctx, r.BoardId)
+	if err != nil {
+		return nil, err
+	}
+
+	if board == nil {
+		return nil, fmt.Errorf("board %d not found", r.BoardId)
+	}
+
+	payload, err := models.BoardPayloadGet(ctx, board.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	var configs boardConfigs
+	if payload != "" {
+		if err = json.Unmarshal([]byte(payload), &configs); err != nil {
+			return nil, fmt.Errorf("failed to decode configs of board %d: %v", board.Id, err)
+		}
+	}
+
+	step := r.Step
+	if step <= 0 {
+		step = r.Range / defaultPoints
+		if step < 15 {
+			step = 15
+		}
+	}
+
+	ret := &Result{
+		Report: r,
+		Board:  board,
+		Start:  now.Add(-time.Duration(r.Range) * time.Second),
+		End:    now,
+		Step:   step,
+	}
+
+	vars := resolveVars(configs.Var, r.Vars, r.Range, step)
+
+	for _, def := range flatten(configs.Panels) {
+		if def.DatasourceCate != "" && def.DatasourceCate != models.PROMETHEUS {
+			continue
+		}
+
+		var exprs, legends []string
+		for _, t := range def.Targets {
+			if t.Expr == "" || t.Hide {
+				continue
+			}
+			exprs = append(exprs, replaceVars(t.Expr, vars))
+			legends = append(legends, t.Legend)
+		}
+
+		if len(exprs) == 0 {
+			continue
+		}
+
+		panel := &Panel{Name: replaceVars(def.Name, vars), Type: def.Type, Unit: def.Unit}
+		ret.Panels = append(ret.Panels, panel)
+
+		dsId := datasourceId(def.DatasourceValue, r)
+		if dsId == 0 {
+			panel.Error = "no datasource, set datasource_id of the report"
+			continue
+		}
+
+		values, err := query(owner(r), dsId, ret.Start.Unix(), ret.End.Unix(), step, exprs)
+		if err != nil {
+			panel.Error = err.Error()
+			continue
+		}
+
+		for i, v := range values {
+			matrix, ok := v.(model.Matrix)
+			if !ok {
+				continue
+			}
+
+			for _, s := range matrix {
+				panel.Series = append(panel.Series, &Series{
+					Name:   seriesName(legends[i], s.Metric),
+					Points: s.Values,
+				})
+			}
+		}
+	}
+
+	return ret, nil
+}
+
+// owner is the user the report reads the data as, the last one who updated it
+func owner(r *models.BoardReport) string {
+	if r.UpdateBy != "" {
+		return r.UpdateBy
+	}
+	return r.CreateBy
+}
+
+func flatten(panels []*panelDef) []*panelDef {
+	var out []*panelDef
+	for _, p := range panels {
+		if p.Type == "row" {
+			out = append(out, flatten(p.Panels)...)
+			continue
+		}
+		out = append(out, p)
+	}
+	return out
+}
+
+// datasourceId resolves numbers and variable references like ${prom}, variables are set in the vars of the report
+func datasourceId(value interface{}, r *models.BoardReport) int64 {
+	switch v := value.(type) {
+	case float64:
+		return int64(v)
+	case string:
+		name := strings.TrimSuffix(strings.TrimPrefix(strings.TrimPrefix(v, "$"), "{"), "}")
+		if id, err := strconv.ParseInt(r.Vars[name], 10, 64); err == nil {
+			return id
+		}
+	}
+	return r.DatasourceId
+}
+
+// resolveVars merges the values set in the report with the defaults of the board variables,
+// variables left unset match everything
+func resolveVars(defs []*varDef, values map[string]string, rangeSec, step int64) map[string]string {
+	vars := make(map[string]string)
+	for _, d := range defs {
+		if v, has := values[d.Name]; has {
+			vars[d.Name] = v
+			continue
+		}
+
+		switch d.Type {
+		case "constant":
+			vars[d.Name] = d.Definition
+		case "textbox":
+			vars[d.Name] = d.DefaultValue
+		case "custom":
+			vars[d.Name] = strings.TrimSpace(strings.Split(d.Definition, ",")[0])
+		case "datasource":
+		default:
+			if d.AllValue != "" {
+				vars[d.Name] = d.AllValue
+			} else {
+				vars[d.Name] = ".*"
+			}
+		}
+	}
+
+	for k, v := range values {
+		if _, has := vars[k]; !has {
+			vars[k] = v
+		}
+	}
+
+	rateInterval := step * 4
+	if rateInterval < 60 {
+		rateInterval = 60
+	}
+
+	vars["__interval"] = fmt.Sprintf("%ds", step)
+	vars["__rate_interval"] = fmt.Sprintf("%ds", rateInterval)
+	vars["__range"] = fmt.Sprintf("%ds", rangeSec)
+
+	return vars
+}
+
+// replaceVars substitutes $name, ${name} and [[name]], longer names first so that $ab is not taken as $a
+func replaceVars(s string, vars map[string]string) string {
+	if !strings.ContainsAny(s, "$[") {
+		return s
+	}
+
+	names := make([]string, 0, len(vars))
+	for k := range vars {
+		names = append(names, k)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+
+	pairs := make([]string, 0, len(names)*6)
+	for _, k := range names {
+		pairs = append(pairs, "${"+k+"}", vars[k], "[["+k+"]]", vars[k], "$"+k, vars[k])
+	}
+
+	return strings.NewReplacer(pairs...).Replace(s)
+}
+
+func seriesName(legend string, metric model.Metric) string {
+	if legend == "" {
+		return metric.String()
+	}
+
+	out := legend
+	for k, v := range metric {
+		out = strings.ReplaceAll(out, "{{"+string(k)+"}}", string(v))
+		out = strings.ReplaceAll(out, "{{ "+string(k)+" }}", string(v))
+	}
+	return out
+}
+
+// Send delivers the result to every channel of the report, one failed channel does not stop the others
+func Send(ctx *ctx.Context, ret *Result) error {
+	r := ret.Report
+
+	channels, err := models.NotifyChannelsGet(ctx, "id in ?", r.NotifyChannelIds)
+	if err != nil {
+		return err
+	}
+
+	if len(channels) == 0 {
+		return fmt.Errorf("notify channels %v not found", r.NotifyChannelIds)
+	}
+
+	subject, content, attachments, err := Render(ret)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, ch := range channels {
+		if !ch.Enable {
+			errs = append(errs, fmt.Sprintf("channel %s is disabled", ch.Name))
+			continue
+		}
+
+		if err := ch.SendReport(subject, content, attachments, r.Sendtos); err != nil {
+			errs = append(errs, fmt.Sprintf("channel %s: %v", ch.Name, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+
+	return nil
+}
+
+// Run builds the report and sends it, the error is recorded on the report as well
+func Run(ctx *ctx.Context, r *models.BoardReport, query Querier, now time.Time) error {
+	ret, err := Build(ctx, r, query, now)
+	if err == nil {
+		err = Send(ctx, ret)
+	}
+
+	lastError := ""
+	if err != nil {
+		lastError = err.Error()
+	}
+
+	if uerr := r.UpdateLastError(ctx, lastError); uerr != nil && err == nil {
+		err = uerr
+	}
+
+	return err
+}
@@ -0,0 +1,92 @@
+package report
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestReplaceVars(t *testing.T) {
+	defs := []*varDef{
+		{Name: "ident", Type: "query"},
+		{Name: "env", Type: "custom", Definition: "prod, test"},
+		{Name: "idc", Type: "query", AllValue: "bj|sh"},
+	}
+
+	vars := resolveVars(defs, map[string]string{"ident": "host1"}, 3600, 15)
+
+	got := replaceVars(`rate(cpu{ident="$ident",env="${env}",idc=~"[[idc]]"}[$__rate_interval])`, vars)
+	want := `rate(cpu{ident="host1",env="prod",idc=~"bj|sh"}[60s])`
+	if got != want {
+		t.Fatalf("got %s, want %s", got, want)
+	}
+}
+
+func TestDatasourceId(t *testing.T) {
+	r := &models.BoardReport{DatasourceId: 1, Vars: map[string]string{"prom": "3"}}
+
+	cases := []struct {
+		value interface{}
+		want  int64
+	}{
+		{float64(2), 2},
+		{"${prom}", 3},
+		{"$other", 1},
+		{nil, 1},
+	}
+
+	for _, c := range cases {
+		if got := datasourceId(c.value, r); got != c.want {
+			t.Errorf("datasourceId(%v) = %d, want %d", c.value, got, c.want)
+		}
+	}
+}
+
+func testResult() *Result {
+	end := time.Unix(1700000000, 0)
+	p := &Panel{Name: "cpu", Series: []*Series{{
+		Name: "host1",
+		Points: []model.SamplePair{
+			{Timestamp: model.TimeFromUnix(end.Unix() - 60), Value: 1},
+			{Timestamp: model.TimeFromUnix(end.Unix()), Value: 3},
+		},
+	}}}
+
+	return &Result{
+		Report: &models.BoardReport{Name: "daily", Formats: []string{"png", "csv", "html"}},
+		Board:  &models.Board{Name: "hosts"},
+		Start:  end.Add(-time.Hour),
+		End:    end,
+		Panels: []*Panel{p},
+	}
+}
+
+func TestRender(t *testing.T) {
+	_, content, attachments, err := Render(testResult())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(content, "cid:panel-1.png") || !strings.Contains(content, "<td>2</td>") {
+		t.Fatalf("unexpected content: %s", content)
+	}
+
+	if len(attachments) != 2 || !attachments[0].Inline || attachments[1].ContentType != "text/csv" {
+		t.Fatalf("unexpected attachments: %+v", attachments)
+	}
+
+	if _, err := png.Decode(bytes.NewReader(attachments[0].Content)); err != nil {
+		t.Fatalf("chart is not a png: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(attachments[1].Content)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("unexpected csv: %v", lines)
+	}
+}
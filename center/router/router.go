@@ -50,18 +50,22 @@ type Router struct {
 	UserCache         *memsto.UserCacheType
 	UserGroupCache    *memsto.UserGroupCacheType
 	UserTokenCache    *memsto.UserTokenCacheType
+	CalendarCache     *memsto.CalendarCacheType
+	DsPermCache       *memsto.DatasourcePermCacheType
 	Ctx               *ctx.Context
 
 	HeartbeatHook       HeartbeatHookFunc
 	TargetDeleteHook    models.TargetDeleteHookFunc
 	AlertRuleModifyHook AlertRuleModifyHookFunc
+	EvalStatusHook      EvalStatusHookFunc
 }
 
 func New(httpConfig httpx.Config, center cconf.Center, alert aconf.Alert, ibex conf.Ibex,
 	operations cconf.Operation, ds *memsto.DatasourceCacheType, ncc *memsto.NotifyConfigCacheType,
 	pc *prom.PromClientMap, redis storage.Redis,
 	sso *sso.SsoClient, ctx *ctx.Context, metaSet *metas.Set, idents *idents.Set,
-	tc *memsto.TargetCacheType, uc *memsto.UserCacheType, ugc *memsto.UserGroupCacheType, utc *memsto.UserTokenCacheType) *Router {
+	tc *memsto.TargetCacheType, uc *memsto.UserCacheType, ugc *memsto.UserGroupCacheType, utc *memsto.UserTokenCacheType,
+	cc *memsto.CalendarCacheType, dpc *memsto.DatasourcePermCacheType) *Router {
 	return &Router{
 		HTTP:                httpConfig,
 		Center:              center,
@@ -79,10 +83,13 @@ func New(httpConfig httpx.Config, center cconf.Center, alert aconf.Alert, ibex c
 		UserCache:           uc,
 		UserGroupCache:      ugc,
 		UserTokenCache:      utc,
+		CalendarCache:       cc,
+		DsPermCache:         dpc,
 		Ctx:                 ctx,
 		HeartbeatHook:       func(ident string) map[string]interface{} { return nil },
 		TargetDeleteHook:    func(tx *gorm.DB, idents []string) error { return nil },
 		AlertRuleModifyHook: func(ar *models.AlertRule) {},
+		EvalStatusHook:      func(ruleId int64) []models.AlertRuleEvalStatus { return nil },
 	}
 }
 
@@ -341,6 +348,7 @@ func (rt *Router) Config(r *gin.Engine) {
 		pages.GET("/busi-groups/boards", rt.auth(), rt.user(), rt.perm("/dashboards"), rt.boardGetsByGids)
 		pages.GET("/busi-group/:id/boards", rt.auth(), rt.user(), rt.perm("/dashboards"), rt.bgro(), rt.boardGets)
 		pages.POST("/busi-group/:id/boards", rt.auth(), rt.user(), rt.perm("/dashboards/add"), rt.bgrw(), rt.boardAdd)
+		pages.POST("/busi-group/:id/boards/import-grafana", rt.auth(), rt.user(), rt.perm("/dashboards/add"), rt.bgrw(), rt.boardImportGrafana)
 		pages.POST("/busi-group/:id/board/:bid/clone", rt.auth(), rt.user(), rt.perm("/dashboards/add"), rt.bgrw(), rt.boardClone)
 		pages.POST("/busi-groups/boards/clones", rt.auth(), rt.user(), rt.perm("/dashboards/add"), rt.boardBatchClone)
 
@@ -350,8 +358,20 @@ func (rt *Router) Config(r *gin.Engine) {
 		pages.PUT("/board/:bid", rt.auth(), rt.user(), rt.perm("/dashboards/put"), rt.boardPut)
 		pages.PUT("/board/:bid/configs", rt.auth(), rt.user(), rt.perm("/dashboards/put"), rt.boardPutConfigs)
 		pages.PUT("/board/:bid/public", rt.auth(), rt.user(), rt.perm("/dashboards/put"), rt.boardPutPublic)
+		pages.GET("/board/:bid/export-grafana", rt.auth(), rt.user(), rt.perm("/dashboards"), rt.boardExportGrafana)
+		pages.GET("/board/:bid/revisions", rt.auth(), rt.user(), rt.perm("/dashboards"), rt.boardRevisionGets)
+		pages.GET("/board/:bid/revisions/diff", rt.auth(), rt.user(), rt.perm("/dashboards"), rt.boardRevisionDiff)
+		pages.GET("/board/:bid/revision/:rid", rt.auth(), rt.user(), rt.perm("/dashboards"), rt.boardRevisionGet)
+		pages.PUT("/board/:bid/revision/:rid/restore", rt.auth(), rt.user(), rt.perm("/dashboards/put"), rt.boardRevisionRestore)
 		pages.DELETE("/boards", rt.auth(), rt.user(), rt.perm("/dashboards/del"), rt.boardDel)
 
+		pages.GET("/busi-group/:id/board-reports", rt.auth(), rt.user(), rt.perm("/dashboards"), rt.bgro(), rt.boardReportGets)
+		pages.POST("/busi-group/:id/board-reports", rt.auth(), rt.user(), rt.perm("/dashboards/put"), rt.bgrw(), rt.boardReportAdd)
+		pages.PUT("/busi-group/:id/board-report/:rid", rt.auth(), rt.user(), rt.perm("/dashboards/put"), rt.bgrw(), rt.boardReportPut)
+		pages.DELETE("/busi-group/:id/board-reports", rt.auth(), rt.user(), rt.perm("/dashboards/put"), rt.bgrw(), rt.boardReportDel)
+		pages.POST("/busi-group/:id/board-report/:rid/run", rt.auth(), rt.user(), rt.perm("/dashboards/put"), rt.bgrw(), rt.boardReportRun)
+		pages.GET("/board-report/:rid", rt.auth(), rt.user(), rt.perm("/dashboards"), rt.boardReportGet)
+
 		pages.GET("/share-charts", rt.chartShareGets)
 		pages.POST("/share-charts", rt.auth(), rt.chartShareAdd)
 
@@ -375,6 +395,11 @@ func (rt *Router) Config(r *gin.Engine) {
 		pages.PUT("/busi-group/:id/alert-rule/:arid", rt.auth(), rt.user(), rt.perm("/alert-rules/put"), rt.alertRulePutByFE)
 		pages.GET("/alert-rule/:arid", rt.auth(), rt.user(), rt.perm("/alert-rules"), rt.alertRuleGet)
 		pages.GET("/alert-rule/:arid/pure", rt.auth(), rt.user(), rt.perm("/alert-rules"), rt.alertRulePureGet)
+		pages.GET("/alert-rule/:arid/status", rt.auth(), rt.user(), rt.perm("/alert-rules"), rt.alertRuleStatusGet)
+		pages.GET("/alert-rule/:arid/revisions", rt.auth(), rt.user(), rt.perm("/alert-rules"), rt.alertRuleRevisionGets)
+		pages.GET("/alert-rule/:arid/revisions/diff", rt.auth(), rt.user(), rt.perm("/alert-rules"), rt.alertRuleRevisionDiff)
+		pages.GET("/alert-rule/:arid/revision/:rid", rt.auth(), rt.user(), rt.perm("/alert-rules"), rt.alertRuleRevisionGet)
+		pages.PUT("/alert-rule/:arid/revision/:rid/restore", rt.auth(), rt.user(), rt.perm("/alert-rules/put"), rt.alertRuleRevisionRestore)
 		pages.PUT("/busi-group/alert-rule/validate", rt.auth(), rt.user(), rt.perm("/alert-rules/put"), rt.alertRuleValidation)
 		pages.POST("/relabel-test", rt.auth(), rt.user(), rt.relabelTest)
 		pages.POST("/busi-group/:id/alert-rules/clone", rt.auth(), rt.user(), rt.perm("/alert-rules/add"), rt.bgrw(), rt.cloneToMachine)
@@ -400,6 +425,13 @@ func (rt *Router) Config(r *gin.Engine) {
 		pages.PUT("/busi-group/:id/alert-mutes/fields", rt.auth(), rt.user(), rt.perm("/alert-mutes/put"), rt.bgrw(), rt.alertMutePutFields)
 		pages.POST("/alert-mute-tryrun", rt.auth(), rt.user(), rt.perm("/alert-mutes/add"), rt.alertMuteTryRun)
 
+		pages.GET("/calendars", rt.auth(), rt.user(), rt.calendarGets)
+		pages.GET("/calendar/:id", rt.auth(), rt.user(), rt.calendarGet)
+		pages.POST("/calendars", rt.auth(), rt.user(), rt.perm("/calendars/add"), rt.calendarAdd)
+		pages.PUT("/calendar/:id", rt.auth(), rt.user(), rt.perm("/calendars/put"), rt.calendarPut)
+		pages.POST("/calendar/:id/ics", rt.auth(), rt.user(), rt.perm("/calendars/put"), rt.calendarImportICS)
+		pages.DELETE("/calendars", rt.auth(), rt.user(), rt.perm("/calendars/del"), rt.calendarsDel)
+
 		pages.GET("/busi-groups/alert-subscribes", rt.auth(), rt.user(), rt.perm("/alert-subscribes"), rt.alertSubscribeGetsByGids)
 		pages.GET("/busi-group/:id/alert-subscribes", rt.auth(), rt.user(), rt.perm("/alert-subscribes"), rt.bgro(), rt.alertSubscribeGets)
 		pages.GET("/alert-subscribe/:sid", rt.auth(), rt.user(), rt.perm("/alert-subscribes"), rt.alertSubscribeGet)
@@ -411,6 +443,8 @@ func (rt *Router) Config(r *gin.Engine) {
 		pages.GET("/alert-cur-event/:eid", rt.alertCurEventGet)
 		pages.GET("/alert-his-event/:eid", rt.alertHisEventGet)
 		pages.GET("/event-notify-records/:eid", rt.notificationRecordList)
+		pages.POST("/event-notify-records/:eid/resend", rt.auth(), rt.user(), rt.perm("/notification-rules/put"), rt.notificationRecordResend)
+		pages.GET("/notify-outboxes", rt.auth(), rt.user(), rt.perm("/notification-rules"), rt.notifyOutboxGets)
 
 		// card logic
 		pages.GET("/alert-cur-events/list", rt.auth(), rt.user(), rt.alertCurEventsList)
@@ -418,6 +452,8 @@ func (rt *Router) Config(r *gin.Engine) {
 		pages.POST("/alert-cur-events/card/details", rt.auth(), rt.alertCurEventsCardDetails)
 		pages.GET("/alert-his-events/list", rt.auth(), rt.user(), rt.alertHisEventsList)
 		pages.DELETE("/alert-his-events", rt.auth(), rt.admin(), rt.alertHisEventsDelete)
+		pages.GET("/alert-his-events/archives", rt.auth(), rt.admin(), rt.alertHisEventArchives)
+		pages.POST("/alert-his-events/archive-import", rt.auth(), rt.admin(), rt.alertHisEventArchiveImport)
 		pages.DELETE("/alert-cur-events", rt.auth(), rt.user(), rt.perm("/alert-cur-events/del"), rt.alertCurEventDel)
 		pages.GET("/alert-cur-events/stats", rt.auth(), rt.alertCurEventsStatistics)
 
@@ -438,6 +474,10 @@ func (rt *Router) Config(r *gin.Engine) {
 		pages.GET("/busi-groups/tasks", rt.auth(), rt.user(), rt.perm("/job-tasks"), rt.taskGetsByGids)
 		pages.GET("/busi-group/:id/tasks", rt.auth(), rt.user(), rt.perm("/job-tasks"), rt.bgro(), rt.taskGets)
 		pages.POST("/busi-group/:id/tasks", rt.auth(), rt.user(), rt.perm("/job-tasks/add"), rt.bgrw(), rt.taskAdd)
+		pages.GET("/busi-group/:id/task-approvals", rt.auth(), rt.user(), rt.perm("/job-tasks"), rt.bgro(), rt.taskApprovalGets)
+		pages.PUT("/busi-group/:id/task-approval/:aid", rt.auth(), rt.user(), rt.perm("/job-tasks/add"), rt.bgrw(), rt.taskApprovalPut)
+		pages.GET("/task-approval/:token", rt.auth(), rt.user(), rt.perm("/job-tasks"), rt.taskApprovalGetByToken)
+		pages.PUT("/task-approval/:token", rt.auth(), rt.user(), rt.perm("/job-tasks/add"), rt.taskApprovalPutByToken)
 
 		pages.GET("/servers", rt.auth(), rt.user(), rt.serversGet)
 		pages.GET("/server-clusters", rt.auth(), rt.user(), rt.serverClustersGet)
@@ -448,6 +488,10 @@ func (rt *Router) Config(r *gin.Engine) {
 		pages.POST("/datasource/desc", rt.auth(), rt.admin(), rt.datasourceGet)
 		pages.POST("/datasource/status/update", rt.auth(), rt.admin(), rt.datasourceUpdataStatus)
 		pages.DELETE("/datasource/", rt.auth(), rt.admin(), rt.datasourceDel)
+		pages.POST("/datasource/query-cache/purge", rt.auth(), rt.admin(), rt.datasourceQueryCachePurge)
+		pages.GET("/query-slow-logs", rt.auth(), rt.admin(), rt.querySlowLogGets)
+		pages.GET("/datasource-perms", rt.auth(), rt.admin(), rt.datasourcePermGets)
+		pages.PUT("/datasource-perms", rt.auth(), rt.admin(), rt.datasourcePermPut)
 
 		pages.GET("/roles", rt.auth(), rt.user(), rt.roleGets)
 		pages.POST("/roles", rt.auth(), rt.user(), rt.perm("/roles/add"), rt.roleAdd)
@@ -624,11 +668,13 @@ func (rt *Router) Config(r *gin.Engine) {
 			service.GET("/recording-rules", rt.recordingRuleGetsByService)
 
 			service.GET("/alert-mutes", rt.alertMuteGets)
+			service.GET("/calendars", rt.calendarGetsByService)
 			service.POST("/alert-mutes", rt.alertMuteAddByService)
 			service.DELETE("/alert-mutes", rt.alertMuteDel)
 
 			service.GET("/alert-cur-events", rt.alertCurEventsList)
 			service.GET("/alert-cur-events-get-by-rid", rt.alertCurEventsGetByRid)
+			service.GET("/alert-cur-events-by-rule", rt.alertCurEventsGetByRule)
 			service.GET("/alert-his-events", rt.alertHisEventsList)
 			service.GET("/alert-his-event/:eid", rt.alertHisEventGet)
 
@@ -652,6 +698,12 @@ func (rt *Router) Config(r *gin.Engine) {
 			service.GET("/notify-tpls", rt.notifyTplGets)
 
 			service.POST("/task-record-add", rt.taskRecordAdd)
+			service.POST("/task-approval-add", rt.taskApprovalAddByService)
+			service.GET("/task-approvals", rt.taskApprovalGetsByService)
+			service.POST("/task-heal-run-add", rt.taskHealRunAddByService)
+			service.GET("/task-heal-runs/count", rt.taskHealRunCountByService)
+			service.GET("/task-host-result", rt.taskHostResultByService)
+			service.POST("/event-annotations", rt.eventAnnotationsMergeByService)
 
 			service.GET("/user-variable/decrypt", rt.userVariableGetDecryptByService)
 
@@ -685,6 +737,28 @@ func (rt *Router) Config(r *gin.Engine) {
 		}
 	}
 
+	if rt.Center.Scim.Enable {
+		scim := r.Group("/scim/v2")
+		scim.Use(rt.scimAuth())
+		{
+			scim.GET("/ServiceProviderConfig", rt.scimServiceProviderConfig)
+
+			scim.GET("/Users", rt.scimUsersGet)
+			scim.POST("/Users", rt.scimUserAdd)
+			scim.GET("/Users/:id", rt.scimUserGet)
+			scim.PUT("/Users/:id", rt.scimUserPut)
+			scim.PATCH("/Users/:id", rt.scimUserPatch)
+			scim.DELETE("/Users/:id", rt.scimUserDel)
+
+			scim.GET("/Groups", rt.scimGroupsGet)
+			scim.POST("/Groups", rt.scimGroupAdd)
+			scim.GET("/Groups/:id", rt.scimGroupGet)
+			scim.PUT("/Groups/:id", rt.scimGroupPut)
+			scim.PATCH("/Groups/:id", rt.scimGroupPatch)
+			scim.DELETE("/Groups/:id", rt.scimGroupDel)
+		}
+	}
+
 	rt.configNoRoute(r, &statikFS)
 
 }
@@ -148,6 +148,10 @@ func (rt *Router) alertCurEventsGetByRid(c *gin.Context) {
 	ginx.NewRender(c).Data(models.AlertCurEventGetByRuleIdAndDsId(rt.Ctx, rid, dsId))
 }
 
+func (rt *Router) alertCurEventsGetByRule(c *gin.Context) {
+	ginx.NewRender(c).Data(models.AlertCurEventGetsByRuleId(rt.Ctx, ginx.QueryInt64(c, "rid")))
+}
+
 // 列表方式，拉取活跃告警
 func (rt *Router) alertCurEventsList(c *gin.Context) {
 	stime, etime := getTimeRange(c)
@@ -23,6 +23,7 @@ import (
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/toolkits/pkg/ginx"
 	"github.com/toolkits/pkg/i18n"
+	"github.com/toolkits/pkg/logger"
 )
 
 type AlertRuleModifyHookFunc func(ar *models.AlertRule)
@@ -262,7 +263,7 @@ func (rt *Router) alertRuleEnableTryRun(c *gin.Context) {
 		ginx.Bomb(http.StatusOK, "rule is disabled")
 	}
 
-	if mute.TimeSpanMuteStrategy(&f.AlertRuleConfig, &curEvent) {
+	if mute.TimeSpanMuteStrategy(&f.AlertRuleConfig, &curEvent, rt.CalendarCache.Get) {
 		ginx.Bomb(http.StatusOK, "event is not match for period of time")
 	}
 
@@ -379,6 +380,9 @@ func (rt *Router) alertRuleAddOneByService(c *gin.Context) {
 	ginx.Dangerous(err)
 
 	err = f.Add(rt.Ctx)
+	if err == nil {
+		rt.alertRuleRevisionAdd(f.Id, "created", f.CreateBy)
+	}
 	ginx.NewRender(c).Data(f.Id, err)
 }
 
@@ -402,6 +406,7 @@ func (rt *Router) alertRuleAddForService(lst []models.AlertRule, username string
 			reterr[lst[i].Name] = err.Error()
 		} else {
 			reterr[lst[i].Name] = ""
+			rt.alertRuleRevisionAdd(lst[i].Id, "created", lst[i].CreateBy)
 		}
 	}
 	return reterr
@@ -424,15 +429,41 @@ func (rt *Router) alertRuleAdd(lst []models.AlertRule, username string, bgid int
 			continue
 		}
 
+		if err := rt.alertRuleDsPermCheck(username, &lst[i]); err != nil {
+			reterr[lst[i].Name] = i18n.Sprintf(lang, err.Error())
+			continue
+		}
+
 		if err := lst[i].Add(rt.Ctx); err != nil {
 			reterr[lst[i].Name] = i18n.Sprintf(lang, err.Error())
 		} else {
 			reterr[lst[i].Name] = ""
+			rt.alertRuleRevisionAdd(lst[i].Id, "created", lst[i].CreateBy)
 		}
 	}
 	return reterr
 }
 
+// alertRuleDsPermCheck checks the user is granted the datasources named by the queries of the rule with no
+// restriction, as the engines evaluate the queries without applying any
+func (rt *Router) alertRuleDsPermCheck(username string, ar *models.AlertRule) error {
+	if username == "" {
+		return nil
+	}
+
+	for _, q := range ar.QueryDatasources() {
+		ok, restricted, err := rt.dsAccessOf(username, q.DatasourceId)
+		if err != nil {
+			return err
+		}
+
+		if !ok || len(restricted) > 0 {
+			return fmt.Errorf("query %s: datasource(%d) forbidden", q.Ref, q.DatasourceId)
+		}
+	}
+	return nil
+}
+
 func (rt *Router) alertRuleDel(c *gin.Context) {
 	var f idsForm
 	ginx.BindJSON(c, &f)
@@ -463,9 +494,16 @@ func (rt *Router) alertRulePutByFE(c *gin.Context) {
 	}
 
 	rt.bgrwCheck(c, ar.GroupId)
+	ginx.Dangerous(models.AlertRuleRevisionBaseline(rt.Ctx, ar, rt.Center.MaxRevisions))
 
 	f.UpdateBy = c.MustGet("username").(string)
-	ginx.NewRender(c).Message(ar.Update(rt.Ctx, f))
+	if err := rt.alertRuleDsPermCheck(f.UpdateBy, &f); err != nil {
+		ginx.Bomb(http.StatusForbidden, err.Error())
+	}
+	ginx.Dangerous(ar.Update(rt.Ctx, f))
+
+	_, err = models.AlertRuleRevisionAdd(rt.Ctx, ar.Id, ginx.QueryStr(c, "message", ""), f.UpdateBy, rt.Center.MaxRevisions)
+	ginx.NewRender(c).Message(err)
 }
 
 func (rt *Router) alertRulePutByService(c *gin.Context) {
@@ -480,7 +518,12 @@ func (rt *Router) alertRulePutByService(c *gin.Context) {
 		ginx.NewRender(c, http.StatusNotFound).Message("No such AlertRule")
 		return
 	}
-	ginx.NewRender(c).Message(ar.Update(rt.Ctx, f))
+
+	ginx.Dangerous(models.AlertRuleRevisionBaseline(rt.Ctx, ar, rt.Center.MaxRevisions))
+	ginx.Dangerous(ar.Update(rt.Ctx, f))
+
+	_, err = models.AlertRuleRevisionAdd(rt.Ctx, ar.Id, ginx.QueryStr(c, "message", ""), f.UpdateBy, rt.Center.MaxRevisions)
+	ginx.NewRender(c).Message(err)
 }
 
 type alertRuleFieldForm struct {
@@ -509,6 +552,8 @@ func (rt *Router) alertRulePutFields(c *gin.Context) {
 			continue
 		}
 
+		ginx.Dangerous(models.AlertRuleRevisionBaseline(rt.Ctx, ar, rt.Center.MaxRevisions))
+
 		if f.Action == "update_triggers" {
 			if triggers, has := f.Fields["triggers"]; has {
 				originRule := ar.RuleConfigJson.(map[string]interface{})
@@ -588,6 +633,13 @@ func (rt *Router) alertRulePutFields(c *gin.Context) {
 			"update_by": updateBy,
 			"update_at": updateAt,
 		}))
+
+		message := "batch update"
+		if f.Action != "" {
+			message += ": " + f.Action
+		}
+		_, err = models.AlertRuleRevisionAdd(rt.Ctx, ar.Id, message, updateBy, rt.Center.MaxRevisions)
+		ginx.Dangerous(err)
 	}
 
 	ginx.NewRender(c).Message(nil)
@@ -834,7 +886,12 @@ func (rt *Router) cloneToMachine(c *gin.Context) {
 		}
 	}
 
-	ginx.NewRender(c).Data(reterr, models.InsertAlertRule(rt.Ctx, newRules))
+	ginx.Dangerous(models.InsertAlertRule(rt.Ctx, newRules))
+	for i := range newRules {
+		rt.alertRuleRevisionAdd(newRules[i].Id, "cloned to machine", user)
+	}
+
+	ginx.NewRender(c).Data(reterr, nil)
 }
 
 type alertBatchCloneForm struct {
@@ -877,8 +934,91 @@ func (rt *Router) batchAlertRuleClone(c *gin.Context) {
 				reterr[fmt.Sprintf("%d-%d", arid, bgid)] = i18n.Sprintf(lang, err.Error())
 				continue
 			}
+
+			rt.alertRuleRevisionAdd(newAr.Id, fmt.Sprintf("cloned from rule %d", arid), me.Username)
 		}
 	}
 
 	ginx.NewRender(c).Data(reterr, nil)
 }
+
+// alertRuleRevisionAdd is used where the rule has been saved already and a failed snapshot should not fail the request
+func (rt *Router) alertRuleRevisionAdd(id int64, message, username string) {
+	if _, err := models.AlertRuleRevisionAdd(rt.Ctx, id, message, username, rt.Center.MaxRevisions); err != nil {
+		logger.Warningf("failed to add revision of alert rule %d: %v", id, err)
+	}
+}
+
+func (rt *Router) alertRuleForRevision(c *gin.Context) *models.AlertRule {
+	ar, err := models.AlertRuleGetById(rt.Ctx, ginx.UrlParamInt64(c, "arid"))
+	ginx.Dangerous(err)
+
+	if ar == nil {
+		ginx.Bomb(http.StatusNotFound, "No such AlertRule")
+	}
+
+	return ar
+}
+
+func (rt *Router) alertRuleRevision(c *gin.Context, arid, rid int64) *models.Revision {
+	rev, err := models.RevisionGet(rt.Ctx, models.RevisionCateAlertRule, arid, rid)
+	ginx.Dangerous(err)
+
+	if rev == nil {
+		ginx.Bomb(http.StatusNotFound, "No such revision")
+	}
+
+	return rev
+}
+
+func (rt *Router) alertRuleRevisionGets(c *gin.Context) {
+	ar := rt.alertRuleForRevision(c)
+	rt.bgroCheck(c, ar.GroupId)
+
+	lst, err := models.RevisionGets(rt.Ctx, models.RevisionCateAlertRule, ar.Id)
+	ginx.NewRender(c).Data(lst, err)
+}
+
+func (rt *Router) alertRuleRevisionGet(c *gin.Context) {
+	ar := rt.alertRuleForRevision(c)
+	rt.bgroCheck(c, ar.GroupId)
+
+	ginx.NewRender(c).Data(rt.alertRuleRevision(c, ar.Id, ginx.UrlParamInt64(c, "rid")), nil)
+}
+
+// alertRuleRevisionDiff compares revision `from` with revision `to`, `to` defaults to the current rule
+func (rt *Router) alertRuleRevisionDiff(c *gin.Context) {
+	ar := rt.alertRuleForRevision(c)
+	rt.bgroCheck(c, ar.GroupId)
+
+	from := rt.alertRuleRevision(c, ar.Id, ginx.QueryInt64(c, "from"))
+
+	var to string
+	if rid := ginx.QueryInt64(c, "to", 0); rid > 0 {
+		to = rt.alertRuleRevision(c, ar.Id, rid).Payload
+	} else {
+		b, err := json.Marshal(ar)
+		ginx.Dangerous(err)
+		to = string(b)
+	}
+
+	ginx.NewRender(c).Data(models.AlertRuleDiffGet(from.Payload, to))
+}
+
+func (rt *Router) alertRuleRevisionRestore(c *gin.Context) {
+	ar := rt.alertRuleForRevision(c)
+	rt.bgrwCheck(c, ar.GroupId)
+
+	rev := rt.alertRuleRevision(c, ar.Id, ginx.UrlParamInt64(c, "rid"))
+
+	var f models.AlertRule
+	ginx.Dangerous(json.Unmarshal([]byte(rev.Payload), &f))
+
+	username := c.MustGet("username").(string)
+	f.UpdateBy = username
+	ginx.Dangerous(ar.Update(rt.Ctx, f))
+
+	message := fmt.Sprintf("restored from version %d", rev.Version)
+	_, err := models.AlertRuleRevisionAdd(rt.Ctx, ar.Id, message, username, rt.Center.MaxRevisions)
+	ginx.NewRender(c).Message(err)
+}
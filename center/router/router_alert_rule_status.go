@@ -0,0 +1,101 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/conf"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/poster"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/toolkits/pkg/logger"
+)
+
+type alertRuleStatus struct {
+	RuleId   int64                        `json:"rule_id"`
+	Statuses []models.AlertRuleEvalStatus `json:"statuses"`
+	Errors   map[string]string            `json:"errors"` // key: instance of the engine failed to answer
+}
+
+// EvalStatusHookFunc returns the evaluation status of the rule on the alert engine running in the process of center
+type EvalStatusHookFunc func(ruleId int64) []models.AlertRuleEvalStatus
+
+// alertRuleStatusGet asks every active alert engine for the evaluation status of the rule. The engine in the
+// process of center answers in process, the others answer on the service api, so HTTP.APIForService.Enable
+// has to be turned on for them.
+func (rt *Router) alertRuleStatusGet(c *gin.Context) {
+	ar := rt.alertRuleForRevision(c)
+	rt.bgroCheck(c, ar.GroupId)
+
+	// engines with a heartbeat in 30 seconds are active, an engine evaluating several datasources has several records
+	engines, err := models.AlertingEngineGets(rt.Ctx, "clock > ?", time.Now().Unix()-30)
+	ginx.Dangerous(err)
+
+	instances := make(map[string]struct{})
+	for _, engine := range engines {
+		instances[engine.Instance] = struct{}{}
+	}
+
+	cfg := conf.CenterApi{Timeout: 3000}
+	for user, pass := range rt.HTTP.APIForService.BasicAuth {
+		cfg.BasicAuthUser, cfg.BasicAuthPass = user, pass
+		break
+	}
+
+	ret := alertRuleStatus{
+		RuleId:   ar.Id,
+		Statuses: make([]models.AlertRuleEvalStatus, 0),
+		Errors:   make(map[string]string),
+	}
+
+	var (
+		lock sync.Mutex
+		wg   sync.WaitGroup
+	)
+	if _, has := instances[rt.Alert.Heartbeat.Endpoint]; has {
+		delete(instances, rt.Alert.Heartbeat.Endpoint)
+		ret.Statuses = append(ret.Statuses, rt.EvalStatusHook(ar.Id)...)
+	}
+
+	for instance := range instances {
+		wg.Add(1)
+		go func(instance string) {
+			defer wg.Done()
+			url := fmt.Sprintf("http://%s/v1/n9e/alert-rule/%d/eval-status", instance, ar.Id)
+			lst, err := poster.GetByUrl[[]models.AlertRuleEvalStatus](url, cfg)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				logger.Warningf("failed to get status of alert rule %d from %s: %v", ar.Id, instance, err)
+				ret.Errors[instance] = evalStatusError(err)
+				return
+			}
+			ret.Statuses = append(ret.Statuses, lst...)
+		}(instance)
+	}
+	wg.Wait()
+
+	sort.Slice(ret.Statuses, func(i, j int) bool {
+		if ret.Statuses[i].DatasourceId != ret.Statuses[j].DatasourceId {
+			return ret.Statuses[i].DatasourceId < ret.Statuses[j].DatasourceId
+		}
+		return ret.Statuses[i].Instance < ret.Statuses[j].Instance
+	})
+
+	ginx.NewRender(c).Data(ret, nil)
+}
+
+// evalStatusError explains the 404 of the engines not serving the service api
+func evalStatusError(err error) string {
+	if strings.Contains(err.Error(), fmt.Sprintf("status code: %d", http.StatusNotFound)) {
+		return "the engine does not serve the service api, turn on HTTP.APIForService.Enable in its config: " + err.Error()
+	}
+	return err.Error()
+}
@@ -289,6 +289,7 @@ func (rt *Router) alertSubscribePut(c *gin.Context) {
 			"note",
 			"notify_rule_ids",
 			"notify_version",
+			"timezone",
 		))
 	}
 
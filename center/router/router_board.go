@@ -21,6 +21,7 @@ type boardForm struct {
 	Public     int     `json:"public"`
 	PublicCate int     `json:"public_cate"`
 	Bgids      []int64 `json:"bgids"`
+	Message    string  `json:"message"`
 }
 
 func (rt *Router) boardAdd(c *gin.Context) {
@@ -207,6 +208,14 @@ func (rt *Router) boardPutConfigs(c *gin.Context) {
 		rt.bgrwCheck(c, bo.GroupId)
 	}
 
+	// keep the configs saved before revisions were introduced, so that the first save can be rolled back
+	cnt, err := models.RevisionCount(rt.Ctx, models.RevisionCateBoard, bo.Id)
+	ginx.Dangerous(err)
+	if cnt == 0 && bo.Configs != "" {
+		_, err = models.RevisionAdd(rt.Ctx, models.RevisionCateBoard, bo.Id, bo.Configs, "", bo.UpdateBy, rt.Center.MaxRevisions)
+		ginx.Dangerous(err)
+	}
+
 	bo.UpdateBy = me.Username
 	bo.UpdateAt = time.Now().Unix()
 	ginx.Dangerous(bo.Update(rt.Ctx, "update_by", "update_at"))
@@ -214,6 +223,86 @@ func (rt *Router) boardPutConfigs(c *gin.Context) {
 	bo.Configs = f.Configs
 	ginx.Dangerous(models.BoardPayloadSave(rt.Ctx, bo.Id, f.Configs))
 
+	_, err = models.RevisionAdd(rt.Ctx, models.RevisionCateBoard, bo.Id, f.Configs, f.Message, me.Username, rt.Center.MaxRevisions)
+	ginx.Dangerous(err)
+
+	ginx.NewRender(c).Data(bo, nil)
+}
+
+func (rt *Router) boardRevisionGets(c *gin.Context) {
+	me := c.MustGet("user").(*models.User)
+	bo := rt.Board(ginx.UrlParamInt64(c, "bid"))
+
+	if !me.IsAdmin() {
+		rt.bgroCheck(c, bo.GroupId)
+	}
+
+	lst, err := models.RevisionGets(rt.Ctx, models.RevisionCateBoard, bo.Id)
+	ginx.NewRender(c).Data(lst, err)
+}
+
+func (rt *Router) boardRevision(c *gin.Context, bid, rid int64) *models.Revision {
+	rev, err := models.RevisionGet(rt.Ctx, models.RevisionCateBoard, bid, rid)
+	ginx.Dangerous(err)
+
+	if rev == nil {
+		ginx.Bomb(http.StatusNotFound, "No such revision")
+	}
+
+	return rev
+}
+
+func (rt *Router) boardRevisionGet(c *gin.Context) {
+	me := c.MustGet("user").(*models.User)
+	bo := rt.Board(ginx.UrlParamInt64(c, "bid"))
+
+	if !me.IsAdmin() {
+		rt.bgroCheck(c, bo.GroupId)
+	}
+
+	ginx.NewRender(c).Data(rt.boardRevision(c, bo.Id, ginx.UrlParamInt64(c, "rid")), nil)
+}
+
+// boardRevisionDiff compares revision `from` with revision `to`, `to` defaults to the current configs
+func (rt *Router) boardRevisionDiff(c *gin.Context) {
+	me := c.MustGet("user").(*models.User)
+	bo := rt.Board(ginx.UrlParamInt64(c, "bid"))
+
+	if !me.IsAdmin() {
+		rt.bgroCheck(c, bo.GroupId)
+	}
+
+	from := rt.boardRevision(c, bo.Id, ginx.QueryInt64(c, "from"))
+
+	to := bo.Configs
+	if rid := ginx.QueryInt64(c, "to", 0); rid > 0 {
+		to = rt.boardRevision(c, bo.Id, rid).Payload
+	}
+
+	ginx.NewRender(c).Data(models.BoardPayloadDiffGet(from.Payload, to))
+}
+
+func (rt *Router) boardRevisionRestore(c *gin.Context) {
+	me := c.MustGet("user").(*models.User)
+	bo := rt.Board(ginx.UrlParamInt64(c, "bid"))
+
+	if !me.IsAdmin() {
+		rt.bgrwCheck(c, bo.GroupId)
+	}
+
+	rev := rt.boardRevision(c, bo.Id, ginx.UrlParamInt64(c, "rid"))
+
+	bo.UpdateBy = me.Username
+	bo.UpdateAt = time.Now().Unix()
+	ginx.Dangerous(bo.Update(rt.Ctx, "update_by", "update_at"))
+
+	bo.Configs = rev.Payload
+	ginx.Dangerous(models.BoardPayloadSave(rt.Ctx, bo.Id, rev.Payload))
+
+	message := fmt.Sprintf("restored from version %d", rev.Version)
+	_, err := models.RevisionAdd(rt.Ctx, models.RevisionCateBoard, bo.Id, rev.Payload, message, me.Username, rt.Center.MaxRevisions)
+	ginx.Dangerous(err)
+
 	ginx.NewRender(c).Data(bo, nil)
 }
 
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/grafana"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+)
+
+type grafanaImportForm struct {
+	Name    string          `json:"name"`  // defaults to the grafana dashboard title
+	Ident   string          `json:"ident"` // optional
+	Payload json.RawMessage `json:"payload" binding:"required"`
+	DryRun  bool            `json:"dry_run"`
+}
+
+// boardImportGrafana creates a board from a grafana dashboard, the payload can be the dashboard json or a string of it
+func (rt *Router) boardImportGrafana(c *gin.Context) {
+	var f grafanaImportForm
+	ginx.BindJSON(c, &f)
+
+	payload := []byte(f.Payload)
+	var s string
+	if err := json.Unmarshal(f.Payload, &s); err == nil {
+		payload = []byte(s)
+	}
+
+	board, report, err := grafana.Import(payload)
+	if err != nil {
+		ginx.Bomb(http.StatusBadRequest, err.Error())
+	}
+
+	if f.Name != "" {
+		board.Name = f.Name
+	}
+
+	if board.Name == "" {
+		ginx.Bomb(http.StatusBadRequest, "name is blank")
+	}
+
+	configs, err := json.Marshal(board.Configs)
+	ginx.Dangerous(err)
+
+	ret := gin.H{
+		"board":  board,
+		"report": report,
+	}
+
+	if f.DryRun {
+		ginx.NewRender(c).Data(ret, nil)
+		return
+	}
+
+	me := c.MustGet("user").(*models.User)
+	bo := &models.Board{
+		GroupId:  ginx.UrlParamInt64(c, "id"),
+		Name:     board.Name,
+		Ident:    f.Ident,
+		Tags:     board.Tags,
+		Configs:  string(configs),
+		CreateBy: me.Username,
+		UpdateBy: me.Username,
+	}
+
+	ginx.Dangerous(bo.Add(rt.Ctx))
+	ginx.Dangerous(models.BoardPayloadSave(rt.Ctx, bo.Id, bo.Configs))
+
+	ret["board"] = bo
+	ginx.NewRender(c).Data(ret, nil)
+}
+
+func (rt *Router) boardExportGrafana(c *gin.Context) {
+	me := c.MustGet("user").(*models.User)
+	bo := rt.Board(ginx.UrlParamInt64(c, "bid"))
+
+	if !me.IsAdmin() {
+		rt.bgroCheck(c, bo.GroupId)
+	}
+
+	configs, err := models.BoardPayloadGet(rt.Ctx, bo.Id)
+	ginx.Dangerous(err)
+
+	dashboard, report, err := grafana.Export(bo.Name, bo.Tags, configs)
+	ginx.Dangerous(err)
+
+	ginx.NewRender(c).Data(gin.H{
+		"dashboard": dashboard,
+		"report":    report,
+	}, nil)
+}
@@ -0,0 +1,139 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/center/report"
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/common/model"
+	"github.com/toolkits/pkg/ginx"
+)
+
+// ReportQuerier queries the panels of scheduled reports the same way as /query-range-batch,
+// the forced matchers of the datasource grants of the report owner are applied as well
+func (rt *Router) ReportQuerier() report.Querier {
+	return func(username string, datasourceId, start, end, step int64, queries []string) ([]model.Value, error) {
+		ok, restricted, err := rt.dsAccessOf(username, datasourceId)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			return nil, fmt.Errorf("%s is not granted datasource %d", username, datasourceId)
+		}
+
+		matchers, err := promMatchers(restricted)
+		if err != nil {
+			return nil, err
+		}
+
+		f := BatchQueryForm{DatasourceId: datasourceId}
+		for _, q := range queries {
+			ql, err := promInjectMatchers(q, matchers)
+			if err != nil {
+				return nil, err
+			}
+			f.Queries = append(f.Queries, QueryFormItem{Start: start, End: end, Step: step, Query: ql})
+		}
+		return PromBatchQueryRange(rt.PromClients, f, "")
+	}
+}
+
+func (rt *Router) boardReportGets(c *gin.Context) {
+	lst, err := models.BoardReportGets(rt.Ctx, ginx.UrlParamInt64(c, "id"))
+	ginx.NewRender(c).Data(lst, err)
+}
+
+func (rt *Router) boardReportGet(c *gin.Context) {
+	r := rt.boardReport(ginx.UrlParamInt64(c, "rid"))
+
+	me := c.MustGet("user").(*models.User)
+	if !me.IsAdmin() {
+		rt.bgroCheck(c, r.GroupId)
+	}
+
+	ginx.NewRender(c).Data(r, nil)
+}
+
+func (rt *Router) boardReport(id int64) *models.BoardReport {
+	r, err := models.BoardReportGet(rt.Ctx, "id = ?", id)
+	ginx.Dangerous(err)
+
+	if r == nil {
+		ginx.Bomb(http.StatusNotFound, "No such board report")
+	}
+
+	return r
+}
+
+// boardReportCheckBoard makes sure the user is able to read the board and the datasource of the report,
+// the panels on other datasources are checked when the report runs
+func (rt *Router) boardReportCheckBoard(c *gin.Context, r *models.BoardReport) {
+	bo := rt.Board(r.BoardId)
+
+	me := c.MustGet("user").(*models.User)
+	if !me.IsAdmin() {
+		rt.bgroCheck(c, bo.GroupId)
+	}
+
+	if r.DatasourceId > 0 {
+		rt.dsPermCheck(c, r.DatasourceId, true)
+	}
+}
+
+func (rt *Router) boardReportAdd(c *gin.Context) {
+	var r models.BoardReport
+	ginx.BindJSON(c, &r)
+
+	rt.boardReportCheckBoard(c, &r)
+
+	me := c.MustGet("user").(*models.User)
+	r.Id = 0
+	r.GroupId = ginx.UrlParamInt64(c, "id")
+	r.LastRunAt = 0
+	r.LastError = ""
+	r.CreateBy = me.Username
+	r.UpdateBy = me.Username
+
+	ginx.Dangerous(r.Add(rt.Ctx))
+	ginx.NewRender(c).Data(r, nil)
+}
+
+func (rt *Router) boardReportPut(c *gin.Context) {
+	var f models.BoardReport
+	ginx.BindJSON(c, &f)
+
+	r := rt.boardReport(ginx.UrlParamInt64(c, "rid"))
+	if r.GroupId != ginx.UrlParamInt64(c, "id") {
+		ginx.Bomb(http.StatusForbidden, "forbidden")
+	}
+
+	rt.boardReportCheckBoard(c, &f)
+
+	me := c.MustGet("user").(*models.User)
+	f.UpdateBy = me.Username
+
+	ginx.NewRender(c).Message(r.Update(rt.Ctx, f))
+}
+
+func (rt *Router) boardReportDel(c *gin.Context) {
+	var f idsForm
+	ginx.BindJSON(c, &f)
+	f.Verify()
+
+	ginx.NewRender(c).Message(models.BoardReportDels(rt.Ctx, f.Ids, ginx.UrlParamInt64(c, "id")))
+}
+
+// boardReportRun sends the report right away, the schedule is not affected
+func (rt *Router) boardReportRun(c *gin.Context) {
+	r := rt.boardReport(ginx.UrlParamInt64(c, "rid"))
+	if r.GroupId != ginx.UrlParamInt64(c, "id") {
+		ginx.Bomb(http.StatusForbidden, "forbidden")
+	}
+
+	ginx.NewRender(c).Message(report.Run(rt.Ctx, r, rt.ReportQuerier(), time.Now()))
+}
@@ -0,0 +1,121 @@
+package router
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ical"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+)
+
+const maxICSSize = 4 * 1024 * 1024
+
+func (rt *Router) calendarGets(c *gin.Context) {
+	lst, err := models.CalendarGets(rt.Ctx, ginx.QueryStr(c, "query", ""))
+	ginx.NewRender(c).Data(lst, err)
+}
+
+func (rt *Router) calendarGetsByService(c *gin.Context) {
+	lst, err := models.CalendarGetsAll(rt.Ctx)
+	ginx.NewRender(c).Data(lst, err)
+}
+
+func (rt *Router) calendarGet(c *gin.Context) {
+	ginx.NewRender(c).Data(rt.calendar(ginx.UrlParamInt64(c, "id")), nil)
+}
+
+func (rt *Router) calendar(id int64) *models.Calendar {
+	cal, err := models.CalendarGet(rt.Ctx, "id = ?", id)
+	ginx.Dangerous(err)
+
+	if cal == nil {
+		ginx.Bomb(http.StatusNotFound, "No such calendar")
+	}
+
+	return cal
+}
+
+func (rt *Router) calendarAdd(c *gin.Context) {
+	var cal models.Calendar
+	ginx.BindJSON(c, &cal)
+
+	me := c.MustGet("user").(*models.User)
+	cal.Id = 0
+	cal.CreateBy = me.Username
+	cal.UpdateBy = me.Username
+
+	ginx.Dangerous(cal.Add(rt.Ctx))
+	ginx.NewRender(c).Data(cal.Id, nil)
+}
+
+func (rt *Router) calendarPut(c *gin.Context) {
+	var f models.Calendar
+	ginx.BindJSON(c, &f)
+
+	cal := rt.calendar(ginx.UrlParamInt64(c, "id"))
+
+	me := c.MustGet("user").(*models.User)
+	f.UpdateBy = me.Username
+	ginx.NewRender(c).Message(cal.Update(rt.Ctx, f))
+}
+
+func (rt *Router) calendarsDel(c *gin.Context) {
+	var f idsForm
+	ginx.BindJSON(c, &f)
+	f.Verify()
+
+	ginx.NewRender(c).Message(models.CalendarDels(rt.Ctx, f.Ids))
+}
+
+// calendarImportICS merges the all-day events of an iCalendar file into the holidays of the calendar,
+// or into the workdays with as=workdays, e.g. the make-up workdays published with the public holidays.
+// The file is the body of the request or the file field of a multipart form.
+func (rt *Router) calendarImportICS(c *gin.Context) {
+	cal := rt.calendar(ginx.UrlParamInt64(c, "id"))
+
+	as := ginx.QueryStr(c, "as", models.CalendarHolidays)
+	if as != models.CalendarHolidays && as != models.CalendarWorkdays {
+		ginx.Bomb(http.StatusBadRequest, "as should be holidays or workdays")
+	}
+
+	var reader io.Reader = c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		f, err := file.Open()
+		ginx.Dangerous(err)
+		defer f.Close()
+		reader = f
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, maxICSSize+1))
+	ginx.Dangerous(err)
+
+	if len(data) > maxICSSize {
+		ginx.Bomb(http.StatusBadRequest, "ics file is too large")
+	}
+
+	events, err := ical.Parse(data, models.LoadTimezone(ginx.QueryStr(c, "timezone", "")))
+	if err != nil {
+		ginx.Bomb(http.StatusBadRequest, "invalid ics file: %v", err)
+	}
+
+	ref := *cal
+	var dates []string
+	for _, event := range events {
+		dates = append(dates, event.Dates()...)
+	}
+
+	if as == models.CalendarWorkdays {
+		ref.Workdays = append(append([]string{}, cal.Workdays...), dates...)
+	} else {
+		ref.Holidays = append(append([]string{}, cal.Holidays...), dates...)
+	}
+
+	me := c.MustGet("user").(*models.User)
+	ref.UpdateBy = me.Username
+	ginx.Dangerous(cal.Update(rt.Ctx, ref))
+
+	ginx.NewRender(c).Data(gin.H{"events": len(events), "dates": len(dates)}, nil)
+}
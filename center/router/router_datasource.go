@@ -44,7 +44,7 @@ func (rt *Router) datasourceList(c *gin.Context) {
 	user := c.MustGet("user").(*models.User)
 
 	list, err := models.GetDatasourcesGetsBy(rt.Ctx, typ, category, name, "")
-	Render(c, rt.DatasourceCache.DatasourceFilter(list, user), err)
+	Render(c, rt.dsPermFilter(c, rt.DatasourceCache.DatasourceFilter(list, user)), err)
 }
 
 func (rt *Router) datasourceGetsByService(c *gin.Context) {
@@ -81,7 +81,7 @@ func (rt *Router) datasourceBriefs(c *gin.Context) {
 
 	if !rt.Center.AnonymousAccess.PromQuerier {
 		user := c.MustGet("user").(*models.User)
-		dss = rt.DatasourceCache.DatasourceFilter(dss, user)
+		dss = rt.dsPermFilter(c, rt.DatasourceCache.DatasourceFilter(dss, user))
 	}
 
 	ginx.NewRender(c).Data(dss, err)
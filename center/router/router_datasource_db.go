@@ -16,6 +16,10 @@ func (rt *Router) ShowDatabases(c *gin.Context) {
 	var f models.QueryParam
 	ginx.BindJSON(c, &f)
 
+	if !rt.Center.AnonymousAccess.PromQuerier {
+		rt.dsPermCheck(c, f.DatasourceId, false)
+	}
+
 	plug, exists := dscache.DsCache.Get(f.Cate, f.DatasourceId)
 	if !exists {
 		logger.Warningf("cluster:%d not exists", f.DatasourceId)
@@ -46,6 +50,10 @@ func (rt *Router) ShowTables(c *gin.Context) {
 	var f models.QueryParam
 	ginx.BindJSON(c, &f)
 
+	if !rt.Center.AnonymousAccess.PromQuerier {
+		rt.dsPermCheck(c, f.DatasourceId, false)
+	}
+
 	plug, exists := dscache.DsCache.Get(f.Cate, f.DatasourceId)
 	if !exists {
 		logger.Warningf("cluster:%d not exists", f.DatasourceId)
@@ -76,6 +84,10 @@ func (rt *Router) DescribeTable(c *gin.Context) {
 	var f models.QueryParam
 	ginx.BindJSON(c, &f)
 
+	if !rt.Center.AnonymousAccess.PromQuerier {
+		rt.dsPermCheck(c, f.DatasourceId, false)
+	}
+
 	plug, exists := dscache.DsCache.Get(f.Cate, f.DatasourceId)
 	if !exists {
 		logger.Warningf("cluster:%d not exists", f.DatasourceId)
@@ -0,0 +1,408 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"github.com/toolkits/pkg/ginx"
+	"github.com/toolkits/pkg/logger"
+)
+
+const dsPermSubjectsKey = "ds_perm_subjects"
+
+func (rt *Router) dsPermUser(c *gin.Context) (*models.User, error) {
+	if user, has := c.Get("user"); has {
+		return user.(*models.User), nil
+	}
+
+	username := c.GetString("username")
+	if username == "" {
+		return nil, nil
+	}
+
+	user, err := models.UserGetByUsername(rt.Ctx, username)
+	if err != nil || user == nil {
+		return nil, err
+	}
+
+	c.Set("user", user)
+	return user, nil
+}
+
+func (rt *Router) dsPermSubjects(c *gin.Context, user *models.User) (*models.DsPermSubjects, error) {
+	if s, has := c.Get(dsPermSubjectsKey); has {
+		return s.(*models.DsPermSubjects), nil
+	}
+
+	s, err := models.DsPermSubjectsOf(rt.Ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set(dsPermSubjectsKey, s)
+	return s, nil
+}
+
+// dsPermGets returns the grants of the datasource, access is denied if the grants are unknown
+func (rt *Router) dsPermGets(dsId int64) ([]*models.DatasourcePerm, error) {
+	if rt.Ctx == nil || rt.DsPermCache == nil {
+		return nil, errors.New("datasource perms are not loaded")
+	}
+
+	return rt.DsPermCache.Get(dsId), nil
+}
+
+// dsAccess resolves the access of the current user to a datasource, the returned grants are the restrictions to apply
+func (rt *Router) dsAccess(c *gin.Context, dsId int64) (bool, []*models.DatasourcePerm, error) {
+	perms, err := rt.dsPermGets(dsId)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if len(perms) == 0 {
+		return true, nil, nil
+	}
+
+	user, err := rt.dsPermUser(c)
+	if err != nil || user == nil {
+		return false, nil, err
+	}
+
+	return dsPermResolve(user, perms, func() (*models.DsPermSubjects, error) {
+		return rt.dsPermSubjects(c, user)
+	})
+}
+
+// dsAccessOf resolves the access of a user out of a request, e.g. the owner of a scheduled report
+func (rt *Router) dsAccessOf(username string, dsId int64) (bool, []*models.DatasourcePerm, error) {
+	perms, err := rt.dsPermGets(dsId)
+	if err != nil {
+		return false, nil, err
+	}
+
+	if len(perms) == 0 {
+		return true, nil, nil
+	}
+
+	user, err := models.UserGetByUsername(rt.Ctx, username)
+	if err != nil || user == nil {
+		return false, nil, err
+	}
+
+	return dsPermResolve(user, perms, func() (*models.DsPermSubjects, error) {
+		return models.DsPermSubjectsOf(rt.Ctx, user)
+	})
+}
+
+func dsPermResolve(user *models.User, perms []*models.DatasourcePerm, subjects func() (*models.DsPermSubjects, error)) (bool, []*models.DatasourcePerm, error) {
+	if user.IsAdmin() {
+		return true, nil, nil
+	}
+
+	s, err := subjects()
+	if err != nil {
+		return false, nil, err
+	}
+
+	ok, restricted := models.DatasourcePermResolve(perms, s)
+	return ok, restricted, nil
+}
+
+// dsPermFilter drops the datasources the user is not granted, used by datasource listing
+func (rt *Router) dsPermFilter(c *gin.Context, list []*models.Datasource) []*models.Datasource {
+	ret := make([]*models.Datasource, 0, len(list))
+	for _, ds := range list {
+		ok, _, err := rt.dsAccess(c, ds.Id)
+		if err != nil {
+			logger.Warningf("failed to check perm of datasource %d: %v", ds.Id, err)
+			continue
+		}
+
+		if ok {
+			ret = append(ret, ds)
+		}
+	}
+	return ret
+}
+
+// dsPermRestrict applies the restrictions of the grants to a query of the datasource,
+// forced filters are supported by elasticsearch and opensearch, other datasources need a full grant
+func (rt *Router) dsPermRestrict(cate string, q interface{}, restricted []*models.DatasourcePerm) error {
+	if len(restricted) == 0 {
+		return nil
+	}
+
+	if query, ok := q.(Query); ok {
+		q = query.Query
+	}
+
+	switch cate {
+	case models.ELASTICSEARCH, models.OPENSEARCH:
+		m, ok := q.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("unsupported query")
+		}
+		index, err := rt.esIndexOf(m)
+		if err != nil {
+			return err
+		}
+		return esRestrict(m, index, restricted)
+	default:
+		return fmt.Errorf("restricted access is not supported by %s", cate)
+	}
+}
+
+func (rt *Router) esIndexOf(m map[string]interface{}) (string, error) {
+	if indexType, _ := m["index_type"].(string); indexType == "index_pattern" {
+		id, _ := strconv.ParseInt(fmt.Sprint(m["index_pattern"]), 10, 64)
+		ip, err := models.EsIndexPatternGet(rt.Ctx, "id = ?", id)
+		if err != nil {
+			return "", err
+		}
+
+		if ip == nil {
+			return "", fmt.Errorf("index pattern:%d not found", id)
+		}
+		return ip.Name, nil
+	}
+
+	index, _ := m["index"].(string)
+	return index, nil
+}
+
+// esRestrict takes the first grant matching the index and forces its filter, the filter is a query
+// clause of its own next to the filter of the query, see eslike.GetQueryString
+func esRestrict(m map[string]interface{}, index string, restricted []*models.DatasourcePerm) error {
+	for _, p := range restricted {
+		if !p.MatchIndex(index) {
+			continue
+		}
+
+		// replaces the grant filter of the request too
+		if p.Filter != "" {
+			m["grant_filter"] = p.Filter
+		} else {
+			delete(m, "grant_filter")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("index %s is not granted", index)
+}
+
+// esIndicesFilter keeps the indices matched by any grant
+func esIndicesFilter(indices []string, restricted []*models.DatasourcePerm) []string {
+	if len(restricted) == 0 {
+		return indices
+	}
+
+	ret := make([]string, 0, len(indices))
+	for _, index := range indices {
+		for _, p := range restricted {
+			if p.MatchIndex(index) {
+				ret = append(ret, index)
+				break
+			}
+		}
+	}
+	return ret
+}
+
+func esIndexGranted(index string, restricted []*models.DatasourcePerm) bool {
+	if len(restricted) == 0 {
+		return true
+	}
+
+	for _, p := range restricted {
+		if p.MatchIndex(index) {
+			return true
+		}
+	}
+	return false
+}
+
+// promMatchers parses the filter of the restricted grants, e.g. env="test",team=~"a|b". Matchers are
+// ANDed into every selector, so the grants of a user can not be ORed: they have to share one filter.
+func promMatchers(restricted []*models.DatasourcePerm) ([]*labels.Matcher, error) {
+	if len(restricted) == 0 {
+		return nil, nil
+	}
+
+	filter := restricted[0].Filter
+	for _, p := range restricted {
+		if p.Filter == "" {
+			return nil, fmt.Errorf("grant %d without filter is not supported by prometheus", p.Id)
+		}
+
+		if p.Filter != filter {
+			return nil, fmt.Errorf("grants %d and %d have different filters, merge them into one grant", restricted[0].Id, p.Id)
+		}
+	}
+
+	return models.PromFilterMatchers(filter)
+}
+
+// promInjectMatchers adds the matchers to every selector of the promql
+func promInjectMatchers(ql string, matchers []*labels.Matcher) (string, error) {
+	if len(matchers) == 0 {
+		return ql, nil
+	}
+
+	expr, err := parser.ParseExpr(ql)
+	if err != nil {
+		return "", err
+	}
+
+	parser.Inspect(expr, func(node parser.Node, _ []parser.Node) error {
+		if vs, ok := node.(*parser.VectorSelector); ok {
+			vs.LabelMatchers = append(vs.LabelMatchers, matchers...)
+		}
+		return nil
+	})
+
+	return expr.String(), nil
+}
+
+// promRestrictParams rewrites the promql param or the series matchers of the prometheus api,
+// it returns whether a matcher param is present
+func promRestrictParams(values url.Values, key string, matchers []*labels.Matcher) (bool, error) {
+	lst, has := values[key]
+	if !has {
+		return false, nil
+	}
+
+	for i := range lst {
+		ql, err := promInjectMatchers(lst[i], matchers)
+		if err != nil {
+			return true, err
+		}
+		lst[i] = ql
+	}
+	return true, nil
+}
+
+// promProxyRestrict makes a proxied prometheus request obey the forced label matchers,
+// only the query and series apis are allowed under restrictions
+func promProxyRestrict(req *http.Request, apiPath string, matchers []*labels.Matcher) error {
+	if len(matchers) == 0 {
+		return nil
+	}
+
+	apiPath = strings.TrimRight(apiPath, "/")
+
+	var key string
+	switch {
+	case strings.HasSuffix(apiPath, "/api/v1/query"), strings.HasSuffix(apiPath, "/api/v1/query_range"),
+		strings.HasSuffix(apiPath, "/api/v1/query_exemplars"):
+		key = "query"
+	case strings.HasSuffix(apiPath, "/api/v1/series"), strings.HasSuffix(apiPath, "/api/v1/labels"),
+		strings.HasPrefix(apiPath, "/api/v1/label/") && strings.HasSuffix(apiPath, "/values"):
+		key = "match[]"
+	default:
+		return fmt.Errorf("%s is not allowed under restricted access", apiPath)
+	}
+
+	query := req.URL.Query()
+	found, err := promRestrictParams(query, key, matchers)
+	if err != nil {
+		return err
+	}
+
+	if req.Method == http.MethodPost && strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			return err
+		}
+
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return err
+		}
+
+		has, err := promRestrictParams(form, key, matchers)
+		if err != nil {
+			return err
+		}
+		found = found || has
+
+		encoded := form.Encode()
+		req.Body = io.NopCloser(strings.NewReader(encoded))
+		req.ContentLength = int64(len(encoded))
+		req.Header.Set("Content-Length", strconv.Itoa(len(encoded)))
+	}
+
+	if !found {
+		if key == "query" {
+			return fmt.Errorf("query is blank")
+		}
+
+		strs := make([]string, 0, len(matchers))
+		for _, m := range matchers {
+			strs = append(strs, m.String())
+		}
+		query.Set(key, "{"+strings.Join(strs, ",")+"}")
+	}
+
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
+// promPermMatchers checks the grants of a prometheus datasource and returns the forced matchers
+func (rt *Router) promPermMatchers(c *gin.Context, dsId int64) []*labels.Matcher {
+	ok, restricted, err := rt.dsAccess(c, dsId)
+	ginx.Dangerous(err)
+
+	if !ok {
+		ginx.Bomb(http.StatusForbidden, "forbidden")
+	}
+
+	matchers, err := promMatchers(restricted)
+	if err != nil {
+		ginx.Bomb(http.StatusForbidden, err.Error())
+	}
+	return matchers
+}
+
+// dsPermCheck bombs when the user is not granted the datasource, restricted grants are allowed only if allowRestricted
+func (rt *Router) dsPermCheck(c *gin.Context, dsId int64, allowRestricted bool) []*models.DatasourcePerm {
+	ok, restricted, err := rt.dsAccess(c, dsId)
+	ginx.Dangerous(err)
+
+	if !ok || (!allowRestricted && len(restricted) > 0) {
+		ginx.Bomb(http.StatusForbidden, "forbidden")
+	}
+	return restricted
+}
+
+type datasourcePermForm struct {
+	DatasourceId int64                    `json:"datasource_id" binding:"required"`
+	Perms        []*models.DatasourcePerm `json:"perms"`
+}
+
+func (rt *Router) datasourcePermGets(c *gin.Context) {
+	lst, err := models.DatasourcePermGets(rt.Ctx, ginx.QueryInt64(c, "datasource_id"))
+	ginx.NewRender(c).Data(lst, err)
+}
+
+// datasourcePermPut replaces all the grants of a datasource, an empty list opens it to everyone
+func (rt *Router) datasourcePermPut(c *gin.Context) {
+	var f datasourcePermForm
+	ginx.BindJSON(c, &f)
+
+	ds, err := models.DatasourceGet(rt.Ctx, f.DatasourceId)
+	if err != nil {
+		ginx.Bomb(http.StatusNotFound, "no such datasource")
+	}
+
+	ginx.NewRender(c).Message(models.DatasourcePermSave(rt.Ctx, ds, f.Perms, c.MustGet("username").(string)))
+}
@@ -0,0 +1,113 @@
+package router
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/models"
+)
+
+func TestEsRestrict(t *testing.T) {
+	restricted := []*models.DatasourcePerm{{IndexPattern: "app-*", Filter: "env:test"}}
+
+	m := map[string]interface{}{"index": "app-2024", "filter": "level:error"}
+	if err := esRestrict(m, "app-2024", restricted); err != nil {
+		t.Fatal(err)
+	}
+
+	if m["filter"] != "level:error" || m["grant_filter"] != "env:test" {
+		t.Fatalf("unexpected filters: %v %v", m["filter"], m["grant_filter"])
+	}
+
+	// neither an injected parenthesis nor a grant filter of the request replaces the grant
+	m = map[string]interface{}{"index": "app-2024", "filter": "x) OR (*", "grant_filter": "*"}
+	if err := esRestrict(m, "app-2024", restricted); err != nil {
+		t.Fatal(err)
+	}
+
+	if m["filter"] != "x) OR (*" || m["grant_filter"] != "env:test" {
+		t.Fatalf("unexpected filters: %v %v", m["filter"], m["grant_filter"])
+	}
+
+	if err := esRestrict(map[string]interface{}{}, "payment-2024", restricted); err == nil {
+		t.Fatalf("index out of the pattern should be denied")
+	}
+
+	if err := (&Router{}).dsPermRestrict(models.MYSQL, map[string]interface{}{}, restricted); err == nil {
+		t.Fatalf("restricted grant should be denied for datasources without filter support")
+	}
+}
+
+func TestDsAccessWithoutContext(t *testing.T) {
+	if ok, _, err := (&Router{}).dsAccess(nil, 1); ok || err == nil {
+		t.Fatalf("access should be denied without the perm cache")
+	}
+}
+
+func TestPromMatchers(t *testing.T) {
+	same := []*models.DatasourcePerm{{Id: 1, Filter: `env="test"`}, {Id: 2, Filter: `env="test"`}}
+	if matchers, err := promMatchers(same); err != nil || len(matchers) != 1 {
+		t.Fatalf("grants of one filter should be merged: %v %v", matchers, err)
+	}
+
+	diff := []*models.DatasourcePerm{{Id: 1, Filter: `env="test"`}, {Id: 2, Filter: `team="a"`}}
+	if _, err := promMatchers(diff); err == nil {
+		t.Fatalf("grants of different filters should be rejected")
+	}
+
+	if _, err := promMatchers([]*models.DatasourcePerm{{Id: 1, IndexPattern: "app-*"}}); err == nil {
+		t.Fatalf("grant without filter should be rejected")
+	}
+}
+
+func TestPromInjectMatchers(t *testing.T) {
+	matchers, err := promMatchers([]*models.DatasourcePerm{{Filter: `env="test"`}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ql, err := promInjectMatchers(`sum(rate(http_requests_total{code="500"}[5m])) / sum(rate(http_requests_total[5m]))`, matchers)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `sum(rate(http_requests_total{code="500",env="test"}[5m])) / sum(rate(http_requests_total{env="test"}[5m]))`
+	if ql != want {
+		t.Fatalf("got %s, want %s", ql, want)
+	}
+}
+
+func TestPromProxyRestrict(t *testing.T) {
+	matchers, _ := promMatchers([]*models.DatasourcePerm{{Filter: `env="test"`}})
+
+	req, _ := http.NewRequest(http.MethodPost, "/api/n9e/proxy/1/api/v1/query_range?step=15",
+		strings.NewReader(url.Values{"query": {"up"}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	if err := promProxyRestrict(req, "/api/v1/query_range", matchers); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	form, _ := url.ParseQuery(string(body))
+	if form.Get("query") != `up{env="test"}` {
+		t.Fatalf("unexpected query: %s", form.Get("query"))
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/n9e/proxy/1/api/v1/label/ident/values", nil)
+	if err := promProxyRestrict(req, "/api/v1/label/ident/values", matchers); err != nil {
+		t.Fatal(err)
+	}
+
+	if req.URL.Query().Get("match[]") != `{env="test"}` {
+		t.Fatalf("unexpected match: %s", req.URL.RawQuery)
+	}
+
+	req, _ = http.NewRequest(http.MethodGet, "/api/n9e/proxy/1/api/v1/status/config", nil)
+	if err := promProxyRestrict(req, "/api/v1/status/config", matchers); err == nil {
+		t.Fatalf("status api should be denied")
+	}
+}
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"net/http"
+
 	"github.com/ccfos/nightingale/v6/datasource/es"
 	"github.com/ccfos/nightingale/v6/dscache"
 
@@ -41,6 +43,10 @@ func (rt *Router) QueryIndices(c *gin.Context) {
 	indices, err := plug.(*es.Elasticsearch).QueryIndices()
 	ginx.Dangerous(err)
 
+	if !rt.Center.AnonymousAccess.PromQuerier {
+		indices = esIndicesFilter(indices, rt.dsPermCheck(c, f.DatasourceId, true))
+	}
+
 	ginx.NewRender(c).Data(indices, nil)
 }
 
@@ -54,6 +60,10 @@ func (rt *Router) QueryFields(c *gin.Context) {
 		ginx.Bomb(200, "cluster not exists")
 	}
 
+	if !rt.Center.AnonymousAccess.PromQuerier && !esIndexGranted(f.Index, rt.dsPermCheck(c, f.DatasourceId, true)) {
+		ginx.Bomb(http.StatusForbidden, "forbidden")
+	}
+
 	fields, err := plug.(*es.Elasticsearch).QueryFields([]string{f.Index})
 	ginx.Dangerous(err)
 
@@ -70,6 +80,10 @@ func (rt *Router) QueryESVariable(c *gin.Context) {
 		ginx.Bomb(200, "cluster not exists")
 	}
 
+	if !rt.Center.AnonymousAccess.PromQuerier && !esIndexGranted(f.Index, rt.dsPermCheck(c, f.DatasourceId, true)) {
+		ginx.Bomb(http.StatusForbidden, "forbidden")
+	}
+
 	fields, err := plug.(*es.Elasticsearch).QueryFieldValue([]string{f.Index}, f.Query.Field, f.Query.Query)
 	ginx.Dangerous(err)
 
@@ -0,0 +1,50 @@
+package router
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/ccfos/nightingale/v6/center/archive"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+)
+
+func (rt *Router) eventArchiveStore() archive.Store {
+	store, err := archive.NewStore(rt.Center.EventRetention)
+	ginx.Dangerous(err)
+
+	if store == nil {
+		ginx.Bomb(http.StatusBadRequest, "event archive is not configured")
+	}
+	return store
+}
+
+func (rt *Router) alertHisEventArchives(c *gin.Context) {
+	files, err := rt.eventArchiveStore().List()
+	ginx.NewRender(c).Data(files, err)
+}
+
+type eventArchiveImportForm struct {
+	Name string `json:"name"`
+}
+
+// alertHisEventArchiveImport restores an archive file for investigation, the file is uploaded
+// as the multipart field file or named by its path in the archive
+func (rt *Router) alertHisEventArchiveImport(c *gin.Context) {
+	var r io.ReadCloser
+	if fh, err := c.FormFile("file"); err == nil {
+		r, err = fh.Open()
+		ginx.Dangerous(err)
+	} else {
+		var f eventArchiveImportForm
+		ginx.BindJSON(c, &f)
+
+		r, err = rt.eventArchiveStore().Open(f.Name)
+		ginx.Dangerous(err)
+	}
+	defer r.Close()
+
+	n, err := archive.Import(rt.Ctx, r, rt.Center.EventRetention.BatchSize)
+	ginx.NewRender(c).Data(gin.H{"imported": n}, err)
+}
@@ -40,6 +40,8 @@ func (rt *Router) statistic(c *gin.Context) {
 		model = models.NotifyRule{}
 	case "notify_channel":
 		model = models.NotifyChannel{}
+	case "calendar":
+		model = models.Calendar{}
 	case "event_pipeline":
 		statistics, err = models.EventPipelineStatistics(rt.Ctx)
 		ginx.NewRender(c).Data(statistics, err)
@@ -102,7 +102,7 @@ func (rt *Router) alertMuteTryRun(c *gin.Context) {
 		}
 	}
 
-	match, err := mute.MatchMute(&curEvent, &f.AlertMute)
+	match, err := mute.MatchMute(&curEvent, &f.AlertMute, rt.CalendarCache.Get)
 	if err != nil {
 		// 对错误信息进行 i18n 翻译
 		translatedErr := i18n.Sprintf(c.GetHeader("X-Language"), err.Error())
@@ -163,7 +163,7 @@ func (rt *Router) user() gin.HandlerFunc {
 			ginx.Bomb(http.StatusUnauthorized, "unauthorized")
 		}
 
-		if user == nil {
+		if user == nil || user.IsDisabled() {
 			ginx.Bomb(http.StatusUnauthorized, "unauthorized")
 		}
 
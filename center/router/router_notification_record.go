@@ -24,6 +24,7 @@ type SubRule struct {
 }
 
 type Record struct {
+	Id           int64  `json:"id"`
 	NotifyRuleId int64  `json:"notify_rule_id"`
 	Target       string `json:"target"`
 	Username     string `json:"username"`
@@ -110,6 +111,7 @@ func buildNotificationResponse(ctx *ctx.Context, nl []*models.NotificaitonRecord
 			n.Target = replaceLastEightChars(n.Target)
 		}
 		record := Record{
+			Id:           n.Id,
 			Target:       n.Target,
 			Status:       n.Status,
 			Detail:       n.Details,
@@ -0,0 +1,150 @@
+package router
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/alert/dispatch"
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+)
+
+func (rt *Router) notifyOutboxGets(c *gin.Context) {
+	status := ginx.QueryInt(c, "status", -1)
+	ruleId := ginx.QueryInt64(c, "notify_rule_id", 0)
+	limit := ginx.QueryInt(c, "limit", 20)
+
+	total, err := models.NotifyOutboxTotal(rt.Ctx, status, ruleId)
+	ginx.Dangerous(err)
+
+	list, err := models.NotifyOutboxGets(rt.Ctx, status, ruleId, limit, ginx.Offset(c, limit))
+	ginx.Dangerous(err)
+
+	ginx.NewRender(c).Data(gin.H{
+		"list":  list,
+		"total": total,
+	}, nil)
+}
+
+// notificationRecordResend sends the notification of a record again. A record of the outbox requeues
+// its outbox row, older records are rebuilt from the event and the notify rule.
+func (rt *Router) notificationRecordResend(c *gin.Context) {
+	// the wildcard shares its name with /event-notify-records/:eid, it is the record id here
+	record, err := models.NotificaitonRecordGet(rt.Ctx, ginx.UrlParamInt64(c, "eid"))
+	ginx.Dangerous(err)
+
+	if record == nil {
+		ginx.Bomb(http.StatusNotFound, "no such notification record")
+	}
+
+	if record.OutboxId > 0 {
+		o, err := models.NotifyOutboxGet(rt.Ctx, record.OutboxId)
+		ginx.Dangerous(err)
+
+		if o != nil {
+			ginx.NewRender(c).Data(o.Id, models.NotifyOutboxRequeue(rt.Ctx, o.Id))
+			return
+		}
+	}
+
+	o, err := rt.notifyOutboxOfRecord(record)
+	ginx.Dangerous(err)
+
+	o.NextRetryAt = time.Now().Unix()
+	ginx.NewRender(c).Data(o.Id, o.Add(rt.Ctx))
+}
+
+// notifyOutboxOfRecord rebuilds the send of a record with the current notify rule and channel,
+// the recipients are narrowed to the target of the record when they can be found
+func (rt *Router) notifyOutboxOfRecord(record *models.NotificaitonRecord) (*models.NotifyOutbox, error) {
+	if record.NotifyRuleID == 0 {
+		return nil, fmt.Errorf("only notifications of notify rules can be resent")
+	}
+
+	his, err := models.AlertHisEventGetById(rt.Ctx, record.EventId)
+	if err != nil {
+		return nil, err
+	}
+
+	if his == nil {
+		return nil, fmt.Errorf("event:%d not found", record.EventId)
+	}
+
+	rule, err := models.NotifyRuleGet(rt.Ctx, "id = ?", record.NotifyRuleID)
+	if err != nil {
+		return nil, err
+	}
+
+	if rule == nil {
+		return nil, fmt.Errorf("notify rule:%d not found", record.NotifyRuleID)
+	}
+
+	for i := range rule.NotifyConfigs {
+		notifyConfig := &rule.NotifyConfigs[i]
+		channel, err := models.NotifyChannelGet(rt.Ctx, "id = ?", notifyConfig.ChannelID)
+		if err != nil {
+			return nil, err
+		}
+
+		// records of smtp channels are written with the channel Email
+		if channel == nil || (channel.Name != record.Channel && !(record.Channel == "Email" && channel.RequestType == "smtp")) {
+			continue
+		}
+
+		events := []*models.AlertCurEvent{his.ToCur()}
+		o := models.NewNotifyOutbox(events, rule.ID, channel)
+
+		var contactKey string
+		if channel.ParamConfig != nil && channel.ParamConfig.UserInfo != nil {
+			contactKey = channel.ParamConfig.UserInfo.ContactKey
+		}
+
+		sendtos, _, customParams := dispatch.GetNotifyConfigParams(notifyConfig, contactKey, rt.UserCache, rt.UserGroupCache)
+		o.CustomParams = customParams
+		o.Sendtos = narrowSendtos(sendtos, record.Target)
+
+		if channel.RequestType == "flashduty" {
+			o.FlashDutyChannelId, _ = strconv.ParseInt(record.Target, 10, 64)
+			return o, nil
+		}
+
+		tpl, err := models.MessageTemplateGet(rt.Ctx, "id = ?", notifyConfig.TemplateID)
+		if err != nil {
+			return nil, err
+		}
+
+		if tpl == nil {
+			return nil, fmt.Errorf("message template:%d not found", notifyConfig.TemplateID)
+		}
+
+		o.TplContent = tpl.RenderEvent(events)
+		return o, nil
+	}
+
+	return nil, fmt.Errorf("channel %s not found in notify rule:%d", record.Channel, rule.ID)
+}
+
+// narrowSendtos keeps the recipients in the target of a record, all of them if none is found
+func narrowSendtos(sendtos []string, target string) []string {
+	targets := make(map[string]struct{})
+	for _, t := range strings.Split(target, ",") {
+		targets[t] = struct{}{}
+	}
+
+	var ret []string
+	for _, s := range sendtos {
+		if _, has := targets[s]; has {
+			ret = append(ret, s)
+		}
+	}
+
+	if len(ret) == 0 {
+		return sendtos
+	}
+	return ret
+}
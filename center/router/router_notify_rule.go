@@ -153,7 +153,7 @@ func (rt *Router) notifyTest(c *gin.Context) {
 	for _, he := range hisEvents {
 		event := he.ToCur()
 		event.SetTagsMap()
-		if err := dispatch.NotifyRuleMatchCheck(&f.NotifyConfig, event); err != nil {
+		if err := dispatch.NotifyRuleMatchCheck(&f.NotifyConfig, event, rt.CalendarCache.Get); err != nil {
 			ginx.Bomb(http.StatusBadRequest, err.Error())
 		}
 
@@ -7,12 +7,14 @@ import (
 	"net"
 	"net/http"
 	"net/http/httputil"
+	"net/url"
 	"regexp"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/ccfos/nightingale/v6/models"
 	"github.com/ccfos/nightingale/v6/pkg/poster"
 	pkgprom "github.com/ccfos/nightingale/v6/pkg/prom"
 	"github.com/ccfos/nightingale/v6/prom"
@@ -39,11 +41,20 @@ func (rt *Router) promBatchQueryRange(c *gin.Context) {
 	var f BatchQueryForm
 	ginx.Dangerous(c.BindJSON(&f))
 
-	lst, err := PromBatchQueryRange(rt.PromClients, f)
+	if !rt.Center.AnonymousAccess.PromQuerier {
+		matchers := rt.promPermMatchers(c, f.DatasourceId)
+		for i := range f.Queries {
+			ql, err := promInjectMatchers(f.Queries[i].Query, matchers)
+			ginx.Dangerous(err)
+			f.Queries[i].Query = ql
+		}
+	}
+
+	lst, err := PromBatchQueryRange(rt.PromClients, f, queryLimitUser(c))
 	ginx.NewRender(c).Data(lst, err)
 }
 
-func PromBatchQueryRange(pc *prom.PromClientMap, f BatchQueryForm) ([]model.Value, error) {
+func PromBatchQueryRange(pc *prom.PromClientMap, f BatchQueryForm, user string) ([]model.Value, error) {
 	var lst []model.Value
 
 	cli := pc.GetCli(f.DatasourceId)
@@ -52,13 +63,7 @@ func PromBatchQueryRange(pc *prom.PromClientMap, f BatchQueryForm) ([]model.Valu
 	}
 
 	for _, item := range f.Queries {
-		r := pkgprom.Range{
-			Start: time.Unix(item.Start, 0),
-			End:   time.Unix(item.End, 0),
-			Step:  time.Duration(item.Step) * time.Second,
-		}
-
-		resp, _, err := cli.QueryRange(context.Background(), item.Query, r)
+		resp, err := promQueryRangeCached(context.Background(), user, f.DatasourceId, cli, item)
 		if err != nil {
 			return lst, err
 		}
@@ -82,11 +87,20 @@ func (rt *Router) promBatchQueryInstant(c *gin.Context) {
 	var f BatchInstantForm
 	ginx.Dangerous(c.BindJSON(&f))
 
-	lst, err := PromBatchQueryInstant(rt.PromClients, f)
+	if !rt.Center.AnonymousAccess.PromQuerier {
+		matchers := rt.promPermMatchers(c, f.DatasourceId)
+		for i := range f.Queries {
+			ql, err := promInjectMatchers(f.Queries[i].Query, matchers)
+			ginx.Dangerous(err)
+			f.Queries[i].Query = ql
+		}
+	}
+
+	lst, err := PromBatchQueryInstant(rt.PromClients, f, queryLimitUser(c))
 	ginx.NewRender(c).Data(lst, err)
 }
 
-func PromBatchQueryInstant(pc *prom.PromClientMap, f BatchInstantForm) ([]model.Value, error) {
+func PromBatchQueryInstant(pc *prom.PromClientMap, f BatchInstantForm, user string) ([]model.Value, error) {
 	var lst []model.Value
 
 	cli := pc.GetCli(f.DatasourceId)
@@ -96,7 +110,12 @@ func PromBatchQueryInstant(pc *prom.PromClientMap, f BatchInstantForm) ([]model.
 	}
 
 	for _, item := range f.Queries {
-		resp, _, err := cli.Query(context.Background(), item.Query, time.Unix(item.Time, 0))
+		var resp model.Value
+		err := limitQuery(context.Background(), user, f.DatasourceId, models.PROMETHEUS, item.Query, func(ctx context.Context) error {
+			var err error
+			resp, _, err = cli.Query(ctx, item.Query, time.Unix(item.Time, 0))
+			return err
+		})
 		if err != nil {
 			return lst, err
 		}
@@ -115,7 +134,41 @@ func (rt *Router) dsProxy(c *gin.Context) {
 		return
 	}
 
+	if !rt.Center.AnonymousAccess.PromQuerier {
+		ok, restricted, err := rt.dsAccess(c, dsId)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		if !ok {
+			c.String(http.StatusForbidden, "forbidden")
+			return
+		}
+
+		// the forced filter of other datasources can not be applied to raw requests
+		if len(restricted) > 0 && ds.PluginType != models.PROMETHEUS {
+			c.String(http.StatusForbidden, "forbidden")
+			return
+		}
+
+		matchers, err := promMatchers(restricted)
+		if err == nil {
+			err = promProxyRestrict(c.Request, c.Param("url"), matchers)
+		}
+
+		if err != nil {
+			c.String(http.StatusForbidden, err.Error())
+			return
+		}
+	}
+
 	target, err := ds.HTTPJson.ParseUrl()
+	if ha, ok := rt.PromClients.GetCli(dsId).(*pkgprom.HAAPI); ok {
+		// proxy to the healthy replica rather than a random one
+		target, err = url.Parse(ha.PreferredUrl())
+	}
+
 	if err != nil {
 		c.String(http.StatusInternalServerError, "invalid urls: %s", ds.HTTPJson.GetUrls())
 		return
@@ -195,8 +248,23 @@ func (rt *Router) dsProxy(c *gin.Context) {
 		ModifyResponse: modifyResponse,
 	}
 
-	proxy.ServeHTTP(c.Writer, c.Request)
+	apiPath := strings.TrimRight(c.Param("url"), "/")
+	if !strings.HasSuffix(apiPath, "/api/v1/query") && !strings.HasSuffix(apiPath, "/api/v1/query_range") {
+		proxy.ServeHTTP(c.Writer, c.Request)
+		return
+	}
+
+	// the queries are limited like the other queries, the query of a form body is not read to keep the body intact
+	served := false
+	err = limitQuery(c.Request.Context(), queryLimitUser(c), dsId, ds.PluginType, c.Request.URL.Query().Get("query"), func(ctx context.Context) error {
+		served = true
+		proxy.ServeHTTP(c.Writer, c.Request.WithContext(ctx))
+		return nil
+	})
 
+	if !served && err != nil {
+		c.String(http.StatusTooManyRequests, err.Error())
+	}
 }
 
 var (
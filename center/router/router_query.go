@@ -1,6 +1,7 @@
 package router
 
 import (
+	"context"
 	"fmt"
 	"sort"
 	"sync"
@@ -12,8 +13,24 @@ import (
 	"github.com/toolkits/pkg/logger"
 )
 
-func CheckDsPerm(c *gin.Context, dsId int64, cate string, q interface{}) bool {
-	// todo: 后续需要根据 cate 判断是否需要权限
+// CheckDsPerm checks the datasource grants of the user, restricted grants rewrite the query in place
+// so that it only reads the granted indices under the forced filter
+func (rt *Router) CheckDsPerm(c *gin.Context, dsId int64, cate string, q interface{}) bool {
+	ok, restricted, err := rt.dsAccess(c, dsId)
+	if err != nil {
+		logger.Warningf("failed to check perm of datasource %d: %v", dsId, err)
+		return false
+	}
+
+	if !ok {
+		return false
+	}
+
+	if err := rt.dsPermRestrict(cate, q, restricted); err != nil {
+		logger.Infof("datasource %d query restricted: user=%s err=%v", dsId, c.GetString("username"), err)
+		return false
+	}
+
 	return true
 }
 
@@ -30,8 +47,10 @@ type Query struct {
 }
 
 type Exp struct {
-	Exp string `json:"exp"`
-	Ref string `json:"ref"`
+	Exp     string        `json:"exp"`
+	Ref     string        `json:"ref"`
+	Joins   []models.Join `json:"joins"`    // same as the joins of alert triggers, refs are joined by identical labels if empty
+	JoinRef string        `json:"join_ref"` // the ref the joins start from
 }
 
 type LogResp struct {
@@ -39,14 +58,14 @@ type LogResp struct {
 	List  []interface{} `json:"list"`
 }
 
-func QueryLogBatchConcurrently(anonymousAccess bool, ctx *gin.Context, f QueryFrom) (LogResp, error) {
+func (rt *Router) QueryLogBatchConcurrently(anonymousAccess bool, ctx *gin.Context, f QueryFrom) (LogResp, error) {
 	var resp LogResp
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 	var errs []error
 
 	for _, q := range f.Queries {
-		if !anonymousAccess && !CheckDsPerm(ctx, q.Did, q.DsCate, q) {
+		if !anonymousAccess && !rt.CheckDsPerm(ctx, q.Did, q.DsCate, q) {
 			return LogResp{}, fmt.Errorf("forbidden")
 		}
 
@@ -60,7 +79,13 @@ func QueryLogBatchConcurrently(anonymousAccess bool, ctx *gin.Context, f QueryFr
 		go func(query Query) {
 			defer wg.Done()
 
-			data, total, err := plug.QueryLog(ctx.Request.Context(), query.Query)
+			var data []interface{}
+			var total int64
+			err := limitQuery(ctx.Request.Context(), queryLimitUser(ctx), query.Did, query.DsCate, query.Query, func(c context.Context) error {
+				var err error
+				data, total, err = plug.QueryLog(c, query.Query)
+				return err
+			})
 			mu.Lock()
 			defer mu.Unlock()
 			if err != nil {
@@ -98,7 +123,7 @@ func (rt *Router) QueryLogBatch(c *gin.Context) {
 	var f QueryFrom
 	ginx.BindJSON(c, &f)
 
-	resp, err := QueryLogBatchConcurrently(rt.Center.AnonymousAccess.PromQuerier, c, f)
+	resp, err := rt.QueryLogBatchConcurrently(rt.Center.AnonymousAccess.PromQuerier, c, f)
 	if err != nil {
 		ginx.Bomb(200, "err:%v", err)
 	}
@@ -106,14 +131,14 @@ func (rt *Router) QueryLogBatch(c *gin.Context) {
 	ginx.NewRender(c).Data(resp, nil)
 }
 
-func QueryDataConcurrently(anonymousAccess bool, ctx *gin.Context, f models.QueryParam) ([]models.DataResp, error) {
+func (rt *Router) QueryDataConcurrently(anonymousAccess bool, ctx *gin.Context, f models.QueryParam) ([]models.DataResp, error) {
 	var resp []models.DataResp
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 	var errs []error
 
 	for _, q := range f.Querys {
-		if !anonymousAccess && !CheckDsPerm(ctx, f.DatasourceId, f.Cate, q) {
+		if !anonymousAccess && !rt.CheckDsPerm(ctx, f.DatasourceId, f.Cate, q) {
 			return nil, fmt.Errorf("forbidden")
 		}
 
@@ -127,7 +152,7 @@ func QueryDataConcurrently(anonymousAccess bool, ctx *gin.Context, f models.Quer
 		go func(query interface{}) {
 			defer wg.Done()
 
-			datas, err := plug.QueryData(ctx.Request.Context(), query)
+			datas, err := queryDataCached(ctx.Request.Context(), queryLimitUser(ctx), f.Cate, f.DatasourceId, plug, query)
 			if err != nil {
 				logger.Warningf("query data error: req:%+v err:%v", query, err)
 				mu.Lock()
@@ -165,10 +190,10 @@ func QueryDataConcurrently(anonymousAccess bool, ctx *gin.Context, f models.Quer
 }
 
 func (rt *Router) QueryData(c *gin.Context) {
-	var f models.QueryParam
+	var f QueryDataForm
 	ginx.BindJSON(c, &f)
 
-	resp, err := QueryDataConcurrently(rt.Center.AnonymousAccess.PromQuerier, c, f)
+	resp, err := rt.QueryDataWithExps(rt.Center.AnonymousAccess.PromQuerier, c, f)
 	if err != nil {
 		ginx.Bomb(200, "err:%v", err)
 	}
@@ -177,14 +202,14 @@ func (rt *Router) QueryData(c *gin.Context) {
 }
 
 // QueryLogConcurrently 并发查询日志
-func QueryLogConcurrently(anonymousAccess bool, ctx *gin.Context, f models.QueryParam) (LogResp, error) {
+func (rt *Router) QueryLogConcurrently(anonymousAccess bool, ctx *gin.Context, f models.QueryParam) (LogResp, error) {
 	var resp LogResp
 	var mu sync.Mutex
 	var wg sync.WaitGroup
 	var errs []error
 
 	for _, q := range f.Querys {
-		if !anonymousAccess && !CheckDsPerm(ctx, f.DatasourceId, f.Cate, q) {
+		if !anonymousAccess && !rt.CheckDsPerm(ctx, f.DatasourceId, f.Cate, q) {
 			return LogResp{}, fmt.Errorf("forbidden")
 		}
 
@@ -198,7 +223,13 @@ func QueryLogConcurrently(anonymousAccess bool, ctx *gin.Context, f models.Query
 		go func(query interface{}) {
 			defer wg.Done()
 
-			data, total, err := plug.QueryLog(ctx.Request.Context(), query)
+			var data []interface{}
+			var total int64
+			err := limitQuery(ctx.Request.Context(), queryLimitUser(ctx), f.DatasourceId, f.Cate, query, func(c context.Context) error {
+				var err error
+				data, total, err = plug.QueryLog(c, query)
+				return err
+			})
 			logger.Debugf("query log: req:%+v resp:%+v", query, data)
 			if err != nil {
 				errMsg := fmt.Sprintf("query data error: %v query:%v\n ", err, query)
@@ -233,7 +264,7 @@ func (rt *Router) QueryLogV2(c *gin.Context) {
 	var f models.QueryParam
 	ginx.BindJSON(c, &f)
 
-	resp, err := QueryLogConcurrently(rt.Center.AnonymousAccess.PromQuerier, c, f)
+	resp, err := rt.QueryLogConcurrently(rt.Center.AnonymousAccess.PromQuerier, c, f)
 	ginx.NewRender(c).Data(resp, err)
 }
 
@@ -243,7 +274,7 @@ func (rt *Router) QueryLog(c *gin.Context) {
 
 	var resp []interface{}
 	for _, q := range f.Querys {
-		if !rt.Center.AnonymousAccess.PromQuerier && !CheckDsPerm(c, f.DatasourceId, f.Cate, q) {
+		if !rt.Center.AnonymousAccess.PromQuerier && !rt.CheckDsPerm(c, f.DatasourceId, f.Cate, q) {
 			ginx.Bomb(200, "forbidden")
 		}
 
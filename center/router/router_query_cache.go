@@ -0,0 +1,147 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/center/qcache"
+	"github.com/ccfos/nightingale/v6/datasource"
+	"github.com/ccfos/nightingale/v6/models"
+	pkgprom "github.com/ccfos/nightingale/v6/pkg/prom"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/common/model"
+	"github.com/toolkits/pkg/ginx"
+)
+
+// promQueryRangeCached serves the range query from the query cache, only the missing tail is sent to prometheus
+func promQueryRangeCached(ctx context.Context, user string, dsId int64, cli pkgprom.API, item QueryFormItem) (model.Value, error) {
+	if qcache.Default == nil {
+		var resp model.Value
+		err := limitQuery(ctx, user, dsId, models.PROMETHEUS, item.Query, func(ctx context.Context) error {
+			var err error
+			resp, _, err = cli.QueryRange(ctx, item.Query, pkgprom.Range{
+				Start: time.Unix(item.Start, 0),
+				End:   time.Unix(item.End, 0),
+				Step:  time.Duration(item.Step) * time.Second,
+			})
+			return err
+		})
+		return resp, err
+	}
+
+	series, err := qcache.Default.QueryRange(ctx, dsId, models.PROMETHEUS+":"+item.Query, item.Start, item.End, item.Step,
+		func(ctx context.Context, start, end int64) ([]models.DataResp, error) {
+			var resp model.Value
+			err := limitQuery(ctx, user, dsId, models.PROMETHEUS, item.Query, func(ctx context.Context) error {
+				var err error
+				resp, _, err = cli.QueryRange(ctx, item.Query, pkgprom.Range{
+					Start: time.Unix(start, 0),
+					End:   time.Unix(end, 0),
+					Step:  time.Duration(item.Step) * time.Second,
+				})
+				return err
+			})
+			if err != nil {
+				return nil, err
+			}
+
+			matrix, ok := resp.(model.Matrix)
+			if !ok {
+				return nil, fmt.Errorf("unexpected result type of range query: %v", resp.Type())
+			}
+			return qcache.MatrixToSeries(matrix), nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return qcache.SeriesToMatrix(series), nil
+}
+
+// queryDataCached serves the queries of elasticsearch and opensearch from the query cache, their date
+// histograms are aligned to the interval like the steps of prometheus. Other datasources are queried directly.
+func queryDataCached(ctx context.Context, user, cate string, dsId int64, plug datasource.Datasource, query interface{}) ([]models.DataResp, error) {
+	queryData := func(ctx context.Context, query interface{}) ([]models.DataResp, error) {
+		var ret []models.DataResp
+		err := limitQuery(ctx, user, dsId, cate, query, func(ctx context.Context) error {
+			var err error
+			ret, err = plug.QueryData(ctx, query)
+			return err
+		})
+		return ret, err
+	}
+
+	m, ok := query.(map[string]interface{})
+	if qcache.Default == nil || !ok || (cate != models.ELASTICSEARCH && cate != models.OPENSEARCH) {
+		return queryData(ctx, query)
+	}
+
+	// the points of an offset query are not in the range of the query
+	start, end, interval := toInt64(m["start"]), toInt64(m["end"]), toInt64(m["interval"])
+	if start == 0 || end == 0 || interval <= 0 || toInt64(m["offset"]) != 0 {
+		return queryData(ctx, query)
+	}
+
+	rest := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k != "start" && k != "end" {
+			rest[k] = v
+		}
+	}
+
+	key, err := json.Marshal(rest)
+	if err != nil {
+		return queryData(ctx, query)
+	}
+
+	return qcache.Default.QueryRange(ctx, dsId, cate+":"+string(key), start, end, interval,
+		func(ctx context.Context, start, end int64) ([]models.DataResp, error) {
+			q := make(map[string]interface{}, len(m))
+			for k, v := range rest {
+				q[k] = v
+			}
+
+			// the bucket at end only counts the documents at that moment, query one more
+			// interval so that it is complete, the cache drops the extra bucket
+			q["start"] = start
+			q["end"] = end + interval
+			return queryData(ctx, q)
+		})
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case json.Number:
+		i, _ := n.Int64()
+		return i
+	}
+	return 0
+}
+
+type queryCachePurgeForm struct {
+	Ids []int64 `json:"ids" binding:"required"`
+}
+
+func (rt *Router) datasourceQueryCachePurge(c *gin.Context) {
+	var f queryCachePurgeForm
+	ginx.BindJSON(c, &f)
+
+	if qcache.Default == nil {
+		ginx.Bomb(400, "query cache is disabled")
+	}
+
+	for _, id := range f.Ids {
+		ginx.Dangerous(qcache.Default.Purge(c.Request.Context(), id))
+	}
+
+	ginx.NewRender(c).Message(nil)
+}
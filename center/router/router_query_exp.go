@@ -0,0 +1,204 @@
+package router
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/ccfos/nightingale/v6/alert/eval"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/parser"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/common/model"
+	"github.com/toolkits/pkg/logger"
+)
+
+// QueryDataForm is the body of /ds-query, cate datasource_id and query are the single datasource form,
+// queries may read several datasources and exps are computed over the refs of the queries
+type QueryDataForm struct {
+	models.QueryParam
+	Queries []Query `json:"queries"`
+	Exps    []Exp   `json:"exps"`
+}
+
+func (rt *Router) QueryDataWithExps(anonymousAccess bool, ctx *gin.Context, f QueryDataForm) ([]models.DataResp, error) {
+	var resp []models.DataResp
+	if len(f.Querys) > 0 {
+		series, err := rt.QueryDataConcurrently(anonymousAccess, ctx, f.QueryParam)
+		if err != nil {
+			return nil, err
+		}
+		resp = append(resp, series...)
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var errs []error
+
+	for _, q := range f.Queries {
+		wg.Add(1)
+		go func(q Query) {
+			defer wg.Done()
+
+			param := models.QueryParam{Cate: q.DsCate, DatasourceId: q.Did, Querys: []interface{}{q.Query}}
+			series, err := rt.QueryDataConcurrently(anonymousAccess, ctx, param)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+				return
+			}
+
+			for i := range series {
+				if series[i].Ref == "" {
+					series[i].Ref = q.Ref
+				}
+			}
+			resp = append(resp, series...)
+		}(q)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	if len(f.Exps) == 0 {
+		return resp, nil
+	}
+
+	series, err := EvalExps(f.Exps, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(resp, series...), nil
+}
+
+// EvalExps computes the expressions over the series of the refs, e.g. $A / $B * 100.
+// Series are grouped with the joins of the expression like alert triggers do, then every timestamp
+// present in all the series of a group is computed. Later expressions can use the refs of earlier ones.
+func EvalExps(exps []Exp, series []models.DataResp) ([]models.DataResp, error) {
+	byRef := make(map[string][]models.DataResp)
+	for _, s := range series {
+		byRef[s.Ref] = append(byRef[s.Ref], s)
+	}
+
+	var ret []models.DataResp
+	for _, exp := range exps {
+		if exp.Ref == "" {
+			return nil, fmt.Errorf("ref of exp %s is blank", exp.Exp)
+		}
+
+		if _, has := byRef[exp.Ref]; has {
+			return nil, fmt.Errorf("ref %s of exp %s is used by a query", exp.Ref, exp.Exp)
+		}
+
+		computed := evalExp(exp, byRef)
+		byRef[exp.Ref] = computed
+		ret = append(ret, computed...)
+	}
+
+	return ret, nil
+}
+
+func evalExp(exp Exp, byRef map[string][]models.DataResp) []models.DataResp {
+	seriesStore := make(map[uint64]models.DataResp)
+	seriesTagIndexes := make(map[string]map[uint64][]uint64)
+	for ref, lst := range byRef {
+		// refs left out of the expression would break the grouping
+		if !parser.HasRef(exp.Exp, ref) {
+			continue
+		}
+
+		seriesTagIndex := make(map[uint64][]uint64)
+		eval.MakeSeriesMap(lst, seriesTagIndex, seriesStore)
+		seriesTagIndexes[ref] = seriesTagIndex
+	}
+
+	trigger := models.Trigger{Exp: exp.Exp, Joins: exp.Joins, JoinRef: exp.JoinRef}
+	groups := eval.ProcessJoins(0, trigger, seriesTagIndexes, seriesStore)
+
+	var ret []models.DataResp
+	for _, hashes := range groups {
+		sort.Slice(hashes, func(i, j int) bool {
+			return hashes[i] < hashes[j]
+		})
+
+		var members []models.DataResp
+		for _, h := range hashes {
+			if s, exists := seriesStore[h]; exists {
+				members = append(members, s)
+			}
+		}
+
+		if s, ok := evalGroup(exp, members); ok {
+			ret = append(ret, s)
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Metric.String() < ret[j].Metric.String()
+	})
+
+	return ret
+}
+
+// evalGroup computes the expression at every timestamp of the group, labels of the members are merged
+func evalGroup(exp Exp, members []models.DataResp) (models.DataResp, bool) {
+	ret := models.DataResp{Ref: exp.Ref, Metric: make(model.Metric), Query: exp.Exp}
+	if len(members) == 0 {
+		return ret, false
+	}
+
+	points := make(map[float64]map[string]interface{})
+	for _, s := range members {
+		for k, v := range s.Metric {
+			if k == model.MetricNameLabel {
+				continue
+			}
+			if _, has := ret.Metric[k]; !has {
+				ret.Metric[k] = v
+			}
+		}
+
+		for _, v := range s.Values {
+			if len(v) < 2 {
+				continue
+			}
+
+			if _, has := points[v[0]]; !has {
+				points[v[0]] = make(map[string]interface{})
+			}
+			points[v[0]]["$"+s.Ref] = v[1]
+		}
+	}
+
+	timestamps := make([]float64, 0, len(points))
+	for ts := range points {
+		timestamps = append(timestamps, ts)
+	}
+	sort.Float64s(timestamps)
+
+	for _, ts := range timestamps {
+		// a ref missing at this timestamp fails the compilation, the point is skipped
+		v, err := parser.MathCalc(exp.Exp, points[ts])
+		if err != nil {
+			logger.Debugf("exp:%s ts:%v data:%v error:%v", exp.Exp, ts, points[ts], err)
+			continue
+		}
+
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+
+		ret.Values = append(ret.Values, []float64{ts, v})
+	}
+
+	ret.Metric[model.MetricNameLabel] = model.LabelValue(exp.Ref)
+	return ret, len(ret.Values) > 0
+}
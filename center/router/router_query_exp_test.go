@@ -0,0 +1,60 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/prometheus/common/model"
+)
+
+func TestEvalExps(t *testing.T) {
+	series := []models.DataResp{
+		{Ref: "A", Metric: model.Metric{"__name__": "A_count", "service": "api"}, Values: [][]float64{{60, 5}, {120, 10}, {180, 1}}},
+		{Ref: "A", Metric: model.Metric{"__name__": "A_count", "service": "web"}, Values: [][]float64{{60, 2}}},
+		{Ref: "B", Metric: model.Metric{"service": "api", "db": "ck"}, Values: [][]float64{{60, 100}, {120, 0}, {180, 50}}},
+	}
+
+	exps := []Exp{
+		{
+			Exp:     "$A / $B * 100",
+			Ref:     "C",
+			JoinRef: "A",
+			Joins:   []models.Join{{JoinType: "inner_join", Ref: "B", On: []string{"service"}}},
+		},
+		{Exp: "$C * 2", Ref: "D"},
+	}
+
+	ret, err := EvalExps(exps, series)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(ret) != 2 {
+		t.Fatalf("unexpected result: %+v", ret)
+	}
+
+	c := ret[0]
+	if c.Ref != "C" || c.Metric["service"] != "api" || c.Metric["db"] != "ck" {
+		t.Fatalf("unexpected series: %+v", c)
+	}
+
+	// division by zero at 120 is dropped
+	want := [][]float64{{60, 5}, {180, 2}}
+	if len(c.Values) != len(want) {
+		t.Fatalf("got %v, want %v", c.Values, want)
+	}
+	for i := range want {
+		if c.Values[i][0] != want[i][0] || c.Values[i][1] != want[i][1] {
+			t.Fatalf("got %v, want %v", c.Values, want)
+		}
+	}
+
+	if d := ret[1]; d.Ref != "D" || len(d.Values) != 2 || d.Values[1][1] != 4 {
+		t.Fatalf("unexpected series: %+v", d)
+	}
+
+	if _, err := EvalExps([]Exp{{Exp: "$A", Ref: "A"}}, series); err == nil {
+		t.Fatalf("ref used by a query should be rejected")
+	}
+}
@@ -0,0 +1,89 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/ccfos/nightingale/v6/center/cstats"
+	"github.com/ccfos/nightingale/v6/pkg/qlimit"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+)
+
+const maxQueryText = 4096
+
+// limitQuery runs a datasource query of the user within the limits of qlimit, the durations are recorded in cstats
+func limitQuery(ctx context.Context, user string, dsId int64, cate string, query interface{}, fn func(ctx context.Context) error) error {
+	entry, err := qlimit.Default.Do(ctx, qlimit.Query{
+		Source:       "center",
+		User:         user,
+		DatasourceId: dsId,
+		Cate:         cate,
+		Text:         queryText(query),
+	}, fn)
+
+	ds := fmt.Sprintf("%d", dsId)
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+
+	cstats.QueryQueueDuration.WithLabelValues(ds).Observe(float64(entry.Queued) / 1000)
+	cstats.QueryDuration.WithLabelValues(ds, cate, status).Observe(float64(entry.Duration) / 1000)
+	return err
+}
+
+func queryText(query interface{}) string {
+	var text string
+	switch q := query.(type) {
+	case string:
+		text = q
+	default:
+		bs, _ := json.Marshal(q)
+		text = string(bs)
+	}
+
+	if len(text) > maxQueryText {
+		text = text[:maxQueryText] + "..."
+	}
+	return text
+}
+
+// queryLimitUser is the user the quotas apply to, anonymous queries share one quota
+func queryLimitUser(c *gin.Context) string {
+	if user := c.GetString("username"); user != "" {
+		return user
+	}
+	return "anonymous"
+}
+
+// querySlowLogGets returns the slow queries of this process, the log is a ring buffer in memory: it is lost
+// on restart, and the queries of the other center instances and of the alert engines are not in it
+func (rt *Router) querySlowLogGets(c *gin.Context) {
+	dsId := ginx.QueryInt64(c, "datasource_id", 0)
+	user := ginx.QueryStr(c, "user", "")
+	source := ginx.QueryStr(c, "source", "")
+	query := ginx.QueryStr(c, "query", "")
+	limit := ginx.QueryInt(c, "limit", 100)
+
+	lst := qlimit.Default.SlowLogs(func(e qlimit.Entry) bool {
+		if dsId > 0 && e.DatasourceId != dsId {
+			return false
+		}
+
+		if user != "" && e.User != user {
+			return false
+		}
+
+		if source != "" && e.Source != source {
+			return false
+		}
+
+		return query == "" || strings.Contains(e.Text, query)
+	}, limit)
+
+	ginx.NewRender(c).Data(lst, nil)
+}
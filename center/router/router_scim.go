@@ -0,0 +1,992 @@
+package router
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/logger"
+)
+
+// SCIM 2.0 provisioning, see RFC 7643 and RFC 7644
+// only the attributes that can be mapped to models.User and models.UserGroup are supported
+
+const (
+	scimSchemaUser  = "urn:ietf:params:scim:schemas:core:2.0:User"
+	scimSchemaGroup = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	scimSchemaList  = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	scimSchemaError = "urn:ietf:params:scim:api:messages:2.0:Error"
+	scimSchemaSPC   = "urn:ietf:params:scim:schemas:core:2.0:ServiceProviderConfig"
+
+	scimBelong       = "scim"
+	scimContentType  = "application/scim+json"
+	scimDefaultCount = 100
+	scimMaxCount     = 1000
+)
+
+type scimName struct {
+	Formatted  string `json:"formatted,omitempty"`
+	GivenName  string `json:"givenName,omitempty"`
+	FamilyName string `json:"familyName,omitempty"`
+}
+
+type scimMultiValue struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+type scimRef struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+	Ref     string `json:"$ref,omitempty"`
+}
+
+type scimMeta struct {
+	ResourceType string `json:"resourceType"`
+	Created      string `json:"created,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Location     string `json:"location,omitempty"`
+}
+
+type scimUser struct {
+	Schemas      []string         `json:"schemas"`
+	Id           string           `json:"id,omitempty"`
+	ExternalId   string           `json:"externalId,omitempty"`
+	UserName     string           `json:"userName"`
+	Name         *scimName        `json:"name,omitempty"`
+	DisplayName  string           `json:"displayName,omitempty"`
+	Active       *bool            `json:"active,omitempty"`
+	Emails       []scimMultiValue `json:"emails,omitempty"`
+	PhoneNumbers []scimMultiValue `json:"phoneNumbers,omitempty"`
+	Groups       []scimRef        `json:"groups,omitempty"`
+	Meta         *scimMeta        `json:"meta,omitempty"`
+}
+
+type scimGroup struct {
+	Schemas     []string  `json:"schemas"`
+	Id          string    `json:"id,omitempty"`
+	ExternalId  string    `json:"externalId,omitempty"`
+	DisplayName string    `json:"displayName"`
+	Members     []scimRef `json:"members"`
+	Meta        *scimMeta `json:"meta,omitempty"`
+}
+
+type scimListResponse struct {
+	Schemas      []string      `json:"schemas"`
+	TotalResults int64         `json:"totalResults"`
+	StartIndex   int           `json:"startIndex"`
+	ItemsPerPage int           `json:"itemsPerPage"`
+	Resources    []interface{} `json:"Resources"`
+}
+
+type scimPatchRequest struct {
+	Schemas    []string      `json:"schemas"`
+	Operations []scimPatchOp `json:"Operations"`
+}
+
+type scimPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+type scimFilter struct {
+	Attr  string
+	Value string
+}
+
+func scimRender(c *gin.Context, code int, obj interface{}) {
+	c.Header("Content-Type", scimContentType)
+	c.JSON(code, obj)
+}
+
+func scimError(c *gin.Context, code int, scimType, detail string) {
+	body := gin.H{
+		"schemas": []string{scimSchemaError},
+		"status":  strconv.Itoa(code),
+		"detail":  detail,
+	}
+
+	if scimType != "" {
+		body["scimType"] = scimType
+	}
+
+	scimRender(c, code, body)
+	c.Abort()
+}
+
+func (rt *Router) scimAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if rt.Center.Scim.Token == "" || token == "" ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(rt.Center.Scim.Token)) != 1 {
+			scimError(c, http.StatusUnauthorized, "", "unauthorized")
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// parseScimFilter supports the `attr eq "value"` form, which is what IdPs send to look up existing resources
+func parseScimFilter(filter string) (*scimFilter, error) {
+	filter = strings.TrimSpace(filter)
+	if filter == "" {
+		return nil, nil
+	}
+
+	arr := strings.SplitN(filter, " ", 3)
+	if len(arr) != 3 || !strings.EqualFold(arr[1], "eq") {
+		return nil, fmt.Errorf("unsupported filter: %s", filter)
+	}
+
+	value := strings.TrimSpace(arr[2])
+	if unquoted, err := strconv.Unquote(value); err == nil {
+		value = unquoted
+	}
+
+	return &scimFilter{Attr: strings.ToLower(arr[0]), Value: value}, nil
+}
+
+func scimPaging(c *gin.Context) (startIndex, count int) {
+	startIndex, _ = strconv.Atoi(c.Query("startIndex"))
+	if startIndex < 1 {
+		startIndex = 1
+	}
+
+	count, err := strconv.Atoi(c.Query("count"))
+	if err != nil || count < 0 {
+		count = scimDefaultCount
+	}
+
+	if count > scimMaxCount {
+		count = scimMaxCount
+	}
+
+	return startIndex, count
+}
+
+func scimTime(ts int64) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).UTC().Format(time.RFC3339)
+}
+
+func scimLocation(c *gin.Context, resource string, id int64) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/scim/v2/%s/%d", scheme, c.Request.Host, resource, id)
+}
+
+// scimBool accepts both json booleans and strings, Azure AD sends "True" / "False"
+func scimBool(raw json.RawMessage) (bool, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err == nil {
+		return b, nil
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return false, err
+	}
+
+	return strconv.ParseBool(strings.ToLower(s))
+}
+
+// scimString accepts a plain string or a multi-valued attribute, the primary value wins
+func scimString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	var values []scimMultiValue
+	if err := json.Unmarshal(raw, &values); err == nil {
+		return scimPrimary(values)
+	}
+
+	return ""
+}
+
+func scimPrimary(values []scimMultiValue) string {
+	for _, v := range values {
+		if v.Primary {
+			return v.Value
+		}
+	}
+
+	if len(values) > 0 {
+		return values[0].Value
+	}
+
+	return ""
+}
+
+// scimPath normalizes a patch path, e.g. `emails[type eq "work"].value` -> `emails.value`
+func scimPath(path string) string {
+	path = strings.TrimPrefix(path, scimSchemaUser+":")
+	if i := strings.Index(path, "["); i >= 0 {
+		if j := strings.Index(path[i:], "]"); j >= 0 {
+			path = path[:i] + path[i+j+1:]
+		}
+	}
+	return strings.ToLower(path)
+}
+
+// scimPathFilterValue extracts the value of a path filter, e.g. `members[value eq "2"]` -> `2`
+func scimPathFilterValue(path string) string {
+	i := strings.Index(path, "[")
+	j := strings.LastIndex(path, "]")
+	if i < 0 || j < i {
+		return ""
+	}
+
+	f, err := parseScimFilter(path[i+1 : j])
+	if err != nil || f == nil {
+		return ""
+	}
+
+	return f.Value
+}
+
+func scimMemberIds(refs []scimRef) []int64 {
+	ids := make([]int64, 0, len(refs))
+	for _, ref := range refs {
+		id, err := strconv.ParseInt(ref.Value, 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (rt *Router) scimUserResource(c *gin.Context, user *models.User) *scimUser {
+	active := !user.IsDisabled()
+	su := &scimUser{
+		Schemas:     []string{scimSchemaUser},
+		Id:          strconv.FormatInt(user.Id, 10),
+		ExternalId:  user.ExternalId,
+		UserName:    user.Username,
+		Name:        &scimName{Formatted: user.Nickname},
+		DisplayName: user.Nickname,
+		Active:      &active,
+		Meta: &scimMeta{
+			ResourceType: "User",
+			Created:      scimTime(user.CreateAt),
+			LastModified: scimTime(user.UpdateAt),
+			Location:     scimLocation(c, "Users", user.Id),
+		},
+	}
+
+	if user.Email != "" {
+		su.Emails = []scimMultiValue{{Value: user.Email, Type: "work", Primary: true}}
+	}
+
+	if user.Phone != "" {
+		su.PhoneNumbers = []scimMultiValue{{Value: user.Phone, Type: "work", Primary: true}}
+	}
+
+	gids, err := models.MyGroupIds(rt.Ctx, user.Id)
+	if err != nil {
+		logger.Warningf("scim: failed to query groups of user %s: %v", user.Username, err)
+		return su
+	}
+
+	groups, err := models.UserGroupGetByIds(rt.Ctx, gids)
+	if err != nil {
+		logger.Warningf("scim: failed to query groups of user %s: %v", user.Username, err)
+		return su
+	}
+
+	for _, ug := range groups {
+		su.Groups = append(su.Groups, scimRef{
+			Value:   strconv.FormatInt(ug.Id, 10),
+			Display: ug.Name,
+			Ref:     scimLocation(c, "Groups", ug.Id),
+		})
+	}
+
+	return su
+}
+
+func (rt *Router) scimGroupResource(c *gin.Context, ug *models.UserGroup) (*scimGroup, error) {
+	sg := &scimGroup{
+		Schemas:     []string{scimSchemaGroup},
+		Id:          strconv.FormatInt(ug.Id, 10),
+		ExternalId:  ug.ExternalId,
+		DisplayName: ug.Name,
+		Members:     []scimRef{},
+		Meta: &scimMeta{
+			ResourceType: "Group",
+			Created:      scimTime(ug.CreateAt),
+			LastModified: scimTime(ug.UpdateAt),
+			Location:     scimLocation(c, "Groups", ug.Id),
+		},
+	}
+
+	ids, err := models.MemberIds(rt.Ctx, ug.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := models.UserGetsByIds(rt.Ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		sg.Members = append(sg.Members, scimRef{
+			Value:   strconv.FormatInt(user.Id, 10),
+			Display: user.Username,
+			Ref:     scimLocation(c, "Users", user.Id),
+		})
+	}
+
+	return sg, nil
+}
+
+// scimUserFromRequest returns nil after rendering an error if the target user cannot be found
+func (rt *Router) scimUserFromRequest(c *gin.Context) *models.User {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "no such user")
+		return nil
+	}
+
+	user, err := models.UserGetById(rt.Ctx, id)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return nil
+	}
+
+	if user == nil {
+		scimError(c, http.StatusNotFound, "", "no such user")
+		return nil
+	}
+
+	return user
+}
+
+// scimGroupFromRequest returns nil after rendering an error if the target group cannot be found
+func (rt *Router) scimGroupFromRequest(c *gin.Context) *models.UserGroup {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		scimError(c, http.StatusNotFound, "", "no such group")
+		return nil
+	}
+
+	ug, err := models.UserGroupGetById(rt.Ctx, id)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return nil
+	}
+
+	if ug == nil {
+		scimError(c, http.StatusNotFound, "", "no such group")
+		return nil
+	}
+
+	return ug
+}
+
+func (rt *Router) scimServiceProviderConfig(c *gin.Context) {
+	scimRender(c, http.StatusOK, gin.H{
+		"schemas":        []string{scimSchemaSPC},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scimMaxCount},
+		"changePassword": gin.H{"supported": false},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": false},
+		"authenticationSchemes": []gin.H{{
+			"type":        "oauthbearertoken",
+			"name":        "OAuth Bearer Token",
+			"description": "Authentication scheme using the static bearer token configured in Center.Scim.Token",
+			"primary":     true,
+		}},
+	})
+}
+
+func (rt *Router) scimUsersGet(c *gin.Context) {
+	filter, err := parseScimFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	var (
+		where string
+		args  []interface{}
+	)
+
+	if filter != nil {
+		switch filter.Attr {
+		case "username":
+			where, args = "username = ?", []interface{}{filter.Value}
+		case "externalid":
+			where, args = "external_id = ?", []interface{}{filter.Value}
+		case "id":
+			where, args = "id = ?", []interface{}{filter.Value}
+		case "displayname":
+			where, args = "nickname = ?", []interface{}{filter.Value}
+		case "emails", "emails.value":
+			where, args = "email = ?", []interface{}{filter.Value}
+		default:
+			scimError(c, http.StatusBadRequest, "invalidFilter", "unsupported filter attribute: "+filter.Attr)
+			return
+		}
+	}
+
+	startIndex, count := scimPaging(c)
+	users, total, err := models.UserGetsPaging(rt.Ctx, count, startIndex-1, where, args...)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	resources := make([]interface{}, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, rt.scimUserResource(c, user))
+	}
+
+	scimRender(c, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimSchemaList},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (rt *Router) scimUserGet(c *gin.Context) {
+	user := rt.scimUserFromRequest(c)
+	if user == nil {
+		return
+	}
+
+	scimRender(c, http.StatusOK, rt.scimUserResource(c, user))
+}
+
+// applyScimUser copies the attributes of a full SCIM user representation to user
+func applyScimUser(user *models.User, su *scimUser) {
+	if su.UserName != "" {
+		user.Username = su.UserName
+	}
+
+	nickname := su.DisplayName
+	if nickname == "" && su.Name != nil {
+		nickname = su.Name.Formatted
+		if nickname == "" {
+			nickname = strings.TrimSpace(su.Name.GivenName + " " + su.Name.FamilyName)
+		}
+	}
+	if nickname != "" {
+		user.Nickname = nickname
+	}
+
+	user.ExternalId = su.ExternalId
+	user.Email = scimPrimary(su.Emails)
+	user.Phone = scimPrimary(su.PhoneNumbers)
+
+	if su.Active != nil && !*su.Active {
+		user.Disabled = 1
+	} else {
+		user.Disabled = 0
+	}
+}
+
+func (rt *Router) scimUserAdd(c *gin.Context) {
+	var su scimUser
+	if err := c.ShouldBindJSON(&su); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	if su.UserName == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "userName is required")
+		return
+	}
+
+	exists, err := models.UserGetByUsername(rt.Ctx, su.UserName)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	if exists != nil {
+		scimError(c, http.StatusConflict, "uniqueness", "userName already exists")
+		return
+	}
+
+	user := new(models.User)
+	user.FullSsoFields(scimBelong, su.UserName, su.UserName, "", "", rt.Center.Scim.DefaultRoles)
+	applyScimUser(user, &su)
+
+	if err := user.Verify(); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	if err := user.Add(rt.Ctx); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	scimRender(c, http.StatusCreated, rt.scimUserResource(c, user))
+}
+
+func (rt *Router) scimUserSave(c *gin.Context, user *models.User, oldUsername string) {
+	if user.Username != oldUsername {
+		exists, err := models.UserGetByUsername(rt.Ctx, user.Username)
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+
+		if exists != nil {
+			scimError(c, http.StatusConflict, "uniqueness", "userName already exists")
+			return
+		}
+	}
+
+	if err := user.Verify(); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	user.UpdateAt = time.Now().Unix()
+	user.UpdateBy = scimBelong
+	err := user.Update(rt.Ctx, "username", "nickname", "email", "phone", "disabled", "external_id", "update_at", "update_by")
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	scimRender(c, http.StatusOK, rt.scimUserResource(c, user))
+}
+
+func (rt *Router) scimUserPut(c *gin.Context) {
+	user := rt.scimUserFromRequest(c)
+	if user == nil {
+		return
+	}
+
+	var su scimUser
+	if err := c.ShouldBindJSON(&su); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	oldUsername := user.Username
+	applyScimUser(user, &su)
+	rt.scimUserSave(c, user, oldUsername)
+}
+
+// applyScimUserAttr applies a single patch operation on a user attribute, unknown attributes are ignored
+func applyScimUserAttr(user *models.User, op, path string, value json.RawMessage) error {
+	remove := op == "remove"
+
+	switch scimPath(path) {
+	case "active":
+		if remove {
+			user.Disabled = 0
+			return nil
+		}
+
+		active, err := scimBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid value of active: %s", string(value))
+		}
+
+		if active {
+			user.Disabled = 0
+		} else {
+			user.Disabled = 1
+		}
+	case "username":
+		if !remove {
+			user.Username = scimString(value)
+		}
+	case "externalid":
+		if remove {
+			user.ExternalId = ""
+		} else {
+			user.ExternalId = scimString(value)
+		}
+	case "displayname", "name.formatted":
+		if remove {
+			user.Nickname = ""
+		} else {
+			user.Nickname = scimString(value)
+		}
+	case "emails", "emails.value":
+		if remove {
+			user.Email = ""
+		} else {
+			user.Email = scimString(value)
+		}
+	case "phonenumbers", "phonenumbers.value":
+		if remove {
+			user.Phone = ""
+		} else {
+			user.Phone = scimString(value)
+		}
+	}
+
+	return nil
+}
+
+func (rt *Router) scimUserPatch(c *gin.Context) {
+	user := rt.scimUserFromRequest(c)
+	if user == nil {
+		return
+	}
+
+	var req scimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	oldUsername := user.Username
+	for _, operation := range req.Operations {
+		op := strings.ToLower(operation.Op)
+		if operation.Path != "" {
+			if err := applyScimUserAttr(user, op, operation.Path, operation.Value); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+			continue
+		}
+
+		// no path, value is a map of attributes
+		var attrs map[string]json.RawMessage
+		if err := json.Unmarshal(operation.Value, &attrs); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+			return
+		}
+
+		for attr, value := range attrs {
+			if err := applyScimUserAttr(user, op, attr, value); err != nil {
+				scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+				return
+			}
+		}
+	}
+
+	rt.scimUserSave(c, user, oldUsername)
+}
+
+func (rt *Router) scimUserDel(c *gin.Context) {
+	user := rt.scimUserFromRequest(c)
+	if user == nil {
+		return
+	}
+
+	if err := user.Del(rt.Ctx); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (rt *Router) scimGroupsGet(c *gin.Context) {
+	filter, err := parseScimFilter(c.Query("filter"))
+	if err != nil {
+		scimError(c, http.StatusBadRequest, "invalidFilter", err.Error())
+		return
+	}
+
+	var (
+		where string
+		args  []interface{}
+	)
+
+	if filter != nil {
+		switch filter.Attr {
+		case "displayname":
+			where, args = "name = ?", []interface{}{filter.Value}
+		case "externalid":
+			where, args = "external_id = ?", []interface{}{filter.Value}
+		case "id":
+			where, args = "id = ?", []interface{}{filter.Value}
+		default:
+			scimError(c, http.StatusBadRequest, "invalidFilter", "unsupported filter attribute: "+filter.Attr)
+			return
+		}
+	}
+
+	startIndex, count := scimPaging(c)
+	groups, total, err := models.UserGroupGetsPaging(rt.Ctx, count, startIndex-1, where, args...)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	excludeMembers := strings.Contains(c.Query("excludedAttributes"), "members")
+
+	resources := make([]interface{}, 0, len(groups))
+	for _, ug := range groups {
+		sg, err := rt.scimGroupResource(c, ug)
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+
+		if excludeMembers {
+			sg.Members = nil
+		}
+		resources = append(resources, sg)
+	}
+
+	scimRender(c, http.StatusOK, scimListResponse{
+		Schemas:      []string{scimSchemaList},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: len(resources),
+		Resources:    resources,
+	})
+}
+
+func (rt *Router) scimGroupRender(c *gin.Context, code int, ug *models.UserGroup) {
+	sg, err := rt.scimGroupResource(c, ug)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	scimRender(c, code, sg)
+}
+
+func (rt *Router) scimGroupGet(c *gin.Context) {
+	ug := rt.scimGroupFromRequest(c)
+	if ug == nil {
+		return
+	}
+
+	rt.scimGroupRender(c, http.StatusOK, ug)
+}
+
+func (rt *Router) scimGroupAdd(c *gin.Context) {
+	var sg scimGroup
+	if err := c.ShouldBindJSON(&sg); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	if sg.DisplayName == "" {
+		scimError(c, http.StatusBadRequest, "invalidValue", "displayName is required")
+		return
+	}
+
+	num, err := models.UserGroupCount(rt.Ctx, "name=?", sg.DisplayName)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	if num > 0 {
+		scimError(c, http.StatusConflict, "uniqueness", "displayName already exists")
+		return
+	}
+
+	ug := &models.UserGroup{
+		Name:       sg.DisplayName,
+		ExternalId: sg.ExternalId,
+		CreateBy:   scimBelong,
+		UpdateBy:   scimBelong,
+	}
+
+	if err := ug.Add(rt.Ctx); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	if err := ug.AddMembers(rt.Ctx, scimMemberIds(sg.Members)); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	rt.scimGroupRender(c, http.StatusCreated, ug)
+}
+
+// scimGroupSave persists the name of ug and, if members is not nil, replaces its members
+func (rt *Router) scimGroupSave(c *gin.Context, ug *models.UserGroup, oldName string, members []int64) {
+	if ug.Name != oldName {
+		num, err := models.UserGroupCount(rt.Ctx, "name=? and id<>?", ug.Name, ug.Id)
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+
+		if num > 0 {
+			scimError(c, http.StatusConflict, "uniqueness", "displayName already exists")
+			return
+		}
+	}
+
+	if members != nil {
+		curIds, err := models.MemberIds(rt.Ctx, ug.Id)
+		if err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+
+		if err := ug.DelMembers(rt.Ctx, curIds); err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+
+		if err := ug.AddMembers(rt.Ctx, members); err != nil {
+			scimError(c, http.StatusInternalServerError, "", err.Error())
+			return
+		}
+	}
+
+	ug.UpdateAt = time.Now().Unix()
+	ug.UpdateBy = scimBelong
+	if err := ug.Update(rt.Ctx, "Name", "ExternalId", "UpdateAt", "UpdateBy"); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+		return
+	}
+
+	rt.scimGroupRender(c, http.StatusOK, ug)
+}
+
+func (rt *Router) scimGroupPut(c *gin.Context) {
+	ug := rt.scimGroupFromRequest(c)
+	if ug == nil {
+		return
+	}
+
+	var sg scimGroup
+	if err := c.ShouldBindJSON(&sg); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	oldName := ug.Name
+	if sg.DisplayName != "" {
+		ug.Name = sg.DisplayName
+	}
+	ug.ExternalId = sg.ExternalId
+
+	rt.scimGroupSave(c, ug, oldName, scimMemberIds(sg.Members))
+}
+
+func (rt *Router) scimGroupPatch(c *gin.Context) {
+	ug := rt.scimGroupFromRequest(c)
+	if ug == nil {
+		return
+	}
+
+	var req scimPatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+		return
+	}
+
+	curIds, err := models.MemberIds(rt.Ctx, ug.Id)
+	if err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	members := make(map[int64]struct{}, len(curIds))
+	for _, id := range curIds {
+		members[id] = struct{}{}
+	}
+
+	oldName := ug.Name
+	for _, operation := range req.Operations {
+		op := strings.ToLower(operation.Op)
+		path := scimPath(operation.Path)
+
+		attrs := map[string]json.RawMessage{}
+		if path != "" {
+			attrs[path] = operation.Value
+		} else if err := json.Unmarshal(operation.Value, &attrs); err != nil {
+			scimError(c, http.StatusBadRequest, "invalidSyntax", err.Error())
+			return
+		}
+
+		for attr, value := range attrs {
+			switch strings.ToLower(attr) {
+			case "displayname":
+				if op != "remove" {
+					ug.Name = scimString(value)
+				}
+			case "externalid":
+				if op == "remove" {
+					ug.ExternalId = ""
+				} else {
+					ug.ExternalId = scimString(value)
+				}
+			case "members":
+				var refs []scimRef
+				if len(value) > 0 {
+					if err := json.Unmarshal(value, &refs); err != nil {
+						scimError(c, http.StatusBadRequest, "invalidValue", err.Error())
+						return
+					}
+				}
+
+				if op == "remove" && len(refs) == 0 {
+					if v := scimPathFilterValue(operation.Path); v != "" {
+						refs = []scimRef{{Value: v}}
+					} else {
+						// remove all members
+						members = map[int64]struct{}{}
+						continue
+					}
+				}
+
+				if op == "replace" {
+					members = map[int64]struct{}{}
+				}
+
+				for _, id := range scimMemberIds(refs) {
+					if op == "remove" {
+						delete(members, id)
+					} else {
+						members[id] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+
+	ids := make([]int64, 0, len(members))
+	for id := range members {
+		ids = append(ids, id)
+	}
+
+	rt.scimGroupSave(c, ug, oldName, ids)
+}
+
+func (rt *Router) scimGroupDel(c *gin.Context) {
+	ug := rt.scimGroupFromRequest(c)
+	if ug == nil {
+		return
+	}
+
+	if err := ug.Del(rt.Ctx); err != nil {
+		scimError(c, http.StatusInternalServerError, "", err.Error())
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
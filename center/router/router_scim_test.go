@@ -0,0 +1,52 @@
+package router
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/models"
+)
+
+func TestParseScimFilter(t *testing.T) {
+	f, err := parseScimFilter(`userName eq "alice@example.com"`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if f.Attr != "username" || f.Value != "alice@example.com" {
+		t.Errorf("got %+v", f)
+	}
+
+	if _, err := parseScimFilter(`userName sw "a"`); err == nil {
+		t.Errorf("expected error for unsupported operator")
+	}
+
+	if f, _ := parseScimFilter(""); f != nil {
+		t.Errorf("expected nil filter for empty input")
+	}
+}
+
+func TestApplyScimUserAttr(t *testing.T) {
+	user := &models.User{Username: "alice", Email: "a@example.com"}
+
+	if err := applyScimUserAttr(user, "replace", "active", json.RawMessage(`"False"`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !user.IsDisabled() {
+		t.Errorf("user should be disabled")
+	}
+
+	applyScimUserAttr(user, "replace", `emails[type eq "work"].value`, json.RawMessage(`"b@example.com"`))
+	if user.Email != "b@example.com" {
+		t.Errorf("got email %s", user.Email)
+	}
+
+	applyScimUserAttr(user, "remove", "phoneNumbers", nil)
+	if user.Phone != "" {
+		t.Errorf("phone should be removed")
+	}
+
+	if v := scimPathFilterValue(`members[value eq "12"]`); v != "12" {
+		t.Errorf("got member value %s", v)
+	}
+}
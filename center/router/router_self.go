@@ -26,6 +26,7 @@ type selfProfileForm struct {
 	Email    string       `json:"email"`
 	Portrait string       `json:"portrait"`
 	Contacts ormx.JSONObj `json:"contacts"`
+	Timezone string       `json:"timezone"`
 }
 
 func (rt *Router) selfProfilePut(c *gin.Context) {
@@ -43,6 +44,7 @@ func (rt *Router) selfProfilePut(c *gin.Context) {
 	user.Email = f.Email
 	user.Portrait = f.Portrait
 	user.Contacts = f.Contacts
+	user.Timezone = f.Timezone
 	user.UpdateBy = user.Username
 
 	if flashduty.NeedSyncUser(rt.Ctx) {
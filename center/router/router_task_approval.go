@@ -0,0 +1,139 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/ccfos/nightingale/v6/alert/sender"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/strx"
+
+	"github.com/gin-gonic/gin"
+	"github.com/toolkits/pkg/ginx"
+)
+
+type taskApprovalForm struct {
+	Action string `json:"action"` // approve reject
+}
+
+func (f *taskApprovalForm) approved() bool {
+	switch f.Action {
+	case "approve":
+		return true
+	case "reject":
+		return false
+	}
+
+	ginx.Bomb(http.StatusBadRequest, "action should be approve or reject")
+	return false
+}
+
+func (rt *Router) taskApprovalGets(c *gin.Context) {
+	bgid := ginx.UrlParamInt64(c, "id")
+	status := ginx.QueryStr(c, "status", "")
+	limit := ginx.QueryInt(c, "limit", 20)
+
+	total, err := models.TaskApprovalTotal(rt.Ctx, []int64{bgid}, status)
+	ginx.Dangerous(err)
+
+	list, err := models.TaskApprovalGets(rt.Ctx, []int64{bgid}, status, limit, ginx.Offset(c, limit))
+	ginx.Dangerous(err)
+
+	ginx.NewRender(c).Data(gin.H{
+		"total": total,
+		"list":  list,
+	}, nil)
+}
+
+func (rt *Router) taskApprovalPut(c *gin.Context) {
+	var f taskApprovalForm
+	ginx.BindJSON(c, &f)
+
+	approval, err := models.TaskApprovalGet(rt.Ctx, "id = ? and group_id = ?", ginx.UrlParamInt64(c, "aid"), ginx.UrlParamInt64(c, "id"))
+	ginx.Dangerous(err)
+
+	if approval == nil {
+		ginx.Bomb(http.StatusNotFound, "No such approval")
+	}
+
+	me := c.MustGet("user").(*models.User)
+	ginx.NewRender(c).Message(approval.Handle(rt.Ctx, f.approved(), me.Username))
+}
+
+// taskApprovalByToken is the approval of the link in the notifications
+func (rt *Router) taskApprovalByToken(c *gin.Context) *models.TaskApproval {
+	approval, err := models.TaskApprovalGet(rt.Ctx, "token = ?", ginx.UrlParamStr(c, "token"))
+	ginx.Dangerous(err)
+
+	if approval == nil {
+		ginx.Bomb(http.StatusNotFound, "No such approval")
+	}
+
+	return approval
+}
+
+func (rt *Router) taskApprovalGetByToken(c *gin.Context) {
+	approval := rt.taskApprovalByToken(c)
+	rt.bgroCheck(c, approval.GroupId)
+	ginx.NewRender(c).Data(approval, nil)
+}
+
+func (rt *Router) taskApprovalPutByToken(c *gin.Context) {
+	var f taskApprovalForm
+	ginx.BindJSON(c, &f)
+
+	approval := rt.taskApprovalByToken(c)
+	rt.bgrwCheck(c, approval.GroupId)
+
+	me := c.MustGet("user").(*models.User)
+	ginx.NewRender(c).Message(approval.Handle(rt.Ctx, f.approved(), me.Username))
+}
+
+func (rt *Router) taskApprovalAddByService(c *gin.Context) {
+	var f models.TaskApproval
+	ginx.BindJSON(c, &f)
+
+	f.Id = 0
+	ginx.Dangerous(f.Add(rt.Ctx))
+	ginx.NewRender(c).Data(f, nil)
+}
+
+func (rt *Router) taskApprovalGetsByService(c *gin.Context) {
+	if ginx.QueryStr(c, "status", "") == models.TaskApprovalPending {
+		lst, err := models.TaskApprovalGetsPending(rt.Ctx)
+		ginx.NewRender(c).Data(lst, err)
+		return
+	}
+
+	ids := strx.IdsInt64ForAPI(ginx.QueryStr(c, "ids", ""), ",")
+	lst, err := models.TaskApprovalGetsByIds(rt.Ctx, ids)
+	ginx.NewRender(c).Data(lst, err)
+}
+
+func (rt *Router) taskHealRunAddByService(c *gin.Context) {
+	var f models.TaskHealRun
+	ginx.BindJSON(c, &f)
+
+	f.Id = 0
+	ginx.NewRender(c).Message(f.Add(rt.Ctx))
+}
+
+func (rt *Router) taskHealRunCountByService(c *gin.Context) {
+	count, err := models.TaskHealRunCount(rt.Ctx, ginx.QueryInt64(c, "tpl_id"), ginx.QueryStr(c, "host"), ginx.QueryInt64(c, "since"))
+	ginx.NewRender(c).Data(count, err)
+}
+
+func (rt *Router) taskHostResultByService(c *gin.Context) {
+	th, err := sender.TaskHostResult(rt.Ctx, ginx.QueryInt64(c, "id"), ginx.QueryStr(c, "host"))
+	ginx.NewRender(c).Data(th, err)
+}
+
+type eventAnnotationsForm struct {
+	Id          int64             `json:"id"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+func (rt *Router) eventAnnotationsMergeByService(c *gin.Context) {
+	var f eventAnnotationsForm
+	ginx.BindJSON(c, &f)
+	ginx.NewRender(c).Message(models.EventAnnotationsMerge(rt.Ctx, f.Id, f.Annotations))
+}
@@ -20,6 +20,10 @@ func (rt *Router) tdengineDatabases(c *gin.Context) {
 	var f databasesQueryForm
 	ginx.BindJSON(c, &f)
 
+	if !rt.Center.AnonymousAccess.PromQuerier {
+		rt.dsPermCheck(c, f.DatasourceId, false)
+	}
+
 	datasource, hit := dscache.DsCache.Get(f.Cate, f.DatasourceId)
 	if _, ok := datasource.(*tdengine.TDengine); !hit || !ok {
 		ginx.NewRender(c, http.StatusNotFound).Message("No such datasource")
@@ -48,6 +52,10 @@ func (rt *Router) tdengineTables(c *gin.Context) {
 	var f tablesQueryForm
 	ginx.BindJSON(c, &f)
 
+	if !rt.Center.AnonymousAccess.PromQuerier {
+		rt.dsPermCheck(c, f.DatasourceId, false)
+	}
+
 	datasource, hit := dscache.DsCache.Get(f.Cate, f.DatasourceId)
 	if _, ok := datasource.(*tdengine.TDengine); !hit || !ok {
 		ginx.NewRender(c, http.StatusNotFound).Message("No such datasource")
@@ -74,6 +82,10 @@ func (rt *Router) tdengineColumns(c *gin.Context) {
 	var f columnsQueryForm
 	ginx.BindJSON(c, &f)
 
+	if !rt.Center.AnonymousAccess.PromQuerier {
+		rt.dsPermCheck(c, f.DatasourceId, false)
+	}
+
 	datasource, hit := dscache.DsCache.Get(f.Cate, f.DatasourceId)
 	if _, ok := datasource.(*tdengine.TDengine); !hit || !ok {
 		ginx.NewRender(c, http.StatusNotFound).Message("No such datasource")
@@ -0,0 +1,91 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/ccfos/nightingale/v6/pkg/grafana"
+)
+
+// GrafanaImport converts a grafana dashboard file to a n9e board file, the
+// output has the same layout as the built-in dashboards and can be imported on the web
+func GrafanaImport(input, output string) error {
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+
+	board, report, err := grafana.Import(data)
+	if err != nil {
+		return err
+	}
+
+	if err = writeJSON(output, board); err != nil {
+		return err
+	}
+
+	return printReport(report)
+}
+
+// GrafanaExport converts a n9e board file, configs as an object or a string, to a grafana dashboard file
+func GrafanaExport(input, output string) error {
+	data, err := os.ReadFile(input)
+	if err != nil {
+		return err
+	}
+
+	var board struct {
+		Name    string          `json:"name"`
+		Tags    string          `json:"tags"`
+		Configs json.RawMessage `json:"configs"`
+	}
+	if err = json.Unmarshal(data, &board); err != nil {
+		return fmt.Errorf("invalid board file: %v", err)
+	}
+
+	configs := string(board.Configs)
+	var s string
+	if err = json.Unmarshal(board.Configs, &s); err == nil {
+		configs = s
+	}
+
+	dashboard, report, err := grafana.Export(board.Name, board.Tags, configs)
+	if err != nil {
+		return err
+	}
+
+	if err = writeJSON(output, dashboard); err != nil {
+		return err
+	}
+
+	return printReport(report)
+}
+
+func writeJSON(output string, v interface{}) error {
+	b, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		_, err = fmt.Println(string(b))
+		return err
+	}
+
+	return os.WriteFile(output, b, 0644)
+}
+
+// printReport goes to stderr, so that stdout can be redirected to a file
+func printReport(report *grafana.Report) error {
+	fmt.Fprintf(os.Stderr, "converted panels: %d\n", report.Panels)
+	for _, u := range report.Unsupported {
+		fmt.Fprintf(os.Stderr, "unsupported %s %q (id: %s, type: %s): %s\n", u.Kind, u.Title, u.Id, u.Type, u.Reason)
+	}
+
+	for _, w := range report.Warnings {
+		fmt.Fprintf(os.Stderr, "warning: %s\n", w)
+	}
+
+	return nil
+}
@@ -13,6 +13,10 @@ var (
 	upgrade     = flag.Bool("upgrade", false, "Upgrade the database.")
 	showVersion = flag.Bool("version", false, "Show version.")
 	configFile  = flag.String("config", "", "Specify webapi.conf of v5.x version")
+
+	grafanaImport = flag.String("grafana-import", "", "Convert a Grafana dashboard json file to a n9e board json file.")
+	grafanaExport = flag.String("grafana-export", "", "Convert a n9e board json file to a Grafana dashboard json file.")
+	output        = flag.String("output", "", "Output file of grafana-import or grafana-export, default is stdout.")
 )
 
 func main() {
@@ -37,4 +41,20 @@ func main() {
 		fmt.Print("Upgrade successfully.")
 		os.Exit(0)
 	}
+
+	if *grafanaImport != "" {
+		if err := cli.GrafanaImport(*grafanaImport, *output); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
+	if *grafanaExport != "" {
+		if err := cli.GrafanaExport(*grafanaExport, *output); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
 }
@@ -10,6 +10,7 @@ import (
 	"github.com/ccfos/nightingale/v6/alert/dispatch"
 	"github.com/ccfos/nightingale/v6/alert/process"
 	alertrt "github.com/ccfos/nightingale/v6/alert/router"
+	"github.com/ccfos/nightingale/v6/alert/sender"
 	"github.com/ccfos/nightingale/v6/center/metas"
 	"github.com/ccfos/nightingale/v6/conf"
 	"github.com/ccfos/nightingale/v6/dscache"
@@ -19,6 +20,7 @@ import (
 	"github.com/ccfos/nightingale/v6/pkg/httpx"
 	"github.com/ccfos/nightingale/v6/pkg/logx"
 	"github.com/ccfos/nightingale/v6/pkg/macros"
+	"github.com/ccfos/nightingale/v6/pkg/qlimit"
 	"github.com/ccfos/nightingale/v6/prom"
 	"github.com/ccfos/nightingale/v6/pushgw/idents"
 	pushgwrt "github.com/ccfos/nightingale/v6/pushgw/router"
@@ -61,7 +63,9 @@ func Initialize(configDir string, cryptoKey string) (func(), error) {
 	r := httpx.GinEngine(config.Global.RunMode, config.HTTP, configCvalCache.PrintBodyPaths, configCvalCache.PrintAccessLog)
 
 	pushgwRouter.Config(r)
+	pushgwRouter.StartKafkaReaders()
 	macros.RegisterMacro(macros.MacroInVain)
+	qlimit.Init(config.QueryLimit)
 	dscache.Init(ctx, false)
 
 	if !config.Alert.Disable {
@@ -77,6 +81,7 @@ func Initialize(configDir string, cryptoKey string) (func(), error) {
 		notifyRuleCache := memsto.NewNotifyRuleCache(ctx, syncStats)
 		notifyChannelCache := memsto.NewNotifyChannelCache(ctx, syncStats)
 		messageTemplateCache := memsto.NewMessageTemplateCache(ctx, syncStats)
+		calendarCache := memsto.NewCalendarCache(ctx, syncStats)
 
 		promClients := prom.NewPromClient(ctx)
 
@@ -84,10 +89,11 @@ func Initialize(configDir string, cryptoKey string) (func(), error) {
 
 		externalProcessors := process.NewExternalProcessors()
 
-		alert.Start(config.Alert, config.Pushgw, syncStats, alertStats, externalProcessors, targetCache, busiGroupCache, alertMuteCache,
-			alertRuleCache, notifyConfigCache, taskTplsCache, dsCache, ctx, promClients, userCache, userGroupCache, notifyRuleCache, notifyChannelCache, messageTemplateCache)
+		sender.Healer.SiteUrl = configCvalCache.SiteUrl
+		scheduler := alert.Start(config.Alert, config.Pushgw, syncStats, alertStats, externalProcessors, targetCache, busiGroupCache, alertMuteCache,
+			alertRuleCache, notifyConfigCache, taskTplsCache, dsCache, ctx, promClients, userCache, userGroupCache, notifyRuleCache, notifyChannelCache, messageTemplateCache, calendarCache)
 
-		alertrtRouter := alertrt.New(config.HTTP, config.Alert, alertMuteCache, targetCache, busiGroupCache, alertStats, ctx, externalProcessors)
+		alertrtRouter := alertrt.New(config.HTTP, config.Alert, alertMuteCache, calendarCache, targetCache, busiGroupCache, alertStats, ctx, externalProcessors, alertRuleCache, scheduler)
 
 		alertrtRouter.Config(r)
 
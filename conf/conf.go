@@ -12,6 +12,7 @@ import (
 	"github.com/ccfos/nightingale/v6/pkg/httpx"
 	"github.com/ccfos/nightingale/v6/pkg/logx"
 	"github.com/ccfos/nightingale/v6/pkg/ormx"
+	"github.com/ccfos/nightingale/v6/pkg/qlimit"
 	"github.com/ccfos/nightingale/v6/pushgw/pconf"
 	"github.com/ccfos/nightingale/v6/storage"
 )
@@ -24,6 +25,9 @@ type ConfigType struct {
 	Redis     storage.RedisConfig
 	CenterApi CenterApi
 
+	// QueryLimit limits the datasource queries of the users and the alert rules
+	QueryLimit qlimit.Config
+
 	Pushgw pconf.Pushgw
 	Alert  aconf.Alert
 	Center cconf.Center
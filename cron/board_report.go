@@ -0,0 +1,112 @@
+package cron
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/center/report"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"github.com/robfig/cron/v3"
+	"github.com/toolkits/pkg/logger"
+)
+
+type boardReportEntry struct {
+	entryId cron.EntryID
+	key     string // changes when the report is updated
+}
+
+type boardReportScheduler struct {
+	ctx     *ctx.Context
+	query   report.Querier
+	cron    *cron.Cron
+	entries map[int64]boardReportEntry
+}
+
+// ScheduleBoardReports reloads the board reports every minute and runs them by their cron patterns,
+// every center schedules all reports and the run is claimed in the db so that it is sent only once
+func ScheduleBoardReports(ctx *ctx.Context, query report.Querier) {
+	s := &boardReportScheduler{
+		ctx:     ctx,
+		query:   query,
+		cron:    cron.New(),
+		entries: make(map[int64]boardReportEntry),
+	}
+
+	s.cron.Start()
+
+	go func() {
+		for {
+			s.sync()
+			time.Sleep(time.Minute)
+		}
+	}()
+}
+
+func (s *boardReportScheduler) sync() {
+	lst, err := models.BoardReportGetsEnabled(s.ctx)
+	if err != nil {
+		logger.Errorf("failed to get board reports: %v", err)
+		return
+	}
+
+	exists := make(map[int64]struct{}, len(lst))
+	for _, r := range lst {
+		exists[r.Id] = struct{}{}
+
+		key := fmt.Sprintf("%s/%d", r.CronPattern, r.UpdateAt)
+		if entry, has := s.entries[r.Id]; has {
+			if entry.key == key {
+				continue
+			}
+			s.cron.Remove(entry.entryId)
+			delete(s.entries, r.Id)
+		}
+
+		schedule, err := cron.ParseStandard(r.CronPattern)
+		if err != nil {
+			logger.Errorf("board report %d has invalid cron pattern %s: %v", r.Id, r.CronPattern, err)
+			continue
+		}
+
+		id := r.Id
+		entryId := s.cron.Schedule(schedule, cron.FuncJob(func() {
+			s.run(id)
+		}))
+		s.entries[r.Id] = boardReportEntry{entryId: entryId, key: key}
+	}
+
+	for id, entry := range s.entries {
+		if _, has := exists[id]; !has {
+			s.cron.Remove(entry.entryId)
+			delete(s.entries, id)
+		}
+	}
+}
+
+func (s *boardReportScheduler) run(id int64) {
+	// cron fires at minute boundaries, centers agree on the truncated time
+	now := time.Now()
+	claimed, err := models.BoardReportClaim(s.ctx, id, now.Truncate(time.Minute).Unix())
+	if err != nil {
+		logger.Errorf("failed to claim board report %d: %v", id, err)
+		return
+	}
+
+	if !claimed {
+		return
+	}
+
+	r, err := models.BoardReportGet(s.ctx, "id = ?", id)
+	if err != nil || r == nil || r.Disabled == 1 {
+		return
+	}
+
+	if err = report.Run(s.ctx, r, s.query, now); err != nil {
+		logger.Errorf("failed to run board report %d: %v", id, err)
+		return
+	}
+
+	logger.Infof("board report %d(%s) sent", r.Id, r.Name)
+}
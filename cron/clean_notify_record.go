@@ -17,6 +17,10 @@ func cleanNotifyRecord(ctx *ctx.Context, day int) {
 		logger.Errorf("Failed to clean notify record: %v", err)
 	}
 
+	// 已发送成功或进入死信的 outbox 记录与通知记录一起清理
+	if err := models.NotifyOutboxClean(ctx, lastWeek); err != nil {
+		logger.Errorf("Failed to clean notify outbox: %v", err)
+	}
 }
 
 // 每天凌晨1点执行清理任务
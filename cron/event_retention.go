@@ -0,0 +1,58 @@
+package cron
+
+import (
+	"time"
+
+	"github.com/ccfos/nightingale/v6/center/archive"
+	"github.com/ccfos/nightingale/v6/center/cconf"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"github.com/robfig/cron/v3"
+	"github.com/toolkits/pkg/logger"
+)
+
+const eventRetentionKey = "event_retention_last_run"
+
+// ScheduleEventRetention archives and deletes the expired alert_his_event rows, one center runs each schedule
+func ScheduleEventRetention(ctx *ctx.Context, conf cconf.EventRetention) {
+	if !conf.Enable {
+		return
+	}
+
+	store, err := archive.NewStore(conf)
+	if err != nil {
+		logger.Errorf("event retention: failed to init archive store: %v", err)
+		return
+	}
+
+	if store == nil {
+		logger.Warning("event retention: neither ArchiveDir nor S3 is configured, expired events are deleted without archive")
+	}
+
+	archiver := archive.NewArchiver(ctx, conf, store)
+	c := cron.New()
+	_, err = c.AddFunc(conf.CronPattern, func() {
+		slot := time.Now().Truncate(time.Minute).Format("2006-01-02 15:04")
+		ok, err := models.ConfigsClaim(ctx, eventRetentionKey, slot)
+		if err != nil {
+			logger.Errorf("event retention: failed to claim %s: %v", slot, err)
+			return
+		}
+
+		if !ok {
+			return
+		}
+
+		if err := archiver.Run(); err != nil {
+			logger.Errorf("event retention: %v", err)
+		}
+	})
+
+	if err != nil {
+		logger.Errorf("event retention: invalid cron pattern %s: %v", conf.CronPattern, err)
+		return
+	}
+
+	c.Start()
+}
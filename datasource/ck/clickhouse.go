@@ -164,6 +164,10 @@ func (c *Clickhouse) QueryData(ctx context.Context, query interface{}) ([]models
 		return nil, err
 	}
 
+	if err := datasource.ShiftSQLRange(ctx, ckQueryParam.Sql, &ckQueryParam.From, &ckQueryParam.To); err != nil {
+		return nil, err
+	}
+
 	if strings.Contains(ckQueryParam.Sql, "$__") {
 		var err error
 		ckQueryParam.Sql, err = macros.Macro(ckQueryParam.Sql, ckQueryParam.From, ckQueryParam.To)
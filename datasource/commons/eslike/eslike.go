@@ -10,6 +10,7 @@ import (
 
 	"github.com/araddon/dateparse"
 	"github.com/bitly/go-simplejson"
+	"github.com/ccfos/nightingale/v6/datasource"
 	"github.com/ccfos/nightingale/v6/memsto"
 	"github.com/ccfos/nightingale/v6/models"
 	"github.com/mitchellh/mapstructure"
@@ -24,6 +25,7 @@ type Query struct {
 	Index          string     `json:"index" mapstructure:"index"`
 	IndexPatternId int64      `json:"index_pattern" mapstructure:"index_pattern"`
 	Filter         string     `json:"filter" mapstructure:"filter"`
+	GrantFilter    string     `json:"grant_filter" mapstructure:"grant_filter"` // forced by the datasource grants of the user
 	Offset         int64      `json:"offset" mapstructure:"offset"`
 	MetricAggr     MetricAggr `json:"value" mapstructure:"value"`
 	GroupBy        []GroupBy  `json:"group_by" mapstructure:"group_by"`
@@ -129,7 +131,9 @@ func TransferData(metric, ref string, m map[string][][]float64) []models.DataRes
 	return datas
 }
 
-func GetQueryString(filter string, q *elastic.RangeQuery) *elastic.BoolQuery {
+// GetQueryString builds the query of the filter and the time range. The grant filter is a clause of
+// its own, the filter of the query is parsed apart and can not escape it.
+func GetQueryString(filter, grantFilter string, q *elastic.RangeQuery) *elastic.BoolQuery {
 	var queryString *elastic.BoolQuery
 	if filter != "" {
 		if strings.Contains(filter, ":") || strings.Contains(filter, "AND") || strings.Contains(filter, "OR") || strings.Contains(filter, "NOT") {
@@ -137,10 +141,17 @@ func GetQueryString(filter string, q *elastic.RangeQuery) *elastic.BoolQuery {
 		} else {
 			queryString = elastic.NewBoolQuery().Filter(elastic.NewMultiMatchQuery(filter).Lenient(true).Type("phrase")).Filter(q)
 		}
+	} else if grantFilter != "" {
+		// a should clause is optional next to a filter clause, the range has to be a filter
+		queryString = elastic.NewBoolQuery().Filter(q)
 	} else {
 		queryString = elastic.NewBoolQuery().Should(q)
 	}
 
+	if grantFilter != "" {
+		queryString = queryString.Filter(elastic.NewQueryStringQuery(grantFilter))
+	}
+
 	return queryString
 }
 
@@ -379,6 +390,11 @@ func QueryData(ctx context.Context, queryParam interface{}, cliTimeout int64, ve
 		start = start - delay
 	}
 
+	if offset := datasource.CompareOffset(ctx); offset > 0 {
+		end = end - offset
+		start = start - offset
+	}
+
 	if param.Offset > 0 {
 		end = end - param.Offset
 		start = start - param.Offset
@@ -391,7 +407,7 @@ func QueryData(ctx context.Context, queryParam interface{}, cliTimeout int64, ve
 	field := param.MetricAggr.Field
 	groupBys := param.GroupBy
 
-	queryString := GetQueryString(param.Filter, q)
+	queryString := GetQueryString(param.Filter, param.GrantFilter, q)
 
 	var aggr elastic.Aggregation
 	switch param.MetricAggr.Func {
@@ -602,7 +618,7 @@ func QueryLog(ctx context.Context, queryParam interface{}, timeout int64, versio
 	q.Lte(time.Unix(end, 0).UnixMilli())
 	q.Format("epoch_millis")
 
-	queryString := GetQueryString(param.Filter, q)
+	queryString := GetQueryString(param.Filter, param.GrantFilter, q)
 
 	if param.Limit <= 0 {
 		param.Limit = 10
@@ -0,0 +1,84 @@
+package eslike
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/datasource"
+
+	"github.com/olivere/elastic/v7"
+)
+
+func TestQueryDataCompareOffset(t *testing.T) {
+	var source string
+	search := func(ctx context.Context, indices []string, s interface{}, timeout int, maxShard int) (*elastic.SearchResult, error) {
+		src, err := s.(*elastic.SearchSource).Source()
+		if err != nil {
+			return nil, err
+		}
+		bs, _ := json.Marshal(src)
+		source = string(bs)
+		return &elastic.SearchResult{Aggregations: elastic.Aggregations{"ts": json.RawMessage(`{"buckets":[]}`)}}, nil
+	}
+
+	query := map[string]interface{}{
+		"ref":      "A",
+		"index":    "logs",
+		"value":    map[string]interface{}{"field": "latency", "func": "avg"},
+		"interval": 60,
+		"start":    1699999980,
+		"end":      1700000580,
+	}
+
+	// the period over period comparison of a day runs the query with the offset of its own
+	ctx := datasource.WithCompareOffset(context.Background(), 86400)
+	if _, err := QueryData(ctx, query, 1000, "7.10.0", search); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(source, `"from":1699913580000`) || !strings.Contains(source, `"to":1699914180000`) {
+		t.Fatalf("the range is not shifted back by the offset: %s", source)
+	}
+}
+
+func TestGetQueryStringGrantFilter(t *testing.T) {
+	q := elastic.NewRangeQuery("@timestamp").Gte(1).Lte(2)
+	src, err := GetQueryString("x) OR (*", "env:test", q).Source()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bs, _ := json.Marshal(src)
+	var query struct {
+		Bool struct {
+			Must   map[string]map[string]interface{}   `json:"must"`
+			Filter []map[string]map[string]interface{} `json:"filter"`
+		} `json:"bool"`
+	}
+	if err := json.Unmarshal(bs, &query); err != nil {
+		t.Fatal(err)
+	}
+
+	if query.Bool.Must["query_string"]["query"] != "x) OR (*" {
+		t.Fatalf("filter of the query not kept apart: %s", bs)
+	}
+
+	granted := false
+	for _, f := range query.Bool.Filter {
+		if qs, ok := f["query_string"]; ok && qs["query"] == "env:test" {
+			granted = true
+		}
+	}
+	if !granted {
+		t.Fatalf("grant filter is not a clause of its own: %s", bs)
+	}
+
+	// without a filter the range stays required next to the grant filter
+	src, _ = GetQueryString("", "env:test", q).Source()
+	bs, _ = json.Marshal(src)
+	if strings.Contains(string(bs), "should") {
+		t.Fatalf("range is optional: %s", bs)
+	}
+}
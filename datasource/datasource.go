@@ -69,6 +69,35 @@ func init() {
 	}
 }
 
+// WithCompareOffset sets the offset of the period over period comparisons, the time range of the
+// queries run with the ctx is shifted back by the offset in seconds
+func WithCompareOffset(ctx context.Context, offset int64) context.Context {
+	return context.WithValue(ctx, "compare_offset", offset)
+}
+
+// CompareOffset returns the offset set by WithCompareOffset, 0 if not set
+func CompareOffset(ctx context.Context) int64 {
+	offset, _ := ctx.Value("compare_offset").(int64)
+	return offset
+}
+
+// ShiftSQLRange shifts the from and to of a SQL query back by the compare offset in the ctx. The SQL
+// reads the range through the time macros only, a query without them can not be shifted.
+func ShiftSQLRange(ctx context.Context, sql string, from, to *int64) error {
+	offset := CompareOffset(ctx)
+	if offset == 0 {
+		return nil
+	}
+
+	if *from == 0 || *to == 0 || !strings.Contains(sql, "$__") {
+		return fmt.Errorf("compare offset %ds needs the from and to of the query and the time macros in the sql", offset)
+	}
+
+	*from -= offset
+	*to -= offset
+	return nil
+}
+
 type NewDatasrouceFn func(settings map[string]interface{}) (Datasource, error)
 
 var datasourceRegister = map[string]NewDatasrouceFn{}
@@ -0,0 +1,31 @@
+package datasource
+
+import (
+	"context"
+	"testing"
+)
+
+func TestShiftSQLRange(t *testing.T) {
+	from, to := int64(1700000000), int64(1700000600)
+	if err := ShiftSQLRange(context.Background(), "select 1", &from, &to); err != nil || from != 1700000000 {
+		t.Fatalf("range shifted without the compare offset: %d %v", from, err)
+	}
+
+	ctx := WithCompareOffset(context.Background(), 86400)
+	sql := "select count(*) from t where $__timeFilter(ts)"
+	if err := ShiftSQLRange(ctx, sql, &from, &to); err != nil {
+		t.Fatal(err)
+	}
+	if from != 1699913600 || to != 1699914200 {
+		t.Fatalf("range not shifted back by the offset: %d %d", from, to)
+	}
+
+	// neither the range nor the sql can be shifted
+	var zero int64
+	if err := ShiftSQLRange(ctx, sql, &zero, &zero); err == nil {
+		t.Fatal("expect error of a query without range")
+	}
+	if err := ShiftSQLRange(ctx, "select 1", &from, &to); err == nil {
+		t.Fatal("expect error of a sql without time macros")
+	}
+}
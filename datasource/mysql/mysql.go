@@ -135,6 +135,10 @@ func (m *MySQL) QueryData(ctx context.Context, query interface{}) ([]models.Data
 		return nil, err
 	}
 
+	if err := datasource.ShiftSQLRange(ctx, mysqlQueryParam.SQL, &mysqlQueryParam.From, &mysqlQueryParam.To); err != nil {
+		return nil, err
+	}
+
 	if strings.Contains(mysqlQueryParam.SQL, "$__") {
 		var err error
 		mysqlQueryParam.SQL, err = macros.Macro(mysqlQueryParam.SQL, mysqlQueryParam.From, mysqlQueryParam.To)
@@ -163,6 +163,10 @@ func (p *PostgreSQL) QueryData(ctx context.Context, query interface{}) ([]models
 	}
 
 	postgresqlQueryParam.SQL = formatSQLDatabaseNameWithRegex(postgresqlQueryParam.SQL)
+	if err := datasource.ShiftSQLRange(ctx, postgresqlQueryParam.SQL, &postgresqlQueryParam.From, &postgresqlQueryParam.To); err != nil {
+		return nil, err
+	}
+
 	if strings.Contains(postgresqlQueryParam.SQL, "$__") {
 		var err error
 		postgresqlQueryParam.SQL, err = macros.Macro(postgresqlQueryParam.SQL, postgresqlQueryParam.From, postgresqlQueryParam.To)
@@ -12,4 +12,6 @@ type Prometheus struct {
 	WriteAddr         string            `json:"prometheus.write_addr"`
 	TsdbType          string            `json:"prometheus.tsdb_type"`
 	InternalAddr      string            `json:"prometheus.internal_addr"`
+	HAMode            string            `json:"prometheus.ha_mode"`
+	ReplicaLabel      string            `json:"prometheus.replica_label"`
 }
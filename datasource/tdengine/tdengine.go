@@ -118,7 +118,7 @@ func (td *TDengine) MakeTSQuery(ctx context.Context, query interface{}, eventTag
 }
 
 func (td *TDengine) QueryData(ctx context.Context, queryParam interface{}) ([]models.DataResp, error) {
-	return td.Query(queryParam, 0)
+	return td.Query(queryParam, int(datasource.CompareOffset(ctx)))
 }
 
 func (td *TDengine) QueryLog(ctx context.Context, queryParam interface{}) ([]interface{}, int64, error) {
@@ -196,6 +196,18 @@ func (td *TDengine) Query(query interface{}, delay ...int) ([]models.DataResp, e
 		q.To = time.Unix(to, 0).UTC().Format(time.RFC3339)
 		from := to - q.Interval
 		q.From = time.Unix(from, 0).UTC().Format(time.RFC3339)
+	} else if delaySec > 0 {
+		// the range of the query is shifted back too
+		from, err := time.Parse(time.RFC3339, q.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := time.Parse(time.RFC3339, q.To)
+		if err != nil {
+			return nil, err
+		}
+		q.From = from.Add(-time.Duration(delaySec) * time.Second).UTC().Format(time.RFC3339)
+		q.To = to.Add(-time.Duration(delaySec) * time.Second).UTC().Format(time.RFC3339)
 	}
 
 	replacements := map[string]string{
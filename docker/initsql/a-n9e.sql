@@ -17,6 +17,9 @@ CREATE TABLE `users` (
     `maintainer` tinyint(1) not null default 0,
     `belong` varchar(191) DEFAULT '' COMMENT 'belong',
     `last_active_time` bigint DEFAULT 0 COMMENT 'last_active_time',
+    `disabled` int not null default 0 COMMENT '0 enabled 1 disabled',
+    `timezone` varchar(64) not null default '' comment 'IANA timezone to display times in',
+    `external_id` varchar(255) not null default '' comment 'id in the identity provider',
     `create_at` bigint not null default 0,
     `create_by` varchar(64) not null default '',
     `update_at` bigint not null default 0,
@@ -35,6 +38,7 @@ CREATE TABLE `user_group` (
     `create_by` varchar(64) not null default '',
     `update_at` bigint not null default 0,
     `update_by` varchar(64) not null default '',
+    `external_id` varchar(255) not null default '' comment 'id in the identity provider',
     PRIMARY KEY (`id`),
     KEY (`create_by`),
     KEY (`update_at`)
@@ -205,6 +209,32 @@ CREATE TABLE `board_payload` (
     UNIQUE KEY (`id`)
 ) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
 
+-- scheduled board reports
+CREATE TABLE `board_report` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `group_id` bigint NOT NULL DEFAULT 0 COMMENT 'busi group id',
+    `name` varchar(255) NOT NULL DEFAULT '',
+    `note` varchar(1024) NOT NULL DEFAULT '',
+    `board_id` bigint NOT NULL DEFAULT 0,
+    `cron_pattern` varchar(64) NOT NULL DEFAULT '',
+    `vars` text,
+    `datasource_id` bigint NOT NULL DEFAULT 0,
+    `range` bigint NOT NULL DEFAULT 0 COMMENT 'unit: s',
+    `step` bigint NOT NULL DEFAULT 0 COMMENT 'unit: s',
+    `formats` varchar(255),
+    `notify_channel_ids` varchar(1024),
+    `sendtos` text,
+    `disabled` int NOT NULL DEFAULT 0,
+    `last_run_at` bigint NOT NULL DEFAULT 0,
+    `last_error` varchar(4096) NOT NULL DEFAULT '',
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `create_by` varchar(64) NOT NULL DEFAULT '',
+    `update_at` bigint NOT NULL DEFAULT 0,
+    `update_by` varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    KEY (`group_id`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
 -- deprecated
 CREATE TABLE `dashboard` (
     `id` bigint unsigned not null auto_increment,
@@ -274,6 +304,8 @@ CREATE TABLE `alert_rule` (
     `enable_etime` varchar(255) not null default '23:59',
     `enable_days_of_week` varchar(255) not null default '' comment 'split by space: 0 1 2 3 4 5 6',
     `enable_in_bg` tinyint(1) not null default 0 comment '1: only this bg 0: global',
+    `timezone` varchar(64) not null default '' comment 'IANA timezone',
+    `enable_calendar` varchar(255) comment 'calendar of the enable time',
     `notify_recovered` tinyint(1) not null comment 'whether notify when recovery',
     `notify_channels` varchar(255) not null default '' comment 'split by space: sms voice email dingtalk wecom',
     `notify_groups` varchar(255) not null default '' comment 'split by space: 233 43',
@@ -287,6 +319,7 @@ CREATE TABLE `alert_rule` (
     `extra_config` text,
     `notify_rule_ids` varchar(1024) DEFAULT '',
     `notify_version` int DEFAULT 0,
+    `version` bigint not null default 0 comment 'latest revision version',
     `create_at` bigint not null default 0,
     `create_by` varchar(64) not null default '',
     `update_at` bigint not null default 0,
@@ -314,6 +347,7 @@ CREATE TABLE `alert_mute` (
     `mute_time_type` tinyint(1) not null default 0,
     `periodic_mutes` varchar(4096) not null default '',
     `severities` varchar(32) not null default '',
+    `timezone` varchar(64) not null default '' comment 'IANA timezone',
     `create_at` bigint not null default 0,
     `create_by` varchar(64) not null default '',
     `update_at` bigint not null default 0,
@@ -349,6 +383,7 @@ CREATE TABLE `alert_subscribe` (
     `for_duration` bigint not null default 0,
     `notify_rule_ids` varchar(1024) DEFAULT '',
     `notify_version` int DEFAULT 0,
+    `timezone` varchar(64) not null default '' comment 'IANA timezone',
     `create_at` bigint not null default 0,
     `create_by` varchar(64) not null default '',
     `update_at` bigint not null default 0,
@@ -441,6 +476,7 @@ CREATE TABLE `alert_cur_event` (
     `group_name` varchar(255) not null default '' comment 'busi group name',
     `hash` varchar(64) not null comment 'rule_id + vector_pk',
     `rule_id` bigint unsigned not null,
+    `rule_version` bigint not null default 0 comment 'rule revision version',
     `rule_name` varchar(255) not null,
     `rule_note` varchar(2048) not null default 'alert rule note',
     `rule_prod` varchar(255) not null default '',
@@ -456,6 +492,7 @@ CREATE TABLE `alert_cur_event` (
     `notify_groups` varchar(255) not null default '' comment 'split by space: 233 43',
     `notify_repeat_next` bigint not null default 0 comment 'next timestamp to notify, get repeat settings from rule',
     `notify_cur_number` int not null default 0 comment '',
+    `flapping` tinyint(1) not null default 0 comment '1 if the event is flapping',
     `target_ident` varchar(191) not null default '' comment 'target ident, also in tags',
     `target_note` varchar(191) not null default '' comment 'target note',
     `first_trigger_time` bigint,
@@ -483,6 +520,7 @@ CREATE TABLE `alert_his_event` (
     `group_name` varchar(255) not null default '' comment 'busi group name',
     `hash` varchar(64) not null comment 'rule_id + vector_pk',
     `rule_id` bigint unsigned not null,
+    `rule_version` bigint not null default 0 comment 'rule revision version',
     `rule_name` varchar(255) not null,
     `rule_note` varchar(2048) not null default 'alert rule note',
     `rule_prod` varchar(255) not null default '',
@@ -497,6 +535,7 @@ CREATE TABLE `alert_his_event` (
     `notify_channels` varchar(255) not null default '' comment 'split by space: sms voice email dingtalk wecom',
     `notify_groups` varchar(255) not null default '' comment 'split by space: 233 43',
     `notify_cur_number` int not null default 0 comment '',
+    `flapping` tinyint(1) not null default 0 comment '1 if the event is flapping',
     `target_ident` varchar(191) not null default '' comment 'target ident, also in tags',
     `target_note` varchar(191) not null default '' comment 'target note',
     `first_trigger_time` bigint,
@@ -568,9 +607,33 @@ CREATE TABLE notification_record (
     `target` varchar(1024) NOT NULL COMMENT 'notification target',
     `details` varchar(2048) DEFAULT '' COMMENT 'notification other info',
     `created_at` bigint NOT NULL COMMENT 'create time',
+    `outbox_id` bigint NOT NULL DEFAULT 0 COMMENT 'notify outbox id',
     INDEX idx_evt (event_id)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE `notify_outbox` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `notify_rule_id` bigint NOT NULL DEFAULT 0,
+    `channel_id` bigint NOT NULL DEFAULT 0,
+    `channel_name` varchar(255) NOT NULL DEFAULT '',
+    `event_id` bigint NOT NULL DEFAULT 0,
+    `events` longtext,
+    `tpl_content` longtext,
+    `custom_params` text,
+    `sendtos` text,
+    `flash_duty_channel_id` bigint NOT NULL DEFAULT 0,
+    `retry` varchar(255),
+    `status` bigint NOT NULL DEFAULT 0 COMMENT '0:pending 1:success 2:dead',
+    `attempts` bigint NOT NULL DEFAULT 0,
+    `next_retry_at` bigint NOT NULL DEFAULT 0,
+    `last_error` varchar(2048) NOT NULL DEFAULT '',
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `update_at` bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    KEY (`event_id`),
+    KEY `idx_status_next` (`status`, `next_retry_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
 CREATE TABLE `task_tpl`
 (
     `id`        int unsigned NOT NULL AUTO_INCREMENT,
@@ -661,6 +724,22 @@ CREATE TABLE `datasource`
     PRIMARY KEY (`id`)
 ) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
 
+CREATE TABLE `datasource_perm` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `datasource_id` bigint NOT NULL DEFAULT 0,
+    `subject_type` varchar(32) NOT NULL DEFAULT '' COMMENT 'role user_group busi_group',
+    `subject` varchar(191) NOT NULL DEFAULT '' COMMENT 'role name or group id',
+    `index_pattern` varchar(1024) NOT NULL DEFAULT '' COMMENT 'granted indices, e.g. app-*,nginx-*',
+    `filter` varchar(4096) NOT NULL DEFAULT '' COMMENT 'forced filter: query string or label matchers',
+    `note` varchar(1024) NOT NULL DEFAULT '',
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `create_by` varchar(64) NOT NULL DEFAULT '',
+    `update_at` bigint NOT NULL DEFAULT 0,
+    `update_by` varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    KEY (`datasource_id`)
+) ENGINE = InnoDB DEFAULT CHARSET = utf8mb4;
+
 CREATE TABLE `builtin_cate` (
     `id` bigint unsigned not null auto_increment,
     `name` varchar(191) not null,
@@ -805,6 +884,7 @@ CREATE TABLE `notify_channel` (
     `param_config` text,
     `request_type` varchar(50) not null,
     `request_config` text,
+    `retry_config` varchar(255),
     `weight` int not null default 0,
     `create_at` bigint not null default 0,
     `create_by` varchar(64) not null default '',
@@ -2227,3 +2307,50 @@ CREATE TABLE `source_token` (
     PRIMARY KEY (`id`),
     KEY `idx_source_type_id_token` (`source_type`, `source_id`, `token`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `revision` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `cate` varchar(64) NOT NULL DEFAULT '' COMMENT 'board or alert_rule',
+    `object_id` bigint NOT NULL DEFAULT 0 COMMENT 'id of board or alert rule',
+    `version` bigint NOT NULL DEFAULT 0,
+    `message` varchar(1024) NOT NULL DEFAULT '',
+    `payload` longtext,
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `create_by` varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    KEY `idx_cate_object` (`cate`, `object_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `calendar` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `name` varchar(255) NOT NULL DEFAULT '',
+    `note` varchar(1024) NOT NULL DEFAULT '',
+    `holidays` text,
+    `workdays` text,
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `create_by` varchar(64) NOT NULL DEFAULT '',
+    `update_at` bigint NOT NULL DEFAULT 0,
+    `update_by` varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE `task_approval` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `group_id` bigint NOT NULL DEFAULT 0,
+    `rule_id` bigint NOT NULL DEFAULT 0,
+    `rule_name` varchar(255) NOT NULL DEFAULT '',
+    `event_id` bigint NOT NULL DEFAULT 0,
+    `event_hash` varchar(64) NOT NULL DEFAULT '',
+    `tpl_id` bigint NOT NULL DEFAULT 0,
+    `title` varchar(255) NOT NULL DEFAULT '',
+    `host` varchar(128) NOT NULL DEFAULT '',
+    `token` varchar(64) NOT NULL DEFAULT '',
+    `status` varchar(32) NOT NULL DEFAULT '',
+    `expire_at` bigint NOT NULL DEFAULT 0,
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `handle_at` bigint NOT NULL DEFAULT 0,
+    `handle_by` varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    KEY `idx_token` (`token`),
+    KEY `idx_group_id` (`group_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
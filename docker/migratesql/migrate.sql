@@ -284,3 +284,144 @@ ALTER TABLE `alert_cur_event` ADD COLUMN `notify_rule_ids` text COMMENT 'notify
 -- 删除 builtin_metrics 表的 idx_collector_typ_name 唯一索引
 DROP INDEX IF EXISTS `idx_collector_typ_name` ON `builtin_metrics`;
 
+/* SCIM provisioning: users deactivated by IdP */
+ALTER TABLE `users` ADD COLUMN `disabled` int NOT NULL DEFAULT 0 COMMENT '0 enabled 1 disabled';
+
+/* board and alert rule revisions */
+CREATE TABLE `revision` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `cate` varchar(64) NOT NULL DEFAULT '' COMMENT 'board or alert_rule',
+    `object_id` bigint NOT NULL DEFAULT 0 COMMENT 'id of board or alert rule',
+    `version` bigint NOT NULL DEFAULT 0,
+    `message` varchar(1024) NOT NULL DEFAULT '',
+    `payload` longtext,
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `create_by` varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    KEY `idx_cate_object` (`cate`, `object_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+/* alert rule revisions */
+ALTER TABLE `alert_rule` ADD COLUMN `version` bigint NOT NULL DEFAULT 0 COMMENT 'latest revision version';
+ALTER TABLE `alert_cur_event` ADD COLUMN `rule_version` bigint NOT NULL DEFAULT 0 COMMENT 'rule revision version';
+ALTER TABLE `alert_his_event` ADD COLUMN `rule_version` bigint NOT NULL DEFAULT 0 COMMENT 'rule revision version';
+
+/* scheduled board reports */
+CREATE TABLE `board_report` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `group_id` bigint NOT NULL DEFAULT 0 COMMENT 'busi group id',
+    `name` varchar(255) NOT NULL DEFAULT '',
+    `note` varchar(1024) NOT NULL DEFAULT '',
+    `board_id` bigint NOT NULL DEFAULT 0,
+    `cron_pattern` varchar(64) NOT NULL DEFAULT '',
+    `vars` text,
+    `datasource_id` bigint NOT NULL DEFAULT 0,
+    `range` bigint NOT NULL DEFAULT 0 COMMENT 'unit: s',
+    `step` bigint NOT NULL DEFAULT 0 COMMENT 'unit: s',
+    `formats` varchar(255),
+    `notify_channel_ids` varchar(1024),
+    `sendtos` text,
+    `disabled` int NOT NULL DEFAULT 0,
+    `last_run_at` bigint NOT NULL DEFAULT 0,
+    `last_error` varchar(4096) NOT NULL DEFAULT '',
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `create_by` varchar(64) NOT NULL DEFAULT '',
+    `update_at` bigint NOT NULL DEFAULT 0,
+    `update_by` varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    KEY (`group_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+/* datasource permissions */
+CREATE TABLE `datasource_perm` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `datasource_id` bigint NOT NULL DEFAULT 0,
+    `subject_type` varchar(32) NOT NULL DEFAULT '' COMMENT 'role user_group busi_group',
+    `subject` varchar(191) NOT NULL DEFAULT '' COMMENT 'role name or group id',
+    `index_pattern` varchar(1024) NOT NULL DEFAULT '' COMMENT 'granted indices, e.g. app-*,nginx-*',
+    `filter` varchar(4096) NOT NULL DEFAULT '' COMMENT 'forced filter: query string or label matchers',
+    `note` varchar(1024) NOT NULL DEFAULT '',
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `create_by` varchar(64) NOT NULL DEFAULT '',
+    `update_at` bigint NOT NULL DEFAULT 0,
+    `update_by` varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    KEY (`datasource_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+/* notify outbox */
+ALTER TABLE `notify_channel` ADD COLUMN `retry_config` varchar(255);
+ALTER TABLE `notification_record` ADD COLUMN `outbox_id` bigint NOT NULL DEFAULT 0 COMMENT 'notify outbox id';
+CREATE TABLE `notify_outbox` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `notify_rule_id` bigint NOT NULL DEFAULT 0,
+    `channel_id` bigint NOT NULL DEFAULT 0,
+    `channel_name` varchar(255) NOT NULL DEFAULT '',
+    `event_id` bigint NOT NULL DEFAULT 0,
+    `events` longtext,
+    `tpl_content` longtext,
+    `custom_params` text,
+    `sendtos` text,
+    `flash_duty_channel_id` bigint NOT NULL DEFAULT 0,
+    `retry` varchar(255),
+    `status` bigint NOT NULL DEFAULT 0 COMMENT '0:pending 1:success 2:dead',
+    `attempts` bigint NOT NULL DEFAULT 0,
+    `next_retry_at` bigint NOT NULL DEFAULT 0,
+    `last_error` varchar(2048) NOT NULL DEFAULT '',
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `update_at` bigint NOT NULL DEFAULT 0,
+    PRIMARY KEY (`id`),
+    KEY (`event_id`),
+    KEY `idx_status_next` (`status`, `next_retry_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+/* timezone of time windows */
+ALTER TABLE `alert_rule` ADD COLUMN `timezone` varchar(64) NOT NULL DEFAULT '' COMMENT 'IANA timezone';
+ALTER TABLE `alert_mute` ADD COLUMN `timezone` varchar(64) NOT NULL DEFAULT '' COMMENT 'IANA timezone';
+ALTER TABLE `alert_subscribe` ADD COLUMN `timezone` varchar(64) NOT NULL DEFAULT '' COMMENT 'IANA timezone';
+ALTER TABLE `users` ADD COLUMN `timezone` varchar(64) NOT NULL DEFAULT '' COMMENT 'IANA timezone to display times in';
+
+/* holiday calendars */
+ALTER TABLE `alert_rule` ADD COLUMN `enable_calendar` varchar(255) COMMENT 'calendar of the enable time';
+CREATE TABLE `calendar` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `name` varchar(255) NOT NULL DEFAULT '',
+    `note` varchar(1024) NOT NULL DEFAULT '',
+    `holidays` text,
+    `workdays` text,
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `create_by` varchar(64) NOT NULL DEFAULT '',
+    `update_at` bigint NOT NULL DEFAULT 0,
+    `update_by` varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+/* approvals of the self-healing tasks */
+CREATE TABLE `task_approval` (
+    `id` bigint unsigned NOT NULL AUTO_INCREMENT,
+    `group_id` bigint NOT NULL DEFAULT 0,
+    `rule_id` bigint NOT NULL DEFAULT 0,
+    `rule_name` varchar(255) NOT NULL DEFAULT '',
+    `event_id` bigint NOT NULL DEFAULT 0,
+    `event_hash` varchar(64) NOT NULL DEFAULT '',
+    `tpl_id` bigint NOT NULL DEFAULT 0,
+    `title` varchar(255) NOT NULL DEFAULT '',
+    `host` varchar(128) NOT NULL DEFAULT '',
+    `token` varchar(64) NOT NULL DEFAULT '',
+    `status` varchar(32) NOT NULL DEFAULT '',
+    `expire_at` bigint NOT NULL DEFAULT 0,
+    `create_at` bigint NOT NULL DEFAULT 0,
+    `handle_at` bigint NOT NULL DEFAULT 0,
+    `handle_by` varchar(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (`id`),
+    KEY `idx_token` (`token`),
+    KEY `idx_group_id` (`group_id`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+/* flap detection of alert events */
+ALTER TABLE `alert_cur_event` ADD COLUMN `flapping` tinyint(1) NOT NULL DEFAULT 0 COMMENT '1 if the event is flapping';
+ALTER TABLE `alert_his_event` ADD COLUMN `flapping` tinyint(1) NOT NULL DEFAULT 0 COMMENT '1 if the event is flapping';
+
+/* SCIM provisioning: ids of the users and groups in the identity provider */
+ALTER TABLE `users` ADD COLUMN `external_id` varchar(255) NOT NULL DEFAULT '' COMMENT 'id in the identity provider';
+ALTER TABLE `user_group` ADD COLUMN `external_id` varchar(255) NOT NULL DEFAULT '' COMMENT 'id in the identity provider';
@@ -2,6 +2,7 @@ package dscache
 
 import (
 	"context"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -16,6 +17,7 @@ import (
 	"github.com/ccfos/nightingale/v6/dskit/tdengine"
 	"github.com/ccfos/nightingale/v6/models"
 	"github.com/ccfos/nightingale/v6/pkg/ctx"
+	"github.com/ccfos/nightingale/v6/pkg/qlimit"
 
 	"github.com/toolkits/pkg/logger"
 )
@@ -60,7 +62,10 @@ func getDatasourcesFromDBLoop(ctx *ctx.Context, fromAPI bool) {
 				continue
 			}
 			var dss []datasource.DatasourceInfo
+			limits := make(map[int64]qlimit.DatasourceLimit)
 			for _, item := range items {
+				limits[item.Id] = queryLimit(item)
+
 				if item.PluginType == "prometheus" && item.IsDefault {
 					atomic.StoreInt64(&PromDefaultDatasourceId, item.Id)
 					foundDefaultDatasource = true
@@ -100,6 +105,7 @@ func getDatasourcesFromDBLoop(ctx *ctx.Context, fromAPI bool) {
 				atomic.StoreInt64(&PromDefaultDatasourceId, 0)
 			}
 
+			qlimit.Default.SetDatasources(limits)
 			PutDatasources(dss)
 		} else {
 			FromAPIHook()
@@ -109,6 +115,38 @@ func getDatasourcesFromDBLoop(ctx *ctx.Context, fromAPI bool) {
 	}
 }
 
+// queryLimit reads the settings ending with max_concurrency and query_timeout (unit: ms) of a datasource,
+// the timeout of the http settings applies if query_timeout is absent
+func queryLimit(item models.Datasource) qlimit.DatasourceLimit {
+	var limit qlimit.DatasourceLimit
+	timeout := item.HTTPJson.Timeout
+	for k, v := range item.SettingsJson {
+		if strings.HasSuffix(k, "max_concurrency") {
+			limit.MaxConcurrency = int(settingInt(v))
+		} else if strings.HasSuffix(k, "query_timeout") && settingInt(v) > 0 {
+			timeout = settingInt(v)
+		}
+	}
+
+	limit.Timeout = time.Duration(timeout) * time.Millisecond
+	return limit
+}
+
+func settingInt(v interface{}) int64 {
+	switch n := v.(type) {
+	case float64:
+		return int64(n)
+	case int64:
+		return n
+	case int:
+		return int64(n)
+	case string:
+		i, _ := strconv.ParseInt(n, 10, 64)
+		return i
+	}
+	return 0
+}
+
 func tdN9eToDatasourceInfo(ds *datasource.DatasourceInfo, item models.Datasource) {
 	ds.Settings = make(map[string]interface{})
 	ds.Settings["tdengine.cluster_name"] = item.Name
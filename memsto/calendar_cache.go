@@ -0,0 +1,130 @@
+package memsto
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/dumper"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"github.com/pkg/errors"
+	"github.com/toolkits/pkg/logger"
+)
+
+type CalendarCacheType struct {
+	statTotal       int64
+	statLastUpdated int64
+	ctx             *ctx.Context
+	stats           *Stats
+
+	sync.RWMutex
+	calendars map[int64]*models.Calendar // key: calendar id
+}
+
+func NewCalendarCache(ctx *ctx.Context, stats *Stats) *CalendarCacheType {
+	cc := &CalendarCacheType{
+		statTotal:       -1,
+		statLastUpdated: -1,
+		ctx:             ctx,
+		stats:           stats,
+		calendars:       make(map[int64]*models.Calendar),
+	}
+	cc.SyncCalendars()
+	return cc
+}
+
+func (cc *CalendarCacheType) Reset() {
+	cc.Lock()
+	defer cc.Unlock()
+
+	cc.statTotal = -1
+	cc.statLastUpdated = -1
+	cc.calendars = make(map[int64]*models.Calendar)
+}
+
+func (cc *CalendarCacheType) StatChanged(total, lastUpdated int64) bool {
+	if cc.statTotal == total && cc.statLastUpdated == lastUpdated {
+		return false
+	}
+
+	return true
+}
+
+func (cc *CalendarCacheType) Set(m map[int64]*models.Calendar, total, lastUpdated int64) {
+	cc.Lock()
+	cc.calendars = m
+	cc.Unlock()
+
+	// only one goroutine used, so no need lock
+	cc.statTotal = total
+	cc.statLastUpdated = lastUpdated
+}
+
+// Get is a models.CalendarGetter, it is safe to call on a nil cache
+func (cc *CalendarCacheType) Get(id int64) *models.Calendar {
+	if cc == nil {
+		return nil
+	}
+
+	cc.RLock()
+	defer cc.RUnlock()
+	return cc.calendars[id]
+}
+
+func (cc *CalendarCacheType) SyncCalendars() {
+	err := cc.syncCalendars()
+	if err != nil {
+		fmt.Println("failed to sync calendars:", err)
+		exit(1)
+	}
+
+	go cc.loopSyncCalendars()
+}
+
+func (cc *CalendarCacheType) loopSyncCalendars() {
+	duration := time.Duration(9000) * time.Millisecond
+	for {
+		time.Sleep(duration)
+		if err := cc.syncCalendars(); err != nil {
+			logger.Warning("failed to sync calendars:", err)
+		}
+	}
+}
+
+func (cc *CalendarCacheType) syncCalendars() error {
+	start := time.Now()
+	stat, err := models.CalendarStatistics(cc.ctx)
+	if err != nil {
+		dumper.PutSyncRecord("calendars", start.Unix(), -1, -1, "failed to query statistics: "+err.Error())
+		return errors.WithMessage(err, "failed to exec CalendarStatistics")
+	}
+
+	if !cc.StatChanged(stat.Total, stat.LastUpdated) {
+		cc.stats.GaugeCronDuration.WithLabelValues("sync_calendars").Set(0)
+		cc.stats.GaugeSyncNumber.WithLabelValues("sync_calendars").Set(0)
+		dumper.PutSyncRecord("calendars", start.Unix(), -1, -1, "not changed")
+		return nil
+	}
+
+	lst, err := models.CalendarGetsAll(cc.ctx)
+	if err != nil {
+		dumper.PutSyncRecord("calendars", start.Unix(), -1, -1, "failed to query records: "+err.Error())
+		return errors.WithMessage(err, "failed to exec CalendarGetsAll")
+	}
+
+	m := make(map[int64]*models.Calendar)
+	for i := 0; i < len(lst); i++ {
+		m[lst[i].Id] = lst[i]
+	}
+
+	cc.Set(m, stat.Total, stat.LastUpdated)
+
+	ms := time.Since(start).Milliseconds()
+	cc.stats.GaugeCronDuration.WithLabelValues("sync_calendars").Set(float64(ms))
+	cc.stats.GaugeSyncNumber.WithLabelValues("sync_calendars").Set(float64(len(m)))
+	dumper.PutSyncRecord("calendars", start.Unix(), ms, len(m), "success")
+
+	return nil
+}
@@ -119,6 +119,7 @@ func (c *CvalCache) GetLastUpdateTime() int64 {
 type SiteInfo struct {
 	PrintBodyPaths []string `json:"print_body_paths"`
 	PrintAccessLog bool     `json:"print_access_log"`
+	SiteUrl        string   `json:"site_url"` // e.g. https://n9e.example.com, the links out of the site are built on it
 }
 
 func (c *CvalCache) GetSiteInfo() *SiteInfo {
@@ -146,3 +147,7 @@ func (c *CvalCache) PrintBodyPaths() map[string]struct{} {
 func (c *CvalCache) PrintAccessLog() bool {
 	return c.GetSiteInfo().PrintAccessLog
 }
+
+func (c *CvalCache) SiteUrl() string {
+	return c.GetSiteInfo().SiteUrl
+}
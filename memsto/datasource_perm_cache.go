@@ -0,0 +1,122 @@
+package memsto
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/dumper"
+	"github.com/ccfos/nightingale/v6/models"
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"github.com/pkg/errors"
+	"github.com/toolkits/pkg/logger"
+)
+
+// DatasourcePermCacheType caches the grants of the datasources, they are checked by every query of the center
+type DatasourcePermCacheType struct {
+	statTotal       int64
+	statLastUpdated int64
+	ctx             *ctx.Context
+	stats           *Stats
+
+	sync.RWMutex
+	perms map[int64][]*models.DatasourcePerm // key: datasource id
+}
+
+func NewDatasourcePermCache(ctx *ctx.Context, stats *Stats) *DatasourcePermCacheType {
+	dpc := &DatasourcePermCacheType{
+		statTotal:       -1,
+		statLastUpdated: -1,
+		ctx:             ctx,
+		stats:           stats,
+		perms:           make(map[int64][]*models.DatasourcePerm),
+	}
+	dpc.SyncDatasourcePerms()
+	return dpc
+}
+
+func (dpc *DatasourcePermCacheType) Reset() {
+	dpc.Lock()
+	defer dpc.Unlock()
+
+	dpc.statTotal = -1
+	dpc.statLastUpdated = -1
+	dpc.perms = make(map[int64][]*models.DatasourcePerm)
+}
+
+func (dpc *DatasourcePermCacheType) StatChanged(total, lastUpdated int64) bool {
+	if dpc.statTotal == total && dpc.statLastUpdated == lastUpdated {
+		return false
+	}
+
+	return true
+}
+
+func (dpc *DatasourcePermCacheType) Set(m map[int64][]*models.DatasourcePerm, total, lastUpdated int64) {
+	dpc.Lock()
+	dpc.perms = m
+	dpc.Unlock()
+
+	// only one goroutine used, so no need lock
+	dpc.statTotal = total
+	dpc.statLastUpdated = lastUpdated
+}
+
+// Get returns the grants of the datasource, none means the datasource is open to everyone
+func (dpc *DatasourcePermCacheType) Get(datasourceId int64) []*models.DatasourcePerm {
+	dpc.RLock()
+	defer dpc.RUnlock()
+	return dpc.perms[datasourceId]
+}
+
+func (dpc *DatasourcePermCacheType) SyncDatasourcePerms() {
+	err := dpc.syncDatasourcePerms()
+	if err != nil {
+		fmt.Println("failed to sync datasource perms:", err)
+		exit(1)
+	}
+
+	go dpc.loopSyncDatasourcePerms()
+}
+
+func (dpc *DatasourcePermCacheType) loopSyncDatasourcePerms() {
+	duration := time.Duration(9000) * time.Millisecond
+	for {
+		time.Sleep(duration)
+		if err := dpc.syncDatasourcePerms(); err != nil {
+			logger.Warning("failed to sync datasource perms:", err)
+		}
+	}
+}
+
+func (dpc *DatasourcePermCacheType) syncDatasourcePerms() error {
+	start := time.Now()
+	stat, err := models.DatasourcePermStatistics(dpc.ctx)
+	if err != nil {
+		dumper.PutSyncRecord("datasource_perms", start.Unix(), -1, -1, "failed to query statistics: "+err.Error())
+		return errors.WithMessage(err, "failed to exec DatasourcePermStatistics")
+	}
+
+	if !dpc.StatChanged(stat.Total, stat.LastUpdated) {
+		dpc.stats.GaugeCronDuration.WithLabelValues("sync_datasource_perms").Set(0)
+		dpc.stats.GaugeSyncNumber.WithLabelValues("sync_datasource_perms").Set(0)
+		dumper.PutSyncRecord("datasource_perms", start.Unix(), -1, -1, "not changed")
+		return nil
+	}
+
+	m, err := models.DatasourcePermGetsAll(dpc.ctx)
+	if err != nil {
+		dumper.PutSyncRecord("datasource_perms", start.Unix(), -1, -1, "failed to query records: "+err.Error())
+		return errors.WithMessage(err, "failed to exec DatasourcePermGetsAll")
+	}
+
+	dpc.Set(m, stat.Total, stat.LastUpdated)
+
+	ms := time.Since(start).Milliseconds()
+	dpc.stats.GaugeCronDuration.WithLabelValues("sync_datasource_perms").Set(float64(ms))
+	dpc.stats.GaugeSyncNumber.WithLabelValues("sync_datasource_perms").Set(float64(len(m)))
+	dumper.PutSyncRecord("datasource_perms", start.Unix(), ms, len(m), "success")
+
+	return nil
+}
@@ -24,6 +24,7 @@ import (
 type NotifyTask struct {
 	Events        []*models.AlertCurEvent
 	NotifyRuleId  int64
+	OutboxId      int64 // 对应的 notify_outbox 记录, 0 表示未持久化
 	NotifyChannel *models.NotifyChannelConfig
 	TplContent    map[string]interface{}
 	CustomParams  map[string]string
@@ -31,7 +32,7 @@ type NotifyTask struct {
 }
 
 // NotifyRecordFunc 通知记录函数类型
-type NotifyRecordFunc func(ctx *ctx.Context, events []*models.AlertCurEvent, notifyRuleId int64, channelName, target, resp string, err error)
+type NotifyRecordFunc func(ctx *ctx.Context, events []*models.AlertCurEvent, notifyRuleId, outboxId int64, channelName, target, resp string, err error)
 
 type NotifyChannelCacheType struct {
 	statTotal       int64
@@ -288,7 +289,7 @@ func (ncc *NotifyChannelCacheType) processNotifyTask(task *NotifyTask) {
 
 			// 调用通知记录回调函数
 			if ncc.notifyRecordFunc != nil {
-				ncc.notifyRecordFunc(ncc.ctx, task.Events, task.NotifyRuleId, task.NotifyChannel.Name, ncc.getSendTarget(task.CustomParams, task.Sendtos), resp, err)
+				ncc.notifyRecordFunc(ncc.ctx, task.Events, task.NotifyRuleId, task.OutboxId, task.NotifyChannel.Name, ncc.getSendTarget(task.CustomParams, task.Sendtos), resp, err)
 			}
 		} else {
 			for i := range task.Sendtos {
@@ -300,7 +301,7 @@ func (ncc *NotifyChannelCacheType) processNotifyTask(task *NotifyTask) {
 
 				// 调用通知记录回调函数
 				if ncc.notifyRecordFunc != nil {
-					ncc.notifyRecordFunc(ncc.ctx, task.Events, task.NotifyRuleId, task.NotifyChannel.Name, ncc.getSendTarget(task.CustomParams, []string{task.Sendtos[i]}), resp, err)
+					ncc.notifyRecordFunc(ncc.ctx, task.Events, task.NotifyRuleId, task.OutboxId, task.NotifyChannel.Name, ncc.getSendTarget(task.CustomParams, []string{task.Sendtos[i]}), resp, err)
 				}
 			}
 		}
@@ -505,7 +506,7 @@ func (ncc *NotifyChannelCacheType) startEmailSender(chID int64, smtp *models.SMT
 			// 记录通知详情
 			if ncc.notifyRecordFunc != nil {
 				target := strings.Join(m.Mail.GetHeader("To"), ",")
-				ncc.notifyRecordFunc(ncc.ctx, m.Events, m.NotifyRuleId, "Email", target, "success", err)
+				ncc.notifyRecordFunc(ncc.ctx, m.Events, m.NotifyRuleId, m.OutboxId, "Email", target, "success", err)
 			}
 			size++
 
@@ -292,3 +292,34 @@ func (tc *TargetCacheType) GetHostMetas(targets []*models.Target) map[string]*mo
 
 	return metaMap
 }
+
+// GetHostExtendInfos returns the extend info reported by the agents, which is stored apart from the host meta
+func (tc *TargetCacheType) GetHostExtendInfos(idents []string) map[string]map[string]interface{} {
+	infos := make(map[string]map[string]interface{})
+	if tc.redis == nil || len(idents) == 0 {
+		return infos
+	}
+
+	pipe := tc.redis.Pipeline()
+	cmds := make(map[string]interface{ Bytes() ([]byte, error) }, len(idents))
+	for _, ident := range idents {
+		cmds[ident] = pipe.Get(context.Background(), models.WrapExtendIdent(ident))
+	}
+	// missing keys are errors of the pipeline, they are skipped below
+	pipe.Exec(context.Background())
+
+	for ident, cmd := range cmds {
+		value, err := cmd.Bytes()
+		if err != nil {
+			continue
+		}
+
+		var info map[string]interface{}
+		if err := json.Unmarshal(value, &info); err != nil || info == nil {
+			continue
+		}
+		infos[ident] = info
+	}
+
+	return infos
+}
@@ -84,7 +84,7 @@ func (uc *UserCacheType) GetByUserIds(ids []int64) []*models.User {
 
 	var users []*models.User
 	for _, id := range ids {
-		if uc.users[id] == nil {
+		if uc.users[id] == nil || uc.users[id].IsDisabled() {
 			continue
 		}
 
@@ -109,7 +109,7 @@ func (uc *UserCacheType) GetMaintainerUsers() []*models.User {
 
 	var users []*models.User
 	for _, v := range uc.users {
-		if v.Maintainer == 1 {
+		if v.Maintainer == 1 && !v.IsDisabled() {
 			users = append(users, v)
 		}
 	}
@@ -29,6 +29,7 @@ type AlertCurEvent struct {
 	GroupName          string              `json:"group_name"` // busi group name
 	Hash               string              `json:"hash"`       // rule_id + vector_key
 	RuleId             int64               `json:"rule_id"`
+	RuleVersion        int64               `json:"rule_version"` // revision version of the rule when fired
 	RuleName           string              `json:"rule_name"`
 	RuleNote           string              `json:"rule_note"`
 	RuleProd           string              `json:"rule_prod"`
@@ -68,6 +69,7 @@ type AlertCurEvent struct {
 	FirstEvalTime      int64               `json:"first_eval_time" gorm:"-"`            // 首次异常检测时间
 	NotifyCurNumber    int                 `json:"notify_cur_number"`                   // notify: current number
 	FirstTriggerTime   int64               `json:"first_trigger_time"`                  // 连续告警的首次告警时间
+	Flapping           int                 `json:"flapping"`                            // 1: the event is flapping, see FlapDetection
 	ExtraConfig        interface{}         `json:"extra_config" gorm:"-"`
 	Status             int                 `json:"status" gorm:"-"`
 	Claimant           string              `json:"claimant" gorm:"-"`
@@ -81,6 +83,8 @@ type AlertCurEvent struct {
 
 	NotifyVersion int                `json:"notify_version"  gorm:"-"` // 0: old, 1: new
 	NotifyRules   []*EventNotifyRule `json:"notify_rules" gorm:"-"`
+	Timezone      string             `json:"timezone" gorm:"-"` // timezone of the rule or subscribe, for the time ranges of notify rules
+	OutboxId      int64              `json:"-" gorm:"-"`        // the notify outbox row of the event queued for a legacy batch webhook
 }
 
 type EventNotifyRule struct {
@@ -419,6 +423,7 @@ func (e *AlertCurEvent) ToHis(ctx *ctx.Context) *AlertHisEvent {
 		GroupName:        e.GroupName,
 		Hash:             e.Hash,
 		RuleId:           e.RuleId,
+		RuleVersion:      e.RuleVersion,
 		RuleName:         e.RuleName,
 		RuleProd:         e.RuleProd,
 		RuleAlgo:         e.RuleAlgo,
@@ -446,6 +451,7 @@ func (e *AlertCurEvent) ToHis(ctx *ctx.Context) *AlertHisEvent {
 		LastEvalTime:     e.LastEvalTime,
 		NotifyCurNumber:  e.NotifyCurNumber,
 		FirstTriggerTime: e.FirstTriggerTime,
+		Flapping:         e.Flapping,
 		NotifyRuleIds:    e.NotifyRuleIds,
 	}
 }
@@ -798,6 +804,28 @@ func AlertCurEventGetByIds(ctx *ctx.Context, ids []int64) ([]*AlertCurEvent, err
 	return lst, err
 }
 
+// AlertCurEventGetsByRuleId returns the firing events of the rule on all its datasources
+func AlertCurEventGetsByRuleId(ctx *ctx.Context, ruleId int64) ([]*AlertCurEvent, error) {
+	if !ctx.IsCenter {
+		lst, err := poster.GetByUrls[[]*AlertCurEvent](ctx, "/v1/n9e/alert-cur-events-by-rule?rid="+strconv.FormatInt(ruleId, 10))
+		if err == nil {
+			for i := 0; i < len(lst); i++ {
+				lst[i].FE2DB()
+			}
+		}
+		return lst, err
+	}
+
+	var lst []*AlertCurEvent
+	err := DB(ctx).Where("rule_id=?", ruleId).Find(&lst).Error
+	if err == nil {
+		for i := 0; i < len(lst); i++ {
+			lst[i].DB2FE()
+		}
+	}
+	return lst, err
+}
+
 func AlertCurEventGetByRuleIdAndDsId(ctx *ctx.Context, ruleId int64, datasourceId int64) ([]*AlertCurEvent, error) {
 	if !ctx.IsCenter {
 		lst, err := poster.GetByUrls[[]*AlertCurEvent](ctx, "/v1/n9e/alert-cur-events-get-by-rid?rid="+strconv.FormatInt(ruleId, 10)+"&dsid="+strconv.FormatInt(datasourceId, 10))
@@ -850,6 +878,16 @@ func (e *AlertCurEvent) UpdateFieldsMap(ctx *ctx.Context, fields map[string]inte
 	return DB(ctx).Model(e).Updates(fields).Error
 }
 
+// AlertCurEventSetAnnotations updates the annotations of the current event of the hash, the edge engines
+// have no database and keep the annotations in memory only
+func AlertCurEventSetAnnotations(ctx *ctx.Context, hash, annotations string) error {
+	if !ctx.IsCenter {
+		return nil
+	}
+
+	return DB(ctx).Model(&AlertCurEvent{}).Where("hash = ?", hash).Update("annotations", annotations).Error
+}
+
 func AlertCurEventUpgradeToV6(ctx *ctx.Context, dsm map[string]Datasource) error {
 	var lst []*AlertCurEvent
 	err := DB(ctx).Where("trigger_time > ?", time.Now().Unix()-3600*24*30).Find(&lst).Error
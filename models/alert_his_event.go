@@ -8,6 +8,8 @@ import (
 	"time"
 
 	"github.com/ccfos/nightingale/v6/pkg/ctx"
+	"github.com/ccfos/nightingale/v6/pkg/poster"
+
 	"github.com/toolkits/pkg/logger"
 )
 
@@ -21,6 +23,7 @@ type AlertHisEvent struct {
 	GroupName          string            `json:"group_name"` // busi group name
 	Hash               string            `json:"hash"`
 	RuleId             int64             `json:"rule_id"`
+	RuleVersion        int64             `json:"rule_version"` // revision version of the rule when fired
 	RuleName           string            `json:"rule_name"`
 	RuleNote           string            `json:"rule_note"`
 	RuleProd           string            `json:"rule_prod"`
@@ -54,6 +57,7 @@ type AlertHisEvent struct {
 	AnnotationsJSON    map[string]string `json:"annotations" gorm:"-"` // for fe
 	NotifyCurNumber    int               `json:"notify_cur_number"`    // notify: current number
 	FirstTriggerTime   int64             `json:"first_trigger_time"`   // 连续告警的首次告警时间
+	Flapping           int               `json:"flapping"`             // 1: the event was flapping
 	ExtraConfig        interface{}       `json:"extra_config" gorm:"-"`
 	NotifyRuleIds      []int64           `json:"notify_rule_ids" gorm:"serializer:json"`
 
@@ -355,6 +359,51 @@ func EventPersist(ctx *ctx.Context, event *AlertCurEvent) error {
 	return nil
 }
 
+// EventAnnotationsMerge adds the annotations to an event already persisted, both the history and
+// the active one, e.g. the result of the self-healing task of the event
+func EventAnnotationsMerge(ctx *ctx.Context, id int64, annotations map[string]string) error {
+	if id == 0 || len(annotations) == 0 {
+		return nil
+	}
+
+	if !ctx.IsCenter {
+		return poster.PostByUrls(ctx, "/v1/n9e/event-annotations", map[string]interface{}{
+			"id":          id,
+			"annotations": annotations,
+		})
+	}
+
+	his, err := AlertHisEventGetById(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if his == nil {
+		return fmt.Errorf("no such event: %d", id)
+	}
+
+	m := his.AnnotationsJSON
+	if m == nil {
+		m = make(map[string]string)
+	}
+
+	for k, v := range annotations {
+		m[k] = v
+	}
+
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if err := DB(ctx).Model(&AlertHisEvent{}).Where("id = ?", id).Update("annotations", string(b)).Error; err != nil {
+		return err
+	}
+
+	// the active event shares the id with its history event
+	return DB(ctx).Model(&AlertCurEvent{}).Where("id = ?", id).Update("annotations", string(b)).Error
+}
+
 func AlertHisEventGetByIds(ctx *ctx.Context, ids []int64) ([]*AlertHisEvent, error) {
 	var lst []*AlertHisEvent
 
@@ -409,6 +458,7 @@ func (e *AlertHisEvent) ToCur() *AlertCurEvent {
 		LastEvalTime:       e.LastEvalTime,
 		NotifyCurNumber:    e.NotifyCurNumber,
 		FirstTriggerTime:   e.FirstTriggerTime,
+		Flapping:           e.Flapping,
 		IsRecovered:        e.IsRecovered == 1,
 		TriggerValues:      e.TriggerValue,
 		CallbacksJSON:      e.CallbacksJSON,
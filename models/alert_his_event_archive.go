@@ -0,0 +1,73 @@
+package models
+
+import (
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"gorm.io/gorm/clause"
+)
+
+// AlertHisEventArchive is an event in the archive files, it carries the columns hidden from the json of AlertHisEvent
+// so that a restored event is the same as the deleted row
+type AlertHisEventArchive struct {
+	*AlertHisEvent
+	RuleConfig     string `json:"rule_config"`
+	Callbacks      string `json:"callbacks"`
+	NotifyChannels string `json:"notify_channels"`
+	NotifyGroups   string `json:"notify_groups"`
+	Tags           string `json:"tags"`
+	OriginalTags   string `json:"original_tags"`
+	Annotations    string `json:"annotations"`
+}
+
+func NewAlertHisEventArchive(e *AlertHisEvent) *AlertHisEventArchive {
+	return &AlertHisEventArchive{
+		AlertHisEvent:  e,
+		RuleConfig:     e.RuleConfig,
+		Callbacks:      e.Callbacks,
+		NotifyChannels: e.NotifyChannels,
+		NotifyGroups:   e.NotifyGroups,
+		Tags:           e.Tags,
+		OriginalTags:   e.OriginalTags,
+		Annotations:    e.Annotations,
+	}
+}
+
+func (a *AlertHisEventArchive) Event() *AlertHisEvent {
+	e := a.AlertHisEvent
+	if e == nil {
+		e = &AlertHisEvent{}
+	}
+
+	e.RuleConfig = a.RuleConfig
+	e.Callbacks = a.Callbacks
+	e.NotifyChannels = a.NotifyChannels
+	e.NotifyGroups = a.NotifyGroups
+	e.Tags = a.Tags
+	e.OriginalTags = a.OriginalTags
+	e.Annotations = a.Annotations
+	return e
+}
+
+// AlertHisEventsAfter pages the events matching the condition by id
+func AlertHisEventsAfter(ctx *ctx.Context, where string, args []interface{}, afterId int64, limit int) ([]*AlertHisEvent, error) {
+	var lst []*AlertHisEvent
+	err := DB(ctx).Where(where, args...).Where("id > ?", afterId).Order("id").Limit(limit).Find(&lst).Error
+	return lst, err
+}
+
+func AlertHisEventDelByIds(ctx *ctx.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return DB(ctx).Where("id in ?", ids).Delete(&AlertHisEvent{}).Error
+}
+
+// AlertHisEventsRestore inserts archived events with their ids, events still in the table are skipped
+func AlertHisEventsRestore(ctx *ctx.Context, lst []*AlertHisEvent) (int64, error) {
+	if len(lst) == 0 {
+		return 0, nil
+	}
+
+	ret := DB(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&lst)
+	return ret.RowsAffected, ret.Error
+}
@@ -117,12 +117,14 @@ type AlertMute struct {
 	PeriodicMutesJson []PeriodicMute `json:"periodic_mutes" gorm:"-"`
 	Severities        string         `json:"-" gorm:"severities"`
 	SeveritiesJson    []int          `json:"severities" gorm:"-"`
+	Timezone          string         `json:"timezone"` // IANA timezone of the periodic mutes, empty is the server timezone
 }
 
 type PeriodicMute struct {
-	EnableStime      string `json:"enable_stime"`        // split by space: "00:00 10:00 12:00"
-	EnableEtime      string `json:"enable_etime"`        // split by space: "00:00 10:00 12:00"
-	EnableDaysOfWeek string `json:"enable_days_of_week"` // eg: "0 1 2 3 4 5 6"
+	EnableStime      string       `json:"enable_stime"`        // split by space: "00:00 10:00 12:00"
+	EnableEtime      string       `json:"enable_etime"`        // split by space: "00:00 10:00 12:00"
+	EnableDaysOfWeek string       `json:"enable_days_of_week"` // eg: "0 1 2 3 4 5 6"
+	Calendar         *CalendarRef `json:"calendar,omitempty"`  // only the days of the calendar, e.g. holidays
 }
 
 func (m *AlertMute) TableName() string {
@@ -215,6 +217,16 @@ func (m *AlertMute) Verify() error {
 		return fmt.Errorf("oops... etime(%d) <= btime(%d)", m.Etime, m.Btime)
 	}
 
+	if err := VerifyTimezone(m.Timezone); err != nil {
+		return err
+	}
+
+	for i := range m.PeriodicMutesJson {
+		if err := m.PeriodicMutesJson[i].Calendar.Verify(); err != nil {
+			return err
+		}
+	}
+
 	if err := m.Parse(); err != nil {
 		return err
 	}
@@ -318,7 +330,7 @@ func (m *AlertMute) DB2FE() error {
 	if m.MuteTimeType == TimeRange {
 		isWithinTime = m.IsWithinTimeRange(time.Now().Unix())
 	} else if m.MuteTimeType == Periodic {
-		isWithinTime = m.IsWithinPeriodicMute(time.Now().Unix())
+		isWithinTime = m.IsWithinPeriodicMute(time.Now().Unix(), nil)
 	} else {
 		logger.Warningf("mute time type invalid, %d", m.MuteTimeType)
 	}
@@ -343,12 +355,17 @@ func (m *AlertMute) IsWithinTimeRange(checkTime int64) bool {
 	return true
 }
 
-func (m *AlertMute) IsWithinPeriodicMute(checkTime int64) bool {
-	tm := time.Unix(checkTime, 0)
+// IsWithinPeriodicMute checks the periodic mutes, the calendars of them are ignored without the getter
+func (m *AlertMute) IsWithinPeriodicMute(checkTime int64, calendars CalendarGetter) bool {
+	tm := TimeIn(checkTime, m.Timezone)
 	triggerTime := tm.Format("15:04")
 	triggerWeek := strconv.Itoa(int(tm.Weekday()))
 
 	for i := 0; i < len(m.PeriodicMutesJson); i++ {
+		if !m.PeriodicMutesJson[i].Calendar.Match(calendars, tm) {
+			continue
+		}
+
 		if strings.Contains(m.PeriodicMutesJson[i].EnableDaysOfWeek, triggerWeek) {
 			if m.PeriodicMutesJson[i].EnableStime == m.PeriodicMutesJson[i].EnableEtime || (m.PeriodicMutesJson[i].EnableStime == "00:00" && m.PeriodicMutesJson[i].EnableEtime == "23:59") {
 				return true
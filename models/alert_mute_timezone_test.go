@@ -0,0 +1,38 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIsWithinPeriodicMuteTimezone(t *testing.T) {
+	if _, err := time.LoadLocation("America/New_York"); err != nil {
+		t.Skip("no tzdata")
+	}
+
+	m := &AlertMute{
+		Timezone: "America/New_York",
+		PeriodicMutesJson: []PeriodicMute{
+			{EnableStime: "09:00", EnableEtime: "18:00", EnableDaysOfWeek: "1 2 3 4 5"},
+		},
+	}
+
+	tests := []struct {
+		name string
+		at   string
+		want bool
+	}{
+		{"before dst, 08:30 EST", "2025-03-07T13:30:00Z", false},
+		{"before dst, 09:30 EST", "2025-03-07T14:30:00Z", true},
+		{"after dst, 09:30 EDT", "2025-03-10T13:30:00Z", true},
+		{"after dst, 18:30 EDT", "2025-03-10T22:30:00Z", false},
+		{"saturday", "2025-03-08T15:00:00Z", false},
+	}
+
+	for _, tt := range tests {
+		at, _ := time.Parse(time.RFC3339, tt.at)
+		if got := m.IsWithinPeriodicMute(at.Unix(), nil); got != tt.want {
+			t.Errorf("%s: IsWithinPeriodicMute() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
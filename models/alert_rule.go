@@ -14,6 +14,7 @@ import (
 
 	"github.com/jinzhu/copier"
 	"github.com/pkg/errors"
+	"github.com/prometheus/common/model"
 	"github.com/tidwall/match"
 	"github.com/toolkits/pkg/logger"
 	"github.com/toolkits/pkg/str"
@@ -81,6 +82,8 @@ type AlertRule struct {
 	RuleConfig            string                 `json:"-" gorm:"rule_config"`                                                   // rule config
 	RuleConfigJson        interface{}            `json:"rule_config" gorm:"-"`                                                   // rule config for fe
 	EventRelabelConfig    []*pconf.RelabelConfig `json:"event_relabel_config" gorm:"-"`                                          // event relabel config
+	Dependencies          []RuleDependency       `json:"dependencies" gorm:"-"`                                                  // parent rules, from rule config
+	FlapDetection         *FlapDetection         `json:"flap_detection" gorm:"-"`                                                // flap detection, from rule config
 	PromEvalInterval      int                    `json:"prom_eval_interval"`                                                     // unit:s
 	EnableStime           string                 `json:"-"`                                                                      // split by space: "00:00 10:00 12:00"
 	EnableStimeJSON       string                 `json:"enable_stime" gorm:"-"`                                                  // for fe
@@ -91,6 +94,8 @@ type AlertRule struct {
 	EnableDaysOfWeek      string                 `json:"-"`                                                                      // eg: "0 1 2 3 4 5 6 ; 0 1 2"
 	EnableDaysOfWeekJSON  []string               `json:"enable_days_of_week" gorm:"-"`                                           // for fe
 	EnableDaysOfWeeksJSON [][]string             `json:"enable_days_of_weeks" gorm:"-"`                                          // for fe
+	EnableCalendar        *CalendarRef           `json:"enable_calendar" gorm:"serializer:json"`                                 // only effective on the days of the calendar
+	Timezone              string                 `json:"timezone"`                                                               // IANA timezone of the enable time, empty is the server timezone
 	EnableInBG            int                    `json:"enable_in_bg"`                                                           // 0: global 1: enable one busi-group
 	NotifyRecovered       int                    `json:"notify_recovered"`                                                       // whether notify when recovery
 	NotifyChannels        string                 `json:"-"`                                                                      // split by space: sms voice email dingtalk wecom
@@ -120,6 +125,7 @@ type AlertRule struct {
 	CronPattern           string                 `json:"cron_pattern"`
 	NotifyRuleIds         []int64                `json:"notify_rule_ids" gorm:"serializer:json"`
 	NotifyVersion         int                    `json:"notify_version"` // 0: old, 1: new
+	Version               int64                  `json:"version"`        // latest revision version
 }
 
 type ChildVarConfig struct {
@@ -148,6 +154,28 @@ type Tpl struct {
 	TplId   int64    `json:"tpl_id"`
 	TplName string   `json:"tpl_name"`
 	Host    []string `json:"host"`
+
+	// policies of the self-healing task, by default the task runs every time the event is notified
+	Approval        bool  `json:"approval,omitempty"`         // wait for an approval in the UI or by the link in the notifications
+	ApprovalTimeout int64 `json:"approval_timeout,omitempty"` // unit: s, the approval expires after it, 3600 if not set
+	MaxRuns         int   `json:"max_runs,omitempty"`         // max runs on a host in the window, 0 means no limit
+	RunsWindow      int64 `json:"runs_window,omitempty"`      // unit: s, 3600 if not set
+	SkipInProgress  bool  `json:"skip_in_progress,omitempty"` // skip while the task of the same event is waiting or running
+	AutoResolve     bool  `json:"auto_resolve,omitempty"`     // resolve the event when the task succeeds
+}
+
+func (t *Tpl) GetApprovalTimeout() int64 {
+	if t.ApprovalTimeout > 0 {
+		return t.ApprovalTimeout
+	}
+	return 3600
+}
+
+func (t *Tpl) GetRunsWindow() int64 {
+	if t.RunsWindow > 0 {
+		return t.RunsWindow
+	}
+	return 3600
 }
 
 type RuleConfig struct {
@@ -161,6 +189,53 @@ type RuleConfig struct {
 	Severity              int                    `json:"severity,omitempty"`
 	AlgoParams            interface{}            `json:"algo_params,omitempty"`
 	OverrideGlobalWebhook bool                   `json:"override_global_webhook,omitempty"`
+	Dependencies          []RuleDependency       `json:"dependencies,omitempty"`
+	FlapDetection         *FlapDetection         `json:"flap_detection,omitempty"`
+}
+
+// FlapDetection marks an event as flapping when it fires and recovers too often. A flapping event is
+// notified once, then it keeps firing without notifications until it has been stable for StableTime.
+type FlapDetection struct {
+	Window     int64 `json:"window"`      // unit: s, the window to count the state changes in
+	Threshold  int   `json:"threshold"`   // state changes in the window to start flapping
+	StableTime int64 `json:"stable_time"` // unit: s, no state changes for it to stop flapping
+}
+
+func (f *FlapDetection) Enabled() bool {
+	return f != nil && f.Threshold > 0
+}
+
+func (f *FlapDetection) Verify() error {
+	if !f.Enabled() {
+		return nil
+	}
+
+	if f.Threshold < 2 {
+		return fmt.Errorf("flap_detection threshold(%d) should be at least 2", f.Threshold)
+	}
+
+	if f.Window <= 0 || f.StableTime <= 0 {
+		return errors.New("flap_detection window and stable_time should be positive")
+	}
+	return nil
+}
+
+// RuleDependency makes a rule depend on a parent rule, the events of the rule are suppressed while
+// the parent is firing, or the rule is not evaluated at all with Skip
+type RuleDependency struct {
+	RuleId int64    `json:"rule_id"`
+	Labels []string `json:"labels"` // labels the events of both rules share, empty means any event of the parent
+	Skip   bool     `json:"skip"`
+}
+
+// Match reports whether the event of the parent rule suppresses the event of the dependent rule
+func (d RuleDependency) Match(parent, event map[string]string) bool {
+	for _, label := range d.Labels {
+		if v, has := parent[label]; !has || v != event[label] {
+			return false
+		}
+	}
+	return true
 }
 
 type PromRuleConfig struct {
@@ -199,11 +274,16 @@ type PromQuery struct {
 	Unit          string        `json:"unit"`
 }
 
+// HostTrigger types: target_miss offset pct_target_miss, and the checks of the host meta reported by agents:
+// agent_version, meta_change, reboot and global_labels_missing
 type HostTrigger struct {
-	Type     string `json:"type"`
-	Duration int    `json:"duration"`
-	Percent  int    `json:"percent"`
-	Severity int    `json:"severity"`
+	Type          string   `json:"type"`
+	Duration      int      `json:"duration"` // reboot: uptime below it, meta_change: keep alerting for it after the change
+	Percent       int      `json:"percent"`
+	Severity      int      `json:"severity"`
+	AgentVersions []string `json:"agent_versions,omitempty"` // agent_version: allowed versions, globs like v0.4.* supported
+	Fields        []string `json:"fields,omitempty"`         // meta_change: cpu_num os arch host_ip, all of them by default
+	LabelKeys     []string `json:"label_keys,omitempty"`     // global_labels_missing: required keys of global_labels
 }
 
 type RuleQuery struct {
@@ -213,10 +293,44 @@ type RuleQuery struct {
 	ExpTriggerDisable bool          `json:"exp_trigger_disable"`
 	Triggers          []Trigger     `json:"triggers"`
 	NodataTrigger     NodataTrigger `json:"nodata_trigger"`
-	AnomalyTrigger    interface{}   `json:"anomaly_trigger"`
+	AnomalyTrigger    interface{}   `json:"anomaly_trigger"`        // CompareTrigger
 	TriggerType       TriggerType   `json:"trigger_type,omitempty"` // 在告警事件中使用
 }
 
+// CompareTrigger is the period over period comparison of the rule, the queries also run shifted back
+// by the offset, and $A.prev in the triggers is the value of A offset ago
+type CompareTrigger struct {
+	Enable bool   `json:"enable"`
+	Offset string `json:"offset"` // e.g. 1d 7d
+}
+
+// CompareOffset returns the offset of the comparison in seconds, 0 means no comparison
+func (rq *RuleQuery) CompareOffset() (int64, error) {
+	if rq.AnomalyTrigger == nil {
+		return 0, nil
+	}
+
+	bs, err := json.Marshal(rq.AnomalyTrigger)
+	if err != nil {
+		return 0, err
+	}
+
+	var ct CompareTrigger
+	if err := json.Unmarshal(bs, &ct); err != nil {
+		return 0, fmt.Errorf("invalid anomaly_trigger: %v", err)
+	}
+
+	if !ct.Enable {
+		return 0, nil
+	}
+
+	offset, err := model.ParseDuration(ct.Offset)
+	if err != nil || offset <= 0 {
+		return 0, fmt.Errorf("invalid offset of anomaly_trigger: %s", ct.Offset)
+	}
+	return int64(time.Duration(offset).Seconds()), nil
+}
+
 type NodataTrigger struct {
 	Enable             bool `json:"enable"`
 	Severity           int  `json:"severity"`
@@ -501,6 +615,27 @@ func (ar *AlertRule) Verify() error {
 		ar.PromEvalInterval = 15
 	}
 
+	if err := VerifyTimezone(ar.Timezone); err != nil {
+		return err
+	}
+
+	if err := ar.EnableCalendar.Verify(); err != nil {
+		return err
+	}
+
+	var ruleConfig RuleConfig
+	if err := json.Unmarshal([]byte(ar.RuleConfig), &ruleConfig); err == nil {
+		for _, d := range ruleConfig.Dependencies {
+			if d.RuleId <= 0 || d.RuleId == ar.Id {
+				return fmt.Errorf("dependency rule_id(%d) invalid", d.RuleId)
+			}
+		}
+
+		if err := ruleConfig.FlapDetection.Verify(); err != nil {
+			return err
+		}
+	}
+
 	// check in front-end
 	// if _, err := parser.ParseExpr(ar.PromQl); err != nil {
 	// 	return errors.New("prom_ql parse error: %")
@@ -525,6 +660,10 @@ func (ar *AlertRule) Verify() error {
 		return err
 	}
 
+	if err := ar.verifyCompare(); err != nil {
+		return err
+	}
+
 	if ar.NotifyVersion == 0 {
 		// 如果是旧版本，则清空 NotifyRuleIds
 		ar.NotifyRuleIds = []int64{}
@@ -560,11 +699,169 @@ func (ar *AlertRule) validateCronPattern() error {
 	return nil
 }
 
+// verifyCompare checks the offset of the period over period comparison
+func (ar *AlertRule) verifyCompare() error {
+	var rq RuleQuery
+	if err := json.Unmarshal([]byte(ar.RuleConfig), &rq); err != nil {
+		return nil
+	}
+
+	_, err := rq.CompareOffset()
+	return err
+}
+
+// QueryDatasource is the datasource a query of the rule names to run on instead of the datasource of the rule
+type QueryDatasource struct {
+	Ref            string `json:"ref"`
+	DatasourceCate string `json:"datasource_cate"`
+	DatasourceId   int64  `json:"datasource_id"`
+}
+
+// queryDatasourceCates are the categories evaluated by the datasource plugins, only their queries can
+// run on datasources of their own
+var queryDatasourceCates = map[string]struct{}{
+	TDENGINE:      {},
+	CLICKHOUSE:    {},
+	ELASTICSEARCH: {},
+	MYSQL:         {},
+	POSTGRESQL:    {},
+	DORIS:         {},
+	OPENSEARCH:    {},
+}
+
+// QueryDatasources returns the datasources named by the queries of the rule, the category defaults to
+// the one of the rule
+func (ar *AlertRule) QueryDatasources() []QueryDatasource {
+	bs := []byte(ar.RuleConfig)
+	if ar.RuleConfigJson != nil {
+		bs, _ = json.Marshal(ar.RuleConfigJson)
+	}
+
+	var ruleConfig struct {
+		Queries []QueryDatasource `json:"queries"`
+	}
+	if err := json.Unmarshal(bs, &ruleConfig); err != nil {
+		return nil
+	}
+
+	var lst []QueryDatasource
+	for _, q := range ruleConfig.Queries {
+		if q.DatasourceId <= 0 {
+			continue
+		}
+		if q.DatasourceCate == "" {
+			q.DatasourceCate = ar.Cate
+		}
+		lst = append(lst, q)
+	}
+	return lst
+}
+
+// verifyQueryDatasources checks the datasources named by the queries exist and are of a category the
+// queries can be evaluated on
+func (ar *AlertRule) verifyQueryDatasources(ctx *ctx.Context) error {
+	lst := ar.QueryDatasources()
+	if len(lst) == 0 {
+		return nil
+	}
+
+	if _, has := queryDatasourceCates[ar.Cate]; !has || ar.Prod == LOKI {
+		return fmt.Errorf("queries of %s rules can not run on datasources of their own", ar.GetRuleType())
+	}
+
+	for _, q := range lst {
+		if _, has := queryDatasourceCates[q.DatasourceCate]; !has {
+			return fmt.Errorf("query %s: datasource_cate(%s) not supported", q.Ref, q.DatasourceCate)
+		}
+
+		var ds []*Datasource
+		if err := DB(ctx).Where("id = ?", q.DatasourceId).Find(&ds).Error; err != nil {
+			return err
+		}
+
+		if len(ds) == 0 {
+			return fmt.Errorf("query %s: datasource(%d) not found", q.Ref, q.DatasourceId)
+		}
+
+		if typ := strings.TrimSuffix(ds[0].PluginType, ".logging"); typ != q.DatasourceCate {
+			return fmt.Errorf("query %s: datasource(%d) is %s, not %s", q.Ref, q.DatasourceId, typ, q.DatasourceCate)
+		}
+	}
+	return nil
+}
+
+// verifyDependencyCycle rejects the dependencies which lead back to the rule through the dependencies of
+// other rules, e.g. A -> B -> A. A new rule is not depended on by any rule, so there is nothing to check.
+func (ar *AlertRule) verifyDependencyCycle(ctx *ctx.Context) error {
+	if ar.Id == 0 {
+		return nil
+	}
+
+	var ruleConfig RuleConfig
+	if err := json.Unmarshal([]byte(ar.RuleConfig), &ruleConfig); err != nil || len(ruleConfig.Dependencies) == 0 {
+		return nil
+	}
+
+	var lst []*AlertRule
+	err := DB(ctx).Select("id", "rule_config").Where("rule_config like ?", "%\"dependencies\"%").Find(&lst).Error
+	if err != nil {
+		return err
+	}
+
+	graph := make(map[int64][]int64, len(lst))
+	for _, rule := range lst {
+		var rc RuleConfig
+		if json.Unmarshal([]byte(rule.RuleConfig), &rc) != nil {
+			continue
+		}
+		for _, d := range rc.Dependencies {
+			graph[rule.Id] = append(graph[rule.Id], d.RuleId)
+		}
+	}
+
+	graph[ar.Id] = nil
+	for _, d := range ruleConfig.Dependencies {
+		graph[ar.Id] = append(graph[ar.Id], d.RuleId)
+	}
+
+	if path := dependencyCycle(graph, ar.Id); len(path) > 0 {
+		return fmt.Errorf("dependency cycle: %s", strings.Join(path, " -> "))
+	}
+	return nil
+}
+
+// dependencyCycle returns the path from the rule back to itself in the dependency graph, nil if there is none
+func dependencyCycle(graph map[int64][]int64, id int64) []string {
+	visited := make(map[int64]bool)
+	var walk func(cur int64, path []string) []string
+	walk = func(cur int64, path []string) []string {
+		for _, next := range graph[cur] {
+			p := append(path[:len(path):len(path)], fmt.Sprint(next))
+			if next == id {
+				return p
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if cycle := walk(next, p); cycle != nil {
+				return cycle
+			}
+		}
+		return nil
+	}
+	return walk(id, []string{fmt.Sprint(id)})
+}
+
 func (ar *AlertRule) Add(ctx *ctx.Context) error {
 	if err := ar.Verify(); err != nil {
 		return err
 	}
 
+	if err := ar.verifyQueryDatasources(ctx); err != nil {
+		return err
+	}
+
 	exists, err := AlertRuleExists(ctx, 0, ar.GroupId, ar.Name)
 	if err != nil {
 		return err
@@ -602,12 +899,21 @@ func (ar *AlertRule) Update(ctx *ctx.Context, arf AlertRule) error {
 	arf.GroupId = ar.GroupId
 	arf.CreateAt = ar.CreateAt
 	arf.CreateBy = ar.CreateBy
+	arf.Version = ar.Version
 	arf.UpdateAt = time.Now().Unix()
 
 	err = arf.Verify()
 	if err != nil {
 		return err
 	}
+
+	if err := arf.verifyQueryDatasources(ctx); err != nil {
+		return err
+	}
+
+	if err := arf.verifyDependencyCycle(ctx); err != nil {
+		return err
+	}
 	return DB(ctx).Model(ar).Select("*").Updates(arf).Error
 }
 
@@ -973,9 +1279,13 @@ func (ar *AlertRule) DB2FE() error {
 	// 解析 RuleConfig 字段
 	var ruleConfig struct {
 		EventRelabelConfig []*pconf.RelabelConfig `json:"event_relabel_config"`
+		Dependencies       []RuleDependency       `json:"dependencies"`
+		FlapDetection      *FlapDetection         `json:"flap_detection"`
 	}
 	json.Unmarshal([]byte(ar.RuleConfig), &ruleConfig)
 	ar.EventRelabelConfig = ruleConfig.EventRelabelConfig
+	ar.Dependencies = ruleConfig.Dependencies
+	ar.FlapDetection = ruleConfig.FlapDetection
 
 	// 兼容旧逻辑填充 cron_pattern
 	if ar.CronPattern == "" && ar.PromEvalInterval != 0 {
@@ -1004,6 +1314,7 @@ func AlertRuleDels(ctx *ctx.Context, ids []int64, bgid ...int64) error {
 		// 说明确实删掉了，把相关的活跃告警也删了，这些告警永远都不会恢复了，而且策略都没了，说明没���关心了
 		if ret.RowsAffected > 0 {
 			DB(ctx).Where("rule_id = ?", ids[i]).Delete(new(AlertCurEvent))
+			RevisionDelByObject(ctx, RevisionCateAlertRule, []int64{ids[i]})
 		}
 	}
 
@@ -1250,6 +1561,7 @@ func (ar *AlertRule) UpdateEvent(event *AlertCurEvent) {
 	event.GroupId = ar.GroupId
 	event.Cate = ar.Cate
 	event.RuleId = ar.Id
+	event.RuleVersion = ar.Version
 	event.RuleName = ar.Name
 	event.RuleNote = ar.Note
 	event.RuleProd = ar.Prod
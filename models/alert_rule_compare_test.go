@@ -0,0 +1,49 @@
+package models
+
+import "testing"
+
+func TestRuleQueryCompareOffset(t *testing.T) {
+	cases := []struct {
+		trigger interface{}
+		offset  int64
+		wantErr bool
+	}{
+		{nil, 0, false},
+		{map[string]interface{}{"enable": false, "offset": "1d"}, 0, false},
+		{map[string]interface{}{"enable": true, "offset": "1d"}, 86400, false},
+		{map[string]interface{}{"enable": true, "offset": "1w"}, 7 * 86400, false},
+		{map[string]interface{}{"enable": true, "offset": "yesterday"}, 0, true},
+	}
+
+	for i, c := range cases {
+		rq := RuleQuery{AnomalyTrigger: c.trigger}
+		offset, err := rq.CompareOffset()
+		if (err != nil) != c.wantErr || offset != c.offset {
+			t.Fatalf("case %d: expect %d, %v, got %d, %v", i, c.offset, c.wantErr, offset, err)
+		}
+	}
+}
+
+func TestAlertRuleVerifyCompare(t *testing.T) {
+	compare := `"anomaly_trigger":{"enable":true,"offset":"1d"}`
+	cases := []struct {
+		cate       string
+		ruleConfig string
+		wantErr    bool
+	}{
+		{ELASTICSEARCH, `{"queries":[{"ref":"A"}],` + compare + `}`, false},
+		{TDENGINE, `{"queries":[{"ref":"A"}],` + compare + `}`, false},
+		{MYSQL, `{"queries":[{"ref":"A"}],` + compare + `}`, false},
+		{MYSQL, `{"queries":[{"ref":"A"}],"anomaly_trigger":{"enable":false,"offset":"1d"}}`, false},
+		{MYSQL, `{"queries":[{"ref":"A","datasource_id":2,"datasource_cate":"elasticsearch"}],` + compare + `}`, false},
+		{ELASTICSEARCH, `{"queries":[{"ref":"A"},{"ref":"B","datasource_id":2,"datasource_cate":"ck"}],` + compare + `}`, false},
+		{ELASTICSEARCH, `{"queries":[{"ref":"A"}],"anomaly_trigger":{"enable":true,"offset":"yesterday"}}`, true},
+	}
+
+	for i, c := range cases {
+		ar := AlertRule{Cate: c.cate, RuleConfig: c.ruleConfig}
+		if err := ar.verifyCompare(); (err != nil) != c.wantErr {
+			t.Fatalf("case %d: expect error %v, got %v", i, c.wantErr, err)
+		}
+	}
+}
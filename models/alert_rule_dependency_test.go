@@ -0,0 +1,45 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleDependencyMatch(t *testing.T) {
+	parent := map[string]string{"cluster": "k8s-a", "job": "apiserver"}
+
+	cases := []struct {
+		labels []string
+		event  map[string]string
+		expect bool
+	}{
+		{nil, map[string]string{"service": "api"}, true},
+		{[]string{"cluster"}, map[string]string{"cluster": "k8s-a", "service": "api"}, true},
+		{[]string{"cluster"}, map[string]string{"cluster": "k8s-b", "service": "api"}, false},
+		{[]string{"cluster", "namespace"}, map[string]string{"cluster": "k8s-a"}, false},
+	}
+
+	for i, c := range cases {
+		d := RuleDependency{RuleId: 1, Labels: c.labels}
+		if got := d.Match(parent, c.event); got != c.expect {
+			t.Fatalf("case %d: expect %v, got %v", i, c.expect, got)
+		}
+	}
+}
+
+func TestDependencyCycle(t *testing.T) {
+	graph := map[int64][]int64{
+		1: {2},
+		2: {3, 4},
+		3: {4},
+	}
+	if path := dependencyCycle(graph, 1); path != nil {
+		t.Fatalf("expect no cycle, got %v", path)
+	}
+
+	graph[4] = []int64{1}
+	path := dependencyCycle(graph, 1)
+	if strings.Join(path, " -> ") != "1 -> 2 -> 3 -> 4 -> 1" {
+		t.Fatalf("unexpected cycle %v", path)
+	}
+}
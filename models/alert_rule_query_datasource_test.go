@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestAlertRuleQueryDatasources(t *testing.T) {
+	ar := AlertRule{
+		Cate: CLICKHOUSE,
+		RuleConfigJson: map[string]interface{}{
+			"queries": []interface{}{
+				map[string]interface{}{"ref": "A", "sql": "select 1"},
+				map[string]interface{}{"ref": "B", "datasource_id": 3},
+				map[string]interface{}{"ref": "C", "datasource_id": 5, "datasource_cate": MYSQL},
+			},
+		},
+	}
+
+	lst := ar.QueryDatasources()
+	if len(lst) != 2 {
+		t.Fatalf("expect 2 query datasources, got %+v", lst)
+	}
+
+	if lst[0] != (QueryDatasource{Ref: "B", DatasourceCate: CLICKHOUSE, DatasourceId: 3}) {
+		t.Fatalf("unexpected %+v", lst[0])
+	}
+
+	if lst[1] != (QueryDatasource{Ref: "C", DatasourceCate: MYSQL, DatasourceId: 5}) {
+		t.Fatalf("unexpected %+v", lst[1])
+	}
+}
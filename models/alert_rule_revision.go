@@ -0,0 +1,183 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+	"github.com/ccfos/nightingale/v6/pkg/jsondiff"
+)
+
+var (
+	alertRuleNotifyKeys = map[string]struct{}{
+		"notify_recovered":   {},
+		"notify_channels":    {},
+		"notify_groups":      {},
+		"notify_repeat_step": {},
+		"notify_max_number":  {},
+		"notify_rule_ids":    {},
+		"notify_version":     {},
+		"callbacks":          {},
+	}
+
+	alertRuleEnableKeys = map[string]struct{}{
+		"disabled":             {},
+		"enable_stime":         {},
+		"enable_stimes":        {},
+		"enable_etime":         {},
+		"enable_etimes":        {},
+		"enable_days_of_week":  {},
+		"enable_days_of_weeks": {},
+		"enable_in_bg":         {},
+		"timezone":             {},
+		"enable_calendar":      {},
+	}
+
+	// fields maintained by the server, they change on every save and are not worth showing
+	alertRuleIgnoreKeys = map[string]struct{}{
+		"id":                 {},
+		"create_at":          {},
+		"create_by":          {},
+		"update_at":          {},
+		"update_by":          {},
+		"update_by_nickname": {},
+		"uuid":               {},
+		"cur_event_count":    {},
+		"notify_groups_obj":  {},
+		"version":            {},
+	}
+)
+
+// AlertRuleDiff groups the changes between two versions of an alert rule
+type AlertRuleDiff struct {
+	RuleConfig    []jsondiff.Change `json:"rule_config"`
+	Notify        []jsondiff.Change `json:"notify"`
+	EnableWindows []jsondiff.Change `json:"enable_windows"`
+	Others        []jsondiff.Change `json:"others"`
+}
+
+func decodeAlertRulePayload(payload string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if payload == "" {
+		return m, nil
+	}
+
+	err := json.Unmarshal([]byte(payload), &m)
+	return m, err
+}
+
+func AlertRuleDiffGet(from, to string) (*AlertRuleDiff, error) {
+	a, err := decodeAlertRulePayload(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode from rule: %v", err)
+	}
+
+	b, err := decodeAlertRulePayload(to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode to rule: %v", err)
+	}
+
+	ret := &AlertRuleDiff{
+		RuleConfig:    []jsondiff.Change{},
+		Notify:        []jsondiff.Change{},
+		EnableWindows: []jsondiff.Change{},
+		Others:        []jsondiff.Change{},
+	}
+
+	keys := make(map[string]struct{})
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		if _, has := alertRuleIgnoreKeys[k]; has {
+			continue
+		}
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		av, aok := a[k]
+		bv, bok := b[k]
+
+		var changes []jsondiff.Change
+		switch {
+		case !aok:
+			changes = []jsondiff.Change{{Path: k, Type: jsondiff.Added, To: bv}}
+		case !bok:
+			changes = []jsondiff.Change{{Path: k, Type: jsondiff.Removed, From: av}}
+		default:
+			changes = jsondiff.Diff(map[string]interface{}{k: av}, map[string]interface{}{k: bv})
+		}
+
+		if len(changes) == 0 {
+			continue
+		}
+
+		if k == "rule_config" {
+			ret.RuleConfig = append(ret.RuleConfig, changes...)
+		} else if _, has := alertRuleNotifyKeys[k]; has {
+			ret.Notify = append(ret.Notify, changes...)
+		} else if _, has := alertRuleEnableKeys[k]; has {
+			ret.EnableWindows = append(ret.EnableWindows, changes...)
+		} else {
+			ret.Others = append(ret.Others, changes...)
+		}
+	}
+
+	return ret, nil
+}
+
+// AlertRuleRevisionAdd snapshots the current state of the rule and records the new version on the rule,
+// events generated afterwards carry this version in rule_version
+func AlertRuleRevisionAdd(ctx *ctx.Context, id int64, message, createBy string, maxRevisions int) (*Revision, error) {
+	ar, err := AlertRuleGetById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if ar == nil {
+		return nil, fmt.Errorf("alert rule %d not found", id)
+	}
+
+	payload, err := json.Marshal(ar)
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := RevisionAdd(ctx, RevisionCateAlertRule, ar.Id, string(payload), message, createBy, maxRevisions)
+	if err != nil {
+		return nil, err
+	}
+
+	// bump update_at with the version, or the rule cache which syncs on max(update_at) misses it
+	updateAt := time.Now().Unix()
+	if updateAt <= ar.UpdateAt {
+		updateAt = ar.UpdateAt + 1
+	}
+
+	err = DB(ctx).Model(&AlertRule{}).Where("id = ?", ar.Id).UpdateColumns(map[string]interface{}{
+		"version":   rev.Version,
+		"update_at": updateAt,
+	}).Error
+	return rev, err
+}
+
+// AlertRuleRevisionBaseline snapshots rules created before revisions were tracked,
+// so that the first change can still be rolled back
+func AlertRuleRevisionBaseline(ctx *ctx.Context, ar *AlertRule, maxRevisions int) error {
+	cnt, err := RevisionCount(ctx, RevisionCateAlertRule, ar.Id)
+	if err != nil || cnt > 0 {
+		return err
+	}
+
+	_, err = AlertRuleRevisionAdd(ctx, ar.Id, "", ar.UpdateBy, maxRevisions)
+	return err
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"testing"
+)
+
+func TestAlertRuleDiffGet(t *testing.T) {
+	from := `{"id":1,"name":"cpu","update_at":1,"rule_config":{"queries":[{"prom_ql":"cpu > 80"}]},"notify_channels":["email"],"enable_stimes":["00:00"]}`
+	to := `{"id":1,"name":"cpu high","update_at":2,"rule_config":{"queries":[{"prom_ql":"cpu > 90"}]},"notify_channels":["email","dingtalk"],"enable_stimes":["00:00"]}`
+
+	diff, err := AlertRuleDiffGet(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diff.RuleConfig) != 1 || diff.RuleConfig[0].To != "cpu > 90" {
+		t.Errorf("unexpected rule_config changes: %+v", diff.RuleConfig)
+	}
+
+	if len(diff.Notify) == 0 {
+		t.Errorf("expected notify changes")
+	}
+
+	if len(diff.EnableWindows) != 0 {
+		t.Errorf("unexpected enable window changes: %+v", diff.EnableWindows)
+	}
+
+	if len(diff.Others) != 1 || diff.Others[0].Path != "name" {
+		t.Errorf("unexpected other changes: %+v", diff.Others)
+	}
+}
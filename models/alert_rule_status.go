@@ -0,0 +1,26 @@
+package models
+
+// AlertRuleEvalStatus is the evaluation status of a rule on one datasource of an alert engine
+type AlertRuleEvalStatus struct {
+	Instance     string          `json:"instance"`
+	EngineName   string          `json:"engine_name"`
+	RuleId       int64           `json:"rule_id"`
+	DatasourceId int64           `json:"datasource_id"`
+	LastEval     int64           `json:"last_eval"` // unix timestamp, unit: ms
+	Duration     int64           `json:"duration"`  // unit: ms
+	LastError    string          `json:"last_error"`
+	SeriesCount  int             `json:"series_count"`
+	FiringCount  int             `json:"firing_count"`
+	SkippedBy    int64           `json:"skipped_by"` // id of the firing parent rule the evaluation is skipped because of
+	Suppressed   int64           `json:"suppressed"` // events suppressed by the parent rules in the last evaluation
+	Pendings     []PendingSeries `json:"pendings"`
+}
+
+type PendingSeries struct {
+	Hash          string   `json:"hash"`
+	Tags          []string `json:"tags"`
+	TriggerValue  string   `json:"trigger_value"`
+	FirstEvalTime int64    `json:"first_eval_time"`
+	LastEvalTime  int64    `json:"last_eval_time"`
+	ForRemaining  int64    `json:"for_remaining"` // seconds before firing
+}
@@ -52,6 +52,7 @@ type AlertSubscribe struct {
 	NotifyRuleIds     []int64      `json:"notify_rule_ids" gorm:"serializer:json"`
 	NotifyVersion     int          `json:"notify_version"`
 	RuleNames         []string     `json:"rule_names" gorm:"-"`
+	Timezone          string       `json:"timezone"` // IANA timezone of the time ranges of the notify rules, empty is the timezone of the rule
 }
 
 func (s *AlertSubscribe) TableName() string {
@@ -116,6 +117,10 @@ func (s *AlertSubscribe) Verify() error {
 		return errors.New("severities is required")
 	}
 
+	if err := VerifyTimezone(s.Timezone); err != nil {
+		return err
+	}
+
 	if s.NotifyVersion == 1 {
 		if len(s.NotifyRuleIds) == 0 {
 			return errors.New("no notify rules selected")
@@ -443,6 +448,10 @@ func (s *AlertSubscribe) ModifyEvent(event *AlertCurEvent) {
 		event.NotifyRuleIds = []int64{}
 	}
 
+	if s.Timezone != "" {
+		event.Timezone = s.Timezone
+	}
+
 	event.NotifyGroups = s.UserGroupIds
 	event.NotifyGroupsJSON = strings.Fields(s.UserGroupIds)
 }
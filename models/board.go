@@ -151,6 +151,14 @@ func (b *Board) Del(ctx *ctx.Context) error {
 			return err
 		}
 
+		if err := tx.Where("cate=? and object_id=?", RevisionCateBoard, b.Id).Delete(&Revision{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Where("board_id=?", b.Id).Delete(&BoardReport{}).Error; err != nil {
+			return err
+		}
+
 		if err := tx.Where("id=?", b.Id).Delete(&Board{}).Error; err != nil {
 			return err
 		}
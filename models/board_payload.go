@@ -1,9 +1,12 @@
 package models
 
 import (
+	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/ccfos/nightingale/v6/pkg/ctx"
+	"github.com/ccfos/nightingale/v6/pkg/jsondiff"
 )
 
 type BoardPayload struct {
@@ -60,3 +63,129 @@ func BoardPayloadSave(ctx *ctx.Context, id int64, payload string) error {
 		Payload: payload,
 	})
 }
+
+type BoardPanelChange struct {
+	Id      string            `json:"id"`
+	Name    string            `json:"name"`
+	Type    string            `json:"type"` // added, removed, modified
+	Changes []jsondiff.Change `json:"changes"`
+}
+
+// BoardPayloadDiff compares two board configs, panels are matched by id,
+// panels nested in rows are compared as well, the rest of configs is compared at the json level
+type BoardPayloadDiff struct {
+	Panels []BoardPanelChange `json:"panels"`
+	Others []jsondiff.Change  `json:"others"`
+}
+
+func decodeBoardPayload(payload string) (map[string]interface{}, error) {
+	m := make(map[string]interface{})
+	if payload == "" {
+		return m, nil
+	}
+
+	if err := json.Unmarshal([]byte(payload), &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// flattenBoardPanels returns panels keyed by id in display order, including the ones collapsed in rows
+func flattenBoardPanels(configs map[string]interface{}) ([]string, map[string]map[string]interface{}) {
+	var ids []string
+	panels := make(map[string]map[string]interface{})
+
+	var walk func(lst []interface{})
+	walk = func(lst []interface{}) {
+		for i, item := range lst {
+			panel, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			id := fmt.Sprint(panel["id"])
+			if panel["id"] == nil {
+				id = fmt.Sprintf("#%d", i)
+			}
+
+			children, _ := panel["panels"].([]interface{})
+			if len(children) > 0 {
+				cp := make(map[string]interface{}, len(panel))
+				for k, v := range panel {
+					if k != "panels" {
+						cp[k] = v
+					}
+				}
+				panel = cp
+			}
+
+			if _, has := panels[id]; !has {
+				ids = append(ids, id)
+			}
+			panels[id] = panel
+			walk(children)
+		}
+	}
+
+	lst, _ := configs["panels"].([]interface{})
+	walk(lst)
+	return ids, panels
+}
+
+func boardPanelName(panel map[string]interface{}) string {
+	if name, ok := panel["name"].(string); ok {
+		return name
+	}
+
+	if title, ok := panel["title"].(string); ok {
+		return title
+	}
+
+	return ""
+}
+
+func BoardPayloadDiffGet(from, to string) (*BoardPayloadDiff, error) {
+	a, err := decodeBoardPayload(from)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode from configs: %v", err)
+	}
+
+	b, err := decodeBoardPayload(to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode to configs: %v", err)
+	}
+
+	aIds, aPanels := flattenBoardPanels(a)
+	bIds, bPanels := flattenBoardPanels(b)
+
+	ret := &BoardPayloadDiff{
+		Panels: []BoardPanelChange{},
+	}
+
+	for _, id := range aIds {
+		pa := aPanels[id]
+		pb, has := bPanels[id]
+		if !has {
+			ret.Panels = append(ret.Panels, BoardPanelChange{Id: id, Name: boardPanelName(pa), Type: jsondiff.Removed})
+			continue
+		}
+
+		changes := jsondiff.Diff(pa, pb)
+		if len(changes) > 0 {
+			ret.Panels = append(ret.Panels, BoardPanelChange{Id: id, Name: boardPanelName(pb), Type: jsondiff.Modified, Changes: changes})
+		}
+	}
+
+	for _, id := range bIds {
+		if _, has := aPanels[id]; !has {
+			ret.Panels = append(ret.Panels, BoardPanelChange{Id: id, Name: boardPanelName(bPanels[id]), Type: jsondiff.Added})
+		}
+	}
+
+	delete(a, "panels")
+	delete(b, "panels")
+	ret.Others = jsondiff.Diff(a, b)
+
+	return ret, nil
+}
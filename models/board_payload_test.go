@@ -0,0 +1,33 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/ccfos/nightingale/v6/pkg/jsondiff"
+)
+
+func TestBoardPayloadDiffGet(t *testing.T) {
+	from := `{"version":"3.0.0","panels":[{"id":"a","name":"cpu","targets":[{"expr":"cpu"}]},{"id":"r","type":"row","panels":[{"id":"b","name":"mem"}]}]}`
+	to := `{"version":"3.0.1","panels":[{"id":"a","name":"cpu","targets":[{"expr":"cpu_usage"}]},{"id":"c","name":"disk"}]}`
+
+	d, err := BoardPayloadDiffGet(from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	types := make(map[string]string)
+	for _, p := range d.Panels {
+		types[p.Id] = p.Type
+	}
+
+	want := map[string]string{"a": jsondiff.Modified, "r": jsondiff.Removed, "b": jsondiff.Removed, "c": jsondiff.Added}
+	for id, typ := range want {
+		if types[id] != typ {
+			t.Errorf("panel %s: got %q, want %q", id, types[id], typ)
+		}
+	}
+
+	if len(d.Others) != 1 || d.Others[0].Path != "version" {
+		t.Errorf("unexpected others: %+v", d.Others)
+	}
+}
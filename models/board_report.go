@@ -0,0 +1,179 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"github.com/toolkits/pkg/str"
+	"gorm.io/gorm"
+)
+
+const (
+	BoardReportFormatPNG  = "png"
+	BoardReportFormatCSV  = "csv"
+	BoardReportFormatHTML = "html"
+)
+
+// BoardReport renders the panels of a board on schedule and delivers the result through notify channels
+type BoardReport struct {
+	Id               int64             `json:"id" gorm:"primaryKey"`
+	GroupId          int64             `json:"group_id" gorm:"not null;default:0;index"`
+	Name             string            `json:"name" gorm:"type:varchar(255);not null;default:''"`
+	Note             string            `json:"note" gorm:"type:varchar(1024);not null;default:''"`
+	BoardId          int64             `json:"board_id" gorm:"not null;default:0"`
+	CronPattern      string            `json:"cron_pattern" gorm:"type:varchar(64);not null;default:''"`     // standard 5 fields, e.g. 0 9 * * 1
+	Vars             map[string]string `json:"vars" gorm:"type:text;serializer:json"`                        // board variable values
+	DatasourceId     int64             `json:"datasource_id" gorm:"not null;default:0"`                      // used when the datasource variable is not set in vars
+	Range            int64             `json:"range" gorm:"not null;default:0"`                              // unit: s, query [now-range, now]
+	Step             int64             `json:"step" gorm:"not null;default:0"`                               // unit: s, 0 means range/240
+	Formats          []string          `json:"formats" gorm:"type:varchar(255);serializer:json"`             // png csv html
+	NotifyChannelIds []int64           `json:"notify_channel_ids" gorm:"type:varchar(1024);serializer:json"` // smtp or http channels
+	Sendtos          []string          `json:"sendtos" gorm:"type:text;serializer:json"`                     // email addresses for smtp channels
+	Disabled         int               `json:"disabled" gorm:"not null;default:0"`
+	LastRunAt        int64             `json:"last_run_at" gorm:"not null;default:0"`
+	LastError        string            `json:"last_error" gorm:"type:varchar(4096);not null;default:''"`
+	CreateAt         int64             `json:"create_at" gorm:"not null;default:0"`
+	CreateBy         string            `json:"create_by" gorm:"type:varchar(64);not null;default:''"`
+	UpdateAt         int64             `json:"update_at" gorm:"not null;default:0"`
+	UpdateBy         string            `json:"update_by" gorm:"type:varchar(64);not null;default:''"`
+}
+
+func (r *BoardReport) TableName() string {
+	return "board_report"
+}
+
+func (r *BoardReport) AfterFind(tx *gorm.DB) (err error) {
+	if r.Vars == nil {
+		r.Vars = map[string]string{}
+	}
+	if r.Formats == nil {
+		r.Formats = []string{}
+	}
+	if r.NotifyChannelIds == nil {
+		r.NotifyChannelIds = []int64{}
+	}
+	if r.Sendtos == nil {
+		r.Sendtos = []string{}
+	}
+	return nil
+}
+
+func (r *BoardReport) Verify() error {
+	if r.Name == "" {
+		return errors.New("Name is blank")
+	}
+
+	if str.Dangerous(r.Name) {
+		return errors.New("Name has invalid characters")
+	}
+
+	if r.BoardId <= 0 {
+		return errors.New("board_id is blank")
+	}
+
+	if _, err := cron.ParseStandard(r.CronPattern); err != nil {
+		return fmt.Errorf("invalid cron_pattern %s: %v", r.CronPattern, err)
+	}
+
+	if r.Range <= 0 {
+		return errors.New("range should be greater than 0")
+	}
+
+	if r.Step < 0 {
+		return errors.New("step should not be negative")
+	}
+
+	if len(r.Formats) == 0 {
+		r.Formats = []string{BoardReportFormatHTML}
+	}
+
+	for _, f := range r.Formats {
+		if f != BoardReportFormatPNG && f != BoardReportFormatCSV && f != BoardReportFormatHTML {
+			return fmt.Errorf("invalid format %s", f)
+		}
+	}
+
+	if len(r.NotifyChannelIds) == 0 {
+		return errors.New("notify_channel_ids is blank")
+	}
+
+	return nil
+}
+
+func (r *BoardReport) Add(ctx *ctx.Context) error {
+	if err := r.Verify(); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	r.CreateAt = now
+	r.UpdateAt = now
+	return Insert(ctx, r)
+}
+
+func (r *BoardReport) Update(ctx *ctx.Context, ref BoardReport) error {
+	ref.Id = r.Id
+	ref.GroupId = r.GroupId
+	ref.CreateAt = r.CreateAt
+	ref.CreateBy = r.CreateBy
+	ref.LastRunAt = r.LastRunAt
+	ref.LastError = r.LastError
+	ref.UpdateAt = time.Now().Unix()
+
+	if err := ref.Verify(); err != nil {
+		return err
+	}
+
+	return DB(ctx).Model(r).Select("*").Updates(ref).Error
+}
+
+func BoardReportDels(ctx *ctx.Context, ids []int64, groupId int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return DB(ctx).Where("id in ? and group_id = ?", ids, groupId).Delete(&BoardReport{}).Error
+}
+
+func BoardReportGet(ctx *ctx.Context, where string, args ...interface{}) (*BoardReport, error) {
+	var lst []*BoardReport
+	err := DB(ctx).Where(where, args...).Find(&lst).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lst) == 0 {
+		return nil, nil
+	}
+
+	return lst[0], nil
+}
+
+func BoardReportGets(ctx *ctx.Context, groupId int64) ([]*BoardReport, error) {
+	var lst []*BoardReport
+	err := DB(ctx).Where("group_id = ?", groupId).Order("name").Find(&lst).Error
+	return lst, err
+}
+
+func BoardReportGetsEnabled(ctx *ctx.Context) ([]*BoardReport, error) {
+	var lst []*BoardReport
+	err := DB(ctx).Where("disabled = 0").Find(&lst).Error
+	return lst, err
+}
+
+// BoardReportClaim marks the run scheduled at runAt as taken, only one center wins when several are deployed
+func BoardReportClaim(ctx *ctx.Context, id, runAt int64) (bool, error) {
+	ret := DB(ctx).Model(&BoardReport{}).Where("id = ? and last_run_at < ?", id, runAt).Update("last_run_at", runAt)
+	return ret.RowsAffected > 0, ret.Error
+}
+
+func (r *BoardReport) UpdateLastError(ctx *ctx.Context, lastError string) error {
+	if len(lastError) > 4000 {
+		lastError = lastError[:4000]
+	}
+	r.LastError = lastError
+	return DB(ctx).Model(r).UpdateColumn("last_error", lastError).Error
+}
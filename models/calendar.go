@@ -0,0 +1,323 @@
+package models
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+	"github.com/ccfos/nightingale/v6/pkg/poster"
+
+	"github.com/pkg/errors"
+	"github.com/toolkits/pkg/logger"
+	"github.com/toolkits/pkg/str"
+	"gorm.io/gorm"
+)
+
+const calendarDateLayout = "2006-01-02"
+
+// modes of CalendarRef
+const (
+	CalendarWorkdays       = "workdays"        // only on the workdays of the calendar
+	CalendarHolidays       = "holidays"        // only on the holidays of the calendar
+	CalendarExceptHolidays = "except_holidays" // every day except the holidays of the calendar
+)
+
+// Calendar is a named set of holidays and workday overrides, e.g. CN-2026. The time windows of rules,
+// periodic mutes and notify rules reference it instead of creating mutes by hand for every holiday.
+type Calendar struct {
+	Id       int64    `json:"id" gorm:"primaryKey"`
+	Name     string   `json:"name" gorm:"type:varchar(255);not null;default:''"`
+	Note     string   `json:"note" gorm:"type:varchar(1024);not null;default:''"`
+	Holidays []string `json:"holidays" gorm:"type:text;serializer:json"` // 2026-10-01
+	Workdays []string `json:"workdays" gorm:"type:text;serializer:json"` // weekend days which are workdays, e.g. 2026-10-10
+	CreateAt int64    `json:"create_at" gorm:"not null;default:0"`
+	CreateBy string   `json:"create_by" gorm:"type:varchar(64);not null;default:''"`
+	UpdateAt int64    `json:"update_at" gorm:"not null;default:0"`
+	UpdateBy string   `json:"update_by" gorm:"type:varchar(64);not null;default:''"`
+
+	holidaySet map[string]struct{}
+	workdaySet map[string]struct{}
+}
+
+// CalendarGetter returns the calendar by id, nil if it does not exist
+type CalendarGetter func(id int64) *Calendar
+
+func (c *Calendar) TableName() string {
+	return "calendar"
+}
+
+func (c *Calendar) AfterFind(tx *gorm.DB) (err error) {
+	c.Parse()
+	return nil
+}
+
+// Parse builds the lookup sets of the dates, it is called after the calendar is loaded
+func (c *Calendar) Parse() {
+	if c.Holidays == nil {
+		c.Holidays = []string{}
+	}
+	if c.Workdays == nil {
+		c.Workdays = []string{}
+	}
+
+	c.holidaySet = make(map[string]struct{}, len(c.Holidays))
+	for _, d := range c.Holidays {
+		c.holidaySet[d] = struct{}{}
+	}
+
+	c.workdaySet = make(map[string]struct{}, len(c.Workdays))
+	for _, d := range c.Workdays {
+		c.workdaySet[d] = struct{}{}
+	}
+}
+
+func (c *Calendar) Verify() error {
+	if c.Name == "" {
+		return errors.New("Name is blank")
+	}
+
+	if str.Dangerous(c.Name) {
+		return errors.New("Name has invalid characters")
+	}
+
+	var err error
+	if c.Holidays, err = normalizeDates(c.Holidays); err != nil {
+		return err
+	}
+
+	if c.Workdays, err = normalizeDates(c.Workdays); err != nil {
+		return err
+	}
+
+	c.Parse()
+	for _, d := range c.Workdays {
+		if _, has := c.holidaySet[d]; has {
+			return fmt.Errorf("%s is both a holiday and a workday", d)
+		}
+	}
+
+	return nil
+}
+
+// normalizeDates checks the dates and removes the duplicated ones
+func normalizeDates(dates []string) ([]string, error) {
+	set := make(map[string]struct{}, len(dates))
+	lst := make([]string, 0, len(dates))
+	for _, d := range dates {
+		if _, err := time.Parse(calendarDateLayout, d); err != nil {
+			return nil, fmt.Errorf("invalid date %s, should be like 2026-01-01", d)
+		}
+
+		if _, has := set[d]; has {
+			continue
+		}
+		set[d] = struct{}{}
+		lst = append(lst, d)
+	}
+
+	sort.Strings(lst)
+	return lst, nil
+}
+
+// IsHoliday tells whether the day of t is a holiday, t should be in the timezone of the window
+func (c *Calendar) IsHoliday(t time.Time) bool {
+	_, has := c.holidaySet[t.Format(calendarDateLayout)]
+	return has
+}
+
+// IsWorkday tells whether the day of t is a workday: not a holiday, and a weekday or a workday override
+func (c *Calendar) IsWorkday(t time.Time) bool {
+	if c.IsHoliday(t) {
+		return false
+	}
+
+	if _, has := c.workdaySet[t.Format(calendarDateLayout)]; has {
+		return true
+	}
+
+	return t.Weekday() != time.Saturday && t.Weekday() != time.Sunday
+}
+
+func (c *Calendar) Add(ctx *ctx.Context) error {
+	if err := c.Verify(); err != nil {
+		return err
+	}
+
+	exists, err := CalendarGet(ctx, "name = ?", c.Name)
+	if err != nil {
+		return err
+	}
+
+	if exists != nil {
+		return errors.New("Calendar already exists")
+	}
+
+	now := time.Now().Unix()
+	c.CreateAt = now
+	c.UpdateAt = now
+	return Insert(ctx, c)
+}
+
+func (c *Calendar) Update(ctx *ctx.Context, ref Calendar) error {
+	ref.Id = c.Id
+	ref.CreateAt = c.CreateAt
+	ref.CreateBy = c.CreateBy
+	ref.UpdateAt = time.Now().Unix()
+
+	if err := ref.Verify(); err != nil {
+		return err
+	}
+
+	exists, err := CalendarGet(ctx, "id <> ? and name = ?", c.Id, ref.Name)
+	if err != nil {
+		return err
+	}
+
+	if exists != nil {
+		return errors.New("Calendar already exists")
+	}
+
+	return DB(ctx).Model(c).Select("*").Updates(&ref).Error
+}
+
+// CalendarDels deletes the calendars, the calendars still referenced by the time windows are not deleted
+func CalendarDels(ctx *ctx.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	for _, id := range ids {
+		if err := calendarCheckRefs(ctx, id); err != nil {
+			return err
+		}
+	}
+
+	return DB(ctx).Where("id in ?", ids).Delete(&Calendar{}).Error
+}
+
+// calendarCheckRefs returns an error if the calendar is referenced by alert rules, mutes or notify rules
+func calendarCheckRefs(ctx *ctx.Context, id int64) error {
+	// the refs are serialized to json, the field after calendar_id keeps 1 from matching 12
+	pattern := fmt.Sprintf("%%\"calendar_id\":%d,%%", id)
+
+	refs := []struct {
+		name   string
+		model  interface{}
+		column string
+	}{
+		{"alert rules", &AlertRule{}, "enable_calendar"},
+		{"alert mutes", &AlertMute{}, "periodic_mutes"},
+		{"notify rules", &NotifyRule{}, "notify_configs"},
+	}
+
+	for _, ref := range refs {
+		var ids []int64
+		err := DB(ctx).Model(ref.model).Where(ref.column+" like ?", pattern).Pluck("id", &ids).Error
+		if err != nil {
+			return err
+		}
+
+		if len(ids) > 0 {
+			return fmt.Errorf("calendar(%d) is referenced by %s %v", id, ref.name, ids)
+		}
+	}
+
+	return nil
+}
+
+func CalendarGet(ctx *ctx.Context, where string, args ...interface{}) (*Calendar, error) {
+	var lst []*Calendar
+	err := DB(ctx).Where(where, args...).Find(&lst).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lst) == 0 {
+		return nil, nil
+	}
+
+	return lst[0], nil
+}
+
+func CalendarGets(ctx *ctx.Context, query string) ([]*Calendar, error) {
+	session := DB(ctx)
+	if query != "" {
+		session = session.Where("name like ?", "%"+query+"%")
+	}
+
+	var lst []*Calendar
+	err := session.Order("name").Find(&lst).Error
+	return lst, err
+}
+
+func CalendarStatistics(ctx *ctx.Context) (*Statistics, error) {
+	if !ctx.IsCenter {
+		s, err := poster.GetByUrls[*Statistics](ctx, "/v1/n9e/statistic?name=calendar")
+		return s, err
+	}
+
+	return StatisticsGet(ctx, &Calendar{})
+}
+
+func CalendarGetsAll(ctx *ctx.Context) ([]*Calendar, error) {
+	if !ctx.IsCenter {
+		lst, err := poster.GetByUrls[[]*Calendar](ctx, "/v1/n9e/calendars")
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range lst {
+			c.Parse()
+		}
+		return lst, nil
+	}
+
+	var lst []*Calendar
+	err := DB(ctx).Find(&lst).Error
+	return lst, err
+}
+
+// CalendarRef restricts a time window to some days of a calendar
+type CalendarRef struct {
+	CalendarId int64  `json:"calendar_id"`
+	Mode       string `json:"mode"` // workdays holidays except_holidays
+}
+
+func (r *CalendarRef) Verify() error {
+	if r == nil || r.CalendarId == 0 {
+		return nil
+	}
+
+	switch r.Mode {
+	case CalendarWorkdays, CalendarHolidays, CalendarExceptHolidays:
+		return nil
+	default:
+		return fmt.Errorf("invalid calendar mode: %s", r.Mode)
+	}
+}
+
+// Match tells whether the day of t is in the days of the calendar. Windows without calendar match
+// every day like before, and windows referencing a calendar which is not found match no day, so a
+// rule restricted to the workdays does not fire on the holidays when the calendar is lost.
+func (r *CalendarRef) Match(calendars CalendarGetter, t time.Time) bool {
+	if r == nil || r.CalendarId == 0 || calendars == nil {
+		return true
+	}
+
+	c := calendars(r.CalendarId)
+	if c == nil {
+		logger.Warningf("calendar(%d) not found, the time window with the calendar matches no day", r.CalendarId)
+		return false
+	}
+
+	switch r.Mode {
+	case CalendarWorkdays:
+		return c.IsWorkday(t)
+	case CalendarHolidays:
+		return c.IsHoliday(t)
+	case CalendarExceptHolidays:
+		return !c.IsHoliday(t)
+	}
+	return true
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCalendarRefMatch(t *testing.T) {
+	cal := &Calendar{
+		Name:     "CN-2026",
+		Holidays: []string{"2026-10-01", "2026-10-02", "2026-10-01"},
+		Workdays: []string{"2026-10-10"},
+	}
+	if err := cal.Verify(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cal.Holidays) != 2 {
+		t.Errorf("duplicated holidays are not removed: %v", cal.Holidays)
+	}
+
+	calendars := func(id int64) *Calendar {
+		if id == 1 {
+			return cal
+		}
+		return nil
+	}
+
+	day := func(s string) time.Time {
+		d, _ := time.Parse("2006-01-02", s)
+		return d
+	}
+
+	tests := []struct {
+		ref  *CalendarRef
+		day  string
+		want bool
+	}{
+		{nil, "2026-10-01", true},
+		{&CalendarRef{CalendarId: 2, Mode: CalendarWorkdays}, "2026-10-01", false}, // calendar not found
+		{&CalendarRef{CalendarId: 1, Mode: CalendarWorkdays}, "2026-10-01", false}, // holiday on thursday
+		{&CalendarRef{CalendarId: 1, Mode: CalendarWorkdays}, "2026-10-05", true},
+		{&CalendarRef{CalendarId: 1, Mode: CalendarWorkdays}, "2026-10-04", false}, // sunday
+		{&CalendarRef{CalendarId: 1, Mode: CalendarWorkdays}, "2026-10-10", true},  // make-up workday on saturday
+		{&CalendarRef{CalendarId: 1, Mode: CalendarHolidays}, "2026-10-02", true},
+		{&CalendarRef{CalendarId: 1, Mode: CalendarHolidays}, "2026-10-04", false},
+		{&CalendarRef{CalendarId: 1, Mode: CalendarExceptHolidays}, "2026-10-04", true},
+		{&CalendarRef{CalendarId: 1, Mode: CalendarExceptHolidays}, "2026-10-01", false},
+	}
+
+	for i, tt := range tests {
+		if got := tt.ref.Match(calendars, day(tt.day)); got != tt.want {
+			t.Errorf("case %d: %+v on %s = %v, want %v", i, tt.ref, tt.day, got, tt.want)
+		}
+	}
+}
+
+func TestCalendarVerify(t *testing.T) {
+	cal := &Calendar{Name: "x", Holidays: []string{"2026-13-01"}}
+	if err := cal.Verify(); err == nil {
+		t.Error("expected error for invalid date")
+	}
+
+	cal = &Calendar{Name: "x", Holidays: []string{"2026-10-01"}, Workdays: []string{"2026-10-01"}}
+	if err := cal.Verify(); err == nil {
+		t.Error("expected error for a day being both holiday and workday")
+	}
+
+	if err := (&CalendarRef{CalendarId: 1, Mode: "weekends"}).Verify(); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
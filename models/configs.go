@@ -170,6 +170,24 @@ func ConfigsSetWithUname(ctx *ctx.Context, ckey, cval, uName string) error { //b
 	return err
 }
 
+// ConfigsClaim lets one of the centers run a job of the slot, ckey keeps the last claimed slot
+func ConfigsClaim(ctx *ctx.Context, ckey, slot string) (bool, error) {
+	num, err := Count(DB(ctx).Model(&Configs{}).Where("ckey=? and external=?", ckey, 0))
+	if err != nil {
+		return false, errors.WithMessage(err, "failed to count configs")
+	}
+
+	if num == 0 {
+		if err := ConfigsSet(ctx, ckey, ""); err != nil {
+			return false, err
+		}
+	}
+
+	ret := DB(ctx).Model(&Configs{}).Where("ckey=? and external=? and cval<>?", ckey, 0, slot).
+		Updates(map[string]interface{}{"cval": slot, "update_at": time.Now().Unix()})
+	return ret.RowsAffected > 0, ret.Error
+}
+
 func ConfigsGetFlashDutyAppKey(ctx *ctx.Context) (string, error) {
 	configs, err := ConfigsSelectByCkey(ctx, "flashduty_app_key")
 	if err != nil {
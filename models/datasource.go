@@ -158,6 +158,11 @@ func DatasourceDel(ctx *ctx.Context, ids []int64) error {
 	if len(ids) == 0 {
 		return nil
 	}
+
+	if err := DatasourcePermDelByDatasources(ctx, ids); err != nil {
+		return err
+	}
+
 	return DB(ctx).Where("id in ?", ids).Delete(new(Datasource)).Error
 }
 
@@ -0,0 +1,290 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/promql/parser"
+	"gorm.io/gorm"
+)
+
+const (
+	DsPermSubjectRole      = "role"
+	DsPermSubjectUserGroup = "user_group"
+	DsPermSubjectBusiGroup = "busi_group"
+)
+
+// DatasourcePerm grants read access of a datasource to a role, a user group or the members of a busi group.
+// A datasource without any grant is readable by everyone, once granted only the subjects and admins can read it.
+type DatasourcePerm struct {
+	Id           int64  `json:"id" gorm:"primaryKey"`
+	DatasourceId int64  `json:"datasource_id" gorm:"not null;default:0;index"`
+	SubjectType  string `json:"subject_type" gorm:"type:varchar(32);not null;default:''"` // role user_group busi_group
+	Subject      string `json:"subject" gorm:"type:varchar(191);not null;default:''"`     // role name or group id
+	IndexPattern string `json:"index_pattern" gorm:"type:varchar(1024);not null;default:''"`
+	Filter       string `json:"filter" gorm:"type:varchar(4096);not null;default:''"`
+	Note         string `json:"note" gorm:"type:varchar(1024);not null;default:''"`
+	CreateAt     int64  `json:"create_at" gorm:"not null;default:0"`
+	CreateBy     string `json:"create_by" gorm:"type:varchar(64);not null;default:''"`
+	UpdateAt     int64  `json:"update_at" gorm:"not null;default:0"`
+	UpdateBy     string `json:"update_by" gorm:"type:varchar(64);not null;default:''"`
+}
+
+func (p *DatasourcePerm) TableName() string {
+	return "datasource_perm"
+}
+
+// Verify checks the grant against the type of the datasource: index patterns are supported by
+// elasticsearch and opensearch, forced filters by them and prometheus
+func (p *DatasourcePerm) Verify(cate string) error {
+	p.Subject = strings.TrimSpace(p.Subject)
+	if p.Subject == "" {
+		return errors.New("subject is blank")
+	}
+
+	switch p.SubjectType {
+	case DsPermSubjectRole:
+	case DsPermSubjectUserGroup, DsPermSubjectBusiGroup:
+		if _, err := strconv.ParseInt(p.Subject, 10, 64); err != nil {
+			return fmt.Errorf("subject of %s should be the group id: %s", p.SubjectType, p.Subject)
+		}
+	default:
+		return fmt.Errorf("invalid subject_type %s", p.SubjectType)
+	}
+
+	for _, pattern := range p.IndexPatterns() {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid index_pattern %s: %v", pattern, err)
+		}
+	}
+
+	p.Filter = strings.TrimSpace(p.Filter)
+
+	switch cate {
+	case ELASTICSEARCH, OPENSEARCH:
+	case PROMETHEUS:
+		if p.IndexPattern != "" {
+			return errors.New("index_pattern is not supported by prometheus")
+		}
+
+		if p.Filter != "" {
+			if _, err := PromFilterMatchers(p.Filter); err != nil {
+				return fmt.Errorf("invalid filter %s: %v", p.Filter, err)
+			}
+		}
+	default:
+		if p.Restricted() {
+			return fmt.Errorf("index_pattern and filter are not supported by %s", cate)
+		}
+	}
+
+	return nil
+}
+
+// PromFilterMatchers parses the filter of a prometheus grant, e.g. env="test",team=~"a|b"
+func PromFilterMatchers(filter string) ([]*labels.Matcher, error) {
+	if !strings.HasPrefix(filter, "{") {
+		filter = "{" + filter + "}"
+	}
+
+	return parser.ParseMetricSelector(filter)
+}
+
+// Restricted means the grant only allows part of the data: some indices or under a forced filter
+func (p *DatasourcePerm) Restricted() bool {
+	return p.IndexPattern != "" || p.Filter != ""
+}
+
+// IndexPatterns splits the index pattern, e.g. app-*,nginx-*
+func (p *DatasourcePerm) IndexPatterns() []string {
+	var patterns []string
+	for _, s := range strings.Split(p.IndexPattern, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			patterns = append(patterns, s)
+		}
+	}
+	return patterns
+}
+
+// MatchIndex checks every index of a comma separated index expression, wildcards in the index
+// are matched literally so that app-* does not let app* through
+func (p *DatasourcePerm) MatchIndex(index string) bool {
+	patterns := p.IndexPatterns()
+	if len(patterns) == 0 {
+		return true
+	}
+
+	indices := strings.Split(index, ",")
+	for _, idx := range indices {
+		idx = strings.TrimSpace(idx)
+		// exclusions, date math and cross cluster indices could escape the patterns
+		if idx == "" || strings.HasPrefix(idx, "-") || strings.HasPrefix(idx, "<") || strings.Contains(idx, ":") {
+			return false
+		}
+
+		matched := false
+		for _, pattern := range patterns {
+			if ok, _ := path.Match(pattern, idx); ok {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DsPermSubjects are the roles and groups a user may be granted through
+type DsPermSubjects struct {
+	Roles        map[string]struct{}
+	UserGroupIds map[string]struct{}
+	BusiGroupIds map[string]struct{}
+}
+
+func DsPermSubjectsOf(ctx *ctx.Context, user *User) (*DsPermSubjects, error) {
+	s := &DsPermSubjects{
+		Roles:        make(map[string]struct{}),
+		UserGroupIds: make(map[string]struct{}),
+		BusiGroupIds: make(map[string]struct{}),
+	}
+
+	for _, role := range user.RolesLst {
+		s.Roles[role] = struct{}{}
+	}
+
+	ugids, err := MyGroupIds(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ugids {
+		s.UserGroupIds[strconv.FormatInt(id, 10)] = struct{}{}
+	}
+
+	bgids, err := BusiGroupIds(ctx, ugids)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range bgids {
+		s.BusiGroupIds[strconv.FormatInt(id, 10)] = struct{}{}
+	}
+
+	return s, nil
+}
+
+func (p *DatasourcePerm) MatchSubject(s *DsPermSubjects) bool {
+	var has bool
+	switch p.SubjectType {
+	case DsPermSubjectRole:
+		_, has = s.Roles[p.Subject]
+	case DsPermSubjectUserGroup:
+		_, has = s.UserGroupIds[p.Subject]
+	case DsPermSubjectBusiGroup:
+		_, has = s.BusiGroupIds[p.Subject]
+	}
+	return has
+}
+
+// DatasourcePermResolve decides the access of a user to a datasource with the grants of the datasource.
+// The returned grants are the restrictions to apply, none means full access.
+func DatasourcePermResolve(perms []*DatasourcePerm, s *DsPermSubjects) (bool, []*DatasourcePerm) {
+	if len(perms) == 0 {
+		return true, nil
+	}
+
+	var restricted []*DatasourcePerm
+	for _, p := range perms {
+		if !p.MatchSubject(s) {
+			continue
+		}
+
+		if !p.Restricted() {
+			return true, nil
+		}
+
+		restricted = append(restricted, p)
+	}
+
+	return len(restricted) > 0, restricted
+}
+
+func DatasourcePermStatistics(ctx *ctx.Context) (*Statistics, error) {
+	return StatisticsGet(ctx, &DatasourcePerm{})
+}
+
+func DatasourcePermGets(ctx *ctx.Context, datasourceId int64) ([]*DatasourcePerm, error) {
+	var lst []*DatasourcePerm
+	err := DB(ctx).Where("datasource_id = ?", datasourceId).Order("id").Find(&lst).Error
+	return lst, err
+}
+
+// DatasourcePermGetsAll returns the grants keyed by datasource id
+func DatasourcePermGetsAll(ctx *ctx.Context) (map[int64][]*DatasourcePerm, error) {
+	var lst []*DatasourcePerm
+	err := DB(ctx).Order("id").Find(&lst).Error
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[int64][]*DatasourcePerm)
+	for _, p := range lst {
+		m[p.DatasourceId] = append(m[p.DatasourceId], p)
+	}
+	return m, nil
+}
+
+// DatasourcePermSave replaces all the grants of a datasource
+func DatasourcePermSave(ctx *ctx.Context, ds *Datasource, perms []*DatasourcePerm, username string) error {
+	stat, err := DatasourcePermStatistics(ctx)
+	if err != nil {
+		return err
+	}
+
+	// the perm cache syncs on max(update_at), grants replaced in the same second must change it
+	datasourceId := ds.Id
+	now := time.Now().Unix()
+	if now <= stat.LastUpdated {
+		now = stat.LastUpdated + 1
+	}
+
+	for _, p := range perms {
+		if err := p.Verify(ds.PluginType); err != nil {
+			return err
+		}
+
+		p.Id = 0
+		p.DatasourceId = datasourceId
+		p.CreateAt = now
+		p.CreateBy = username
+		p.UpdateAt = now
+		p.UpdateBy = username
+	}
+
+	return DB(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("datasource_id = ?", datasourceId).Delete(&DatasourcePerm{}).Error; err != nil {
+			return err
+		}
+
+		if len(perms) == 0 {
+			return nil
+		}
+
+		return tx.Create(perms).Error
+	})
+}
+
+func DatasourcePermDelByDatasources(ctx *ctx.Context, datasourceIds []int64) error {
+	return DB(ctx).Where("datasource_id in ?", datasourceIds).Delete(&DatasourcePerm{}).Error
+}
@@ -0,0 +1,78 @@
+package models
+
+import "testing"
+
+func TestDatasourcePermMatchIndex(t *testing.T) {
+	p := &DatasourcePerm{IndexPattern: "app-*, nginx-*"}
+
+	cases := map[string]bool{
+		"app-2024.01.01":     true,
+		"app-*":              true,
+		"app-*,nginx-access": true,
+		"app*":               false,
+		"payment-2024.01.01": false,
+		"app-*,payment-*":    false,
+		"app-*,-app-secret":  false,
+		"remote:app-2024":    false,
+		"<app-{now/d}>":      false,
+		"":                   false,
+	}
+
+	for index, want := range cases {
+		if got := p.MatchIndex(index); got != want {
+			t.Errorf("MatchIndex(%q) = %v, want %v", index, got, want)
+		}
+	}
+}
+
+func TestDatasourcePermResolve(t *testing.T) {
+	s := &DsPermSubjects{
+		Roles:        map[string]struct{}{"Standard": {}},
+		UserGroupIds: map[string]struct{}{"2": {}},
+		BusiGroupIds: map[string]struct{}{},
+	}
+
+	if ok, restricted := DatasourcePermResolve(nil, s); !ok || len(restricted) != 0 {
+		t.Fatalf("datasource without grants should be open")
+	}
+
+	perms := []*DatasourcePerm{
+		{SubjectType: DsPermSubjectBusiGroup, Subject: "1"},
+		{SubjectType: DsPermSubjectUserGroup, Subject: "2", IndexPattern: "app-*", Filter: "env:test"},
+	}
+
+	ok, restricted := DatasourcePermResolve(perms, s)
+	if !ok || len(restricted) != 1 || restricted[0].Filter != "env:test" {
+		t.Fatalf("unexpected resolve: %v %v", ok, restricted)
+	}
+
+	perms = append(perms, &DatasourcePerm{SubjectType: DsPermSubjectRole, Subject: "Standard"})
+	if ok, restricted = DatasourcePermResolve(perms, s); !ok || len(restricted) != 0 {
+		t.Fatalf("full grant should win: %v %v", ok, restricted)
+	}
+
+	if ok, _ = DatasourcePermResolve(perms[:1], s); ok {
+		t.Fatalf("user without grant should be denied")
+	}
+}
+
+func TestDatasourcePermVerify(t *testing.T) {
+	cases := []struct {
+		cate string
+		perm DatasourcePerm
+		ok   bool
+	}{
+		{ELASTICSEARCH, DatasourcePerm{SubjectType: DsPermSubjectRole, Subject: "Standard", IndexPattern: "app-*", Filter: "env:test"}, true},
+		{PROMETHEUS, DatasourcePerm{SubjectType: DsPermSubjectRole, Subject: "Standard", Filter: `env="test"`}, true},
+		{PROMETHEUS, DatasourcePerm{SubjectType: DsPermSubjectRole, Subject: "Standard", IndexPattern: "app-*"}, false},
+		{PROMETHEUS, DatasourcePerm{SubjectType: DsPermSubjectRole, Subject: "Standard", Filter: "env:test"}, false},
+		{MYSQL, DatasourcePerm{SubjectType: DsPermSubjectRole, Subject: "Standard"}, true},
+		{MYSQL, DatasourcePerm{SubjectType: DsPermSubjectRole, Subject: "Standard", Filter: "env='test'"}, false},
+	}
+
+	for i, c := range cases {
+		if err := c.perm.Verify(c.cate); (err == nil) != c.ok {
+			t.Errorf("case %d: unexpected verify result: %v", i, err)
+		}
+	}
+}
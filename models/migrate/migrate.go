@@ -65,10 +65,12 @@ func MigrateTables(db *gorm.DB) error {
 	}
 	dts := []interface{}{&RecordingRule{}, &AlertRule{}, &AlertSubscribe{}, &AlertMute{},
 		&TaskRecord{}, &ChartShare{}, &Target{}, &Configs{}, &Datasource{}, &NotifyTpl{},
-		&Board{}, &BoardBusigroup{}, &Users{}, &SsoConfig{}, &models.BuiltinMetric{},
+		&Board{}, &BoardBusigroup{}, &Users{}, &UserGroup{}, &SsoConfig{}, &models.BuiltinMetric{},
 		&models.MetricFilter{}, &models.NotificaitonRecord{}, &models.TargetBusiGroup{},
 		&models.UserToken{}, &models.DashAnnotation{}, MessageTemplate{}, NotifyRule{}, NotifyChannelConfig{}, &EsIndexPatternMigrate{},
-		&models.EventPipeline{}, &models.EmbeddedProduct{}, &models.SourceToken{}}
+		&models.EventPipeline{}, &models.EmbeddedProduct{}, &models.SourceToken{},
+		&models.Revision{}, &models.BoardReport{}, &models.DatasourcePerm{}, &models.NotifyOutbox{},
+		&models.Calendar{}, &models.TaskApproval{}, &models.TaskHealRun{}}
 
 	if isPostgres(db) {
 		dts = append(dts, &models.PostgresBuiltinComponent{})
@@ -277,6 +279,9 @@ type AlertRule struct {
 	DatasourceQueries []models.DatasourceQuery `gorm:"datasource_queries;type:text;serializer:json"` // datasource queries
 	NotifyRuleIds     []int64                  `gorm:"column:notify_rule_ids;type:varchar(1024)"`
 	NotifyVersion     int                      `gorm:"column:notify_version;type:int;default:0"`
+	Version           int64                    `gorm:"column:version;type:bigint;not null;default:0;comment:latest revision version"`
+	Timezone          string                   `gorm:"column:timezone;type:varchar(64);not null;default:'';comment:IANA timezone"`
+	EnableCalendar    string                   `gorm:"column:enable_calendar;type:varchar(255);comment:calendar of the enable time"`
 }
 
 type AlertSubscribe struct {
@@ -287,11 +292,13 @@ type AlertSubscribe struct {
 	RuleIds       []int64      `gorm:"column:rule_ids;type:varchar(1024)"`
 	NotifyRuleIds []int64      `gorm:"column:notify_rule_ids;type:varchar(1024)"`
 	NotifyVersion int          `gorm:"column:notify_version;type:int;default:0"`
+	Timezone      string       `gorm:"column:timezone;type:varchar(64);not null;default:'';comment:IANA timezone"`
 }
 
 type AlertMute struct {
 	Severities string `gorm:"column:severities;type:varchar(32);not null;default:''"`
 	Tags       string `gorm:"column:tags;type:varchar(4096);default:'[]';comment:json,map,tagkey->regexp|value"`
+	Timezone   string `gorm:"column:timezone;type:varchar(64);not null;default:'';comment:IANA timezone"`
 }
 
 type RecordingRule struct {
@@ -315,11 +322,15 @@ type AlertHisEvent struct {
 	LastEvalTime  int64   `gorm:"column:last_eval_time;bigint(20);not null;default:0;comment:for time filter;index:idx_last_eval_time"`
 	OriginalTags  string  `gorm:"column:original_tags;type:text;comment:labels key=val,,k2=v2"`
 	NotifyRuleIds []int64 `gorm:"column:notify_rule_ids;type:text;serializer:json;comment:notify rule ids"`
+	RuleVersion   int64   `gorm:"column:rule_version;type:bigint;not null;default:0;comment:rule revision version"`
+	Flapping      int     `gorm:"column:flapping;type:tinyint(1);not null;default:0;comment:1 if the event is flapping"`
 }
 
 type AlertCurEvent struct {
 	OriginalTags  string  `gorm:"column:original_tags;type:text;comment:labels key=val,,k2=v2"`
 	NotifyRuleIds []int64 `gorm:"column:notify_rule_ids;type:text;serializer:json;comment:notify rule ids"`
+	RuleVersion   int64   `gorm:"column:rule_version;type:bigint;not null;default:0;comment:rule revision version"`
+	Flapping      int     `gorm:"column:flapping;type:tinyint(1);not null;default:0;comment:1 if the event is flapping"`
 }
 
 type Target struct {
@@ -366,6 +377,17 @@ type BoardBusigroup struct {
 type Users struct {
 	Belong         string `gorm:"column:belong;varchar(16);default:'';comment:belong"`
 	LastActiveTime int64  `gorm:"column:last_active_time;type:int;default:0;comment:last_active_time"`
+	Disabled       int    `gorm:"column:disabled;type:int;not null;default:0;comment:0 enabled 1 disabled"`
+	Timezone       string `gorm:"column:timezone;type:varchar(64);not null;default:'';comment:IANA timezone to display times in"`
+	ExternalId     string `gorm:"column:external_id;type:varchar(255);not null;default:'';comment:id in the identity provider"`
+}
+
+type UserGroup struct {
+	ExternalId string `gorm:"column:external_id;type:varchar(255);not null;default:'';comment:id in the identity provider"`
+}
+
+func (UserGroup) TableName() string {
+	return "user_group"
 }
 
 type SsoConfig struct {
@@ -463,6 +485,7 @@ type NotifyChannelConfig struct {
 	ParamConfig   models.NotifyParamConfig `gorm:"column:param_config;type:text"`
 	RequestType   string                   `gorm:"column:request_type;type:varchar(50);not null"`
 	RequestConfig *models.RequestConfig    `gorm:"column:request_config;type:text"`
+	RetryConfig   string                   `gorm:"column:retry_config;type:varchar(255)"`
 	Weight        int                      `gorm:"column:weight;type:int;not null;default:0"`
 	CreateAt      int64                    `gorm:"column:create_at;not null;default:0"`
 	CreateBy      string                   `gorm:"column:create_by;type:varchar(64);not null;default:''"`
@@ -21,6 +21,7 @@ type NotificaitonRecord struct {
 	Target       string `json:"target" gorm:"type:varchar(1024);not null;comment:notification target"`
 	Details      string `json:"details" gorm:"type:varchar(2048);default:'';comment:notification other info"`
 	CreatedAt    int64  `json:"created_at" gorm:"type:bigint;not null;comment:create time"`
+	OutboxId     int64  `json:"outbox_id" gorm:"type:bigint;not null;default:0;comment:notify outbox id"`
 }
 
 func NewNotificationRecord(event *AlertCurEvent, notifyRuleID int64, channel, target string) *NotificaitonRecord {
@@ -91,3 +92,11 @@ func NotificaitonRecordsGet(ctx *ctx.Context, where string, args ...interface{})
 
 	return lst, nil
 }
+
+func NotificaitonRecordGet(ctx *ctx.Context, id int64) (*NotificaitonRecord, error) {
+	lst, err := NotificaitonRecordsGet(ctx, "id=?", id)
+	if err != nil || len(lst) == 0 {
+		return nil, err
+	}
+	return lst[0], nil
+}
@@ -38,6 +38,7 @@ import (
 
 type EmailContext struct {
 	NotifyRuleId int64
+	OutboxId     int64
 	Events       []*AlertCurEvent
 	Mail         *gomail.Message
 }
@@ -58,6 +59,9 @@ type NotifyChannelConfig struct {
 	RequestType   string         `json:"request_type"` // http, stmp, script, flashduty
 	RequestConfig *RequestConfig `json:"request_config,omitempty" gorm:"serializer:json"`
 
+	// 发送失败后的重试策略, 为空时使用默认值
+	RetryConfig NotifyRetryConfig `json:"retry_config" gorm:"serializer:json"`
+
 	Weight   int    `json:"weight"` // 权重，根据此字段对内置模板进行排序
 	CreateAt int64  `json:"create_at"`
 	CreateBy string `json:"create_by"`
@@ -801,13 +805,13 @@ func needsTemplateRendering(s string) bool {
 	return strings.Contains(s, "{{") && strings.Contains(s, "}}")
 }
 
-func (ncc *NotifyChannelConfig) SendEmail(notifyRuleId int64, events []*AlertCurEvent, tpl map[string]interface{}, sendtos []string, ch chan *EmailContext) {
+func (ncc *NotifyChannelConfig) SendEmail(notifyRuleId, outboxId int64, events []*AlertCurEvent, tpl map[string]interface{}, sendtos []string, ch chan *EmailContext) {
 	m := gomail.NewMessage()
 	m.SetHeader("From", ncc.RequestConfig.SMTPRequestConfig.From)
 	m.SetHeader("To", sendtos...)
 	m.SetHeader("Subject", tpl["subject"].(string))
 	m.SetBody("text/html", tpl["content"].(string))
-	ch <- &EmailContext{notifyRuleId, events, m}
+	ch <- &EmailContext{NotifyRuleId: notifyRuleId, OutboxId: outboxId, Events: events, Mail: m}
 }
 
 func (ncc *NotifyChannelConfig) SendEmailNow(events []*AlertCurEvent, tpl map[string]interface{}, sendtos []string) error {
@@ -821,6 +825,7 @@ func (ncc *NotifyChannelConfig) SendEmailNow(events []*AlertCurEvent, tpl map[st
 		logger.Errorf("email_sender: failed to dial: %s", err)
 		return err
 	}
+	defer s.Close()
 
 	m := gomail.NewMessage()
 	m.SetHeader("From", ncc.RequestConfig.SMTPRequestConfig.From)
@@ -830,6 +835,110 @@ func (ncc *NotifyChannelConfig) SendEmailNow(events []*AlertCurEvent, tpl map[st
 	return gomail.Send(s, m)
 }
 
+// ReportAttachment is a file delivered with a board report, inline ones are referenced by the html body as cid:<name>
+type ReportAttachment struct {
+	Name        string `json:"name"`
+	ContentType string `json:"content_type"`
+	Content     []byte `json:"content"`
+	Inline      bool   `json:"inline"`
+}
+
+// SendReport delivers a board report, smtp channels send a mail with attachments,
+// http channels post {subject, content, sendtos, attachments} as json to the configured url
+func (ncc *NotifyChannelConfig) SendReport(subject, content string, attachments []*ReportAttachment, sendtos []string) error {
+	if ncc.RequestConfig == nil {
+		return fmt.Errorf("channel %s has no request config", ncc.Name)
+	}
+
+	switch ncc.RequestType {
+	case "smtp":
+		if ncc.RequestConfig.SMTPRequestConfig == nil {
+			return fmt.Errorf("channel %s has no smtp request config", ncc.Name)
+		}
+
+		if len(sendtos) == 0 {
+			return fmt.Errorf("no recipients for channel %s", ncc.Name)
+		}
+
+		smtp := ncc.RequestConfig.SMTPRequestConfig
+		d := gomail.NewDialer(smtp.Host, smtp.Port, smtp.Username, smtp.Password)
+		if smtp.InsecureSkipVerify {
+			d.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+		}
+
+		m := gomail.NewMessage()
+		m.SetHeader("From", smtp.From)
+		m.SetHeader("To", sendtos...)
+		m.SetHeader("Subject", subject)
+		m.SetBody("text/html", content)
+
+		for _, a := range attachments {
+			data := a.Content
+			settings := []gomail.FileSetting{
+				gomail.SetHeader(map[string][]string{"Content-Type": {a.ContentType}}),
+				gomail.SetCopyFunc(func(w io.Writer) error {
+					_, err := w.Write(data)
+					return err
+				}),
+			}
+
+			if a.Inline {
+				m.Embed(a.Name, settings...)
+			} else {
+				m.Attach(a.Name, settings...)
+			}
+		}
+
+		return d.DialAndSend(m)
+	case "http":
+		client, err := GetHTTPClient(ncc)
+		if err != nil {
+			return err
+		}
+
+		body, err := json.Marshal(map[string]interface{}{
+			"subject":     subject,
+			"content":     content,
+			"sendtos":     sendtos,
+			"attachments": attachments,
+		})
+		if err != nil {
+			return err
+		}
+
+		httpConfig := ncc.RequestConfig.HTTPRequestConfig
+		method := httpConfig.Method
+		if method == "" || method == "GET" {
+			method = "POST"
+		}
+
+		req, err := http.NewRequest(method, httpConfig.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+
+		req.Header.Set("Content-Type", "application/json")
+		for k, v := range httpConfig.Headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			b, _ := io.ReadAll(resp.Body)
+			return fmt.Errorf("failed to send report, status code: %d, body: %s", resp.StatusCode, string(b))
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("request type %s of channel %s does not support reports", ncc.RequestType, ncc.Name)
+}
+
 func (ncc *NotifyChannelConfig) Verify() error {
 	if ncc.Name == "" {
 		return errors.New("channel name cannot be empty")
@@ -855,6 +964,10 @@ func (ncc *NotifyChannelConfig) Verify() error {
 		}
 	}
 
+	if ncc.RetryConfig.MaxAttempts < 0 || ncc.RetryConfig.Interval < 0 || ncc.RetryConfig.MaxInterval < 0 {
+		return errors.New("retry config cannot be negative")
+	}
+
 	// 校验 Request 配置
 	switch ncc.RequestType {
 	case "http":
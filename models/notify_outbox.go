@@ -0,0 +1,246 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"gorm.io/gorm"
+)
+
+const (
+	OutboxStatusPending = iota
+	OutboxStatusSuccess
+	OutboxStatusDead
+)
+
+// OutboxLease is how long a send may take before the outbox row is picked up again,
+// it covers the sends lost in the in-memory queues when n9e restarts
+const OutboxLease = 600
+
+// NotifyRetryConfig 通知发送失败后的重试策略, 重试间隔按 interval*2^(n-1) 指数退避, 不超过 max_interval
+type NotifyRetryConfig struct {
+	MaxAttempts int   `json:"max_attempts"` // 最多发送次数, 用完后进入死信状态
+	Interval    int64 `json:"interval"`     // 首次重试间隔, 单位秒
+	MaxInterval int64 `json:"max_interval"` // 最大重试间隔, 单位秒
+}
+
+func (c NotifyRetryConfig) Normalize() NotifyRetryConfig {
+	if c.MaxAttempts <= 0 {
+		c.MaxAttempts = 5
+	}
+
+	if c.Interval <= 0 {
+		c.Interval = 30
+	}
+
+	if c.MaxInterval < c.Interval {
+		c.MaxInterval = 3600
+		if c.MaxInterval < c.Interval {
+			c.MaxInterval = c.Interval
+		}
+	}
+	return c
+}
+
+// Backoff returns the seconds to wait after the given number of failed attempts
+func (c NotifyRetryConfig) Backoff(attempts int) int64 {
+	c = c.Normalize()
+	wait := c.Interval
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= c.MaxInterval {
+			return c.MaxInterval
+		}
+	}
+	return wait
+}
+
+// NotifyOutbox is a send of a notify rule persisted before it is tried. Failed sends are retried with backoff
+// until the attempts of the channel retry config are used up, then the row is left as a dead letter. The sends
+// of the legacy notify configs have no channel: a webhook carries its config, an email its subject and content
+// in TplContent.
+type NotifyOutbox struct {
+	Id                 int64                  `json:"id" gorm:"primaryKey"`
+	NotifyRuleId       int64                  `json:"notify_rule_id" gorm:"not null;default:0"`
+	ChannelId          int64                  `json:"channel_id" gorm:"not null;default:0"`
+	ChannelName        string                 `json:"channel_name" gorm:"type:varchar(255);not null;default:''"`
+	EventId            int64                  `json:"event_id" gorm:"not null;default:0;index"`
+	Events             []*AlertCurEvent       `json:"events" gorm:"type:longtext;serializer:json"`
+	TplContent         map[string]interface{} `json:"tpl_content" gorm:"type:longtext;serializer:json"`
+	CustomParams       map[string]string      `json:"custom_params" gorm:"type:text;serializer:json"`
+	Sendtos            []string               `json:"sendtos" gorm:"type:text;serializer:json"`
+	FlashDutyChannelId int64                  `json:"flashduty_channel_id" gorm:"not null;default:0"`
+	Webhook            *Webhook               `json:"webhook,omitempty" gorm:"type:text;serializer:json"` // legacy webhook
+	WebhookBatch       bool                   `json:"webhook_batch" gorm:"not null;default:false"`        // the legacy webhook takes a list of events
+	Retry              NotifyRetryConfig      `json:"retry" gorm:"type:varchar(255);serializer:json"`
+	Status             int                    `json:"status" gorm:"not null;default:0;index:idx_status_next,priority:1"` // 0-pending 1-success 2-dead
+	Attempts           int                    `json:"attempts" gorm:"not null;default:0"`
+	NextRetryAt        int64                  `json:"next_retry_at" gorm:"not null;default:0;index:idx_status_next,priority:2"`
+	LastError          string                 `json:"last_error" gorm:"type:varchar(2048);not null;default:''"`
+	CreateAt           int64                  `json:"create_at" gorm:"not null;default:0"`
+	UpdateAt           int64                  `json:"update_at" gorm:"not null;default:0"`
+}
+
+func (o *NotifyOutbox) TableName() string {
+	return "notify_outbox"
+}
+
+func NewNotifyOutbox(events []*AlertCurEvent, notifyRuleId int64, channel *NotifyChannelConfig) *NotifyOutbox {
+	now := time.Now().Unix()
+	o := &NotifyOutbox{
+		NotifyRuleId: notifyRuleId,
+		ChannelId:    channel.ID,
+		ChannelName:  channel.Name,
+		Events:       events,
+		Retry:        channel.RetryConfig.Normalize(),
+		Status:       OutboxStatusPending,
+		NextRetryAt:  now + OutboxLease,
+		CreateAt:     now,
+		UpdateAt:     now,
+	}
+
+	if len(events) > 0 {
+		o.EventId = events[0].Id
+	}
+	return o
+}
+
+// NewLegacyNotifyOutbox returns the send of a legacy notify config, channel is the channel of its notify records
+func NewLegacyNotifyOutbox(events []*AlertCurEvent, channel string, retry NotifyRetryConfig) *NotifyOutbox {
+	now := time.Now().Unix()
+	o := &NotifyOutbox{
+		ChannelName: channel,
+		Events:      events,
+		Retry:       retry.Normalize(),
+		Status:      OutboxStatusPending,
+		NextRetryAt: now + OutboxLease,
+		CreateAt:    now,
+		UpdateAt:    now,
+	}
+
+	if len(events) > 0 {
+		o.EventId = events[0].Id
+	}
+	return o
+}
+
+// Legacy tells whether the row is a send of a legacy notify config
+func (o *NotifyOutbox) Legacy() bool {
+	return o.ChannelId == 0
+}
+
+func (o *NotifyOutbox) Add(ctx *ctx.Context) error {
+	return Insert(ctx, o)
+}
+
+// Done applies the result of an attempt: success ends the row, a failure schedules the next attempt
+// or turns the row into a dead letter
+func (o *NotifyOutbox) Done(now int64, sendErr error) {
+	o.UpdateAt = now
+	if sendErr == nil {
+		o.Status = OutboxStatusSuccess
+		o.LastError = ""
+		return
+	}
+
+	o.Attempts++
+	o.LastError = sendErr.Error()
+	if len(o.LastError) > 2048 {
+		o.LastError = o.LastError[:2048]
+	}
+
+	if o.Attempts >= o.Retry.Normalize().MaxAttempts {
+		o.Status = OutboxStatusDead
+		return
+	}
+
+	o.NextRetryAt = now + o.Retry.Backoff(o.Attempts)
+}
+
+func NotifyOutboxGet(ctx *ctx.Context, id int64) (*NotifyOutbox, error) {
+	var lst []*NotifyOutbox
+	err := DB(ctx).Where("id = ?", id).Find(&lst).Error
+	if err != nil || len(lst) == 0 {
+		return nil, err
+	}
+	return lst[0], nil
+}
+
+// NotifyOutboxDone records the result of an attempt of the row
+func NotifyOutboxDone(ctx *ctx.Context, id int64, sendErr error) error {
+	o, err := NotifyOutboxGet(ctx, id)
+	if err != nil || o == nil {
+		return err
+	}
+
+	if o.Status != OutboxStatusPending {
+		return nil
+	}
+
+	o.Done(time.Now().Unix(), sendErr)
+	return DB(ctx).Model(o).Select("status", "attempts", "next_retry_at", "last_error", "update_at").Updates(o).Error
+}
+
+// NotifyOutboxDue returns the pending rows whose next attempt is due
+func NotifyOutboxDue(ctx *ctx.Context, now int64, limit int) ([]*NotifyOutbox, error) {
+	var lst []*NotifyOutbox
+	err := DB(ctx).Where("status = ? and next_retry_at <= ?", OutboxStatusPending, now).Order("next_retry_at").Limit(limit).Find(&lst).Error
+	return lst, err
+}
+
+// NotifyOutboxClaim takes the row for an attempt by moving its lease forward,
+// only one of the centers racing for the row succeeds
+func NotifyOutboxClaim(ctx *ctx.Context, o *NotifyOutbox, now int64) (bool, error) {
+	ret := DB(ctx).Model(&NotifyOutbox{}).Where("id = ? and status = ? and next_retry_at = ?", o.Id, OutboxStatusPending, o.NextRetryAt).
+		Updates(map[string]interface{}{"next_retry_at": now + OutboxLease, "update_at": now})
+	if ret.Error != nil {
+		return false, ret.Error
+	}
+
+	if ret.RowsAffected == 0 {
+		return false, nil
+	}
+
+	o.NextRetryAt = now + OutboxLease
+	return true, nil
+}
+
+// NotifyOutboxRequeue makes the row due now with all its attempts, used by manual resend
+func NotifyOutboxRequeue(ctx *ctx.Context, id int64) error {
+	now := time.Now().Unix()
+	return DB(ctx).Model(&NotifyOutbox{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":        OutboxStatusPending,
+		"attempts":      0,
+		"next_retry_at": now,
+		"last_error":    "",
+		"update_at":     now,
+	}).Error
+}
+
+func NotifyOutboxTotal(ctx *ctx.Context, status int, ruleId int64) (int64, error) {
+	return Count(notifyOutboxSession(ctx, status, ruleId))
+}
+
+func NotifyOutboxGets(ctx *ctx.Context, status int, ruleId int64, limit, offset int) ([]*NotifyOutbox, error) {
+	var lst []*NotifyOutbox
+	err := notifyOutboxSession(ctx, status, ruleId).Order("id desc").Limit(limit).Offset(offset).Find(&lst).Error
+	return lst, err
+}
+
+func notifyOutboxSession(ctx *ctx.Context, status int, ruleId int64) *gorm.DB {
+	session := DB(ctx).Model(&NotifyOutbox{})
+	if status >= 0 {
+		session = session.Where("status = ?", status)
+	}
+
+	if ruleId > 0 {
+		session = session.Where("notify_rule_id = ?", ruleId)
+	}
+	return session
+}
+
+// NotifyOutboxClean removes the finished rows created before the timestamp, pending ones are kept
+func NotifyOutboxClean(ctx *ctx.Context, before int64) error {
+	return DB(ctx).Where("status <> ? and create_at < ?", OutboxStatusPending, before).Delete(&NotifyOutbox{}).Error
+}
@@ -0,0 +1,46 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNotifyRetryConfigBackoff(t *testing.T) {
+	c := NotifyRetryConfig{Interval: 10, MaxInterval: 60}
+	expected := []int64{10, 20, 40, 60, 60}
+	for i, e := range expected {
+		if got := c.Backoff(i + 1); got != e {
+			t.Errorf("backoff of attempt %d: expected %d, got %d", i+1, e, got)
+		}
+	}
+
+	d := NotifyRetryConfig{}.Normalize()
+	if d.MaxAttempts != 5 || d.Interval != 30 || d.MaxInterval != 3600 {
+		t.Errorf("unexpected default retry config: %+v", d)
+	}
+}
+
+func TestNotifyOutboxDone(t *testing.T) {
+	o := &NotifyOutbox{Retry: NotifyRetryConfig{MaxAttempts: 3, Interval: 10}}
+
+	o.Done(100, errors.New("timeout"))
+	if o.Status != OutboxStatusPending || o.Attempts != 1 || o.NextRetryAt != 110 {
+		t.Fatalf("unexpected outbox after first failure: %+v", o)
+	}
+
+	o.Done(200, errors.New("timeout"))
+	if o.Status != OutboxStatusPending || o.NextRetryAt != 220 {
+		t.Fatalf("unexpected outbox after second failure: %+v", o)
+	}
+
+	o.Done(300, errors.New("timeout"))
+	if o.Status != OutboxStatusDead || o.Attempts != 3 || o.LastError != "timeout" {
+		t.Fatalf("outbox should be a dead letter: %+v", o)
+	}
+
+	s := &NotifyOutbox{Attempts: 2, LastError: "timeout"}
+	s.Done(100, nil)
+	if s.Status != OutboxStatusSuccess || s.LastError != "" {
+		t.Fatalf("unexpected outbox after success: %+v", s)
+	}
+}
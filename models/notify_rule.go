@@ -44,6 +44,7 @@ type NotifyConfig struct {
 	TimeRanges []TimeRanges `json:"time_ranges"` // 适用时段
 	LabelKeys  []TagFilter  `json:"label_keys"`  // 适用标签
 	Attributes []TagFilter  `json:"attributes"`  // 适用属性
+	Timezone   string       `json:"timezone"`    // IANA timezone of the time ranges, empty is the timezone of the rule or subscribe
 }
 
 type CustomParams struct {
@@ -53,9 +54,10 @@ type CustomParams struct {
 }
 
 type TimeRanges struct {
-	Start string `json:"start"`
-	End   string `json:"end"`
-	Week  []int  `json:"week"`
+	Start    string       `json:"start"`
+	End      string       `json:"end"`
+	Week     []int        `json:"week"`
+	Calendar *CalendarRef `json:"calendar,omitempty"` // only the days of the calendar
 }
 
 var NotifyRuleCache struct {
@@ -156,6 +158,10 @@ func (c *NotifyConfig) Verify() error {
 		}
 	}
 
+	if err := VerifyTimezone(c.Timezone); err != nil {
+		return err
+	}
+
 	for _, label := range c.LabelKeys {
 		if err := label.Verify(); err != nil {
 			return err
@@ -175,7 +181,7 @@ func (t *TimeRanges) Verify() error {
 
 	// 进一步校验时间格式或检查时间段的合理性
 
-	return nil
+	return t.Calendar.Verify()
 }
 
 func (r *NotifyRule) Update(ctx *ctx.Context, ref NotifyRule) error {
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"time"
+
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	RevisionCateBoard     = "board"
+	RevisionCateAlertRule = "alert_rule"
+
+	DefaultMaxRevisions = 50
+)
+
+// Revision is a full snapshot of an object taken every time it is saved,
+// objects are identified by cate and object_id, e.g. board / alert_rule
+type Revision struct {
+	Id       int64  `json:"id" gorm:"primaryKey"`
+	Cate     string `json:"cate" gorm:"type:varchar(64);not null;default:'';index:idx_cate_object,priority:1"`
+	ObjectId int64  `json:"object_id" gorm:"not null;default:0;index:idx_cate_object,priority:2"`
+	Version  int64  `json:"version" gorm:"not null;default:0"`
+	Message  string `json:"message" gorm:"type:varchar(1024);not null;default:''"`
+	Payload  string `json:"payload,omitempty" gorm:"type:longtext"`
+	CreateAt int64  `json:"create_at" gorm:"not null;default:0"`
+	CreateBy string `json:"create_by" gorm:"type:varchar(64);not null;default:''"`
+}
+
+func (r *Revision) TableName() string {
+	return "revision"
+}
+
+// RevisionAdd stores a new revision of the object and drops the oldest ones beyond maxRevisions
+func RevisionAdd(ctx *ctx.Context, cate string, objectId int64, payload, message, createBy string, maxRevisions int) (*Revision, error) {
+	if cate == "" || objectId == 0 {
+		return nil, errors.New("cate and object_id are required")
+	}
+
+	if maxRevisions <= 0 {
+		maxRevisions = DefaultMaxRevisions
+	}
+
+	var last []Revision
+	err := DB(ctx).Select("version").Where("cate = ? and object_id = ?", cate, objectId).
+		Order("version desc").Limit(1).Find(&last).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rev := &Revision{
+		Cate:     cate,
+		ObjectId: objectId,
+		Version:  1,
+		Message:  message,
+		Payload:  payload,
+		CreateAt: time.Now().Unix(),
+		CreateBy: createBy,
+	}
+
+	if len(last) > 0 {
+		rev.Version = last[0].Version + 1
+	}
+
+	if err = Insert(ctx, rev); err != nil {
+		return nil, err
+	}
+
+	if rev.Version > int64(maxRevisions) {
+		err = DB(ctx).Where("cate = ? and object_id = ? and version <= ?", cate, objectId, rev.Version-int64(maxRevisions)).
+			Delete(&Revision{}).Error
+	}
+
+	return rev, err
+}
+
+// RevisionGets returns the revisions of an object without payload, newest first
+func RevisionGets(ctx *ctx.Context, cate string, objectId int64) ([]Revision, error) {
+	var lst []Revision
+	err := DB(ctx).Select("id", "cate", "object_id", "version", "message", "create_at", "create_by").
+		Where("cate = ? and object_id = ?", cate, objectId).Order("version desc").Find(&lst).Error
+	return lst, err
+}
+
+func RevisionCount(ctx *ctx.Context, cate string, objectId int64) (int64, error) {
+	return Count(DB(ctx).Model(&Revision{}).Where("cate = ? and object_id = ?", cate, objectId))
+}
+
+func RevisionGet(ctx *ctx.Context, cate string, objectId, id int64) (*Revision, error) {
+	var lst []*Revision
+	err := DB(ctx).Where("cate = ? and object_id = ? and id = ?", cate, objectId, id).Find(&lst).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lst) == 0 {
+		return nil, nil
+	}
+
+	return lst[0], nil
+}
+
+func RevisionDelByObject(ctx *ctx.Context, cate string, objectIds []int64) error {
+	if len(objectIds) == 0 {
+		return nil
+	}
+
+	return DB(ctx).Where("cate = ? and object_id in ?", cate, objectIds).Delete(&Revision{}).Error
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+	"github.com/ccfos/nightingale/v6/pkg/poster"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+// status of TaskApproval
+const (
+	TaskApprovalPending  = "pending"
+	TaskApprovalApproved = "approved"
+	TaskApprovalRejected = "rejected"
+)
+
+// TaskApproval is a self-healing task waiting for an approval before running, see Tpl.Approval.
+// It is approved in the UI, or with the link carrying the token in the notifications of the event.
+type TaskApproval struct {
+	Id        int64  `json:"id" gorm:"primaryKey"`
+	GroupId   int64  `json:"group_id" gorm:"not null;default:0;index:idx_group_id"`
+	RuleId    int64  `json:"rule_id" gorm:"not null;default:0"`
+	RuleName  string `json:"rule_name" gorm:"type:varchar(255);not null;default:''"`
+	EventId   int64  `json:"event_id" gorm:"not null;default:0"`
+	EventHash string `json:"event_hash" gorm:"type:varchar(64);not null;default:''"`
+	TplId     int64  `json:"tpl_id" gorm:"not null;default:0"`
+	Title     string `json:"title" gorm:"type:varchar(255);not null;default:''"`
+	Host      string `json:"host" gorm:"type:varchar(128);not null;default:''"`
+	Token     string `json:"token" gorm:"type:varchar(64);not null;default:'';index:idx_token"`
+	Status    string `json:"status" gorm:"type:varchar(32);not null;default:''"`
+	ExpireAt  int64  `json:"expire_at" gorm:"not null;default:0"`
+	CreateAt  int64  `json:"create_at" gorm:"not null;default:0"`
+	HandleAt  int64  `json:"handle_at" gorm:"not null;default:0"`
+	HandleBy  string `json:"handle_by" gorm:"type:varchar(64);not null;default:''"`
+}
+
+func (a *TaskApproval) TableName() string {
+	return "task_approval"
+}
+
+// Add saves the approval with a new token, the edge engines save it through the center
+func (a *TaskApproval) Add(ctx *ctx.Context) error {
+	if !ctx.IsCenter {
+		ret, err := poster.PostByUrlsWithResp[*TaskApproval](ctx, "/v1/n9e/task-approval-add", a)
+		if err != nil {
+			return err
+		}
+
+		if ret == nil {
+			return errors.New("empty response of task approval")
+		}
+
+		a.Id = ret.Id
+		a.Token = ret.Token
+		return nil
+	}
+
+	a.Token = strings.ReplaceAll(uuid.NewString(), "-", "")
+	a.Status = TaskApprovalPending
+	if a.CreateAt == 0 {
+		a.CreateAt = time.Now().Unix()
+	}
+
+	return Insert(ctx, a)
+}
+
+// Expired reports whether a pending approval is out of date, it is never run after that
+func (a *TaskApproval) Expired(now int64) bool {
+	return a.Status == TaskApprovalPending && a.ExpireAt > 0 && now > a.ExpireAt
+}
+
+// Handle approves or rejects the task. Tasks of recovered events can not be approved any more.
+func (a *TaskApproval) Handle(ctx *ctx.Context, approved bool, username string) error {
+	now := time.Now().Unix()
+	if a.Status != TaskApprovalPending {
+		return fmt.Errorf("the task is already %s", a.Status)
+	}
+
+	if a.Expired(now) {
+		return errors.New("the approval is expired")
+	}
+
+	status := TaskApprovalRejected
+	if approved {
+		exists, err := AlertCurEventExists(ctx, "hash = ?", a.EventHash)
+		if err != nil {
+			return err
+		}
+
+		if !exists {
+			return errors.New("the event is recovered")
+		}
+		status = TaskApprovalApproved
+	}
+
+	// only the first one wins when approving and rejecting at the same time
+	res := DB(ctx).Model(a).Where("status = ?", TaskApprovalPending).Updates(map[string]interface{}{
+		"status":    status,
+		"handle_at": now,
+		"handle_by": username,
+	})
+	if res.Error != nil {
+		return res.Error
+	}
+
+	if res.RowsAffected == 0 {
+		return errors.New("the task is already handled")
+	}
+
+	a.Status = status
+	a.HandleAt = now
+	a.HandleBy = username
+	return nil
+}
+
+func TaskApprovalGet(ctx *ctx.Context, where string, args ...interface{}) (*TaskApproval, error) {
+	var lst []*TaskApproval
+	err := DB(ctx).Where(where, args...).Find(&lst).Error
+	if err != nil {
+		return nil, err
+	}
+
+	if len(lst) == 0 {
+		return nil, nil
+	}
+
+	return lst[0], nil
+}
+
+// TaskApprovalGetsByIds is used by the alert engines to learn the approvals of their waiting tasks
+func TaskApprovalGetsByIds(ctx *ctx.Context, ids []int64) ([]*TaskApproval, error) {
+	if len(ids) == 0 {
+		return []*TaskApproval{}, nil
+	}
+
+	if !ctx.IsCenter {
+		strs := make([]string, 0, len(ids))
+		for _, id := range ids {
+			strs = append(strs, fmt.Sprint(id))
+		}
+		return poster.GetByUrls[[]*TaskApproval](ctx, "/v1/n9e/task-approvals?ids="+strings.Join(strs, ","))
+	}
+
+	var lst []*TaskApproval
+	err := DB(ctx).Where("id in ?", ids).Find(&lst).Error
+	return lst, err
+}
+
+// TaskApprovalGetsPending returns the approvals still waiting, the alert engines take them over after a restart
+func TaskApprovalGetsPending(ctx *ctx.Context) ([]*TaskApproval, error) {
+	if !ctx.IsCenter {
+		return poster.GetByUrls[[]*TaskApproval](ctx, "/v1/n9e/task-approvals?status="+TaskApprovalPending)
+	}
+
+	var lst []*TaskApproval
+	err := DB(ctx).Where("status = ? and expire_at > ?", TaskApprovalPending, time.Now().Unix()).Find(&lst).Error
+	return lst, err
+}
+
+func TaskApprovalTotal(ctx *ctx.Context, bgids []int64, status string) (int64, error) {
+	session := DB(ctx).Model(&TaskApproval{})
+	if len(bgids) > 0 {
+		session = session.Where("group_id in ?", bgids)
+	}
+
+	if status != "" {
+		session = session.Where("status = ?", status)
+	}
+
+	return Count(session)
+}
+
+func TaskApprovalGets(ctx *ctx.Context, bgids []int64, status string, limit, offset int) ([]*TaskApproval, error) {
+	session := DB(ctx).Order("id desc").Limit(limit).Offset(offset)
+	if len(bgids) > 0 {
+		session = session.Where("group_id in ?", bgids)
+	}
+
+	if status != "" {
+		session = session.Where("status = ?", status)
+	}
+
+	var lst []*TaskApproval
+	err := session.Find(&lst).Error
+	return lst, err
+}
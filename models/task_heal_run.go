@@ -0,0 +1,59 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/pkg/ctx"
+	"github.com/ccfos/nightingale/v6/pkg/poster"
+)
+
+// the runs are kept at least for a week, and for the longest window of the runs
+const taskHealRunKeep = 7 * 86400
+
+// TaskHealRun is a run of a self-healing task template on a host. The alert engines count the runs in the
+// window of the template from it, see Tpl.MaxRuns, so the limit holds across restarts, reshards and engines.
+type TaskHealRun struct {
+	Id        int64  `json:"id" gorm:"primaryKey"`
+	TplId     int64  `json:"tpl_id" gorm:"not null;default:0;index:idx_tpl_host"`
+	Host      string `json:"host" gorm:"type:varchar(128);not null;default:'';index:idx_tpl_host"`
+	RuleId    int64  `json:"rule_id" gorm:"not null;default:0"`
+	EventHash string `json:"event_hash" gorm:"type:varchar(64);not null;default:''"`
+	Window    int64  `json:"window" gorm:"not null;default:0"`
+	CreateAt  int64  `json:"create_at" gorm:"not null;default:0;index:idx_create_at"`
+}
+
+func (r *TaskHealRun) TableName() string {
+	return "task_heal_run"
+}
+
+// Add saves the run and prunes the old runs of the template on the host, the edge engines save it through the center
+func (r *TaskHealRun) Add(ctx *ctx.Context) error {
+	if !ctx.IsCenter {
+		return poster.PostByUrls(ctx, "/v1/n9e/task-heal-run-add", r)
+	}
+
+	if r.CreateAt == 0 {
+		r.CreateAt = time.Now().Unix()
+	}
+
+	if err := Insert(ctx, r); err != nil {
+		return err
+	}
+
+	keep := r.Window
+	if keep < taskHealRunKeep {
+		keep = taskHealRunKeep
+	}
+	return DB(ctx).Where("tpl_id = ? and host = ? and create_at < ?", r.TplId, r.Host, r.CreateAt-keep).Delete(&TaskHealRun{}).Error
+}
+
+// TaskHealRunCount returns the number of the runs of the template on the host since the time
+func TaskHealRunCount(ctx *ctx.Context, tplId int64, host string, since int64) (int64, error) {
+	if !ctx.IsCenter {
+		return poster.GetByUrls[int64](ctx, fmt.Sprintf("/v1/n9e/task-heal-runs/count?tpl_id=%d&host=%s&since=%d", tplId, url.QueryEscape(host), since))
+	}
+
+	return Count(DB(ctx).Model(&TaskHealRun{}).Where("tpl_id = ? and host = ? and create_at > ?", tplId, host, since))
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+var timezones sync.Map // name -> *time.Location
+
+// LoadTimezone returns the location of the IANA timezone, e.g. Asia/Shanghai. The local timezone
+// of the server is used when the name is empty or unknown, which is how the time windows worked before
+func LoadTimezone(name string) *time.Location {
+	if name == "" {
+		return time.Local
+	}
+
+	if loc, has := timezones.Load(name); has {
+		return loc.(*time.Location)
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return time.Local
+	}
+
+	timezones.Store(name, loc)
+	return loc
+}
+
+// VerifyTimezone checks the timezone is empty or a known IANA timezone
+func VerifyTimezone(name string) error {
+	if name == "" {
+		return nil
+	}
+
+	if _, err := time.LoadLocation(name); err != nil {
+		return fmt.Errorf("invalid timezone: %s", name)
+	}
+	return nil
+}
+
+// TimeIn returns the time of the unix timestamp in the first non empty timezone, the windows of
+// rules and mutes are compared with its wall clock, so DST transitions follow the timezone
+func TimeIn(ts int64, names ...string) time.Time {
+	for _, tz := range names {
+		if tz != "" {
+			return time.Unix(ts, 0).In(LoadTimezone(tz))
+		}
+	}
+	return time.Unix(ts, 0)
+}
@@ -87,6 +87,9 @@ type User struct {
 	UserGroupsRes  []*UserGroupRes `json:"user_groups" gorm:"-"`
 	BusiGroupsRes  []*BusiGroupRes `json:"busi_groups" gorm:"-"`
 	LastActiveTime int64           `json:"last_active_time"`
+	Disabled       int             `json:"disabled"`    // 0: enabled 1: disabled, e.g. deactivated by SCIM
+	Timezone       string          `json:"timezone"`    // IANA timezone to display times in, empty is the browser timezone
+	ExternalId     string          `json:"external_id"` // id of the user in the identity provider, set by SCIM
 }
 
 type UserGroupRes struct {
@@ -112,6 +115,10 @@ func (u *User) String() string {
 	return fmt.Sprintf("<id:%d username:%s nickname:%s email:%s phone:%s contacts:%s>", u.Id, u.Username, u.Nickname, u.Email, u.Phone, string(bs))
 }
 
+func (u *User) IsDisabled() bool {
+	return u.Disabled == 1
+}
+
 func (u *User) IsAdmin() bool {
 	for i := 0; i < len(u.RolesLst); i++ {
 		if u.RolesLst[i] == AdminRole {
@@ -163,6 +170,10 @@ func (u *User) Verify() error {
 		return errors.New("Email invalid")
 	}
 
+	if err := VerifyTimezone(u.Timezone); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -341,6 +352,33 @@ func UsersGet(ctx *ctx.Context, where string, args ...interface{}) ([]*User, err
 	return lst, nil
 }
 
+// UserGetsPaging returns users matching where ordered by id, along with the total count
+func UserGetsPaging(ctx *ctx.Context, limit, offset int, where string, args ...interface{}) ([]*User, int64, error) {
+	session := DB(ctx).Model(&User{})
+	if where != "" {
+		session = session.Where(where, args...)
+	}
+	session = session.Session(&gorm.Session{})
+
+	total, err := Count(session)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lst []*User
+	err = session.Order("id").Limit(limit).Offset(offset).Find(&lst).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, user := range lst {
+		user.RolesLst = strings.Fields(user.Roles)
+		user.Admin = user.IsAdmin()
+	}
+
+	return lst, total, nil
+}
+
 func UserMapGet(ctx *ctx.Context, where string, args ...interface{}) map[string]*User {
 	lst, err := UsersGet(ctx, where, args...)
 	if err != nil {
@@ -525,6 +563,10 @@ func PassLogin(ctx *ctx.Context, redis storage.Redis, username, pass string) (*U
 		return nil, fmt.Errorf("Username or password invalid")
 	}
 
+	if user.IsDisabled() {
+		return nil, fmt.Errorf("User is disabled")
+	}
+
 	return user, nil
 }
 
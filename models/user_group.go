@@ -12,15 +12,16 @@ import (
 )
 
 type UserGroup struct {
-	Id       int64   `json:"id" gorm:"primaryKey"`
-	Name     string  `json:"name"`
-	Note     string  `json:"note"`
-	CreateAt int64   `json:"create_at"`
-	CreateBy string  `json:"create_by"`
-	UpdateAt int64   `json:"update_at"`
-	UpdateBy string  `json:"update_by"`
-	UserIds  []int64 `json:"-" gorm:"-"`
-	Users    []User  `json:"users" gorm:"-"`
+	Id         int64   `json:"id" gorm:"primaryKey"`
+	Name       string  `json:"name"`
+	Note       string  `json:"note"`
+	CreateAt   int64   `json:"create_at"`
+	CreateBy   string  `json:"create_by"`
+	UpdateAt   int64   `json:"update_at"`
+	UpdateBy   string  `json:"update_by"`
+	ExternalId string  `json:"external_id"` // id of the group in the identity provider, set by SCIM
+	UserIds    []int64 `json:"-" gorm:"-"`
+	Users      []User  `json:"users" gorm:"-"`
 }
 
 func (ug *UserGroup) TableName() string {
@@ -99,6 +100,24 @@ func UserGroupGet(ctx *ctx.Context, where string, args ...interface{}) (*UserGro
 	return lst[0], nil
 }
 
+// UserGroupGetsPaging returns user groups matching where ordered by id, along with the total count
+func UserGroupGetsPaging(ctx *ctx.Context, limit, offset int, where string, args ...interface{}) ([]*UserGroup, int64, error) {
+	session := DB(ctx).Model(&UserGroup{})
+	if where != "" {
+		session = session.Where(where, args...)
+	}
+	session = session.Session(&gorm.Session{})
+
+	total, err := Count(session)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var lst []*UserGroup
+	err = session.Order("id").Limit(limit).Offset(offset).Find(&lst).Error
+	return lst, total, err
+}
+
 func UserGroupGetById(ctx *ctx.Context, id int64) (*UserGroup, error) {
 	return UserGroupGet(ctx, "id = ?", id)
 }
@@ -0,0 +1,551 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var panelTypesToGrafana = map[string]string{
+	"timeseries": "timeseries",
+	"stat":       "stat",
+	"gauge":      "gauge",
+	"table":      "table",
+	"barGauge":   "bargauge",
+}
+
+type exporter struct {
+	report    *Report
+	vars      []*Variable
+	dsNames   map[string]struct{}
+	defaultDs string
+	nextId    int
+}
+
+// Export converts n9e board configs to a grafana dashboard
+func Export(name, tags, configs string) (*Dashboard, *Report, error) {
+	m := make(map[string]interface{})
+	if configs != "" {
+		if err := json.Unmarshal([]byte(configs), &m); err != nil {
+			return nil, nil, fmt.Errorf("invalid board configs: %v", err)
+		}
+	}
+
+	ex := &exporter{
+		report:  newReport(),
+		dsNames: make(map[string]struct{}),
+	}
+
+	vars, _ := m["var"].([]interface{})
+	for _, v := range vars {
+		if vm, ok := v.(map[string]interface{}); ok && getString(vm, "type") == "datasource" {
+			ex.variable(vm)
+		}
+	}
+
+	for _, v := range vars {
+		if vm, ok := v.(map[string]interface{}); ok && getString(vm, "type") != "datasource" {
+			ex.variable(vm)
+		}
+	}
+
+	panels, _ := m["panels"].([]interface{})
+	out := ex.panels(panels)
+
+	var links []*Link
+	if lst, ok := m["links"].([]interface{}); ok {
+		for _, l := range lst {
+			lm, ok := l.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			links = append(links, &Link{
+				Title:       getString(lm, "title"),
+				Type:        "link",
+				Url:         getString(lm, "url"),
+				TargetBlank: getBool(lm, "targetBlank"),
+			})
+		}
+	}
+
+	if ex.vars == nil {
+		ex.vars = []*Variable{}
+	}
+
+	return &Dashboard{
+		Title:         name,
+		Tags:          strings.Fields(tags),
+		SchemaVersion: schemaVersion,
+		Time:          &TimeRange{From: "now-1h", To: "now"},
+		Templating:    Templating{List: ex.vars},
+		Links:         links,
+		Panels:        out,
+	}, ex.report, nil
+}
+
+func jsonString(s string) json.RawMessage {
+	b, _ := json.Marshal(s)
+	return b
+}
+
+func dsRefJSON(uid string) json.RawMessage {
+	b, _ := json.Marshal(map[string]string{"type": prometheusType, "uid": uid})
+	return b
+}
+
+func (ex *exporter) addDsVar(name string) {
+	ex.dsNames[name] = struct{}{}
+	// datasource variables go first, query variables refer to them
+	ex.vars = append([]*Variable{{
+		Name:  name,
+		Type:  "datasource",
+		Query: jsonString(prometheusType),
+	}}, ex.vars...)
+
+	if ex.defaultDs == "" {
+		ex.defaultDs = name
+	}
+}
+
+// datasourceRef turns the n9e datasource value, a variable reference or a datasource id, into a grafana reference
+func (ex *exporter) datasourceRef(value interface{}) json.RawMessage {
+	if s, ok := value.(string); ok {
+		if name := varName(s); name != "" {
+			if _, has := ex.dsNames[name]; !has {
+				ex.addDsVar(name)
+			}
+			return dsRefJSON("${" + name + "}")
+		}
+	}
+
+	if ex.defaultDs == "" {
+		ex.addDsVar(defaultDsVar)
+	}
+
+	if value != nil && value != "" {
+		ex.report.warnf("datasource %v is replaced with variable ${%s}", value, ex.defaultDs)
+	}
+
+	return dsRefJSON("${" + ex.defaultDs + "}")
+}
+
+func (ex *exporter) variable(v map[string]interface{}) {
+	name, label, typ := getString(v, "name"), getString(v, "label"), getString(v, "type")
+	gv := &Variable{
+		Name:  name,
+		Label: label,
+		Type:  typ,
+	}
+	if getBool(v, "hide") {
+		gv.Hide = 2
+	}
+
+	switch typ {
+	case "datasource":
+		if def := getString(v, "definition"); def != prometheusType {
+			ex.report.unsupported("variable", name, label, typ, fmt.Sprintf("datasource type %s is not supported", def))
+			return
+		}
+
+		if _, has := ex.dsNames[name]; has {
+			return
+		}
+
+		ex.dsNames[name] = struct{}{}
+		if ex.defaultDs == "" {
+			ex.defaultDs = name
+		}
+		gv.Query = jsonString(prometheusType)
+	case "query":
+		ds := getMap(v, "datasource")
+		if cate := getString(ds, "cate"); cate != "" && cate != prometheusType {
+			ex.report.unsupported("variable", name, label, typ, fmt.Sprintf("datasource type %s is not supported", cate))
+			return
+		}
+
+		def := getString(v, "definition")
+		gv.Datasource = ex.datasourceRef(ds["value"])
+		gv.Definition = def
+		gv.Query = jsonString(def)
+		gv.Refresh = 1
+		gv.Multi = getBool(v, "multi")
+		gv.IncludeAll = getBool(v, "allOption")
+		gv.AllValue = getString(v, "allValue")
+		gv.Regex = getString(v, "reg")
+	case "custom":
+		gv.Query = jsonString(getString(v, "definition"))
+		gv.Multi = getBool(v, "multi")
+		gv.IncludeAll = getBool(v, "allOption")
+		gv.AllValue = getString(v, "allValue")
+	case "constant":
+		gv.Query = jsonString(getString(v, "definition"))
+		gv.Hide = 2
+	case "textbox":
+		gv.Query = jsonString(getString(v, "defaultValue"))
+	default:
+		ex.report.unsupported("variable", name, label, typ, "variable type is not supported")
+		return
+	}
+
+	ex.vars = append(ex.vars, gv)
+}
+
+func (ex *exporter) panels(lst []interface{}) []*Panel {
+	out := make([]*Panel, 0, len(lst))
+	for _, item := range lst {
+		p, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		if getString(p, "type") == "row" {
+			ex.nextId++
+			row := &Panel{
+				Id:        ex.nextId,
+				Type:      "row",
+				Title:     getString(p, "name"),
+				Collapsed: getBool(p, "collapsed"),
+				GridPos:   gridPos(p),
+				Panels:    []*Panel{},
+			}
+			row.GridPos.H, row.GridPos.W, row.GridPos.X = 1, 24, 0
+
+			if children, ok := p["panels"].([]interface{}); ok {
+				row.Panels = ex.panels(children)
+			}
+
+			out = append(out, row)
+			continue
+		}
+
+		if gp := ex.panel(p); gp != nil {
+			out = append(out, gp)
+		}
+	}
+	return out
+}
+
+func gridPos(p map[string]interface{}) GridPos {
+	l := getMap(p, "layout")
+	return GridPos{H: getInt(l, "h"), W: getInt(l, "w"), X: getInt(l, "x"), Y: getInt(l, "y")}
+}
+
+func (ex *exporter) panel(p map[string]interface{}) *Panel {
+	id, name, typ := getString(p, "id"), getString(p, "name"), getString(p, "type")
+
+	gtype, has := panelTypesToGrafana[typ]
+	if !has {
+		ex.report.unsupported("panel", id, name, typ, "panel type is not supported")
+		return nil
+	}
+
+	if cate := getString(p, "datasourceCate"); cate != "" && cate != prometheusType {
+		ex.report.unsupported("panel", id, name, typ, fmt.Sprintf("datasource type %s is not supported", cate))
+		return nil
+	}
+
+	ex.nextId++
+	gp := &Panel{
+		Id:          ex.nextId,
+		Type:        gtype,
+		Title:       name,
+		Description: getString(p, "description"),
+		GridPos:     gridPos(p),
+		Datasource:  ex.datasourceRef(p["datasourceValue"]),
+	}
+
+	if targets, ok := p["targets"].([]interface{}); ok {
+		for _, t := range targets {
+			tm, ok := t.(map[string]interface{})
+			if !ok || getString(tm, "expr") == "" {
+				continue
+			}
+			gp.Targets = append(gp.Targets, &Target{
+				RefId:        getString(tm, "refId"),
+				Expr:         getString(tm, "expr"),
+				LegendFormat: getString(tm, "legend"),
+				Instant:      getBool(tm, "instant"),
+				Hide:         getBool(tm, "hide"),
+				Datasource:   gp.Datasource,
+			})
+		}
+	}
+
+	options, custom := getMap(p, "options"), getMap(p, "custom")
+	std := getMap(options, "standardOptions")
+
+	def := FieldDefaults{
+		Unit:       ex.unit(name, getString(std, "util")),
+		Thresholds: thresholdsToGrafana(getMap(options, "thresholds")),
+		Mappings:   ex.mappings(name, options["valueMappings"]),
+		Custom:     map[string]interface{}{},
+	}
+	if v, ok := getFloat(std, "decimals"); ok {
+		d := int(v)
+		def.Decimals = &d
+	}
+	if v, ok := getFloat(std, "min"); ok {
+		def.Min = &v
+	}
+	if v, ok := getFloat(std, "max"); ok {
+		def.Max = &v
+	}
+
+	if overrides, ok := p["overrides"].([]interface{}); ok && len(overrides) > 0 {
+		ex.report.warnf("panel %q: overrides are not exported", name)
+	}
+
+	switch gtype {
+	case "timeseries":
+		def.Custom = ex.timeseriesCustom(custom)
+
+		tooltip := "single"
+		if getString(getMap(options, "tooltip"), "mode") == "all" {
+			tooltip = "multi"
+		}
+
+		legend := getMap(options, "legend")
+		displayMode := getString(legend, "displayMode")
+		placement := getString(legend, "placement")
+		if placement == "" {
+			placement = "bottom"
+		}
+
+		gp.Options = map[string]interface{}{
+			"tooltip": map[string]interface{}{"mode": tooltip},
+			"legend": map[string]interface{}{
+				"showLegend":  displayMode != "hidden",
+				"displayMode": strings.Replace(displayMode, "hidden", "list", 1),
+				"placement":   placement,
+			},
+		}
+	case "stat":
+		textMode := "value_and_name"
+		if getString(custom, "textMode") == "value" {
+			textMode = "value"
+		}
+
+		colorMode := getString(custom, "colorMode")
+		if colorMode == "" {
+			colorMode = "value"
+		}
+
+		graphMode := getString(custom, "graphMode")
+		if graphMode == "" {
+			graphMode = "none"
+		}
+
+		gp.Options = map[string]interface{}{
+			"reduceOptions": ex.reduceOptions(name, custom),
+			"textMode":      textMode,
+			"colorMode":     colorMode,
+			"graphMode":     graphMode,
+			"orientation":   getString(custom, "orientation"),
+		}
+	case "gauge":
+		gp.Options = map[string]interface{}{
+			"reduceOptions":        ex.reduceOptions(name, custom),
+			"showThresholdMarkers": true,
+		}
+	case "bargauge":
+		gp.Options = map[string]interface{}{
+			"reduceOptions": ex.reduceOptions(name, custom),
+			"displayMode":   "gradient",
+			"orientation":   "horizontal",
+		}
+	case "table":
+		showHeader := true
+		if v, ok := custom["showHeader"].(bool); ok {
+			showHeader = v
+		}
+		gp.Options = map[string]interface{}{
+			"showHeader": showHeader,
+		}
+	}
+
+	gp.FieldConfig = &FieldConfig{Defaults: def, Overrides: []interface{}{}}
+	ex.report.Panels++
+	return gp
+}
+
+func (ex *exporter) timeseriesCustom(c map[string]interface{}) map[string]interface{} {
+	drawStyle := getString(c, "drawStyle")
+	if drawStyle == "" {
+		drawStyle = "lines"
+	}
+
+	lineInterpolation := getString(c, "lineInterpolation")
+	if lineInterpolation == "" {
+		lineInterpolation = "linear"
+	}
+
+	lineWidth, ok := getFloat(c, "lineWidth")
+	if !ok {
+		lineWidth = 1
+	}
+
+	fillOpacity, _ := getFloat(c, "fillOpacity")
+
+	stacking := "none"
+	if s := getString(c, "stack"); s == "noraml" || s == "normal" {
+		stacking = "normal"
+	}
+
+	showPoints := "never"
+	if getString(c, "showPoints") == "always" {
+		showPoints = "always"
+	}
+
+	pointSize, ok := getFloat(c, "pointSize")
+	if !ok {
+		pointSize = 5
+	}
+
+	scale := getMap(c, "scaleDistribution")
+	if len(scale) == 0 {
+		scale = map[string]interface{}{"type": "linear"}
+	}
+
+	return map[string]interface{}{
+		"drawStyle":         drawStyle,
+		"lineInterpolation": lineInterpolation,
+		"lineWidth":         lineWidth,
+		"fillOpacity":       fillOpacity * 100,
+		"spanNulls":         getBool(c, "spanNulls"),
+		"showPoints":        showPoints,
+		"pointSize":         pointSize,
+		"stacking":          map[string]interface{}{"mode": stacking, "group": "A"},
+		"scaleDistribution": scale,
+	}
+}
+
+func (ex *exporter) reduceOptions(panel string, custom map[string]interface{}) map[string]interface{} {
+	calc := getString(custom, "calc")
+	reducer, has := calcsToGrafana[calc]
+	if !has {
+		if calc != "" {
+			ex.report.warnf("panel %q: calculation %s is not supported, fallback to lastNotNull", panel, calc)
+		}
+		reducer = "lastNotNull"
+	}
+
+	return map[string]interface{}{
+		"calcs":  []string{reducer},
+		"fields": "",
+		"values": false,
+	}
+}
+
+func (ex *exporter) unit(panel, util string) string {
+	if util == "" {
+		return "none"
+	}
+
+	if unit, has := unitsToGrafana[util]; has {
+		return unit
+	}
+
+	ex.report.warnf("panel %q: unit %s is not supported, fallback to none", panel, util)
+	return "none"
+}
+
+// thresholdsToGrafana puts the base step first and sorts the others ascending, as grafana expects
+func thresholdsToGrafana(t map[string]interface{}) *Thresholds {
+	lst, ok := t["steps"].([]interface{})
+	if !ok || len(lst) == 0 {
+		return nil
+	}
+
+	var base *ThresholdStep
+	steps := make([]*ThresholdStep, 0, len(lst))
+	for _, s := range lst {
+		sm, ok := s.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		step := &ThresholdStep{Color: getString(sm, "color")}
+		v, ok := getFloat(sm, "value")
+		if !ok || getString(sm, "type") == "base" {
+			if base == nil {
+				base = step
+			}
+			continue
+		}
+
+		step.Value = &v
+		steps = append(steps, step)
+	}
+
+	sort.SliceStable(steps, func(i, j int) bool {
+		return *steps[i].Value < *steps[j].Value
+	})
+
+	if base == nil {
+		base = &ThresholdStep{Color: "green"}
+	}
+
+	mode := getString(t, "mode")
+	if mode == "" {
+		mode = "absolute"
+	}
+
+	return &Thresholds{Mode: mode, Steps: append([]*ThresholdStep{base}, steps...)}
+}
+
+func (ex *exporter) mappings(panel string, v interface{}) []*Mapping {
+	lst, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var out []*Mapping
+	values := make(map[string]MappingResult)
+	for _, item := range lst {
+		m, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		match, result := getMap(m, "match"), getMap(m, "result")
+		res := MappingResult{Text: getString(result, "text"), Color: getString(result, "color")}
+
+		switch getString(m, "type") {
+		case "special":
+			f, ok := getFloat(match, "special")
+			if !ok {
+				continue
+			}
+			res.Index = len(values)
+			values[strconv.FormatFloat(f, 'f', -1, 64)] = res
+		case "textValue":
+			text := getString(match, "textValue")
+			if text == "" {
+				continue
+			}
+			res.Index = len(values)
+			values[text] = res
+		case "range":
+			r := map[string]interface{}{"result": res}
+			if f, ok := getFloat(match, "from"); ok {
+				r["from"] = f
+			}
+			if f, ok := getFloat(match, "to"); ok {
+				r["to"] = f
+			}
+			b, _ := json.Marshal(r)
+			out = append(out, &Mapping{Type: "range", Options: b})
+		default:
+			ex.report.warnf("panel %q: %s value mappings are not supported", panel, getString(m, "type"))
+		}
+	}
+
+	if len(values) > 0 {
+		b, _ := json.Marshal(values)
+		out = append([]*Mapping{{Type: "value", Options: b}}, out...)
+	}
+
+	return out
+}
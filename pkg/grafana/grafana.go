@@ -0,0 +1,358 @@
+// Package grafana converts dashboards between the Grafana JSON model and n9e board configs.
+// Only prometheus panels are converted, everything else is listed in the Report.
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	boardVersion   = "3.0.0"
+	panelVersion   = "3.0.0"
+	schemaVersion  = 39
+	prometheusType = "prometheus"
+	defaultDsVar   = "prom"
+)
+
+// Dashboard is the subset of the Grafana dashboard model the converter understands
+type Dashboard struct {
+	Uid           string          `json:"uid,omitempty"`
+	Title         string          `json:"title"`
+	Description   string          `json:"description,omitempty"`
+	Tags          []string        `json:"tags"`
+	SchemaVersion int             `json:"schemaVersion"`
+	Time          *TimeRange      `json:"time,omitempty"`
+	Templating    Templating      `json:"templating"`
+	Links         []*Link         `json:"links,omitempty"`
+	Panels        []*Panel        `json:"panels"`
+	Rows          []*LegacyRow    `json:"rows,omitempty"` // schemaVersion < 16
+	Inputs        json.RawMessage `json:"__inputs,omitempty"`
+}
+
+type TimeRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Templating struct {
+	List []*Variable `json:"list"`
+}
+
+type Link struct {
+	Title       string `json:"title"`
+	Type        string `json:"type"`
+	Url         string `json:"url,omitempty"`
+	TargetBlank bool   `json:"targetBlank,omitempty"`
+}
+
+type Variable struct {
+	Name       string          `json:"name"`
+	Label      string          `json:"label,omitempty"`
+	Type       string          `json:"type"`
+	Hide       int             `json:"hide"` // 0: show 1: hide label 2: hide variable
+	Multi      bool            `json:"multi,omitempty"`
+	IncludeAll bool            `json:"includeAll,omitempty"`
+	AllValue   string          `json:"allValue,omitempty"`
+	Datasource json.RawMessage `json:"datasource,omitempty"`
+	Definition string          `json:"definition,omitempty"`
+	Query      json.RawMessage `json:"query,omitempty"` // string or {"query": "..."}
+	Regex      string          `json:"regex,omitempty"`
+	Refresh    interface{}     `json:"refresh,omitempty"` // int, or bool in old versions
+}
+
+type GridPos struct {
+	H int `json:"h"`
+	W int `json:"w"`
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Panel struct {
+	Id          int                    `json:"id"`
+	Type        string                 `json:"type"`
+	Title       string                 `json:"title"`
+	Description string                 `json:"description,omitempty"`
+	GridPos     GridPos                `json:"gridPos"`
+	Datasource  json.RawMessage        `json:"datasource,omitempty"`
+	Targets     []*Target              `json:"targets,omitempty"`
+	FieldConfig *FieldConfig           `json:"fieldConfig,omitempty"`
+	Options     map[string]interface{} `json:"options,omitempty"`
+	Collapsed   bool                   `json:"collapsed,omitempty"`
+	Panels      []*Panel               `json:"panels,omitempty"`
+
+	// legacy graph and singlestat panels
+	Span      float64       `json:"span,omitempty"`
+	Lines     *bool         `json:"lines,omitempty"`
+	Bars      bool          `json:"bars,omitempty"`
+	Fill      float64       `json:"fill,omitempty"`
+	Linewidth float64       `json:"linewidth,omitempty"`
+	Stack     bool          `json:"stack,omitempty"`
+	Legend    *LegacyLegend `json:"legend,omitempty"`
+	Yaxes     []*LegacyAxis `json:"yaxes,omitempty"`
+	Format    string        `json:"format,omitempty"`
+	ValueName string        `json:"valueName,omitempty"`
+}
+
+type LegacyRow struct {
+	Title    string      `json:"title"`
+	Collapse bool        `json:"collapse"`
+	Height   interface{} `json:"height"` // "250px" or 250
+	Panels   []*Panel    `json:"panels"`
+}
+
+type LegacyLegend struct {
+	Show bool `json:"show"`
+}
+
+type LegacyAxis struct {
+	Format   string `json:"format"`
+	Decimals *int   `json:"decimals,omitempty"`
+}
+
+type Target struct {
+	RefId        string          `json:"refId"`
+	Expr         string          `json:"expr"`
+	LegendFormat string          `json:"legendFormat,omitempty"`
+	Instant      bool            `json:"instant,omitempty"`
+	Hide         bool            `json:"hide,omitempty"`
+	Datasource   json.RawMessage `json:"datasource,omitempty"`
+}
+
+type FieldConfig struct {
+	Defaults  FieldDefaults `json:"defaults"`
+	Overrides []interface{} `json:"overrides"`
+}
+
+type FieldDefaults struct {
+	Unit       string                 `json:"unit,omitempty"`
+	Decimals   *int                   `json:"decimals,omitempty"`
+	Min        *float64               `json:"min,omitempty"`
+	Max        *float64               `json:"max,omitempty"`
+	Thresholds *Thresholds            `json:"thresholds,omitempty"`
+	Mappings   []*Mapping             `json:"mappings,omitempty"`
+	Custom     map[string]interface{} `json:"custom,omitempty"`
+}
+
+type Thresholds struct {
+	Mode  string           `json:"mode"`
+	Steps []*ThresholdStep `json:"steps"`
+}
+
+type ThresholdStep struct {
+	Color string   `json:"color"`
+	Value *float64 `json:"value"`
+}
+
+// Mapping options depend on type: value, range, special or regex
+type Mapping struct {
+	Type    string          `json:"type"`
+	Options json.RawMessage `json:"options"`
+}
+
+type MappingResult struct {
+	Text  string `json:"text,omitempty"`
+	Color string `json:"color,omitempty"`
+	Index int    `json:"index"`
+}
+
+// Report lists everything that could not be converted, the rest of the dashboard is still usable
+type Report struct {
+	Panels      int            `json:"panels"`
+	Unsupported []*Unsupported `json:"unsupported"`
+	Warnings    []string       `json:"warnings"`
+}
+
+type Unsupported struct {
+	Kind   string `json:"kind"` // panel or variable
+	Id     string `json:"id"`
+	Title  string `json:"title"`
+	Type   string `json:"type"`
+	Reason string `json:"reason"`
+}
+
+func newReport() *Report {
+	return &Report{
+		Unsupported: []*Unsupported{},
+		Warnings:    []string{},
+	}
+}
+
+func (r *Report) unsupported(kind, id, title, typ, reason string) {
+	r.Unsupported = append(r.Unsupported, &Unsupported{Kind: kind, Id: id, Title: title, Type: typ, Reason: reason})
+}
+
+func (r *Report) warnf(format string, a ...interface{}) {
+	r.Warnings = append(r.Warnings, fmt.Sprintf(format, a...))
+}
+
+// grafana unit -> n9e util
+var unitsToN9e = map[string]string{
+	"":              "none",
+	"none":          "none",
+	"short":         "none",
+	"percent":       "percent",
+	"percentunit":   "percentUnit",
+	"bytes":         "bytesIEC",
+	"decbytes":      "bytesSI",
+	"bits":          "bitsIEC",
+	"decbits":       "bitsSI",
+	"Bps":           "bytesSecSI",
+	"binBps":        "bytesSecIEC",
+	"bps":           "bitsSecSI",
+	"binbps":        "bitsSecIEC",
+	"pps":           "packetsSec",
+	"reqps":         "reqps",
+	"ops":           "ops",
+	"iops":          "iops",
+	"s":             "seconds",
+	"ms":            "milliseconds",
+	"µs":            "microseconds",
+	"ns":            "nanoseconds",
+	"dtdurations":   "humantimeSeconds",
+	"dtdurationms":  "humantimeMilliseconds",
+	"dateTimeAsIso": "datetimeMilliseconds",
+}
+
+var unitsToGrafana = map[string]string{
+	"none":                  "none",
+	"percent":               "percent",
+	"percentUnit":           "percentunit",
+	"bytesIEC":              "bytes",
+	"bytesSI":               "decbytes",
+	"bitsIEC":               "bits",
+	"bitsSI":                "decbits",
+	"bytesSecSI":            "Bps",
+	"bytesSecIEC":           "binBps",
+	"bitsSecSI":             "bps",
+	"bitsSecIEC":            "binbps",
+	"packetsSec":            "pps",
+	"reqps":                 "reqps",
+	"ops":                   "ops",
+	"iops":                  "iops",
+	"seconds":               "s",
+	"milliseconds":          "ms",
+	"microseconds":          "µs",
+	"nanoseconds":           "ns",
+	"humantimeSeconds":      "dtdurations",
+	"humantimeMilliseconds": "dtdurationms",
+	"datetimeSeconds":       "dateTimeAsIso",
+	"datetimeMilliseconds":  "dateTimeAsIso",
+}
+
+// grafana reducer -> n9e calc
+var calcsToN9e = map[string]string{
+	"lastNotNull":  "lastNotNull",
+	"last":         "last",
+	"firstNotNull": "firstNotNull",
+	"first":        "first",
+	"mean":         "avg",
+	"min":          "min",
+	"max":          "max",
+	"sum":          "sum",
+	"count":        "count",
+	// singlestat valueName
+	"avg":     "avg",
+	"current": "lastNotNull",
+	"total":   "sum",
+}
+
+var calcsToGrafana = map[string]string{
+	"lastNotNull":  "lastNotNull",
+	"last":         "last",
+	"firstNotNull": "firstNotNull",
+	"first":        "first",
+	"avg":          "mean",
+	"min":          "min",
+	"max":          "max",
+	"sum":          "sum",
+	"count":        "count",
+}
+
+// varName returns the variable name of references like $ds or ${ds}, empty if it is not a reference
+func varName(s string) string {
+	if strings.HasPrefix(s, "${") && strings.HasSuffix(s, "}") {
+		return strings.TrimSuffix(strings.TrimPrefix(s, "${"), "}")
+	}
+
+	if strings.HasPrefix(s, "$") && len(s) > 1 {
+		return s[1:]
+	}
+
+	return ""
+}
+
+// datasourceRef decodes a datasource reference, grafana uses names in old versions and {type, uid} objects in new ones
+func datasourceRef(raw json.RawMessage) (typ, uid string) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", ""
+	}
+
+	var name string
+	if err := json.Unmarshal(raw, &name); err == nil {
+		return "", name
+	}
+
+	var ref struct {
+		Type string `json:"type"`
+		Uid  string `json:"uid"`
+	}
+	if err := json.Unmarshal(raw, &ref); err == nil {
+		return ref.Type, ref.Uid
+	}
+
+	return "", ""
+}
+
+// rawString decodes values that are either a string or an object with a string field
+func rawString(raw json.RawMessage, field string) string {
+	if len(raw) == 0 {
+		return ""
+	}
+
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+
+	m := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &m); err == nil {
+		if v, ok := m[field].(string); ok {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func getMap(m map[string]interface{}, key string) map[string]interface{} {
+	if v, ok := m[key].(map[string]interface{}); ok {
+		return v
+	}
+	return map[string]interface{}{}
+}
+
+func getString(m map[string]interface{}, key string) string {
+	if v, ok := m[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func getBool(m map[string]interface{}, key string) bool {
+	if v, ok := m[key].(bool); ok {
+		return v
+	}
+	return false
+}
+
+func getFloat(m map[string]interface{}, key string) (float64, bool) {
+	v, ok := m[key].(float64)
+	return v, ok
+}
+
+func getInt(m map[string]interface{}, key string) int {
+	v, _ := getFloat(m, key)
+	return int(v)
+}
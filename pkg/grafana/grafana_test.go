@@ -0,0 +1,168 @@
+package grafana
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+const testDashboard = `{
+  "dashboard": {
+    "title": "Node Exporter",
+    "tags": ["linux", "node"],
+    "templating": {
+      "list": [
+        {"name": "DS_PROMETHEUS", "type": "datasource", "query": "prometheus", "hide": 0},
+        {"name": "instance", "type": "query", "datasource": {"type": "prometheus", "uid": "${DS_PROMETHEUS}"},
+         "query": {"query": "label_values(node_uname_info, instance)", "refId": "A"}, "multi": true, "includeAll": true},
+        {"name": "env", "type": "custom", "query": "prod,test"},
+        {"name": "job", "type": "constant", "query": "node"},
+        {"name": "interval", "type": "interval", "query": "1m,5m"}
+      ]
+    },
+    "panels": [
+      {"id": 1, "type": "timeseries", "title": "CPU", "gridPos": {"h": 8, "w": 12, "x": 0, "y": 0},
+       "datasource": {"type": "prometheus", "uid": "${DS_PROMETHEUS}"},
+       "targets": [{"refId": "A", "expr": "rate(node_cpu_seconds_total{instance=~\"$instance\"}[5m])", "legendFormat": "{{cpu}}"}],
+       "fieldConfig": {"defaults": {"unit": "percentunit", "custom": {"fillOpacity": 10, "stacking": {"mode": "normal"}}}, "overrides": []},
+       "options": {"tooltip": {"mode": "multi"}, "legend": {"showLegend": false}}},
+      {"id": 2, "type": "row", "title": "Disk", "collapsed": true, "gridPos": {"h": 1, "w": 24, "x": 0, "y": 8},
+       "panels": [
+         {"id": 3, "type": "stat", "title": "Up", "gridPos": {"h": 4, "w": 6, "x": 0, "y": 9},
+          "targets": [{"refId": "A", "expr": "up"}],
+          "fieldConfig": {"defaults": {"mappings": [{"type": "value", "options": {"1": {"text": "UP", "color": "green"}}}],
+            "thresholds": {"mode": "absolute", "steps": [{"color": "green", "value": null}, {"color": "red", "value": 80}]}}},
+          "options": {"reduceOptions": {"calcs": ["mean"]}, "colorMode": "background"}}
+       ]},
+      {"id": 4, "type": "logs", "title": "Logs", "gridPos": {"h": 8, "w": 24, "x": 0, "y": 9},
+       "datasource": {"type": "loki", "uid": "abc"}}
+    ]
+  }
+}`
+
+func TestImport(t *testing.T) {
+	board, report, err := Import([]byte(testDashboard))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if board.Name != "Node Exporter" || board.Tags != "linux node" {
+		t.Fatalf("unexpected board: %s %s", board.Name, board.Tags)
+	}
+
+	vars := board.Configs["var"].([]interface{})
+	if len(vars) != 4 {
+		t.Fatalf("expected 4 variables, got %d", len(vars))
+	}
+
+	if name := vars[0].(map[string]interface{})["name"]; name != "DS_PROMETHEUS" {
+		t.Errorf("datasource variable should go first, got %v", name)
+	}
+
+	query := vars[1].(map[string]interface{})
+	if query["definition"] != "label_values(node_uname_info, instance)" || query["allOption"] != true {
+		t.Errorf("unexpected query variable: %v", query)
+	}
+
+	panels := board.Configs["panels"].([]interface{})
+	if len(panels) != 2 {
+		t.Fatalf("expected 2 panels, got %d", len(panels))
+	}
+
+	ts := panels[0].(map[string]interface{})
+	if ts["datasourceValue"] != "${DS_PROMETHEUS}" {
+		t.Errorf("unexpected datasource value: %v", ts["datasourceValue"])
+	}
+
+	custom := ts["custom"].(map[string]interface{})
+	if custom["stack"] != "noraml" || custom["fillOpacity"] != 0.1 {
+		t.Errorf("unexpected timeseries custom: %v", custom)
+	}
+
+	options := ts["options"].(map[string]interface{})
+	if options["standardOptions"].(map[string]interface{})["util"] != "percentUnit" {
+		t.Errorf("unexpected standard options: %v", options["standardOptions"])
+	}
+	if options["legend"].(map[string]interface{})["displayMode"] != "hidden" {
+		t.Errorf("unexpected legend: %v", options["legend"])
+	}
+
+	row := panels[1].(map[string]interface{})
+	children := row["panels"].([]interface{})
+	if row["type"] != "row" || len(children) != 1 {
+		t.Fatalf("unexpected row: %v", row)
+	}
+
+	stat := children[0].(map[string]interface{})
+	if stat["custom"].(map[string]interface{})["calc"] != "avg" {
+		t.Errorf("unexpected stat custom: %v", stat["custom"])
+	}
+
+	if report.Panels != 2 || len(report.Unsupported) != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestImportLegacyRows(t *testing.T) {
+	data := `{"title": "old", "rows": [{"title": "Overview", "height": "300px", "panels": [
+		{"id": 1, "type": "graph", "title": "Load", "span": 6, "targets": [{"expr": "node_load1"}], "yaxes": [{"format": "short"}], "stack": true, "fill": 1},
+		{"id": 2, "type": "singlestat", "title": "Uptime", "span": 6, "format": "s", "valueName": "current", "targets": [{"expr": "node_time_seconds - node_boot_time_seconds"}]}
+	]}]}`
+
+	board, report, err := Import([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	panels := board.Configs["panels"].([]interface{})
+	if len(panels) != 3 || report.Panels != 2 {
+		t.Fatalf("expected a row and 2 panels, got %d panels, report %+v", len(panels), report)
+	}
+
+	second := panels[2].(map[string]interface{})["layout"].(map[string]interface{})
+	if second["x"] != 12 || second["w"] != 12 || second["h"] != 10 {
+		t.Errorf("unexpected layout: %v", second)
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	board, _, err := Import([]byte(testDashboard))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configs, err := json.Marshal(board.Configs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dash, report, err := Export(board.Name, board.Tags, string(configs))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if dash.Title != "Node Exporter" || len(dash.Tags) != 2 {
+		t.Errorf("unexpected dashboard: %s %v", dash.Title, dash.Tags)
+	}
+
+	if len(dash.Templating.List) != 4 || dash.Templating.List[0].Type != "datasource" {
+		t.Errorf("unexpected variables: %+v", dash.Templating.List)
+	}
+
+	if len(dash.Panels) != 2 || dash.Panels[1].Type != "row" || len(dash.Panels[1].Panels) != 1 {
+		t.Fatalf("unexpected panels: %+v", dash.Panels)
+	}
+
+	ts := dash.Panels[0]
+	if ts.FieldConfig.Defaults.Unit != "percentunit" || ts.Targets[0].LegendFormat != "{{cpu}}" {
+		t.Errorf("unexpected timeseries: %+v", ts)
+	}
+
+	stat := dash.Panels[1].Panels[0]
+	if len(stat.FieldConfig.Defaults.Mappings) != 1 || stat.FieldConfig.Defaults.Thresholds.Steps[0].Value != nil {
+		t.Errorf("unexpected stat field config: %+v", stat.FieldConfig.Defaults)
+	}
+
+	if report.Panels != 2 || len(report.Unsupported) != 0 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
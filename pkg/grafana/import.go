@@ -0,0 +1,790 @@
+package grafana
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Board is an imported dashboard, configs can be saved as board payload directly
+type Board struct {
+	Name    string                 `json:"name"`
+	Tags    string                 `json:"tags"`
+	Configs map[string]interface{} `json:"configs"`
+}
+
+var panelTypesToN9e = map[string]string{
+	"timeseries": "timeseries",
+	"graph":      "timeseries",
+	"stat":       "stat",
+	"singlestat": "stat",
+	"gauge":      "gauge",
+	"table":      "table",
+	"table-old":  "table",
+	"bargauge":   "barGauge",
+}
+
+// grafana named colors -> hex, other colors are valid css already
+var colorsToN9e = map[string]string{
+	"green":  "#73BF69",
+	"red":    "#F2495C",
+	"yellow": "#FADE2A",
+	"orange": "#FF9830",
+	"blue":   "#5794F2",
+	"purple": "#B877D9",
+	"text":   "#CCCCDC",
+}
+
+type importer struct {
+	report    *Report
+	dsVars    []interface{}
+	otherVars []interface{}
+	dsNames   map[string]struct{}
+	defaultDs string
+}
+
+// Import converts a grafana dashboard json, both the dashboard model and the
+// {"dashboard": {...}} wrapper returned by the grafana api are accepted
+func Import(data []byte) (*Board, *Report, error) {
+	var wrapper struct {
+		Dashboard json.RawMessage `json:"dashboard"`
+	}
+	if err := json.Unmarshal(data, &wrapper); err == nil && len(wrapper.Dashboard) > 0 && wrapper.Dashboard[0] == '{' {
+		data = wrapper.Dashboard
+	}
+
+	var dash Dashboard
+	if err := json.Unmarshal(data, &dash); err != nil {
+		return nil, nil, fmt.Errorf("invalid grafana dashboard: %v", err)
+	}
+
+	if dash.Title == "" && len(dash.Panels) == 0 && len(dash.Rows) == 0 {
+		return nil, nil, fmt.Errorf("invalid grafana dashboard: no title and no panels")
+	}
+
+	board, report := ImportDashboard(&dash)
+	return board, report, nil
+}
+
+func ImportDashboard(dash *Dashboard) (*Board, *Report) {
+	im := &importer{
+		report:  newReport(),
+		dsNames: make(map[string]struct{}),
+	}
+
+	// datasource variables go first, query variables refer to them
+	for _, v := range dash.Templating.List {
+		if v.Type == "datasource" {
+			im.variable(v)
+		}
+	}
+
+	for _, v := range dash.Templating.List {
+		if v.Type != "datasource" {
+			im.variable(v)
+		}
+	}
+
+	panels := dash.Panels
+	if len(panels) == 0 && len(dash.Rows) > 0 {
+		panels = legacyPanels(dash.Rows)
+	}
+
+	out := im.panels(panels)
+
+	links := make([]interface{}, 0, len(dash.Links))
+	for _, l := range dash.Links {
+		if l.Type != "link" {
+			im.report.warnf("link %q: links of type %s are not supported", l.Title, l.Type)
+			continue
+		}
+		links = append(links, map[string]interface{}{
+			"title":       l.Title,
+			"url":         l.Url,
+			"targetBlank": l.TargetBlank,
+		})
+	}
+
+	vars := append(im.dsVars, im.otherVars...)
+	if vars == nil {
+		vars = []interface{}{}
+	}
+
+	return &Board{
+		Name: dash.Title,
+		Tags: strings.Join(dash.Tags, " "),
+		Configs: map[string]interface{}{
+			"version": boardVersion,
+			"links":   links,
+			"var":     vars,
+			"panels":  out,
+		},
+	}, im.report
+}
+
+func (im *importer) addDsVar(name string) {
+	im.dsNames[name] = struct{}{}
+	im.dsVars = append(im.dsVars, map[string]interface{}{
+		"name":       name,
+		"type":       "datasource",
+		"definition": prometheusType,
+		"hide":       false,
+	})
+
+	if im.defaultDs == "" {
+		im.defaultDs = name
+	}
+}
+
+func (im *importer) defaultDatasource() string {
+	if im.defaultDs == "" {
+		im.addDsVar(defaultDsVar)
+	}
+	return im.defaultDs
+}
+
+// datasourceValue turns a grafana datasource reference into a n9e datasource variable reference,
+// datasources bound by uid or name can not be resolved and fall back to the default variable
+func (im *importer) datasourceValue(uid string) string {
+	if name := varName(uid); name != "" {
+		if _, has := im.dsNames[name]; !has {
+			im.addDsVar(name)
+		}
+		return "${" + name + "}"
+	}
+
+	ds := im.defaultDatasource()
+	if uid != "" {
+		im.report.warnf("datasource %s is replaced with variable ${%s}", uid, ds)
+	}
+
+	return "${" + ds + "}"
+}
+
+func (im *importer) variable(v *Variable) {
+	out := map[string]interface{}{
+		"name":  v.Name,
+		"label": v.Label,
+		"hide":  v.Hide == 2,
+	}
+
+	switch v.Type {
+	case "datasource":
+		if q := rawString(v.Query, "query"); q != prometheusType {
+			im.report.unsupported("variable", v.Name, v.Label, v.Type, fmt.Sprintf("datasource type %s is not supported", q))
+			return
+		}
+
+		if _, has := im.dsNames[v.Name]; has {
+			return
+		}
+
+		im.dsNames[v.Name] = struct{}{}
+		if im.defaultDs == "" {
+			im.defaultDs = v.Name
+		}
+
+		out["type"] = "datasource"
+		out["definition"] = prometheusType
+		im.dsVars = append(im.dsVars, out)
+		return
+	case "query":
+		typ, uid := datasourceRef(v.Datasource)
+		if typ != "" && typ != prometheusType {
+			im.report.unsupported("variable", v.Name, v.Label, v.Type, fmt.Sprintf("datasource type %s is not supported", typ))
+			return
+		}
+
+		def := rawString(v.Query, "query")
+		if def == "" {
+			def = v.Definition
+		}
+
+		out["type"] = "query"
+		out["definition"] = def
+		out["multi"] = v.Multi
+		out["allOption"] = v.IncludeAll
+		if v.AllValue != "" {
+			out["allValue"] = v.AllValue
+		}
+		if v.Regex != "" {
+			out["reg"] = v.Regex
+		}
+		out["datasource"] = map[string]interface{}{
+			"cate":  prometheusType,
+			"value": im.datasourceValue(uid),
+		}
+	case "custom":
+		out["type"] = "custom"
+		out["definition"] = rawString(v.Query, "query")
+		out["multi"] = v.Multi
+		out["allOption"] = v.IncludeAll
+		if v.AllValue != "" {
+			out["allValue"] = v.AllValue
+		}
+	case "constant":
+		out["type"] = "constant"
+		out["definition"] = rawString(v.Query, "query")
+	case "textbox":
+		out["type"] = "textbox"
+		out["defaultValue"] = rawString(v.Query, "query")
+	default:
+		im.report.unsupported("variable", v.Name, v.Label, v.Type, "variable type is not supported")
+		return
+	}
+
+	im.otherVars = append(im.otherVars, out)
+}
+
+func (im *importer) panels(lst []*Panel) []interface{} {
+	out := make([]interface{}, 0, len(lst))
+	for _, p := range lst {
+		if p.Type == "row" {
+			id := uuid.NewString()
+			row := map[string]interface{}{
+				"type":      "row",
+				"id":        id,
+				"name":      p.Title,
+				"collapsed": p.Collapsed,
+				"layout":    layout(GridPos{H: 1, W: 24, X: 0, Y: p.GridPos.Y}, id, false),
+				"panels":    im.panels(p.Panels),
+			}
+			out = append(out, row)
+			continue
+		}
+
+		if np := im.panel(p); np != nil {
+			out = append(out, np)
+		}
+	}
+	return out
+}
+
+func (im *importer) panel(p *Panel) map[string]interface{} {
+	typ, has := panelTypesToN9e[p.Type]
+	if !has {
+		im.report.unsupported("panel", strconv.Itoa(p.Id), p.Title, p.Type, "panel type is not supported")
+		return nil
+	}
+
+	dsValue, reason := im.panelDatasource(p)
+	if reason != "" {
+		im.report.unsupported("panel", strconv.Itoa(p.Id), p.Title, p.Type, reason)
+		return nil
+	}
+
+	id := uuid.NewString()
+	out := map[string]interface{}{
+		"type":            typ,
+		"id":              id,
+		"name":            p.Title,
+		"description":     p.Description,
+		"layout":          layout(p.GridPos, id, true),
+		"version":         panelVersion,
+		"datasourceCate":  prometheusType,
+		"datasourceValue": dsValue,
+		"targets":         im.targets(p),
+		"maxPerRow":       4,
+		"options":         im.options(p, typ),
+		"custom":          im.custom(p, typ),
+	}
+
+	if p.FieldConfig != nil && len(p.FieldConfig.Overrides) > 0 {
+		im.report.warnf("panel %q: field overrides are not converted", p.Title)
+	}
+
+	im.report.Panels++
+	return out
+}
+
+func (im *importer) panelDatasource(p *Panel) (string, string) {
+	typ, uid := datasourceRef(p.Datasource)
+	if typ == "" && uid == "" {
+		for _, t := range p.Targets {
+			if typ, uid = datasourceRef(t.Datasource); typ != "" || uid != "" {
+				break
+			}
+		}
+	}
+
+	switch {
+	case uid == "-- Mixed --":
+		return "", "mixed datasources are not supported"
+	case uid == "-- Grafana --" || uid == "-- Dashboard --" || typ == "grafana" || typ == "datasource":
+		return "", "grafana built-in datasources are not supported"
+	case typ != "" && typ != prometheusType:
+		return "", fmt.Sprintf("datasource type %s is not supported", typ)
+	}
+
+	return im.datasourceValue(uid), ""
+}
+
+func (im *importer) targets(p *Panel) []interface{} {
+	out := make([]interface{}, 0, len(p.Targets))
+	for i, t := range p.Targets {
+		if t.Expr == "" {
+			continue
+		}
+
+		refId := t.RefId
+		if refId == "" {
+			refId = string(rune('A' + i))
+		}
+
+		legend := t.LegendFormat
+		if legend == "__auto" {
+			legend = ""
+		}
+
+		nt := map[string]interface{}{
+			"refId":         refId,
+			"expr":          t.Expr,
+			"legend":        legend,
+			"maxDataPoints": 240,
+		}
+
+		if t.Instant {
+			nt["instant"] = true
+		}
+
+		if t.Hide {
+			nt["hide"] = true
+		}
+
+		out = append(out, nt)
+	}
+
+	if len(out) == 0 {
+		im.report.warnf("panel %q: no prometheus query found", p.Title)
+	}
+
+	return out
+}
+
+func (im *importer) options(p *Panel, typ string) map[string]interface{} {
+	var def FieldDefaults
+	if p.FieldConfig != nil {
+		def = p.FieldConfig.Defaults
+	}
+
+	unit, decimals := def.Unit, def.Decimals
+	switch p.Type {
+	case "graph":
+		if len(p.Yaxes) > 0 {
+			unit, decimals = p.Yaxes[0].Format, p.Yaxes[0].Decimals
+		}
+	case "singlestat":
+		unit = p.Format
+	}
+
+	std := map[string]interface{}{
+		"util": im.unit(p, unit),
+	}
+	if decimals != nil {
+		std["decimals"] = *decimals
+	}
+	if def.Min != nil {
+		std["min"] = *def.Min
+	}
+	if def.Max != nil {
+		std["max"] = *def.Max
+	}
+
+	out := map[string]interface{}{
+		"standardOptions": std,
+	}
+
+	if def.Thresholds != nil && len(def.Thresholds.Steps) > 0 {
+		steps := make([]interface{}, 0, len(def.Thresholds.Steps))
+		for _, s := range def.Thresholds.Steps {
+			step := map[string]interface{}{
+				"color": color(s.Color),
+				"value": s.Value,
+				"type":  "",
+			}
+			if s.Value == nil {
+				step["type"] = "base"
+			}
+			steps = append(steps, step)
+		}
+
+		mode := def.Thresholds.Mode
+		if mode == "" {
+			mode = "absolute"
+		}
+
+		out["thresholds"] = map[string]interface{}{
+			"mode":  mode,
+			"steps": steps,
+		}
+	}
+
+	if len(def.Mappings) > 0 {
+		out["valueMappings"] = im.mappings(p, def.Mappings)
+	}
+
+	if typ == "timeseries" {
+		tooltip := getString(getMap(p.Options, "tooltip"), "mode")
+		if tooltip == "multi" {
+			tooltip = "all"
+		} else {
+			tooltip = "single"
+		}
+
+		legend := getMap(p.Options, "legend")
+		displayMode := getString(legend, "displayMode")
+		if displayMode == "" {
+			displayMode = "list"
+		}
+		if show, ok := legend["showLegend"].(bool); ok && !show {
+			displayMode = "hidden"
+		}
+		if p.Type == "graph" && (p.Legend == nil || !p.Legend.Show) {
+			displayMode = "hidden"
+		}
+
+		placement := getString(legend, "placement")
+		if placement == "" {
+			placement = "bottom"
+		}
+
+		out["tooltip"] = map[string]interface{}{"mode": tooltip}
+		out["legend"] = map[string]interface{}{
+			"displayMode": displayMode,
+			"placement":   placement,
+			"behaviour":   "showItem",
+		}
+	}
+
+	return out
+}
+
+func (im *importer) mappings(p *Panel, lst []*Mapping) []interface{} {
+	out := make([]interface{}, 0, len(lst))
+	for _, m := range lst {
+		switch m.Type {
+		case "value":
+			values := make(map[string]MappingResult)
+			if err := json.Unmarshal(m.Options, &values); err != nil {
+				im.report.warnf("panel %q: invalid value mapping: %v", p.Title, err)
+				continue
+			}
+
+			keys := make([]string, 0, len(values))
+			for k := range values {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				nm := map[string]interface{}{
+					"type":   "textValue",
+					"match":  map[string]interface{}{"textValue": k},
+					"result": mappingResult(values[k]),
+				}
+				if f, err := strconv.ParseFloat(k, 64); err == nil {
+					nm["type"] = "special"
+					nm["match"] = map[string]interface{}{"special": f}
+				}
+				out = append(out, nm)
+			}
+		case "range":
+			var r struct {
+				From   *float64      `json:"from"`
+				To     *float64      `json:"to"`
+				Result MappingResult `json:"result"`
+			}
+			if err := json.Unmarshal(m.Options, &r); err != nil {
+				im.report.warnf("panel %q: invalid range mapping: %v", p.Title, err)
+				continue
+			}
+
+			match := map[string]interface{}{}
+			if r.From != nil {
+				match["from"] = *r.From
+			}
+			if r.To != nil {
+				match["to"] = *r.To
+			}
+
+			out = append(out, map[string]interface{}{
+				"type":   "range",
+				"match":  match,
+				"result": mappingResult(r.Result),
+			})
+		default:
+			im.report.warnf("panel %q: %s value mappings are not supported", p.Title, m.Type)
+		}
+	}
+	return out
+}
+
+func mappingResult(r MappingResult) map[string]interface{} {
+	out := map[string]interface{}{}
+	if r.Text != "" {
+		out["text"] = r.Text
+	}
+	if r.Color != "" {
+		out["color"] = color(r.Color)
+	}
+	return out
+}
+
+func (im *importer) custom(p *Panel, typ string) map[string]interface{} {
+	var c map[string]interface{}
+	if p.FieldConfig != nil {
+		c = p.FieldConfig.Defaults.Custom
+	}
+	if c == nil {
+		c = map[string]interface{}{}
+	}
+
+	switch typ {
+	case "timeseries":
+		return im.timeseriesCustom(p, c)
+	case "stat":
+		colorMode := getString(p.Options, "colorMode")
+		if strings.HasPrefix(colorMode, "background") {
+			colorMode = "background"
+		} else {
+			colorMode = "value"
+		}
+
+		graphMode := getString(p.Options, "graphMode")
+		if graphMode != "area" {
+			graphMode = "none"
+		}
+
+		textMode := "valueAndName"
+		if getString(p.Options, "textMode") == "value" {
+			textMode = "value"
+		}
+
+		orientation := getString(p.Options, "orientation")
+		if orientation == "" {
+			orientation = "auto"
+		}
+
+		return map[string]interface{}{
+			"textMode":    textMode,
+			"colorMode":   colorMode,
+			"graphMode":   graphMode,
+			"calc":        im.calc(p),
+			"valueField":  "Value",
+			"colSpan":     1,
+			"textSize":    map[string]interface{}{},
+			"orientation": orientation,
+		}
+	case "gauge":
+		return map[string]interface{}{
+			"textMode": "valueAndName",
+			"calc":     im.calc(p),
+		}
+	case "barGauge":
+		return map[string]interface{}{
+			"calc": im.calc(p),
+		}
+	case "table":
+		showHeader := true
+		if v, ok := p.Options["showHeader"].(bool); ok {
+			showHeader = v
+		}
+
+		return map[string]interface{}{
+			"showHeader":  showHeader,
+			"colorMode":   "value",
+			"calc":        im.calc(p),
+			"displayMode": "seriesToRows",
+		}
+	}
+
+	return c
+}
+
+func (im *importer) timeseriesCustom(p *Panel, c map[string]interface{}) map[string]interface{} {
+	drawStyle := "lines"
+	if getString(c, "drawStyle") == "bars" || (p.Type == "graph" && p.Bars && (p.Lines == nil || !*p.Lines)) {
+		drawStyle = "bars"
+	}
+
+	lineInterpolation := "linear"
+	if getString(c, "lineInterpolation") == "smooth" {
+		lineInterpolation = "smooth"
+	}
+
+	lineWidth, ok := getFloat(c, "lineWidth")
+	if !ok {
+		lineWidth = 1
+	}
+
+	fillOpacity, _ := getFloat(c, "fillOpacity")
+	fillOpacity = fillOpacity / 100
+
+	stack := "off"
+	switch getString(getMap(c, "stacking"), "mode") {
+	case "normal":
+		stack = "noraml"
+	case "percent":
+		stack = "noraml"
+		im.report.warnf("panel %q: percent stacking is converted to normal stacking", p.Title)
+	}
+
+	if p.Type == "graph" {
+		if p.Linewidth > 0 {
+			lineWidth = p.Linewidth
+		}
+		fillOpacity = p.Fill / 10
+		if p.Stack {
+			stack = "noraml"
+		}
+	}
+
+	showPoints := "none"
+	if getString(c, "showPoints") == "always" {
+		showPoints = "always"
+	}
+
+	pointSize, ok := getFloat(c, "pointSize")
+	if !ok {
+		pointSize = 5
+	}
+
+	scale := getMap(c, "scaleDistribution")
+	if len(scale) == 0 {
+		scale = map[string]interface{}{"type": "linear"}
+	}
+
+	return map[string]interface{}{
+		"drawStyle":         drawStyle,
+		"lineInterpolation": lineInterpolation,
+		"spanNulls":         getBool(c, "spanNulls"),
+		"lineWidth":         lineWidth,
+		"fillOpacity":       fillOpacity,
+		"gradientMode":      "none",
+		"stack":             stack,
+		"scaleDistribution": scale,
+		"showPoints":        showPoints,
+		"pointSize":         pointSize,
+	}
+}
+
+func (im *importer) calc(p *Panel) string {
+	name := p.ValueName
+	if calcs, ok := getMap(p.Options, "reduceOptions")["calcs"].([]interface{}); ok && len(calcs) > 0 {
+		name, _ = calcs[0].(string)
+	}
+
+	if name == "" {
+		return "lastNotNull"
+	}
+
+	if calc, has := calcsToN9e[name]; has {
+		return calc
+	}
+
+	im.report.warnf("panel %q: calculation %s is not supported, fallback to lastNotNull", p.Title, name)
+	return "lastNotNull"
+}
+
+func (im *importer) unit(p *Panel, unit string) string {
+	if util, has := unitsToN9e[unit]; has {
+		return util
+	}
+
+	im.report.warnf("panel %q: unit %s is not supported, fallback to none", p.Title, unit)
+	return "none"
+}
+
+func color(c string) string {
+	if hex, has := colorsToN9e[c]; has {
+		return hex
+	}
+	return c
+}
+
+func layout(g GridPos, id string, resizable bool) map[string]interface{} {
+	if g.H <= 0 {
+		g.H = 8
+	}
+
+	if g.W <= 0 {
+		g.W = 12
+	}
+
+	return map[string]interface{}{
+		"h":           g.H,
+		"w":           g.W,
+		"x":           g.X,
+		"y":           g.Y,
+		"i":           id,
+		"isResizable": resizable,
+	}
+}
+
+// legacyPanels lays out panels of dashboards older than schema 16, they are sized by span (1-12) and row height in pixels
+func legacyPanels(rows []*LegacyRow) []*Panel {
+	var out []*Panel
+	y := 0
+	for i, row := range rows {
+		h := legacyHeight(row.Height)
+
+		var rowPanel *Panel
+		if row.Title != "" || row.Collapse {
+			rowPanel = &Panel{Id: -(i + 1), Type: "row", Title: row.Title, Collapsed: row.Collapse, GridPos: GridPos{H: 1, W: 24, Y: y}}
+			out = append(out, rowPanel)
+			y++
+		}
+
+		x := 0
+		for _, p := range row.Panels {
+			w := int(p.Span * 2)
+			if w <= 0 || w > 24 {
+				w = 12
+			}
+
+			if x+w > 24 {
+				x = 0
+				y += h
+			}
+
+			p.GridPos = GridPos{H: h, W: w, X: x, Y: y}
+			x += w
+
+			if rowPanel != nil && row.Collapse {
+				rowPanel.Panels = append(rowPanel.Panels, p)
+			} else {
+				out = append(out, p)
+			}
+		}
+
+		if len(row.Panels) > 0 {
+			y += h
+		}
+	}
+	return out
+}
+
+func legacyHeight(v interface{}) int {
+	var px float64
+	switch h := v.(type) {
+	case float64:
+		px = h
+	case string:
+		px, _ = strconv.ParseFloat(strings.TrimSuffix(h, "px"), 64)
+	}
+
+	if px <= 0 {
+		return 8
+	}
+
+	// grafana grid cells are 30px high
+	units := int(px / 30)
+	if units < 2 {
+		units = 2
+	}
+	return units
+}
@@ -0,0 +1,161 @@
+package ical
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Event is a VEVENT of an iCalendar file, Start is inclusive and End is exclusive like DTEND
+type Event struct {
+	Summary string
+	Start   time.Time
+	End     time.Time
+}
+
+// Dates returns the days covered by the event, e.g. 2026-01-01
+func (e Event) Dates() []string {
+	var dates []string
+	for d := e.Start; d.Before(e.End); d = d.AddDate(0, 0, 1) {
+		dates = append(dates, d.Format(dateLayout))
+	}
+	return dates
+}
+
+// Parse reads the events of an iCalendar (.ics) file, like the holiday calendars published by google or
+// the government. Times are converted into the location, only the date part of them is kept.
+func Parse(data []byte, loc *time.Location) ([]Event, error) {
+	var (
+		events []Event
+		cur    *Event
+		lineNo int
+	)
+
+	for _, line := range unfold(data) {
+		lineNo++
+		name, params, value := splitLine(line)
+
+		switch name {
+		case "BEGIN":
+			if value == "VEVENT" {
+				cur = &Event{}
+			}
+		case "END":
+			if value != "VEVENT" || cur == nil {
+				continue
+			}
+
+			if cur.Start.IsZero() {
+				return nil, fmt.Errorf("event %q has no DTSTART", cur.Summary)
+			}
+
+			if !cur.End.After(cur.Start) {
+				cur.End = cur.Start.AddDate(0, 0, 1)
+			}
+
+			events = append(events, *cur)
+			cur = nil
+		case "SUMMARY":
+			if cur != nil {
+				cur.Summary = unescape(value)
+			}
+		case "DTSTART", "DTEND":
+			if cur == nil {
+				continue
+			}
+
+			t, err := parseDate(params, value, loc)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", lineNo, err)
+			}
+
+			if name == "DTSTART" {
+				cur.Start = t
+			} else {
+				cur.End = t
+			}
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Start.Before(events[j].Start)
+	})
+
+	return events, nil
+}
+
+// unfold joins the continuation lines, which start with a space or a tab
+func unfold(data []byte) []string {
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if len(line) > 0 && (line[0] == ' ' || line[0] == '\t') && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// splitLine splits DTSTART;VALUE=DATE:20260101 into the name, the params and the value
+func splitLine(line string) (string, map[string]string, string) {
+	idx := strings.Index(line, ":")
+	if idx < 0 {
+		return strings.ToUpper(line), nil, ""
+	}
+
+	parts := strings.Split(line[:idx], ";")
+	params := make(map[string]string, len(parts)-1)
+	for _, p := range parts[1:] {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	return strings.ToUpper(parts[0]), params, strings.TrimSpace(line[idx+1:])
+}
+
+func parseDate(params map[string]string, value string, loc *time.Location) (time.Time, error) {
+	if len(value) == 8 {
+		t, err := time.ParseInLocation("20060102", value, loc)
+		if err != nil {
+			return t, fmt.Errorf("invalid date %s", value)
+		}
+		return t, nil
+	}
+
+	var (
+		t   time.Time
+		err error
+	)
+	if strings.HasSuffix(value, "Z") {
+		t, err = time.Parse("20060102T150405Z", value)
+	} else {
+		tzLoc := loc
+		if tzid, has := params["TZID"]; has {
+			if l, e := time.LoadLocation(tzid); e == nil {
+				tzLoc = l
+			}
+		}
+		t, err = time.ParseInLocation("20060102T150405", value, tzLoc)
+	}
+	if err != nil {
+		return t, fmt.Errorf("invalid datetime %s", value)
+	}
+
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc), nil
+}
+
+func unescape(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(s)
+}
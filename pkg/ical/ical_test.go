@@ -0,0 +1,63 @@
+package ical
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+const holidays = "BEGIN:VCALENDAR\r\n" +
+	"VERSION:2.0\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20261001\r\n" +
+	"DTEND;VALUE=DATE:20261004\r\n" +
+	"SUMMARY:National\r\n" +
+	"  Day\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;VALUE=DATE:20260101\r\n" +
+	"SUMMARY:New Year\\, 2026\r\n" +
+	"END:VEVENT\r\n" +
+	"BEGIN:VEVENT\r\n" +
+	"DTSTART;TZID=Asia/Shanghai:20260501T000000\r\n" +
+	"DTEND;TZID=Asia/Shanghai:20260502T000000\r\n" +
+	"SUMMARY:Labour Day\r\n" +
+	"END:VEVENT\r\n" +
+	"END:VCALENDAR\r\n"
+
+func TestParse(t *testing.T) {
+	loc := time.FixedZone("CST", 8*3600)
+	events, err := Parse([]byte(holidays), loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(events) != 3 {
+		t.Fatalf("got %d events, want 3", len(events))
+	}
+
+	want := []struct {
+		summary string
+		dates   []string
+	}{
+		{"New Year, 2026", []string{"2026-01-01"}},
+		{"Labour Day", []string{"2026-05-01"}},
+		{"National Day", []string{"2026-10-01", "2026-10-02", "2026-10-03"}},
+	}
+
+	for i, w := range want {
+		if events[i].Summary != w.summary {
+			t.Errorf("event %d summary = %q, want %q", i, events[i].Summary, w.summary)
+		}
+		if got := events[i].Dates(); !reflect.DeepEqual(got, w.dates) {
+			t.Errorf("event %d dates = %v, want %v", i, got, w.dates)
+		}
+	}
+}
+
+func TestParseNoStart(t *testing.T) {
+	data := "BEGIN:VEVENT\nSUMMARY:x\nEND:VEVENT\n"
+	if _, err := Parse([]byte(data), time.UTC); err == nil {
+		t.Error("expected error for event without DTSTART")
+	}
+}
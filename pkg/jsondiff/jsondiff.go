@@ -0,0 +1,135 @@
+package jsondiff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Modified = "modified"
+)
+
+// Change describes a difference at a json path, e.g. panels[0].targets[1].expr
+type Change struct {
+	Path string      `json:"path"`
+	Type string      `json:"type"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// DiffBytes decodes two json documents and compares them, empty input is treated as null
+func DiffBytes(from, to []byte) ([]Change, error) {
+	var a, b interface{}
+	if len(from) > 0 {
+		if err := json.Unmarshal(from, &a); err != nil {
+			return nil, fmt.Errorf("failed to decode from: %v", err)
+		}
+	}
+
+	if len(to) > 0 {
+		if err := json.Unmarshal(to, &b); err != nil {
+			return nil, fmt.Errorf("failed to decode to: %v", err)
+		}
+	}
+
+	return Diff(a, b), nil
+}
+
+// DiffObjects marshals two arbitrary values to json and compares them
+func DiffObjects(from, to interface{}) ([]Change, error) {
+	a, err := json.Marshal(from)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(to)
+	if err != nil {
+		return nil, err
+	}
+
+	return DiffBytes(a, b)
+}
+
+// Diff compares two decoded json values, changes are ordered by path
+func Diff(from, to interface{}) []Change {
+	changes := []Change{}
+	diff("", from, to, &changes)
+	return changes
+}
+
+func diff(path string, from, to interface{}, changes *[]Change) {
+	if from == nil && to == nil {
+		return
+	}
+
+	if from == nil {
+		*changes = append(*changes, Change{Path: path, Type: Added, To: to})
+		return
+	}
+
+	if to == nil {
+		*changes = append(*changes, Change{Path: path, Type: Removed, From: from})
+		return
+	}
+
+	switch a := from.(type) {
+	case map[string]interface{}:
+		b, ok := to.(map[string]interface{})
+		if !ok {
+			break
+		}
+
+		keys := make([]string, 0, len(a)+len(b))
+		for k := range a {
+			keys = append(keys, k)
+		}
+		for k := range b {
+			if _, has := a[k]; !has {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			diff(join(path, k), a[k], b[k], changes)
+		}
+		return
+	case []interface{}:
+		b, ok := to.([]interface{})
+		if !ok {
+			break
+		}
+
+		n := len(a)
+		if len(b) > n {
+			n = len(b)
+		}
+
+		for i := 0; i < n; i++ {
+			var x, y interface{}
+			if i < len(a) {
+				x = a[i]
+			}
+			if i < len(b) {
+				y = b[i]
+			}
+			diff(fmt.Sprintf("%s[%d]", path, i), x, y, changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(from, to) {
+		*changes = append(*changes, Change{Path: path, Type: Modified, From: from, To: to})
+	}
+}
+
+func join(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,43 @@
+package jsondiff
+
+import (
+	"testing"
+)
+
+func TestDiffBytes(t *testing.T) {
+	from := `{"name":"a","panels":[{"id":"1","expr":"up"}],"var":[1,2]}`
+	to := `{"name":"b","panels":[{"id":"1","expr":"up == 0"}],"var":[1],"links":[]}`
+
+	changes, err := DiffBytes([]byte(from), []byte(to))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := []Change{
+		{Path: "links", Type: Added, To: []interface{}{}},
+		{Path: "name", Type: Modified, From: "a", To: "b"},
+		{Path: "panels[0].expr", Type: Modified, From: "up", To: "up == 0"},
+		{Path: "var[1]", Type: Removed, From: float64(2)},
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+
+	for i := range want {
+		if changes[i].Path != want[i].Path || changes[i].Type != want[i].Type {
+			t.Errorf("change %d: got %+v, want %+v", i, changes[i], want[i])
+		}
+	}
+}
+
+func TestDiffEqual(t *testing.T) {
+	changes, err := DiffBytes([]byte(`{"a":[1,{"b":true}]}`), []byte(`{"a":[1,{"b":true}]}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(changes) != 0 {
+		t.Errorf("expected no changes, got %+v", changes)
+	}
+}
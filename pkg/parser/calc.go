@@ -22,8 +22,12 @@ func MathCalc(s string, data map[string]interface{}) (float64, error) {
 		m[k] = v
 	}
 
+	for k, v := range windowFuncMap {
+		m[k] = v
+	}
+
 	// 表达式要求类型一致，否则此处编译会报错
-	program, err := expr.Compile(cleanStr(s), expr.Env(m))
+	program, err := expr.Compile(cleanStr(rewriteWindowFuncs(s)), expr.Env(m))
 	if err != nil {
 		return 0, err
 	}
@@ -64,9 +68,10 @@ func cleanStr(s string) string {
 	return s
 }
 
+var refFieldRe = regexp.MustCompile(`\$(` + refPattern + `)\.`)
+
 func replaceDollarSigns(s string) string {
-	re := regexp.MustCompile(`\$([A-Z])\.`)
-	return re.ReplaceAllString(s, "${1}_")
+	return refFieldRe.ReplaceAllString(s, "${1}_")
 }
 
 // 自定义 expr 函数
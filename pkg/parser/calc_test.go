@@ -223,6 +223,13 @@ func TestMathCalc(t *testing.T) {
 			expected: 8,
 			wantErr:  false,
 		},
+		{
+			name:     "Period over period comparison",
+			expr:     "abs($A - $A.prev) / $A.prev > 0.3",
+			data:     map[string]interface{}{"$A": 60.0, "$A.prev": 100.0},
+			expected: 1,
+			wantErr:  false,
+		},
 	}
 
 	for _, tc := range tests {
@@ -529,3 +536,24 @@ func TestCalc(t *testing.T) {
 		})
 	}
 }
+
+func TestHasRef(t *testing.T) {
+	cases := []struct {
+		exp  string
+		ref  string
+		want bool
+	}{
+		{"$A > 0", "A", true},
+		{"$AB > 0", "A", false},
+		{"$AB > 0", "AB", true},
+		{"$A1 / $B", "A", false},
+		{"$A.prev < $A", "A", true},
+		{"avg($A, 5m) > 1", "A", true},
+	}
+
+	for _, c := range cases {
+		if got := HasRef(c.exp, c.ref); got != c.want {
+			t.Errorf("HasRef(%q, %q) = %v, want %v", c.exp, c.ref, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package parser
+
+import (
+	"regexp"
+)
+
+// refPattern is the grammar of the refs of the queries in the expressions, e.g. A AB A1
+const refPattern = `[A-Z][A-Z0-9_]*`
+
+var refRe = regexp.MustCompile(`\$(` + refPattern + `)`)
+
+// ExpRefs returns the refs used by the expression, $A.prev and $A.label count as A
+func ExpRefs(exp string) map[string]struct{} {
+	refs := make(map[string]struct{})
+	for _, m := range refRe.FindAllStringSubmatch(exp, -1) {
+		refs[m[1]] = struct{}{}
+	}
+	return refs
+}
+
+// HasRef matches the ref on a token boundary, $A is not used by $AB > 0
+func HasRef(exp, ref string) bool {
+	_, has := ExpRefs(exp)[ref]
+	return has
+}
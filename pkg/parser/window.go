@@ -0,0 +1,228 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is the points of a series returned by a query, the window functions in trigger expressions
+// aggregate them: avg($A, 5m) max($A) min($A) sum($A) delta($A) pct_change($A, 1h) count_over($A > 100, 5m).
+// Without the duration the functions take all the points.
+type Window struct {
+	Times  []float64
+	Values []float64
+}
+
+// WindowKey is the key of the window of the ref in the data of MathCalc
+func WindowKey(ref string) string {
+	return "__window_" + ref
+}
+
+// NewWindow builds the window from the values of models.DataResp, the points are [timestamp, value]
+func NewWindow(points [][]float64) *Window {
+	w := &Window{
+		Times:  make([]float64, 0, len(points)),
+		Values: make([]float64, 0, len(points)),
+	}
+
+	for _, p := range points {
+		if len(p) != 2 {
+			continue
+		}
+		w.Times = append(w.Times, p[0])
+		w.Values = append(w.Values, p[1])
+	}
+	return w
+}
+
+// values returns the values of the points in the duration before the last point
+func (w *Window) values(dur []string) ([]float64, error) {
+	if w == nil || len(w.Values) == 0 {
+		return nil, fmt.Errorf("no points in window")
+	}
+
+	if len(dur) == 0 {
+		return w.Values, nil
+	}
+
+	d, err := parseWindowDuration(dur[0])
+	if err != nil {
+		return nil, err
+	}
+
+	from := w.Times[len(w.Times)-1] - d.Seconds()
+	i := len(w.Times) - 1
+	for i > 0 && w.Times[i-1] >= from {
+		i--
+	}
+	return w.Values[i:], nil
+}
+
+func parseWindowDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(s, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window duration: %s", s)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid window duration: %s", s)
+	}
+	return d, nil
+}
+
+func windowAvg(w *Window, dur ...string) (float64, error) {
+	vs, err := w.values(dur)
+	if err != nil {
+		return 0, err
+	}
+
+	var sum float64
+	for _, v := range vs {
+		sum += v
+	}
+	return sum / float64(len(vs)), nil
+}
+
+func windowMax(w *Window, dur ...string) (float64, error) {
+	vs, err := w.values(dur)
+	if err != nil {
+		return 0, err
+	}
+
+	max := vs[0]
+	for _, v := range vs[1:] {
+		if v > max {
+			max = v
+		}
+	}
+	return max, nil
+}
+
+func windowMin(w *Window, dur ...string) (float64, error) {
+	vs, err := w.values(dur)
+	if err != nil {
+		return 0, err
+	}
+
+	min := vs[0]
+	for _, v := range vs[1:] {
+		if v < min {
+			min = v
+		}
+	}
+	return min, nil
+}
+
+func windowSum(w *Window, dur ...string) (float64, error) {
+	vs, err := w.values(dur)
+	if err != nil {
+		return 0, err
+	}
+
+	var sum float64
+	for _, v := range vs {
+		sum += v
+	}
+	return sum, nil
+}
+
+// windowDelta is the last value minus the first one in the window
+func windowDelta(w *Window, dur ...string) (float64, error) {
+	vs, err := w.values(dur)
+	if err != nil {
+		return 0, err
+	}
+	return vs[len(vs)-1] - vs[0], nil
+}
+
+// windowPctChange is the change of the last value from the first one in the window, in percent
+func windowPctChange(w *Window, dur ...string) (float64, error) {
+	vs, err := w.values(dur)
+	if err != nil {
+		return 0, err
+	}
+
+	if vs[0] == 0 {
+		return 0, fmt.Errorf("first value in window is 0")
+	}
+	return (vs[len(vs)-1] - vs[0]) / vs[0] * 100, nil
+}
+
+// windowCountOver counts the points matching the condition in the window
+func windowCountOver(w *Window, op string, threshold float64, dur ...string) (float64, error) {
+	vs, err := w.values(dur)
+	if err != nil {
+		return 0, err
+	}
+
+	var count float64
+	for _, v := range vs {
+		var match bool
+		switch op {
+		case ">":
+			match = v > threshold
+		case ">=":
+			match = v >= threshold
+		case "<":
+			match = v < threshold
+		case "<=":
+			match = v <= threshold
+		case "==":
+			match = v == threshold
+		case "!=":
+			match = v != threshold
+		default:
+			return 0, fmt.Errorf("invalid operator of count_over: %s", op)
+		}
+
+		if match {
+			count++
+		}
+	}
+	return count, nil
+}
+
+var windowFuncMap = map[string]interface{}{
+	"window_avg":        windowAvg,
+	"window_max":        windowMax,
+	"window_min":        windowMin,
+	"window_sum":        windowSum,
+	"window_delta":      windowDelta,
+	"window_pct_change": windowPctChange,
+	"window_count_over": windowCountOver,
+}
+
+var (
+	countOverRe  = regexp.MustCompile(`\bcount_over\(\s*\$(` + refPattern + `)\s*(>=|<=|==|!=|>|<)\s*(-?[0-9.]+(?:[eE][-+]?[0-9]+)?)\s*(?:,\s*([0-9.]+[smhd])\s*)?\)`)
+	windowFuncRe = regexp.MustCompile(`\b(avg|max|min|sum|delta|pct_change)\(\s*\$(` + refPattern + `)\s*(?:,\s*([0-9.]+[smhd])\s*)?\)`)
+)
+
+// rewriteWindowFuncs turns the window functions of the trigger expression into calls on the windows of the
+// refs, e.g. avg($A, 5m) into window_avg(__window_A, "5m"), other calls like max(1, 2) are kept
+func rewriteWindowFuncs(s string) string {
+	s = countOverRe.ReplaceAllStringFunc(s, func(m string) string {
+		sub := countOverRe.FindStringSubmatch(m)
+		call := fmt.Sprintf(`window_count_over(%s, "%s", %s`, WindowKey(sub[1]), sub[2], sub[3])
+		if sub[4] != "" {
+			call += fmt.Sprintf(`, "%s"`, sub[4])
+		}
+		return call + ")"
+	})
+
+	return windowFuncRe.ReplaceAllStringFunc(s, func(m string) string {
+		sub := windowFuncRe.FindStringSubmatch(m)
+		call := fmt.Sprintf(`window_%s(%s`, sub[1], WindowKey(sub[2]))
+		if sub[3] != "" {
+			call += fmt.Sprintf(`, "%s"`, sub[3])
+		}
+		return call + ")"
+	})
+}
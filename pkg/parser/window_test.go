@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"math"
+	"testing"
+)
+
+func TestWindowFuncs(t *testing.T) {
+	// a point per minute, the values are 1 to 10
+	var points [][]float64
+	for i := 0; i < 10; i++ {
+		points = append(points, []float64{float64(1700000000 + i*60), float64(i + 1)})
+	}
+
+	data := map[string]interface{}{
+		"$A":           10.0,
+		WindowKey("A"): NewWindow(points),
+	}
+
+	tests := []struct {
+		expr     string
+		expected float64
+	}{
+		{"avg($A)", 5.5},
+		{"avg($A, 2m)", 9},
+		{"max($A) == 10 && min($A) == 1", 1},
+		{"min($A, 5m)", 5},
+		{"sum($A, 1m)", 19},
+		{"delta($A)", 9},
+		{"pct_change($A, 1h) > 800", 1},
+		{"count_over($A > 5)", 5},
+		{"count_over($A >= 8, 3m)", 3},
+		{"$A > avg($A, 1h) && max(1, 2) == 2", 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			got, err := MathCalc(tt.expr, data)
+			if err != nil {
+				t.Fatalf("MathCalc(%s) error: %v", tt.expr, err)
+			}
+
+			if math.Abs(got-tt.expected) > 1e-9 {
+				t.Errorf("MathCalc(%s) = %v, want %v", tt.expr, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestWindowFuncsError(t *testing.T) {
+	data := map[string]interface{}{WindowKey("A"): NewWindow(nil)}
+	for _, e := range []string{"avg($A)", "avg($B)", "pct_change($A, 5x)"} {
+		if _, err := MathCalc(e, data); err == nil {
+			t.Errorf("MathCalc(%s) expects error", e)
+		}
+	}
+}
+
+func TestWindowFuncsMultiCharRef(t *testing.T) {
+	var points [][]float64
+	for i := 0; i < 10; i++ {
+		points = append(points, []float64{float64(1700000000 + i*60), float64(i + 1)})
+	}
+
+	data := map[string]interface{}{
+		"$AA":           10.0,
+		WindowKey("AA"): NewWindow(points),
+		"$A1":           3.0,
+		WindowKey("A1"): NewWindow(points[:3]),
+		"$A1.prev":      2.0,
+	}
+
+	tests := []struct {
+		expr     string
+		expected float64
+	}{
+		{"avg($AA, 2m)", 9},
+		{"count_over($AA > 5)", 5},
+		{"max($A1) == $A1 && $AA > avg($AA)", 1},
+		{"$A1 - $A1.prev", 1},
+	}
+
+	for _, tt := range tests {
+		got, err := MathCalc(tt.expr, data)
+		if err != nil {
+			t.Fatalf("MathCalc(%s) error: %v", tt.expr, err)
+		}
+
+		if math.Abs(got-tt.expected) > 1e-9 {
+			t.Errorf("MathCalc(%s) = %v, want %v", tt.expr, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,547 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+const (
+	// HAModeFailover sends a request to the first healthy replica, the next one is tried when it fails
+	HAModeFailover = "failover"
+	// HAModeMerge queries all the healthy replicas and merges the results, like Thanos and Promxy do
+	HAModeMerge = "merge"
+
+	defaultCooldown = 30 * time.Second
+)
+
+type HAOptions struct {
+	Mode string
+	// ReplicaLabel is the label telling the replicas apart, it is dropped from the results
+	ReplicaLabel string
+	// Cooldown is how long a failed replica is skipped
+	Cooldown time.Duration
+}
+
+type Replica struct {
+	Url string
+	API API
+
+	sync.RWMutex
+	downUntil time.Time
+	lastError string
+	lastCheck int64
+}
+
+func (r *Replica) healthy(now time.Time) bool {
+	r.RLock()
+	defer r.RUnlock()
+	return !now.Before(r.downUntil)
+}
+
+func (r *Replica) mark(err error, cooldown time.Duration) {
+	r.Lock()
+	defer r.Unlock()
+
+	r.lastCheck = time.Now().Unix()
+	if err == nil {
+		r.downUntil = time.Time{}
+		r.lastError = ""
+		return
+	}
+
+	r.downUntil = time.Now().Add(cooldown)
+	r.lastError = err.Error()
+}
+
+type ReplicaHealth struct {
+	Url       string `json:"url"`
+	Healthy   bool   `json:"healthy"`
+	LastError string `json:"last_error"`
+	LastCheck int64  `json:"last_check"`
+}
+
+// HAAPI is the API of a datasource served by several replicas of Prometheus.
+// Failed replicas are skipped for the cooldown, when all of them failed they are all tried again.
+type HAAPI struct {
+	replicas []*Replica
+	opt      HAOptions
+}
+
+func NewHAAPI(replicas []*Replica, opt HAOptions) *HAAPI {
+	if opt.Mode != HAModeMerge {
+		opt.Mode = HAModeFailover
+	}
+
+	if opt.Cooldown <= 0 {
+		opt.Cooldown = defaultCooldown
+	}
+
+	return &HAAPI{replicas: replicas, opt: opt}
+}
+
+// candidates are the healthy replicas in the configured order, then the others as a last resort
+func (h *HAAPI) candidates() []*Replica {
+	now := time.Now()
+	ret := make([]*Replica, 0, len(h.replicas))
+	var down []*Replica
+	for _, r := range h.replicas {
+		if r.healthy(now) {
+			ret = append(ret, r)
+		} else {
+			down = append(down, r)
+		}
+	}
+	return append(ret, down...)
+}
+
+// PreferredUrl is the url of the replica used by failover now, used by raw proxies
+func (h *HAAPI) PreferredUrl() string {
+	return h.candidates()[0].Url
+}
+
+func (h *HAAPI) Health() []ReplicaHealth {
+	now := time.Now()
+	ret := make([]ReplicaHealth, 0, len(h.replicas))
+	for _, r := range h.replicas {
+		r.RLock()
+		ret = append(ret, ReplicaHealth{Url: r.Url, Healthy: !now.Before(r.downUntil), LastError: r.lastError, LastCheck: r.lastCheck})
+		r.RUnlock()
+	}
+	return ret
+}
+
+// CheckHealth probes every replica with a trivial query
+func (h *HAAPI) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, r := range h.replicas {
+		wg.Add(1)
+		go func(r *Replica) {
+			defer wg.Done()
+			_, _, err := r.API.Query(ctx, "vector(1)", time.Now())
+			r.mark(err, h.opt.Cooldown)
+		}(r)
+	}
+	wg.Wait()
+}
+
+// shouldFailover tells whether an error is caused by the replica rather than by the request
+func shouldFailover(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.Type {
+		case ErrBadData, ErrExec, ErrCanceled:
+			return false
+		}
+	}
+	return true
+}
+
+func failover[T any](ctx context.Context, h *HAAPI, fn func(API) (T, Warnings, error)) (T, Warnings, error) {
+	var (
+		ret      T
+		warnings Warnings
+		err      error
+	)
+
+	for _, r := range h.candidates() {
+		ret, warnings, err = fn(r.API)
+		if err == nil {
+			r.mark(nil, h.opt.Cooldown)
+			return ret, warnings, nil
+		}
+
+		if !shouldFailover(ctx, err) {
+			return ret, warnings, err
+		}
+
+		r.mark(err, h.opt.Cooldown)
+	}
+	return ret, warnings, err
+}
+
+func failoverNoWarnings[T any](ctx context.Context, h *HAAPI, fn func(API) (T, error)) (T, error) {
+	ret, _, err := failover(ctx, h, func(a API) (T, Warnings, error) {
+		v, err := fn(a)
+		return v, nil, err
+	})
+	return ret, err
+}
+
+type replicaResult[T any] struct {
+	value    T
+	warnings Warnings
+	err      error
+}
+
+// all calls every healthy replica, or every replica when none is healthy, the results keep the replica order
+func all[T any](ctx context.Context, h *HAAPI, fn func(API) (T, Warnings, error)) ([]T, Warnings, error) {
+	now := time.Now()
+	var replicas []*Replica
+	for _, r := range h.replicas {
+		if r.healthy(now) {
+			replicas = append(replicas, r)
+		}
+	}
+
+	if len(replicas) == 0 {
+		replicas = h.replicas
+	}
+
+	results := make([]replicaResult[T], len(replicas))
+	var wg sync.WaitGroup
+	for i := range replicas {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, w, err := fn(replicas[i].API)
+			results[i] = replicaResult[T]{value: v, warnings: w, err: err}
+		}(i)
+	}
+	wg.Wait()
+
+	var (
+		values   []T
+		warnings Warnings
+		firstErr error
+	)
+
+	for i, res := range results {
+		if res.err != nil {
+			if shouldFailover(ctx, res.err) {
+				replicas[i].mark(res.err, h.opt.Cooldown)
+			}
+
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+
+		replicas[i].mark(nil, h.opt.Cooldown)
+		values = append(values, res.value)
+		warnings = append(warnings, res.warnings...)
+	}
+
+	if len(values) == 0 {
+		return nil, warnings, firstErr
+	}
+
+	if firstErr != nil {
+		warnings = append(warnings, "partial result: "+firstErr.Error())
+	}
+	return values, warnings, nil
+}
+
+func (h *HAAPI) dropReplica(m model.Metric) model.Metric {
+	if h.opt.ReplicaLabel == "" {
+		return m
+	}
+
+	name := model.LabelName(h.opt.ReplicaLabel)
+	if _, has := m[name]; !has {
+		return m
+	}
+
+	ret := make(model.Metric, len(m))
+	for k, v := range m {
+		if k != name {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// dedup drops the replica label of a single result so that failover does not change the series
+func (h *HAAPI) dedup(v model.Value) model.Value {
+	if h.opt.ReplicaLabel == "" || v == nil {
+		return v
+	}
+	return mergeValues([]model.Value{v}, h.dropReplica)
+}
+
+// mergeValues merges the results of the replicas, a series is identified by its labels without the replica label.
+// Samples of earlier replicas win, the others fill the gaps; range query results share the step grid
+// so that the samples of the replicas line up.
+func mergeValues(values []model.Value, drop func(model.Metric) model.Metric) model.Value {
+	if len(values) == 0 {
+		return nil
+	}
+
+	switch values[0].Type() {
+	case model.ValVector:
+		seen := make(map[model.Fingerprint]struct{})
+		var ret model.Vector
+		for _, v := range values {
+			vec, ok := v.(model.Vector)
+			if !ok {
+				continue
+			}
+
+			for _, s := range vec {
+				m := drop(s.Metric)
+				fp := m.Fingerprint()
+				if _, has := seen[fp]; has {
+					continue
+				}
+				seen[fp] = struct{}{}
+				ret = append(ret, &model.Sample{Metric: m, Value: s.Value, Timestamp: s.Timestamp, Histogram: s.Histogram})
+			}
+		}
+		return ret
+	case model.ValMatrix:
+		streams := make(map[model.Fingerprint]*model.SampleStream)
+		points := make(map[model.Fingerprint]map[model.Time]model.SamplePair)
+		var order []model.Fingerprint
+		for _, v := range values {
+			matrix, ok := v.(model.Matrix)
+			if !ok {
+				continue
+			}
+
+			for _, s := range matrix {
+				m := drop(s.Metric)
+				fp := m.Fingerprint()
+				if _, has := streams[fp]; !has {
+					streams[fp] = &model.SampleStream{Metric: m}
+					points[fp] = make(map[model.Time]model.SamplePair)
+					order = append(order, fp)
+				}
+
+				for _, p := range s.Values {
+					if _, has := points[fp][p.Timestamp]; !has {
+						points[fp][p.Timestamp] = p
+					}
+				}
+			}
+		}
+
+		ret := make(model.Matrix, 0, len(order))
+		for _, fp := range order {
+			s := streams[fp]
+			for _, p := range points[fp] {
+				s.Values = append(s.Values, p)
+			}
+			sort.Slice(s.Values, func(i, j int) bool {
+				return s.Values[i].Timestamp < s.Values[j].Timestamp
+			})
+			ret = append(ret, s)
+		}
+		return ret
+	default:
+		return values[0]
+	}
+}
+
+func mergeStrings(lists [][]string, exclude string) []string {
+	seen := make(map[string]struct{})
+	var ret []string
+	for _, lst := range lists {
+		for _, s := range lst {
+			if _, has := seen[s]; has || (exclude != "" && s == exclude) {
+				continue
+			}
+			seen[s] = struct{}{}
+			ret = append(ret, s)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+func (h *HAAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, Warnings, error) {
+	fn := func(a API) (model.Value, Warnings, error) {
+		return a.Query(ctx, query, ts)
+	}
+
+	if h.opt.Mode != HAModeMerge {
+		v, w, err := failover(ctx, h, fn)
+		return h.dedup(v), w, err
+	}
+
+	values, w, err := all(ctx, h, fn)
+	if err != nil {
+		return nil, w, err
+	}
+	return mergeValues(values, h.dropReplica), w, nil
+}
+
+func (h *HAAPI) QueryRange(ctx context.Context, query string, r Range) (model.Value, Warnings, error) {
+	fn := func(a API) (model.Value, Warnings, error) {
+		return a.QueryRange(ctx, query, r)
+	}
+
+	if h.opt.Mode != HAModeMerge {
+		v, w, err := failover(ctx, h, fn)
+		return h.dedup(v), w, err
+	}
+
+	values, w, err := all(ctx, h, fn)
+	if err != nil {
+		return nil, w, err
+	}
+	return mergeValues(values, h.dropReplica), w, nil
+}
+
+func (h *HAAPI) Series(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) ([]model.LabelSet, Warnings, error) {
+	fn := func(a API) ([]model.LabelSet, Warnings, error) {
+		return a.Series(ctx, matches, startTime, endTime)
+	}
+
+	var lists [][]model.LabelSet
+	var warnings Warnings
+	if h.opt.Mode != HAModeMerge {
+		lst, w, err := failover(ctx, h, fn)
+		if err != nil {
+			return nil, w, err
+		}
+		lists, warnings = [][]model.LabelSet{lst}, w
+	} else {
+		var err error
+		lists, warnings, err = all(ctx, h, fn)
+		if err != nil {
+			return nil, warnings, err
+		}
+	}
+
+	seen := make(map[model.Fingerprint]struct{})
+	var ret []model.LabelSet
+	for _, lst := range lists {
+		for _, ls := range lst {
+			m := h.dropReplica(model.Metric(ls))
+			fp := m.Fingerprint()
+			if _, has := seen[fp]; has {
+				continue
+			}
+			seen[fp] = struct{}{}
+			ret = append(ret, model.LabelSet(m))
+		}
+	}
+	return ret, warnings, nil
+}
+
+func (h *HAAPI) LabelNames(ctx context.Context) ([]string, Warnings, error) {
+	fn := func(a API) ([]string, Warnings, error) {
+		return a.LabelNames(ctx)
+	}
+
+	if h.opt.Mode != HAModeMerge {
+		lst, w, err := failover(ctx, h, fn)
+		if err != nil {
+			return nil, w, err
+		}
+		return mergeStrings([][]string{lst}, h.opt.ReplicaLabel), w, nil
+	}
+
+	lists, w, err := all(ctx, h, fn)
+	if err != nil {
+		return nil, w, err
+	}
+	return mergeStrings(lists, h.opt.ReplicaLabel), w, nil
+}
+
+func (h *HAAPI) LabelValues(ctx context.Context, label string, matchs []string) (model.LabelValues, Warnings, error) {
+	fn := func(a API) (model.LabelValues, Warnings, error) {
+		return a.LabelValues(ctx, label, matchs)
+	}
+
+	if h.opt.Mode != HAModeMerge {
+		return failover(ctx, h, fn)
+	}
+
+	lists, w, err := all(ctx, h, fn)
+	if err != nil {
+		return nil, w, err
+	}
+
+	strs := make([][]string, 0, len(lists))
+	for _, lst := range lists {
+		s := make([]string, 0, len(lst))
+		for _, v := range lst {
+			s = append(s, string(v))
+		}
+		strs = append(strs, s)
+	}
+
+	merged := mergeStrings(strs, "")
+	ret := make(model.LabelValues, 0, len(merged))
+	for _, s := range merged {
+		ret = append(ret, model.LabelValue(s))
+	}
+	return ret, w, nil
+}
+
+func (h *HAAPI) Alerts(ctx context.Context) (AlertsResult, error) {
+	return failoverNoWarnings(ctx, h, func(a API) (AlertsResult, error) { return a.Alerts(ctx) })
+}
+
+func (h *HAAPI) AlertManagers(ctx context.Context) (AlertManagersResult, error) {
+	return failoverNoWarnings(ctx, h, func(a API) (AlertManagersResult, error) { return a.AlertManagers(ctx) })
+}
+
+// CleanTombstones, DeleteSeries and Snapshot change the storage, they are sent to every replica
+func (h *HAAPI) CleanTombstones(ctx context.Context) error {
+	return h.each(func(a API) error { return a.CleanTombstones(ctx) })
+}
+
+func (h *HAAPI) DeleteSeries(ctx context.Context, matches []string, startTime time.Time, endTime time.Time) error {
+	return h.each(func(a API) error { return a.DeleteSeries(ctx, matches, startTime, endTime) })
+}
+
+func (h *HAAPI) Snapshot(ctx context.Context, skipHead bool) (SnapshotResult, error) {
+	var ret SnapshotResult
+	err := h.each(func(a API) error {
+		r, err := a.Snapshot(ctx, skipHead)
+		if err == nil && ret.Name == "" {
+			ret = r
+		}
+		return err
+	})
+	return ret, err
+}
+
+func (h *HAAPI) each(fn func(API) error) error {
+	var errs []error
+	for _, r := range h.replicas {
+		if err := fn(r.API); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (h *HAAPI) Config(ctx context.Context) (ConfigResult, error) {
+	return failoverNoWarnings(ctx, h, func(a API) (ConfigResult, error) { return a.Config(ctx) })
+}
+
+func (h *HAAPI) Flags(ctx context.Context) (FlagsResult, error) {
+	return failoverNoWarnings(ctx, h, func(a API) (FlagsResult, error) { return a.Flags(ctx) })
+}
+
+func (h *HAAPI) Rules(ctx context.Context) (RulesResult, error) {
+	return failoverNoWarnings(ctx, h, func(a API) (RulesResult, error) { return a.Rules(ctx) })
+}
+
+func (h *HAAPI) Targets(ctx context.Context) (TargetsResult, error) {
+	return failoverNoWarnings(ctx, h, func(a API) (TargetsResult, error) { return a.Targets(ctx) })
+}
+
+func (h *HAAPI) TargetsMetadata(ctx context.Context, matchTarget string, metric string, limit string) ([]MetricMetadata, error) {
+	return failoverNoWarnings(ctx, h, func(a API) ([]MetricMetadata, error) {
+		return a.TargetsMetadata(ctx, matchTarget, metric, limit)
+	})
+}
+
+func (h *HAAPI) Metadata(ctx context.Context, metric string, limit string) (map[string][]Metadata, error) {
+	return failoverNoWarnings(ctx, h, func(a API) (map[string][]Metadata, error) {
+		return a.Metadata(ctx, metric, limit)
+	})
+}
@@ -0,0 +1,133 @@
+package prom
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/common/model"
+)
+
+type fakeAPI struct {
+	API
+	value model.Value
+	err   error
+	calls int
+}
+
+func (f *fakeAPI) Query(ctx context.Context, query string, ts time.Time) (model.Value, Warnings, error) {
+	f.calls++
+	return f.value, nil, f.err
+}
+
+func (f *fakeAPI) QueryRange(ctx context.Context, query string, r Range) (model.Value, Warnings, error) {
+	f.calls++
+	return f.value, nil, f.err
+}
+
+func sample(replica string, v float64) *model.Sample {
+	return &model.Sample{
+		Metric: model.Metric{"__name__": "up", "instance": "a", "replica": model.LabelValue(replica)},
+		Value:  model.SampleValue(v),
+	}
+}
+
+func TestHAFailover(t *testing.T) {
+	down := &fakeAPI{err: errors.New("connection refused")}
+	up := &fakeAPI{value: model.Vector{sample("b", 1)}}
+	ha := NewHAAPI([]*Replica{{Url: "http://a", API: down}, {Url: "http://b", API: up}}, HAOptions{ReplicaLabel: "replica"})
+
+	v, _, err := ha.Query(context.Background(), "up", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vec := v.(model.Vector)
+	if len(vec) != 1 {
+		t.Fatalf("expect 1 sample, got %d", len(vec))
+	}
+
+	if _, has := vec[0].Metric["replica"]; has {
+		t.Fatal("replica label should be dropped")
+	}
+
+	if ha.PreferredUrl() != "http://b" {
+		t.Fatalf("failed replica should be skipped, got %s", ha.PreferredUrl())
+	}
+
+	// the failed replica is not queried during the cooldown
+	if _, _, err := ha.Query(context.Background(), "up", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	if down.calls != 1 || up.calls != 2 {
+		t.Fatalf("unexpected calls: down %d, up %d", down.calls, up.calls)
+	}
+}
+
+func TestHAFailoverBadData(t *testing.T) {
+	bad := &fakeAPI{err: &Error{Type: ErrBadData, Msg: "parse error"}}
+	other := &fakeAPI{value: model.Vector{}}
+	ha := NewHAAPI([]*Replica{{Url: "http://a", API: bad}, {Url: "http://b", API: other}}, HAOptions{})
+
+	if _, _, err := ha.Query(context.Background(), "up{", time.Now()); err == nil {
+		t.Fatal("expect the error of the bad query")
+	}
+
+	if other.calls != 0 {
+		t.Fatal("bad queries should not fail over")
+	}
+
+	if ha.PreferredUrl() != "http://a" {
+		t.Fatal("bad queries should not mark the replica down")
+	}
+}
+
+func TestHAMerge(t *testing.T) {
+	a := &fakeAPI{value: model.Matrix{{
+		Metric: model.Metric{"__name__": "up", "replica": "a"},
+		Values: []model.SamplePair{{Timestamp: 1000, Value: 1}, {Timestamp: 3000, Value: 1}},
+	}}}
+	b := &fakeAPI{value: model.Matrix{{
+		Metric: model.Metric{"__name__": "up", "replica": "b"},
+		Values: []model.SamplePair{{Timestamp: 1000, Value: 2}, {Timestamp: 2000, Value: 2}, {Timestamp: 3000, Value: 2}},
+	}}}
+	ha := NewHAAPI([]*Replica{{Url: "http://a", API: a}, {Url: "http://b", API: b}}, HAOptions{Mode: HAModeMerge, ReplicaLabel: "replica"})
+
+	v, _, err := ha.QueryRange(context.Background(), "up", Range{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	matrix := v.(model.Matrix)
+	if len(matrix) != 1 {
+		t.Fatalf("expect 1 series, got %d", len(matrix))
+	}
+
+	expect := []model.SampleValue{1, 2, 1}
+	if len(matrix[0].Values) != len(expect) {
+		t.Fatalf("expect %d points, got %v", len(expect), matrix[0].Values)
+	}
+
+	for i, p := range matrix[0].Values {
+		if p.Value != expect[i] {
+			t.Fatalf("point %d: expect %v, got %v", i, expect[i], p.Value)
+		}
+	}
+}
+
+func TestHAMergePartial(t *testing.T) {
+	a := &fakeAPI{err: errors.New("timeout")}
+	b := &fakeAPI{value: model.Vector{sample("b", 1)}}
+	ha := NewHAAPI([]*Replica{{Url: "http://a", API: a}, {Url: "http://b", API: b}}, HAOptions{Mode: HAModeMerge, ReplicaLabel: "replica"})
+
+	v, warnings, err := ha.Query(context.Background(), "up", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(v.(model.Vector)) != 1 || len(warnings) != 1 {
+		t.Fatalf("unexpected result %v, warnings %v", v, warnings)
+	}
+}
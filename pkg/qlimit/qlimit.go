@@ -0,0 +1,325 @@
+// Package qlimit limits the queries sent to the datasources: concurrent queries of a datasource beyond its
+// limit wait in a bounded queue, users have a concurrency limit and a quota per minute, queries run with
+// the timeout of their datasource, and slow queries are kept in a ring buffer in the memory of the process.
+// The queries of the alert rules have slots of their own on each datasource, so dashboards never starve
+// the evaluation of the rules.
+package qlimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/toolkits/pkg/logger"
+)
+
+// SourceAlert is the source of the queries of the alert rules
+const SourceAlert = "alert"
+
+var (
+	ErrQueueFull     = errors.New("too many queries are waiting for the datasource")
+	ErrQueueTimeout  = errors.New("timeout waiting for a free slot of the datasource")
+	ErrQuotaExceeded = errors.New("query quota of the user exceeded")
+)
+
+type Config struct {
+	MaxConcurrency       int   // concurrent queries of a datasource, overridden by the max_concurrency setting of it, 0 means no limit
+	AlertMaxConcurrency  int   // concurrent queries of the alert rules on a datasource besides the others, 0 means the limit of the datasource
+	MaxQueue             int   // queries waiting for a datasource, default: 100
+	QueueTimeout         int64 // unit: ms, default: 30000
+	Timeout              int64 // queries of datasources without timeout setting, unit: ms, 0 means no timeout
+	UserMaxConcurrency   int   // 0 means no limit
+	UserQueriesPerMinute int   // 0 means no limit
+	SlowThreshold        int64 // unit: ms, default: 5000
+	SlowLogSize          int   // default: 1000
+}
+
+func (c *Config) PreCheck() {
+	if c.MaxQueue <= 0 {
+		c.MaxQueue = 100
+	}
+
+	if c.QueueTimeout <= 0 {
+		c.QueueTimeout = 30000
+	}
+
+	if c.SlowThreshold <= 0 {
+		c.SlowThreshold = 5000
+	}
+
+	if c.SlowLogSize <= 0 {
+		c.SlowLogSize = 1000
+	}
+}
+
+// DatasourceLimit is read from the settings of a datasource
+type DatasourceLimit struct {
+	MaxConcurrency int
+	Timeout        time.Duration
+}
+
+// Query describes a query for the limits and the slow log, the queries of alert rules carry RuleId instead of User
+type Query struct {
+	Source       string `json:"source"`
+	User         string `json:"user"`
+	RuleId       int64  `json:"rule_id"`
+	DatasourceId int64  `json:"datasource_id"`
+	Cate         string `json:"cate"`
+	Text         string `json:"query"`
+}
+
+type Entry struct {
+	Query
+	Time     int64  `json:"time"`
+	Queued   int64  `json:"queued"`   // unit: ms
+	Duration int64  `json:"duration"` // unit: ms
+	Error    string `json:"error"`
+}
+
+type semaphore struct {
+	slots   chan struct{}
+	waiting int32
+}
+
+func newSemaphore(n int) *semaphore {
+	return &semaphore{slots: make(chan struct{}, n)}
+}
+
+type userWindow struct {
+	minute int64
+	count  int
+}
+
+type Limiter struct {
+	conf Config
+
+	sync.Mutex
+	dsLimits  map[int64]DatasourceLimit
+	dsSems    map[int64]*semaphore
+	alertSems map[int64]*semaphore // the slots of the alert rules
+	userSems  map[string]*semaphore
+	windows   map[string]*userWindow
+
+	slowMu   sync.RWMutex
+	slowLogs []Entry
+	slowNext int
+}
+
+// Default is unlimited until Init is called
+var Default = New(Config{})
+
+func Init(conf Config) {
+	Default = New(conf)
+}
+
+func New(conf Config) *Limiter {
+	conf.PreCheck()
+	return &Limiter{
+		conf:      conf,
+		dsLimits:  make(map[int64]DatasourceLimit),
+		dsSems:    make(map[int64]*semaphore),
+		alertSems: make(map[int64]*semaphore),
+		userSems:  make(map[string]*semaphore),
+		windows:   make(map[string]*userWindow),
+		slowLogs:  make([]Entry, 0, conf.SlowLogSize),
+	}
+}
+
+// SetDatasources replaces the limits of the datasources, datasources absent use the defaults
+func (l *Limiter) SetDatasources(limits map[int64]DatasourceLimit) {
+	l.Lock()
+	defer l.Unlock()
+
+	for _, sems := range []map[int64]*semaphore{l.dsSems, l.alertSems} {
+		for id := range sems {
+			if limits[id].MaxConcurrency != l.dsLimits[id].MaxConcurrency {
+				// a new semaphore is created by the next query, the running ones release their slots to the old one
+				delete(sems, id)
+			}
+		}
+	}
+	l.dsLimits = limits
+}
+
+func (l *Limiter) datasource(dsId int64, source string) (*semaphore, time.Duration) {
+	l.Lock()
+	defer l.Unlock()
+
+	limit, has := l.dsLimits[dsId]
+	n := l.conf.MaxConcurrency
+	if has && limit.MaxConcurrency > 0 {
+		n = limit.MaxConcurrency
+	}
+
+	sems := l.dsSems
+	if source == SourceAlert {
+		sems = l.alertSems
+		if l.conf.AlertMaxConcurrency > 0 {
+			n = l.conf.AlertMaxConcurrency
+		}
+	}
+
+	timeout := time.Duration(l.conf.Timeout) * time.Millisecond
+	if has && limit.Timeout > 0 {
+		timeout = limit.Timeout
+	}
+
+	if n <= 0 {
+		return nil, timeout
+	}
+
+	sem, has := sems[dsId]
+	if !has {
+		sem = newSemaphore(n)
+		sems[dsId] = sem
+	}
+	return sem, timeout
+}
+
+func (l *Limiter) user(user string) (*semaphore, error) {
+	if user == "" {
+		return nil, nil
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	if l.conf.UserQueriesPerMinute > 0 {
+		minute := time.Now().Unix() / 60
+		w, has := l.windows[user]
+		if !has || w.minute != minute {
+			w = &userWindow{minute: minute}
+			l.windows[user] = w
+		}
+
+		if w.count >= l.conf.UserQueriesPerMinute {
+			return nil, ErrQuotaExceeded
+		}
+		w.count++
+	}
+
+	if l.conf.UserMaxConcurrency <= 0 {
+		return nil, nil
+	}
+
+	sem, has := l.userSems[user]
+	if !has {
+		sem = newSemaphore(l.conf.UserMaxConcurrency)
+		l.userSems[user] = sem
+	}
+	return sem, nil
+}
+
+func (l *Limiter) acquire(ctx context.Context, sem *semaphore) (func(), error) {
+	if sem == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case sem.slots <- struct{}{}:
+		return func() { <-sem.slots }, nil
+	default:
+	}
+
+	if int(atomic.AddInt32(&sem.waiting, 1)) > l.conf.MaxQueue {
+		atomic.AddInt32(&sem.waiting, -1)
+		return nil, ErrQueueFull
+	}
+	defer atomic.AddInt32(&sem.waiting, -1)
+
+	timer := time.NewTimer(time.Duration(l.conf.QueueTimeout) * time.Millisecond)
+	defer timer.Stop()
+
+	select {
+	case sem.slots <- struct{}{}:
+		return func() { <-sem.slots }, nil
+	case <-timer.C:
+		return nil, ErrQueueTimeout
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Do runs fn within the limits of the user and the datasource, the context of fn carries the timeout
+// of the datasource. The entry of the query is returned for the metrics of the caller.
+func (l *Limiter) Do(ctx context.Context, q Query, fn func(ctx context.Context) error) (Entry, error) {
+	entry := Entry{Query: q, Time: time.Now().Unix()}
+	start := time.Now()
+
+	userSem, err := l.user(q.User)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry, err
+	}
+
+	releaseUser, err := l.acquire(ctx, userSem)
+	if err != nil {
+		entry.Error = err.Error()
+		return entry, err
+	}
+	defer releaseUser()
+
+	dsSem, timeout := l.datasource(q.DatasourceId, q.Source)
+	releaseDs, err := l.acquire(ctx, dsSem)
+	if err != nil {
+		entry.Error = fmt.Sprintf("datasource %d: %v", q.DatasourceId, err)
+		return entry, fmt.Errorf("datasource %d: %w", q.DatasourceId, err)
+	}
+	defer releaseDs()
+
+	begin := time.Now()
+	entry.Queued = begin.Sub(start).Milliseconds()
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	err = fn(ctx)
+	entry.Duration = time.Since(begin).Milliseconds()
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if entry.Duration >= l.conf.SlowThreshold {
+		logger.Warningf("slow query: source=%s user=%s rule_id=%d datasource=%d cate=%s duration=%dms queued=%dms query=%s err=%s",
+			q.Source, q.User, q.RuleId, q.DatasourceId, q.Cate, entry.Duration, entry.Queued, q.Text, entry.Error)
+		l.addSlow(entry)
+	}
+
+	return entry, err
+}
+
+func (l *Limiter) addSlow(e Entry) {
+	l.slowMu.Lock()
+	defer l.slowMu.Unlock()
+
+	if len(l.slowLogs) < l.conf.SlowLogSize {
+		l.slowLogs = append(l.slowLogs, e)
+		return
+	}
+
+	l.slowLogs[l.slowNext] = e
+	l.slowNext = (l.slowNext + 1) % l.conf.SlowLogSize
+}
+
+// SlowLogs returns the slow queries matching the filter, the latest first
+func (l *Limiter) SlowLogs(filter func(Entry) bool, limit int) []Entry {
+	l.slowMu.RLock()
+	defer l.slowMu.RUnlock()
+
+	n := len(l.slowLogs)
+	ret := make([]Entry, 0)
+	for i := 0; i < n && (limit <= 0 || len(ret) < limit); i++ {
+		// slowNext is the oldest entry once the buffer is full
+		e := l.slowLogs[(l.slowNext-1-i+2*n)%n]
+		if filter == nil || filter(e) {
+			ret = append(ret, e)
+		}
+	}
+	return ret
+}
@@ -0,0 +1,134 @@
+package qlimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDatasourceConcurrency(t *testing.T) {
+	l := New(Config{MaxQueue: 1, QueueTimeout: 1000})
+	l.SetDatasources(map[int64]DatasourceLimit{1: {MaxConcurrency: 1}})
+
+	hold := make(chan struct{})
+	started := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	go func() {
+		defer wg.Done()
+		l.Do(context.Background(), Query{DatasourceId: 1}, func(ctx context.Context) error {
+			close(started)
+			<-hold
+			return nil
+		})
+	}()
+	<-started
+
+	var queued Entry
+	go func() {
+		defer wg.Done()
+		queued, _ = l.Do(context.Background(), Query{DatasourceId: 1}, func(ctx context.Context) error {
+			return nil
+		})
+	}()
+
+	// wait for the second query to be queued, the third one finds the queue full
+	for i := 0; i < 100; i++ {
+		l.Lock()
+		sem := l.dsSems[1]
+		l.Unlock()
+		if sem != nil && atomic.LoadInt32(&sem.waiting) == 1 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err := l.Do(context.Background(), Query{DatasourceId: 1}, func(ctx context.Context) error { return nil })
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expect queue full, got %v", err)
+	}
+
+	// other datasources are not limited
+	if _, err := l.Do(context.Background(), Query{DatasourceId: 2}, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	close(hold)
+	wg.Wait()
+
+	if queued.Queued < 20 {
+		t.Fatalf("second query should wait for the slot, queued: %dms", queued.Queued)
+	}
+}
+
+func TestUserQuota(t *testing.T) {
+	l := New(Config{UserQueriesPerMinute: 2})
+	for i := 0; i < 2; i++ {
+		if _, err := l.Do(context.Background(), Query{User: "alice"}, func(ctx context.Context) error { return nil }); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := l.Do(context.Background(), Query{User: "alice"}, func(ctx context.Context) error { return nil }); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expect quota exceeded, got %v", err)
+	}
+
+	if _, err := l.Do(context.Background(), Query{User: "bob"}, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTimeoutAndSlowLog(t *testing.T) {
+	l := New(Config{SlowThreshold: 1, SlowLogSize: 2})
+	l.SetDatasources(map[int64]DatasourceLimit{1: {Timeout: 10 * time.Millisecond}})
+
+	for _, text := range []string{"a", "b", "c"} {
+		_, err := l.Do(context.Background(), Query{DatasourceId: 1, Text: text}, func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expect the timeout of the datasource, got %v", err)
+		}
+	}
+
+	logs := l.SlowLogs(nil, 0)
+	if len(logs) != 2 || logs[0].Text != "c" || logs[1].Text != "b" {
+		t.Fatalf("unexpected slow logs: %+v", logs)
+	}
+}
+
+func TestAlertSlots(t *testing.T) {
+	l := New(Config{MaxQueue: 1, QueueTimeout: 50})
+	l.SetDatasources(map[int64]DatasourceLimit{1: {MaxConcurrency: 1}})
+
+	hold := make(chan struct{})
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		l.Do(context.Background(), Query{Source: "center", DatasourceId: 1}, func(ctx context.Context) error {
+			close(started)
+			<-hold
+			return nil
+		})
+	}()
+	<-started
+
+	// the dashboards take all the slots of the datasource, the alert rules still get one
+	if _, err := l.Do(context.Background(), Query{Source: SourceAlert, DatasourceId: 1}, func(ctx context.Context) error { return nil }); err != nil {
+		t.Fatalf("expect the alert query to run, got %v", err)
+	}
+
+	if _, err := l.Do(context.Background(), Query{Source: "center", DatasourceId: 1}, func(ctx context.Context) error { return nil }); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("expect queue timeout, got %v", err)
+	}
+
+	close(hold)
+	<-done
+}
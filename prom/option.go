@@ -20,6 +20,11 @@ type PromOption struct {
 
 	Headers []string
 
+	// Urls are the replicas of a HA datasource, Url is the first of them
+	Urls         []string
+	HAMode       string
+	ReplicaLabel string
+
 	tlsx.ClientConfig
 }
 
@@ -62,6 +67,24 @@ func (po *PromOption) Equal(target PromOption) bool {
 		}
 	}
 
+	if len(po.Urls) != len(target.Urls) {
+		return false
+	}
+
+	for i := 0; i < len(po.Urls); i++ {
+		if po.Urls[i] != target.Urls[i] {
+			return false
+		}
+	}
+
+	if po.HAMode != target.HAMode {
+		return false
+	}
+
+	if po.ReplicaLabel != target.ReplicaLabel {
+		return false
+	}
+
 	return true
 }
 
@@ -1,6 +1,7 @@
 package prom
 
 import (
+	"context"
 	"fmt"
 	"net"
 	"net/http"
@@ -33,6 +34,8 @@ func (pc *PromClientMap) InitReader() error {
 			time.Sleep(time.Second)
 		}
 	}()
+
+	go pc.checkHealth()
 	return nil
 }
 
@@ -79,11 +82,24 @@ func (pc *PromClientMap) loadFromDatabase() {
 
 		var writeAddr string
 		var internalAddr string
+		var haMode string
+		var replicaLabel string
 		for k, v := range ds.SettingsJson {
 			if strings.Contains(k, "write_addr") {
 				writeAddr = v.(string)
 			} else if strings.Contains(k, "internal_addr") && v.(string) != "" {
 				internalAddr = v.(string)
+			} else if strings.Contains(k, "ha_mode") {
+				haMode, _ = v.(string)
+			} else if strings.Contains(k, "replica_label") {
+				replicaLabel, _ = v.(string)
+			}
+		}
+
+		var urls []string
+		for _, u := range ds.HTTPJson.Urls {
+			if u = strings.TrimSpace(u); u != "" {
+				urls = append(urls, u)
 			}
 		}
 
@@ -97,9 +113,16 @@ func (pc *PromClientMap) loadFromDatabase() {
 			DialTimeout:         ds.HTTPJson.DialTimeout,
 			MaxIdleConnsPerHost: ds.HTTPJson.MaxIdleConnsPerHost,
 			Headers:             header,
+			Urls:                urls,
+			HAMode:              haMode,
+			ReplicaLabel:        replicaLabel,
 		}
 
-		if strings.HasPrefix(ds.HTTPJson.Url, "https") {
+		if po.Url == "" && len(urls) > 0 {
+			po.Url = urls[0]
+		}
+
+		if strings.HasPrefix(po.Url, "https") {
 			po.UseTLS = true
 			po.InsecureSkipVerify = ds.HTTPJson.TLS.SkipTlsVerify
 		}
@@ -107,6 +130,7 @@ func (pc *PromClientMap) loadFromDatabase() {
 		if internalAddr != "" && !pc.ctx.IsCenter {
 			// internal addr is set, use internal addr when edge mode
 			po.Url = internalAddr
+			po.Urls = nil
 		}
 
 		newCluster[dsId] = struct{}{}
@@ -144,11 +168,28 @@ func (pc *PromClientMap) loadFromDatabase() {
 	}
 }
 
-func (pc *PromClientMap) newReaderClientFromPromOption(po PromOption) (api.Client, error) {
+// checkHealth probes the replicas of the HA datasources, failed replicas are skipped by the queries
+func (pc *PromClientMap) checkHealth() {
+	for {
+		time.Sleep(10 * time.Second)
+		for _, dsId := range pc.GetDatasourceIds() {
+			ha, ok := pc.GetCli(dsId).(*prom.HAAPI)
+			if !ok {
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			ha.CheckHealth(ctx)
+			cancel()
+		}
+	}
+}
+
+func (pc *PromClientMap) newReaderClientFromPromOption(po PromOption, addr string) (api.Client, error) {
 	tlsConfig, _ := po.TLSConfig()
 
 	return api.NewClient(api.Config{
-		Address: po.Url,
+		Address: addr,
 		RoundTripper: &http.Transport{
 			TLSClientConfig: tlsConfig,
 			Proxy:           http.ProxyFromEnvironment,
@@ -187,16 +228,29 @@ func (pc *PromClientMap) setClientFromPromOption(datasourceId int64, po PromOpti
 		return fmt.Errorf("prometheus url is blank")
 	}
 
-	readerCli, err := pc.newReaderClientFromPromOption(po)
-	if err != nil {
-		return fmt.Errorf("failed to newClientFromPromOption: %v", err)
+	urls := po.Urls
+	if len(urls) == 0 {
+		urls = []string{po.Url}
 	}
 
-	reader := prom.NewAPI(readerCli, prom.ClientOptions{
-		BasicAuthUser: po.BasicAuthUser,
-		BasicAuthPass: po.BasicAuthPass,
-		Headers:       po.Headers,
-	})
+	replicas := make([]*prom.Replica, 0, len(urls))
+	for _, u := range urls {
+		readerCli, err := pc.newReaderClientFromPromOption(po, u)
+		if err != nil {
+			return fmt.Errorf("failed to newClientFromPromOption: %v", err)
+		}
+
+		replicas = append(replicas, &prom.Replica{Url: u, API: prom.NewAPI(readerCli, prom.ClientOptions{
+			BasicAuthUser: po.BasicAuthUser,
+			BasicAuthPass: po.BasicAuthPass,
+			Headers:       po.Headers,
+		})})
+	}
+
+	reader := replicas[0].API
+	if len(replicas) > 1 {
+		reader = prom.NewHAAPI(replicas, prom.HAOptions{Mode: po.HAMode, ReplicaLabel: po.ReplicaLabel})
+	}
 
 	writerCli, err := pc.newWriterClientFromPromOption(po)
 	if err != nil {
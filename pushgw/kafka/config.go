@@ -0,0 +1,39 @@
+package kafka
+
+import (
+	"time"
+
+	"github.com/ccfos/nightingale/v6/pushgw/pconf"
+
+	"github.com/IBM/sarama"
+	"github.com/toolkits/pkg/logger"
+)
+
+// NewConfig builds the sarama config of the producers, timeout unit: second
+func NewConfig(version string, timeout int64, sasl *pconf.SASLConfig) *sarama.Config {
+	cfg := sarama.NewConfig()
+	if sasl != nil && sasl.Enable {
+		cfg.Net.SASL.Enable = true
+		cfg.Net.SASL.User = sasl.User
+		cfg.Net.SASL.Password = sasl.Password
+		cfg.Net.SASL.Mechanism = sarama.SASLMechanism(sasl.Mechanism)
+		cfg.Net.SASL.Version = sasl.Version
+		cfg.Net.SASL.Handshake = sasl.Handshake
+		cfg.Net.SASL.AuthIdentity = sasl.AuthIdentity
+	}
+
+	if timeout != 0 {
+		cfg.Producer.Timeout = time.Duration(timeout) * time.Second
+	}
+
+	if version != "" {
+		kafkaVersion, err := sarama.ParseKafkaVersion(version)
+		if err != nil {
+			logger.Warningf("parse kafka version got error: %v", err)
+		} else {
+			cfg.Version = kafkaVersion
+		}
+	}
+
+	return cfg
+}
@@ -43,27 +43,43 @@ type (
 		Close() error
 	}
 
+	// AckFunc is called with each message acked by kafka, err is nil if the message is delivered
+	AckFunc func(msg *sarama.ProducerMessage, err error)
+
 	AsyncProducerWrapper struct {
 		asyncProducer sarama.AsyncProducer
+		ack           AckFunc
 		stop          chan struct{}
 	}
 
 	SyncProducerWrapper struct {
 		syncProducer sarama.SyncProducer
+		ack          AckFunc
 		stop         chan struct{}
 	}
 )
 
 func New(typ string, brokers []string, config *sarama.Config) (Producer, error) {
+	return NewWithAck(typ, brokers, config, nil)
+}
+
+// NewWithAck returns a producer reporting the acks of the messages to ack, the async
+// producer hands a message off in Send and reports its ack later
+func NewWithAck(typ string, brokers []string, config *sarama.Config, ack AckFunc) (Producer, error) {
 	stop := make(chan struct{})
 	switch typ {
 	case AsyncProducer:
+		if ack != nil {
+			config.Producer.Return.Successes = true
+			config.Producer.Return.Errors = true
+		}
 		p, err := sarama.NewAsyncProducer(brokers, config)
 		if err != nil {
 			return nil, err
 		}
 		apw := &AsyncProducerWrapper{
 			asyncProducer: p,
+			ack:           ack,
 			stop:          stop,
 		}
 		go apw.errorWorker()
@@ -74,7 +90,10 @@ func New(typ string, brokers []string, config *sarama.Config) (Producer, error)
 			config.Producer.Return.Successes = true
 		}
 		p, err := sarama.NewSyncProducer(brokers, config)
-		return &SyncProducerWrapper{syncProducer: p}, err
+		if err != nil {
+			return nil, err
+		}
+		return &SyncProducerWrapper{syncProducer: p, ack: ack, stop: stop}, nil
 	default:
 		return nil, fmt.Errorf("unknown producer type: %s", typ)
 	}
@@ -93,8 +112,11 @@ func (p *AsyncProducerWrapper) Close() error {
 func (p *AsyncProducerWrapper) errorWorker() {
 	for {
 		select {
-		case <-p.asyncProducer.Errors():
+		case err := <-p.asyncProducer.Errors():
 			KafkaProducerError.WithLabelValues(AsyncProducer).Inc()
+			if p.ack != nil && err != nil {
+				p.ack(err.Msg, err.Err)
+			}
 		case <-p.stop:
 			return
 		}
@@ -104,8 +126,11 @@ func (p *AsyncProducerWrapper) errorWorker() {
 func (p *AsyncProducerWrapper) successWorker() {
 	for {
 		select {
-		case <-p.asyncProducer.Successes():
+		case msg := <-p.asyncProducer.Successes():
 			KafkaProducerSuccess.WithLabelValues(AsyncProducer).Inc()
+			if p.ack != nil {
+				p.ack(msg, nil)
+			}
 		case <-p.stop:
 			return
 		}
@@ -119,6 +144,9 @@ func (p *SyncProducerWrapper) Send(msg *sarama.ProducerMessage) error {
 	} else {
 		KafkaProducerError.WithLabelValues(SyncProducer).Inc()
 	}
+	if p.ack != nil {
+		p.ack(msg, err)
+	}
 	return err
 }
 
@@ -31,6 +31,7 @@ type Pushgw struct {
 	WriterOpt           WriterGlobalOpt
 	Writers             []WriterOptions
 	KafkaWriters        []KafkaWriterOptions
+	KafkaReaders        []KafkaReaderOptions
 }
 
 type WriterGlobalOpt struct {
@@ -94,6 +95,23 @@ type KafkaWriterOptions struct {
 	WriteRelabels []*RelabelConfig
 }
 
+// KafkaReaderOptions consumes the samples from kafka as a consumer group, the offsets
+// are committed after the samples are written to the writers, so a sample is written at
+// least once
+type KafkaReaderOptions struct {
+	Brokers         []string
+	Topics          []string
+	GroupId         string
+	Version         string
+	Format          string // prometheus(remote write protobuf) json influx
+	InfluxPrecision string // ns us ms s, precision of the timestamps in the influx line protocol
+	InitialOffset   string // newest oldest, where to start when the group has no committed offset
+	IgnoreIdent     bool
+	IgnoreHost      bool
+
+	SASL *SASLConfig
+}
+
 type RelabelConfig struct {
 	SourceLabels  model.LabelNames `json:"source_labels"`
 	Separator     string           `json:"separator"`
@@ -178,6 +196,24 @@ func (p *Pushgw) PreCheck() {
 		p.IdentDropThreshold = 5000000
 	}
 
+	for i := range p.KafkaReaders {
+		if p.KafkaReaders[i].GroupId == "" {
+			p.KafkaReaders[i].GroupId = "n9e-pushgw"
+		}
+
+		if p.KafkaReaders[i].Format == "" {
+			p.KafkaReaders[i].Format = "prometheus"
+		}
+
+		if p.KafkaReaders[i].InfluxPrecision == "" {
+			p.KafkaReaders[i].InfluxPrecision = "ns"
+		}
+
+		if p.KafkaReaders[i].InitialOffset == "" {
+			p.KafkaReaders[i].InitialOffset = "newest"
+		}
+	}
+
 	for index := range p.Writers {
 		for _, relabel := range p.Writers[index].WriteRelabels {
 			if relabel.Regex == "" {
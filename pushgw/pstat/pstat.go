@@ -95,6 +95,13 @@ var (
 		Help:      "Number of push queue over limit.",
 	})
 
+	CounterKafkaReaderWriteErrorTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: subsystem,
+		Name:      "kafka_reader_write_error_total",
+		Help:      "Number of failed writes of the kafka reader batches, the batches are written again.",
+	}, []string{"topic"})
+
 	RedisOperationLatency = prometheus.NewHistogramVec(
 		prometheus.HistogramOpts{
 			Namespace: namespace,
@@ -120,6 +127,7 @@ func init() {
 		CounterPushQueueErrorTotal,
 		GaugeSampleQueueSize,
 		CounterPushQueueOverLimitTotal,
+		CounterKafkaReaderWriteErrorTotal,
 		RedisOperationLatency,
 	)
 }
@@ -0,0 +1,225 @@
+package router
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+var influxUnescaper = strings.NewReplacer(`\,`, ",", `\ `, " ", `\=`, "=")
+
+// influxPrecision returns the unit of the timestamps in the line protocol
+func influxPrecision(precision string) (time.Duration, error) {
+	switch precision {
+	case "", "ns":
+		return time.Nanosecond, nil
+	case "us":
+		return time.Microsecond, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "s":
+		return time.Second, nil
+	}
+	return 0, fmt.Errorf("unknown influx precision: %s", precision)
+}
+
+// parseInfluxLines parses the influx line protocol. Each numeric field is a series named like
+// the prometheus output of telegraf: <measurement>_<field>, or <measurement> for the field value.
+// String fields are skipped. The samples without a timestamp use now, unit: ms.
+// The broken lines are skipped too, the error reports the first of them and the series of
+// the other lines are still returned.
+func parseInfluxLines(data []byte, precision time.Duration, now int64) ([]prompb.TimeSeries, error) {
+	var (
+		series  []prompb.TimeSeries
+		lineErr error
+		broken  int
+	)
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		lst, err := parseInfluxLine(line, precision, now)
+		if err != nil {
+			if broken == 0 {
+				lineErr = fmt.Errorf("%v, line: %s", err, line)
+			}
+			broken++
+			continue
+		}
+		series = append(series, lst...)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return series, err
+	}
+
+	if broken > 0 {
+		return series, fmt.Errorf("%d broken lines skipped, first: %v", broken, lineErr)
+	}
+
+	return series, nil
+}
+
+func parseInfluxLine(line string, precision time.Duration, now int64) ([]prompb.TimeSeries, error) {
+	i := indexUnescaped(line, ' ', false)
+	if i < 0 {
+		return nil, fmt.Errorf("fields not found")
+	}
+	key, rest := line[:i], strings.TrimLeft(line[i+1:], " ")
+
+	fieldSet, tsStr := rest, ""
+	if i = indexUnescaped(rest, ' ', true); i >= 0 {
+		fieldSet, tsStr = rest[:i], strings.TrimSpace(rest[i+1:])
+	}
+
+	ts := now
+	if tsStr != "" {
+		n, err := strconv.ParseInt(tsStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timestamp: %s", tsStr)
+		}
+		ts = n * int64(precision) / int64(time.Millisecond)
+	}
+
+	parts := splitUnescaped(key, ',', false)
+	measurement := sanitizeInfluxName(influxUnescaper.Replace(parts[0]), true)
+
+	labels := make([]prompb.Label, 0, len(parts))
+	for _, tag := range parts[1:] {
+		k, v, ok := splitInfluxPair(tag)
+		if !ok {
+			return nil, fmt.Errorf("invalid tag: %s", tag)
+		}
+		labels = append(labels, prompb.Label{Name: sanitizeInfluxName(k, false), Value: v})
+	}
+
+	var series []prompb.TimeSeries
+	for _, field := range splitUnescaped(fieldSet, ',', true) {
+		k, v, ok := splitInfluxPair(field)
+		if !ok {
+			return nil, fmt.Errorf("invalid field: %s", field)
+		}
+
+		value, ok, err := parseInfluxValue(v)
+		if err != nil {
+			return nil, err
+		}
+
+		if !ok {
+			continue
+		}
+
+		name := measurement
+		if k != "value" {
+			name = measurement + "_" + sanitizeInfluxName(k, false)
+		}
+
+		lbs := make([]prompb.Label, 0, len(labels)+1)
+		lbs = append(lbs, prompb.Label{Name: model.MetricNameLabel, Value: name})
+		lbs = append(lbs, labels...)
+
+		series = append(series, prompb.TimeSeries{
+			Labels:  lbs,
+			Samples: []prompb.Sample{{Value: value, Timestamp: ts}},
+		})
+	}
+
+	return series, nil
+}
+
+// parseInfluxValue returns false for the string fields
+func parseInfluxValue(v string) (float64, bool, error) {
+	if v == "" {
+		return 0, false, fmt.Errorf("blank field value")
+	}
+
+	if v[0] == '"' {
+		return 0, false, nil
+	}
+
+	switch v {
+	case "t", "T", "true", "True", "TRUE":
+		return 1, true, nil
+	case "f", "F", "false", "False", "FALSE":
+		return 0, true, nil
+	}
+
+	switch v[len(v)-1] {
+	case 'i':
+		n, err := strconv.ParseInt(v[:len(v)-1], 10, 64)
+		return float64(n), err == nil, err
+	case 'u':
+		n, err := strconv.ParseUint(v[:len(v)-1], 10, 64)
+		return float64(n), err == nil, err
+	}
+
+	f, err := strconv.ParseFloat(v, 64)
+	return f, err == nil, err
+}
+
+func splitInfluxPair(s string) (string, string, bool) {
+	i := indexUnescaped(s, '=', false)
+	if i <= 0 {
+		return "", "", false
+	}
+	return influxUnescaper.Replace(s[:i]), influxUnescaper.Replace(s[i+1:]), true
+}
+
+// indexUnescaped returns the index of the first sep which is not escaped by a backslash,
+// and not in double quotes if quotes is true
+func indexUnescaped(s string, sep byte, quotes bool) int {
+	quoted := false
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\':
+			i++
+		case quotes && s[i] == '"':
+			quoted = !quoted
+		case s[i] == sep && !quoted:
+			return i
+		}
+	}
+	return -1
+}
+
+func splitUnescaped(s string, sep byte, quotes bool) []string {
+	var parts []string
+	for {
+		i := indexUnescaped(s, sep, quotes)
+		if i < 0 {
+			return append(parts, s)
+		}
+		parts = append(parts, s[:i])
+		s = s[i+1:]
+	}
+}
+
+// sanitizeInfluxName replaces the chars not allowed in the metric or label names with _
+func sanitizeInfluxName(s string, metric bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		if i == 0 && r >= '0' && r <= '9' {
+			b.WriteByte('_')
+		}
+
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+			(r >= '0' && r <= '9') || (metric && r == ':')
+		if valid {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,76 @@
+package router
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestParseInfluxLines(t *testing.T) {
+	data := []byte(`# comment
+cpu,host=web\ 1,region=us-west usage_idle=98.5,usage_user=1i,ok=true,msg="a b,c=d" 1700000000000000000
+
+mem value=3u
+`)
+
+	series, err := parseInfluxLines(data, time.Nanosecond, 123)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	labels := func(name string, tags ...string) []prompb.Label {
+		lbs := []prompb.Label{{Name: "__name__", Value: name}}
+		for i := 0; i < len(tags); i += 2 {
+			lbs = append(lbs, prompb.Label{Name: tags[i], Value: tags[i+1]})
+		}
+		return lbs
+	}
+
+	want := []prompb.TimeSeries{
+		{Labels: labels("cpu_usage_idle", "host", "web 1", "region", "us-west"), Samples: []prompb.Sample{{Value: 98.5, Timestamp: 1700000000000}}},
+		{Labels: labels("cpu_usage_user", "host", "web 1", "region", "us-west"), Samples: []prompb.Sample{{Value: 1, Timestamp: 1700000000000}}},
+		{Labels: labels("cpu_ok", "host", "web 1", "region", "us-west"), Samples: []prompb.Sample{{Value: 1, Timestamp: 1700000000000}}},
+		{Labels: labels("mem"), Samples: []prompb.Sample{{Value: 3, Timestamp: 123}}},
+	}
+
+	if !reflect.DeepEqual(series, want) {
+		t.Fatalf("got %+v\nwant %+v", series, want)
+	}
+}
+
+func TestParseInfluxLinesError(t *testing.T) {
+	for _, line := range []string{"cpu", "cpu usage", "cpu usage=abc", "cpu,host usage=1", "cpu usage=1 abc"} {
+		if _, err := parseInfluxLines([]byte(line), time.Second, 0); err == nil {
+			t.Errorf("expect error of line: %s", line)
+		}
+	}
+}
+
+func TestParseInfluxLinesSkipBroken(t *testing.T) {
+	data := []byte("cpu usage=1 1\ncpu usage=abc\nmem value=2 2\n")
+
+	series, err := parseInfluxLines(data, time.Millisecond, 0)
+	if err == nil {
+		t.Fatal("expect error of the broken line")
+	}
+
+	if len(series) != 2 || series[0].Samples[0].Value != 1 || series[1].Samples[0].Value != 2 {
+		t.Fatalf("series of the valid lines not returned: %+v", series)
+	}
+}
+
+func TestSanitizeInfluxName(t *testing.T) {
+	cases := map[string]string{
+		"disk.used-percent": "disk_used_percent",
+		"1m":                "_1m",
+		"a:b":               "a:b",
+	}
+
+	for in, want := range cases {
+		if got := sanitizeInfluxName(in, true); got != want {
+			t.Errorf("sanitize %s = %s, want %s", in, got, want)
+		}
+	}
+}
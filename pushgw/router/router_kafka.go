@@ -0,0 +1,280 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/ccfos/nightingale/v6/pushgw/kafka"
+	"github.com/ccfos/nightingale/v6/pushgw/pconf"
+	"github.com/ccfos/nightingale/v6/pushgw/pstat"
+
+	"github.com/IBM/sarama"
+	"github.com/gogo/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/toolkits/pkg/logger"
+)
+
+// kafkaReader consumes the samples of the topics and writes them to the backends. Unlike the
+// http apis the samples skip the queues of the writers, a message is marked only after its
+// samples are written, the messages not marked yet are consumed again after a rebalance or
+// restart. A batch failed to write is written again until it succeeds, the partition stops
+// meanwhile and kafka keeps the samples.
+type kafkaReader struct {
+	rt        *Router
+	opts      pconf.KafkaReaderOptions
+	precision time.Duration
+	batchSize int
+	write     func([]prompb.TimeSeries) error
+}
+
+const (
+	kafkaReaderRetryMin = time.Second
+	kafkaReaderRetryMax = 30 * time.Second
+)
+
+// StartKafkaReaders starts the consumer groups of Pushgw.KafkaReaders
+func (rt *Router) StartKafkaReaders() {
+	for i := range rt.Pushgw.KafkaReaders {
+		if err := rt.startKafkaReader(rt.Pushgw.KafkaReaders[i]); err != nil {
+			logger.Errorf("start kafka reader brokers:%v topics:%v got error: %v", rt.Pushgw.KafkaReaders[i].Brokers, rt.Pushgw.KafkaReaders[i].Topics, err)
+		}
+	}
+}
+
+func (rt *Router) startKafkaReader(opts pconf.KafkaReaderOptions) error {
+	switch opts.Format {
+	case "prometheus", "json", "influx":
+	default:
+		return fmt.Errorf("unknown format: %s", opts.Format)
+	}
+
+	precision, err := influxPrecision(opts.InfluxPrecision)
+	if err != nil {
+		return err
+	}
+
+	cfg := kafka.NewConfig(opts.Version, 0, opts.SASL)
+	cfg.Consumer.Return.Errors = true
+	if opts.InitialOffset == "oldest" {
+		cfg.Consumer.Offsets.Initial = sarama.OffsetOldest
+	}
+
+	reader := &kafkaReader{
+		rt:        rt,
+		opts:      opts,
+		precision: precision,
+		batchSize: rt.Pushgw.WriterOpt.QueuePopSize,
+		write:     rt.Writers.WriteBatch,
+	}
+
+	go reader.run(cfg)
+
+	return nil
+}
+
+// run connects to the brokers until it succeeds, then consumes until the process exits
+func (r *kafkaReader) run(cfg *sarama.Config) {
+	ctx := r.rt.Ctx.Ctx
+	opts := r.opts
+
+	var group sarama.ConsumerGroup
+	for retry := kafkaReaderRetryMin; ; retry = nextRetry(retry) {
+		var err error
+		group, err = sarama.NewConsumerGroup(opts.Brokers, opts.GroupId, cfg)
+		if err == nil {
+			break
+		}
+
+		logger.Errorf("kafka reader group:%s brokers:%v new consumer group got error: %v, retry in %v", opts.GroupId, opts.Brokers, err, retry)
+		if !sleepCtx(ctx, retry) {
+			return
+		}
+	}
+
+	go func() {
+		for err := range group.Errors() {
+			logger.Warningf("kafka reader group:%s topics:%v got error: %v", opts.GroupId, opts.Topics, err)
+		}
+	}()
+
+	for {
+		// Consume returns when the session ends, e.g. a rebalance
+		if err := group.Consume(ctx, opts.Topics, r); err != nil {
+			logger.Warningf("kafka reader group:%s topics:%v consume got error: %v", opts.GroupId, opts.Topics, err)
+			time.Sleep(time.Second)
+		}
+
+		if ctx.Err() != nil {
+			group.Close()
+			return
+		}
+	}
+}
+
+func nextRetry(retry time.Duration) time.Duration {
+	if retry*2 > kafkaReaderRetryMax {
+		return kafkaReaderRetryMax
+	}
+	return retry * 2
+}
+
+// sleepCtx returns false if the ctx is done before the duration
+func sleepCtx(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+func (r *kafkaReader) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (r *kafkaReader) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+func (r *kafkaReader) ConsumeClaim(sess sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	var (
+		batch []prompb.TimeSeries
+		last  *sarama.ConsumerMessage
+	)
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				r.commit(sess, batch, last)
+				return nil
+			}
+
+			batch = append(batch, r.handle(msg)...)
+			last = msg
+			if len(batch) < r.batchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-sess.Context().Done():
+			// the batch is not marked and is consumed again by the next session
+			return nil
+		}
+
+		if !r.commit(sess, batch, last) {
+			return nil
+		}
+		batch, last = nil, nil
+	}
+}
+
+// commit writes the batch and marks the last message, the messages of the claim are of one
+// partition, so marking the last one marks the batch. The batch is written again until it
+// succeeds, it returns false if the session ends before, the batch is not marked then.
+func (r *kafkaReader) commit(sess sarama.ConsumerGroupSession, batch []prompb.TimeSeries, last *sarama.ConsumerMessage) bool {
+	if last == nil {
+		return true
+	}
+
+	for retry := kafkaReaderRetryMin; ; retry = nextRetry(retry) {
+		err := r.write(batch)
+		if err == nil {
+			sess.MarkMessage(last, "")
+			return true
+		}
+
+		pstat.CounterKafkaReaderWriteErrorTotal.WithLabelValues(last.Topic).Inc()
+		logger.Warningf("kafka reader topic:%s partition:%d offset:%d write %d series got error: %v, retry in %v", last.Topic, last.Partition, last.Offset, len(batch), err, retry)
+		if !sleepCtx(sess.Context(), retry) {
+			return false
+		}
+	}
+}
+
+func (r *kafkaReader) decode(value []byte) ([]prompb.TimeSeries, error) {
+	switch r.opts.Format {
+	case "json":
+		// the format of the kafka writers, an array or a single series
+		var series []prompb.TimeSeries
+		if len(value) > 0 && value[0] == '{' {
+			var one prompb.TimeSeries
+			err := json.Unmarshal(value, &one)
+			return append(series, one), err
+		}
+		err := json.Unmarshal(value, &series)
+		return series, err
+	case "influx":
+		return parseInfluxLines(value, r.precision, time.Now().UnixMilli())
+	default:
+		// remote write protobuf, snappy compressed or not
+		if buf, err := snappy.Decode(nil, value); err == nil {
+			value = buf
+		}
+
+		var req prompb.WriteRequest
+		if err := proto.Unmarshal(value, &req); err != nil {
+			return nil, err
+		}
+		return req.Timeseries, nil
+	}
+}
+
+// handle decodes the message and returns the series to write
+func (r *kafkaReader) handle(msg *sarama.ConsumerMessage) []prompb.TimeSeries {
+	series, err := r.decode(msg.Value)
+	if err != nil {
+		// the broken messages are skipped, or the partition gets stuck, the valid lines of
+		// the influx messages are still written
+		logger.Warningf("kafka reader topic:%s partition:%d offset:%d decode %s got error: %v", msg.Topic, msg.Partition, msg.Offset, r.opts.Format, err)
+	}
+
+	count := len(series)
+	if count == 0 {
+		return nil
+	}
+
+	rt := r.rt
+	source := fmt.Sprintf("kafka:%s/%d", msg.Topic, msg.Partition)
+	ids := make(map[string]struct{})
+	forward := make([]prompb.TimeSeries, 0, count)
+
+	for i := 0; i < count; i++ {
+		if duplicateLabelKey(&series[i]) {
+			continue
+		}
+
+		ident, insertTarget := extractIdentFromTimeSeries(&series[i], r.opts.IgnoreIdent, r.opts.IgnoreHost, rt.Pushgw.IdentMetrics)
+		if len(ident) > 0 {
+			// enrich host labels
+			target, has := rt.TargetCache.Get(ident)
+			if has {
+				rt.AppendLabels(&series[i], target, rt.BusiGroupCache)
+			}
+
+			pstat.CounterSampleReceivedByIdent.WithLabelValues(ident).Inc()
+		}
+
+		if insertTarget {
+			ids[ident] = struct{}{}
+		}
+
+		// the same as ForwardToQueue, without the queues
+		v := rt.BeforePush(source, &series[i])
+		if v == nil {
+			continue
+		}
+
+		if rt.DropSample(v) {
+			pstat.CounterDropSampleTotal.Inc()
+			continue
+		}
+
+		forward = append(forward, *v)
+	}
+
+	pstat.CounterSampleTotal.WithLabelValues("kafka").Add(float64(count))
+	rt.IdentSet.MSet(ids)
+
+	return forward
+}
@@ -0,0 +1,54 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+type fakeSession struct {
+	sarama.ConsumerGroupSession
+	ctx    context.Context
+	marked []int64
+}
+
+func (s *fakeSession) Context() context.Context { return s.ctx }
+
+func (s *fakeSession) MarkMessage(msg *sarama.ConsumerMessage, metadata string) {
+	s.marked = append(s.marked, msg.Offset)
+}
+
+func TestKafkaReaderCommit(t *testing.T) {
+	batch := []prompb.TimeSeries{{Labels: []prompb.Label{{Name: "__name__", Value: "up"}}}}
+	last := &sarama.ConsumerMessage{Topic: "n9e-metrics", Offset: 7}
+
+	writes := 0
+	r := &kafkaReader{write: func([]prompb.TimeSeries) error {
+		writes++
+		return errors.New("backend down")
+	}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	defer cancel()
+	sess := &fakeSession{ctx: ctx}
+
+	if r.commit(sess, batch, last) {
+		t.Fatal("commit succeeded with a failing backend")
+	}
+	if len(sess.marked) != 0 {
+		t.Fatalf("offset marked with a failing backend: %v", sess.marked)
+	}
+	if writes < 2 {
+		t.Fatalf("failed batch not written again, writes: %d", writes)
+	}
+
+	r.write = func([]prompb.TimeSeries) error { return nil }
+	sess.ctx = context.Background()
+	if !r.commit(sess, batch, last) || len(sess.marked) != 1 || sess.marked[0] != 7 {
+		t.Fatalf("offset not marked after the batch is written: %v", sess.marked)
+	}
+}
@@ -19,14 +19,14 @@ type KafkaWriterType struct {
 	RetryInterval    int64 // 单位秒
 }
 
-func (w KafkaWriterType) Write(key string, items []prompb.TimeSeries, headers ...map[string]string) {
+func (w KafkaWriterType) Write(key string, items []prompb.TimeSeries, headers ...map[string]string) error {
 	if len(items) == 0 {
-		return
+		return nil
 	}
 
 	items = Relabel(items, w.Opts.WriteRelabels)
 	if len(items) == 0 {
-		return
+		return nil
 	}
 
 	start := time.Now()
@@ -37,14 +37,14 @@ func (w KafkaWriterType) Write(key string, items []prompb.TimeSeries, headers ..
 	data, err := beforeWrite(key, items, w.ForceUseServerTS, "json")
 	if err != nil {
 		logger.Warningf("marshal prom data to proto got error: %v, data: %+v", err, items)
-		return
+		return nil
 	}
 
 	for i := 0; i < w.RetryCount; i++ {
-		err := w.Client.Send(&sarama.ProducerMessage{Topic: w.Opts.Topic,
+		err = w.Client.Send(&sarama.ProducerMessage{Topic: w.Opts.Topic,
 			Key: sarama.StringEncoder(key), Value: sarama.ByteEncoder(data)})
 		if err == nil {
-			break
+			return nil
 		}
 
 		pstat.CounterWirteErrorTotal.WithLabelValues(key).Add(float64(len(items)))
@@ -57,4 +57,6 @@ func (w KafkaWriterType) Write(key string, items []prompb.TimeSeries, headers ..
 
 		time.Sleep(time.Duration(w.RetryInterval) * time.Second)
 	}
+
+	return err
 }
@@ -10,7 +10,6 @@ import (
 	"sync/atomic"
 	"time"
 
-	"github.com/IBM/sarama"
 	"github.com/ccfos/nightingale/v6/pkg/fasttime"
 	"github.com/ccfos/nightingale/v6/pushgw/kafka"
 	"github.com/ccfos/nightingale/v6/pushgw/pconf"
@@ -56,14 +55,14 @@ func beforeWrite(key string, items []prompb.TimeSeries, forceUseServerTS bool, e
 	return json.MarshalWithCustomFloat(items)
 }
 
-func (w WriterType) Write(key string, items []prompb.TimeSeries, headers ...map[string]string) {
+func (w WriterType) Write(key string, items []prompb.TimeSeries, headers ...map[string]string) error {
 	if len(items) == 0 {
-		return
+		return nil
 	}
 
 	items = Relabel(items, w.Opts.WriteRelabels)
 	if len(items) == 0 {
-		return
+		return nil
 	}
 
 	start := time.Now()
@@ -74,13 +73,13 @@ func (w WriterType) Write(key string, items []prompb.TimeSeries, headers ...map[
 	data, err := beforeWrite(key, items, w.ForceUseServerTS, "proto")
 	if err != nil {
 		logger.Warningf("marshal prom data to proto got error: %v, data: %+v", err, items)
-		return
+		return err
 	}
 
 	for i := 0; i < w.RetryCount; i++ {
-		err := w.Post(snappy.Encode(nil, data), headers...)
+		err = w.Post(snappy.Encode(nil, data), headers...)
 		if err == nil {
-			break
+			return nil
 		}
 
 		pstat.CounterWirteErrorTotal.WithLabelValues(key).Add(float64(len(items)))
@@ -92,6 +91,8 @@ func (w WriterType) Write(key string, items []prompb.TimeSeries, headers ...map[
 
 		time.Sleep(time.Duration(w.RetryInterval) * time.Second)
 	}
+
+	return err
 }
 
 func (w WriterType) Post(req []byte, headers ...map[string]string) error {
@@ -262,7 +263,7 @@ func (ws *WritersType) PushSample(queueid string, v interface{}) error {
 }
 
 type Writer interface {
-	Write(string, []prompb.TimeSeries, ...map[string]string)
+	Write(string, []prompb.TimeSeries, ...map[string]string) error
 }
 
 func (ws *WritersType) StartConsumer(identQueue *IdentQueue) {
@@ -284,6 +285,24 @@ func (ws *WritersType) StartConsumer(identQueue *IdentQueue) {
 	}
 }
 
+// WriteBatch writes the series to the backends directly in batches of QueuePopSize, unlike
+// PushSample it returns after the backends are written. It stops at the first backend that
+// still fails after the retries, the caller writes the whole series again, so the backends
+// written before may get some samples twice.
+func (ws *WritersType) WriteBatch(series []prompb.TimeSeries) error {
+	size := ws.pushgw.WriterOpt.QueuePopSize
+	for len(series) > 0 {
+		n := min(size, len(series))
+		for key := range ws.backends {
+			if err := ws.backends[key].Write(key, series[:n]); err != nil {
+				return fmt.Errorf("write to %s got error: %v", key, err)
+			}
+		}
+		series = series[n:]
+	}
+	return nil
+}
+
 func (ws *WritersType) Init() error {
 	ws.AllQueueLen.Store(int64(0))
 
@@ -321,35 +340,11 @@ func (ws *WritersType) initWriters() error {
 	return nil
 }
 
-func initKakfaSASL(cfg *sarama.Config, opt pconf.KafkaWriterOptions) {
-	if opt.SASL != nil && opt.SASL.Enable {
-		cfg.Net.SASL.Enable = true
-		cfg.Net.SASL.User = opt.SASL.User
-		cfg.Net.SASL.Password = opt.SASL.Password
-		cfg.Net.SASL.Mechanism = sarama.SASLMechanism(opt.SASL.Mechanism)
-		cfg.Net.SASL.Version = opt.SASL.Version
-		cfg.Net.SASL.Handshake = opt.SASL.Handshake
-		cfg.Net.SASL.AuthIdentity = opt.SASL.AuthIdentity
-	}
-}
-
 func (ws *WritersType) initKafkaWriters() error {
 	opts := ws.pushgw.KafkaWriters
 
 	for i := 0; i < len(opts); i++ {
-		cfg := sarama.NewConfig()
-		initKakfaSASL(cfg, opts[i])
-		if opts[i].Timeout != 0 {
-			cfg.Producer.Timeout = time.Duration(opts[i].Timeout) * time.Second
-		}
-		if opts[i].Version != "" {
-			kafkaVersion, err := sarama.ParseKafkaVersion(opts[i].Version)
-			if err != nil {
-				logger.Warningf("parse kafka version got error: %v", err)
-			} else {
-				cfg.Version = kafkaVersion
-			}
-		}
+		cfg := kafka.NewConfig(opts[i].Version, opts[i].Timeout, opts[i].SASL)
 
 		if opts[i].Typ == "" {
 			opts[i].Typ = kafka.AsyncProducer